@@ -0,0 +1,136 @@
+package api
+
+import (
+	"net/http"
+
+	"lab04-backend/models"
+)
+
+// ListCategories handles GET /api/categories.
+// With counts=true every category includes its number of posts.
+func (h *Handler) ListCategories(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("counts") == "true" {
+		counts, err := h.categories.GetPostCountsContext(r.Context())
+		if err != nil {
+			h.writeStoreError(w, err)
+			return
+		}
+		h.writeData(w, http.StatusOK, counts)
+		return
+	}
+
+	categories, err := h.categories.GetAllContext(r.Context())
+	if err != nil {
+		h.writeStoreError(w, err)
+		return
+	}
+	h.writeData(w, http.StatusOK, categories)
+}
+
+// CreateCategory handles POST /api/categories
+func (h *Handler) CreateCategory(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateCategoryRequest
+	if err := h.parseJSON(w, r, &req); err != nil {
+		h.writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if err := req.Validate(); err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	category := req.ToCategory()
+	if err := h.categories.CreateContext(r.Context(), category); err != nil {
+		h.writeStoreError(w, err)
+		return
+	}
+	h.writeData(w, http.StatusCreated, category)
+}
+
+// GetCategory handles GET /api/categories/{id}
+func (h *Handler) GetCategory(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	category, err := h.categories.GetByIDContext(r.Context(), uint(id))
+	if err != nil {
+		h.writeStoreError(w, err)
+		return
+	}
+	h.writeData(w, http.StatusOK, category)
+}
+
+// UpdateCategory handles PUT and PATCH /api/categories/{id}.
+// Only the fields present in the body are changed.
+func (h *Handler) UpdateCategory(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var req models.UpdateCategoryRequest
+	if err := h.parseJSON(w, r, &req); err != nil {
+		h.writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if err := req.Validate(); err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	category, err := h.categories.GetByIDContext(r.Context(), uint(id))
+	if err != nil {
+		h.writeStoreError(w, err)
+		return
+	}
+	req.ApplyTo(category)
+	if err := h.categories.UpdateContext(r.Context(), category); err != nil {
+		h.writeStoreError(w, err)
+		return
+	}
+	h.writeData(w, http.StatusOK, category)
+}
+
+// DeleteCategory handles DELETE /api/categories/{id} (soft delete)
+func (h *Handler) DeleteCategory(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.categories.DeleteContext(r.Context(), uint(id)); err != nil {
+		h.writeStoreError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListCategoryPosts handles GET /api/categories/{id}/posts?limit=&cursor=
+func (h *Handler) ListCategoryPosts(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	page, err := pageRequest(r)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if _, err := h.categories.GetByIDContext(r.Context(), uint(id)); err != nil {
+		h.writeStoreError(w, err)
+		return
+	}
+	posts, err := h.posts.GetByCategoryIDPage(r.Context(), uint(id), page)
+	if err != nil {
+		h.writeStoreError(w, err)
+		return
+	}
+	h.writePostPage(w, r, posts)
+}
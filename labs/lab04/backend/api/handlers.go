@@ -0,0 +1,190 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"lab04-backend/models"
+	"lab04-backend/repository"
+
+	"github.com/gorilla/mux"
+	"github.com/mattn/go-sqlite3"
+	"gorm.io/gorm"
+)
+
+// maxBodyBytes bounds the size of JSON request bodies
+const maxBodyBytes = 1 << 20
+
+// Handler exposes the lab04 repositories over a REST API
+type Handler struct {
+	users      *repository.UserRepository
+	posts      *repository.PostRepository
+	categories *repository.CategoryRepository
+	search     *repository.SearchService
+}
+
+// APIResponse is the envelope of every JSON response
+type APIResponse struct {
+	Success bool        `json:"success"`
+	Data    interface{} `json:"data,omitempty"`
+	Error   string      `json:"error,omitempty"`
+}
+
+// NewHandler creates a handler over the given repositories
+func NewHandler(
+	users *repository.UserRepository,
+	posts *repository.PostRepository,
+	categories *repository.CategoryRepository,
+	search *repository.SearchService,
+) *Handler {
+	return &Handler{users: users, posts: posts, categories: categories, search: search}
+}
+
+// SetupRoutes configures all API routes under /api
+func (h *Handler) SetupRoutes() *mux.Router {
+	router := mux.NewRouter()
+	api := router.PathPrefix("/api").Subrouter()
+
+	api.HandleFunc("/health", h.HealthCheck).Methods(http.MethodGet)
+
+	api.HandleFunc("/users", h.ListUsers).Methods(http.MethodGet)
+	api.HandleFunc("/users", h.CreateUser).Methods(http.MethodPost)
+	api.HandleFunc("/users/{id:[0-9]+}", h.GetUser).Methods(http.MethodGet)
+	api.HandleFunc("/users/{id:[0-9]+}", h.UpdateUser).Methods(http.MethodPut, http.MethodPatch)
+	api.HandleFunc("/users/{id:[0-9]+}", h.DeleteUser).Methods(http.MethodDelete)
+	api.HandleFunc("/users/{id:[0-9]+}/posts", h.ListUserPosts).Methods(http.MethodGet)
+
+	api.HandleFunc("/posts", h.ListPosts).Methods(http.MethodGet)
+	api.HandleFunc("/posts", h.CreatePost).Methods(http.MethodPost)
+	api.HandleFunc("/posts/{id:[0-9]+}", h.GetPost).Methods(http.MethodGet)
+	api.HandleFunc("/posts/{id:[0-9]+}", h.UpdatePost).Methods(http.MethodPut, http.MethodPatch)
+	api.HandleFunc("/posts/{id:[0-9]+}", h.DeletePost).Methods(http.MethodDelete)
+	api.HandleFunc("/posts/{id:[0-9]+}/categories", h.GetPostCategories).Methods(http.MethodGet)
+	api.HandleFunc("/posts/{id:[0-9]+}/categories", h.AttachPostCategories).Methods(http.MethodPost)
+	api.HandleFunc("/posts/{id:[0-9]+}/categories", h.ReplacePostCategories).Methods(http.MethodPut)
+	api.HandleFunc("/posts/{id:[0-9]+}/categories/{categoryID:[0-9]+}", h.DetachPostCategory).Methods(http.MethodDelete)
+	api.HandleFunc("/posts/{id:[0-9]+}/revisions", h.ListRevisions).Methods(http.MethodGet)
+	api.HandleFunc("/posts/{id:[0-9]+}/revisions/{revision:[0-9]+}", h.GetRevision).Methods(http.MethodGet)
+	api.HandleFunc("/posts/{id:[0-9]+}/revisions/{revision:[0-9]+}/restore", h.RestoreRevision).Methods(http.MethodPost)
+	api.HandleFunc("/posts/{id:[0-9]+}/diff", h.DiffRevisions).Methods(http.MethodGet)
+	api.HandleFunc("/posts/{id:[0-9]+}/status", h.TransitionPost).Methods(http.MethodPost)
+	api.HandleFunc("/posts/{id:[0-9]+}/schedule", h.SchedulePost).Methods(http.MethodPut)
+
+	api.HandleFunc("/categories", h.ListCategories).Methods(http.MethodGet)
+	api.HandleFunc("/categories", h.CreateCategory).Methods(http.MethodPost)
+	api.HandleFunc("/categories/{id:[0-9]+}", h.GetCategory).Methods(http.MethodGet)
+	api.HandleFunc("/categories/{id:[0-9]+}", h.UpdateCategory).Methods(http.MethodPut, http.MethodPatch)
+	api.HandleFunc("/categories/{id:[0-9]+}", h.DeleteCategory).Methods(http.MethodDelete)
+	api.HandleFunc("/categories/{id:[0-9]+}/posts", h.ListCategoryPosts).Methods(http.MethodGet)
+
+	api.HandleFunc("/search/posts", h.SearchPosts).Methods(http.MethodGet)
+	api.HandleFunc("/search/users", h.SearchUsers).Methods(http.MethodGet)
+	api.HandleFunc("/stats", h.GetStats).Methods(http.MethodGet)
+	api.HandleFunc("/stats/top-users", h.GetTopUsers).Methods(http.MethodGet)
+
+	return router
+}
+
+// HealthCheck handles GET /api/health
+func (h *Handler) HealthCheck(w http.ResponseWriter, r *http.Request) {
+	h.writeJSON(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data: map[string]interface{}{
+			"status":    "ok",
+			"timestamp": time.Now(),
+		},
+	})
+}
+
+// writeJSON writes data as a JSON response with the given status
+func (h *Handler) writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		log.Printf("failed to encode response: %v", err)
+	}
+}
+
+// writeData writes a successful response wrapping data
+func (h *Handler) writeData(w http.ResponseWriter, status int, data interface{}) {
+	h.writeJSON(w, status, APIResponse{Success: true, Data: data})
+}
+
+// writeError writes a failed response with the given message
+func (h *Handler) writeError(w http.ResponseWriter, status int, message string) {
+	h.writeJSON(w, status, APIResponse{Success: false, Error: message})
+}
+
+// writeStoreError maps a repository error to a status code and writes it.
+// Unknown errors are logged and reported without details.
+func (h *Handler) writeStoreError(w http.ResponseWriter, err error) {
+	status, message := storeErrorStatus(err)
+	if status == http.StatusInternalServerError {
+		log.Printf("request failed: %v", err)
+	}
+	h.writeError(w, status, message)
+}
+
+// storeErrorStatus classifies repository and SQLite errors
+func storeErrorStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows), errors.Is(err, gorm.ErrRecordNotFound):
+		return http.StatusNotFound, "resource not found"
+	case errors.Is(err, repository.ErrInvalidCursor), errors.Is(err, repository.ErrUnsupportedOrder):
+		return http.StatusBadRequest, err.Error()
+	case errors.Is(err, models.ErrInvalidTransition):
+		return http.StatusConflict, err.Error()
+	case errors.Is(err, models.ErrDiffTooLarge):
+		return http.StatusUnprocessableEntity, err.Error()
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout, "database query timed out"
+	}
+
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		switch sqliteErr.ExtendedCode {
+		case sqlite3.ErrConstraintUnique, sqlite3.ErrConstraintPrimaryKey:
+			return http.StatusConflict, "resource already exists"
+		case sqlite3.ErrConstraintForeignKey:
+			return http.StatusUnprocessableEntity, "referenced resource does not exist"
+		case sqlite3.ErrConstraintNotNull, sqlite3.ErrConstraintCheck:
+			return http.StatusUnprocessableEntity, "invalid field value"
+		}
+	}
+
+	return http.StatusInternalServerError, "internal server error"
+}
+
+// parseJSON decodes the request body into dst
+func (h *Handler) parseJSON(w http.ResponseWriter, r *http.Request, dst interface{}) error {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+	return json.NewDecoder(r.Body).Decode(dst)
+}
+
+// pathID returns the numeric path variable with the given name
+func pathID(r *http.Request, name string) (int, error) {
+	id, err := strconv.Atoi(mux.Vars(r)[name])
+	if err != nil || id <= 0 {
+		return 0, errors.New("invalid " + name)
+	}
+	return id, nil
+}
+
+// pageRequest reads the limit and cursor query parameters
+func pageRequest(r *http.Request) (repository.PageRequest, error) {
+	page := repository.PageRequest{Cursor: r.URL.Query().Get("cursor")}
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 0 {
+			return page, errors.New("limit must be a non-negative integer")
+		}
+		page.Limit = limit
+	}
+	return page, nil
+}
@@ -0,0 +1,268 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"lab04-backend/database"
+	"lab04-backend/repository"
+)
+
+func setupTestRouter(t *testing.T) (http.Handler, func()) {
+	testDB := "./test_api.db"
+	os.Remove(testDB)
+
+	db, err := database.InitDBWithConfig(&database.Config{
+		DatabasePath: testDB,
+		MaxOpenConns: 5,
+		MaxIdleConns: 1,
+	})
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	cleanup := func() {
+		database.CloseDB(db)
+		os.Remove(testDB)
+	}
+	if err := database.RunMigrations(db); err != nil {
+		cleanup()
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+	gormDB, err := database.InitGORM(db)
+	if err != nil {
+		cleanup()
+		t.Fatalf("Failed to initialize gorm: %v", err)
+	}
+
+	handler := NewHandler(
+		repository.NewUserRepository(db),
+		repository.NewPostRepository(db),
+		repository.NewCategoryRepository(gormDB),
+		repository.NewSearchService(db),
+	)
+	return handler.SetupRoutes(), cleanup
+}
+
+// doRequest sends a JSON request and decodes the response envelope,
+// unmarshalling Data into data when it is non-nil
+func doRequest(t *testing.T, router http.Handler, method, path string, body interface{}, data interface{}) (int, APIResponse) {
+	t.Helper()
+
+	var reader *bytes.Reader
+	if body != nil {
+		raw, _ := json.Marshal(body)
+		reader = bytes.NewReader(raw)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	var response struct {
+		APIResponse
+		Data json.RawMessage `json:"data"`
+	}
+	if rr.Code != http.StatusNoContent {
+		if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+			t.Fatalf("%s %s: could not decode response: %v", method, path, err)
+		}
+		if data != nil && len(response.Data) > 0 {
+			if err := json.Unmarshal(response.Data, data); err != nil {
+				t.Fatalf("%s %s: could not decode data: %v", method, path, err)
+			}
+		}
+	}
+	return rr.Code, response.APIResponse
+}
+
+func TestUserEndpoints(t *testing.T) {
+	router, cleanup := setupTestRouter(t)
+	defer cleanup()
+
+	var user struct {
+		ID    int    `json:"id"`
+		Name  string `json:"name"`
+		Email string `json:"email"`
+	}
+	status, _ := doRequest(t, router, http.MethodPost, "/api/users",
+		map[string]string{"name": "Ada Lovelace", "email": "ada@example.com"}, &user)
+	if status != http.StatusCreated || user.ID == 0 {
+		t.Fatalf("POST /api/users = %d %+v, want 201", status, user)
+	}
+
+	status, resp := doRequest(t, router, http.MethodPost, "/api/users",
+		map[string]string{"name": "Ada Again", "email": "ada@example.com"}, nil)
+	if status != http.StatusConflict || resp.Success {
+		t.Errorf("duplicate email = %d, want 409", status)
+	}
+
+	status, _ = doRequest(t, router, http.MethodPost, "/api/users",
+		map[string]string{"name": "A", "email": "not-an-email"}, nil)
+	if status != http.StatusBadRequest {
+		t.Errorf("invalid user = %d, want 400", status)
+	}
+
+	// Only the name changes; the email is kept
+	status, _ = doRequest(t, router, http.MethodPatch, "/api/users/1",
+		map[string]string{"name": "Countess Ada"}, &user)
+	if status != http.StatusOK || user.Name != "Countess Ada" || user.Email != "ada@example.com" {
+		t.Errorf("PATCH /api/users/1 = %d %+v", status, user)
+	}
+
+	if status, _ := doRequest(t, router, http.MethodDelete, "/api/users/1", nil, nil); status != http.StatusNoContent {
+		t.Errorf("DELETE /api/users/1 = %d, want 204", status)
+	}
+	if status, _ := doRequest(t, router, http.MethodGet, "/api/users/1", nil, nil); status != http.StatusNotFound {
+		t.Errorf("GET deleted user = %d, want 404", status)
+	}
+}
+
+func TestPostEndpoints(t *testing.T) {
+	router, cleanup := setupTestRouter(t)
+	defer cleanup()
+
+	doRequest(t, router, http.MethodPost, "/api/users",
+		map[string]string{"name": "Writer", "email": "writer@example.com"}, nil)
+
+	status, _ := doRequest(t, router, http.MethodPost, "/api/posts",
+		map[string]interface{}{"user_id": 42, "title": "Orphan post"}, nil)
+	if status != http.StatusUnprocessableEntity {
+		t.Errorf("post for unknown user = %d, want 422", status)
+	}
+
+	var post struct {
+		ID         int    `json:"id"`
+		Title      string `json:"title"`
+		Content    string `json:"content"`
+		Published  bool   `json:"published"`
+		Categories []struct {
+			Name string `json:"name"`
+		} `json:"categories"`
+	}
+	status, _ = doRequest(t, router, http.MethodPost, "/api/posts",
+		map[string]interface{}{"user_id": 1, "title": "Hello API", "content": "Body text"}, &post)
+	if status != http.StatusCreated {
+		t.Fatalf("POST /api/posts = %d, want 201", status)
+	}
+
+	status, _ = doRequest(t, router, http.MethodPost, "/api/posts",
+		map[string]interface{}{"user_id": 1, "title": "Hello API", "content": "Body text", "published": true}, nil)
+	if status != http.StatusConflict {
+		t.Errorf("POST published post = %d, want 409", status)
+	}
+
+	// The published flag follows the workflow: a draft must go through review
+	published := true
+	status, _ = doRequest(t, router, http.MethodPatch, "/api/posts/1",
+		map[string]interface{}{"published": published}, nil)
+	if status != http.StatusConflict {
+		t.Errorf("PATCH published draft = %d, want 409", status)
+	}
+	doRequest(t, router, http.MethodPost, "/api/posts/1/status", map[string]string{"status": "review"}, nil)
+
+	// editor_id in the body is ignored; the revision belongs to the owner
+	status, _ = doRequest(t, router, http.MethodPatch, "/api/posts/1",
+		map[string]interface{}{"published": published, "title": "Hello again API", "editor_id": 99}, &post)
+	if status != http.StatusOK || !post.Published || post.Content != "Body text" {
+		t.Errorf("PATCH /api/posts/1 = %d %+v", status, post)
+	}
+
+	doRequest(t, router, http.MethodPost, "/api/categories", map[string]string{"name": "Go"}, nil)
+	status, _ = doRequest(t, router, http.MethodPut, "/api/posts/1/categories",
+		map[string]interface{}{"category_ids": []int{1}}, nil)
+	if status != http.StatusOK {
+		t.Errorf("PUT /api/posts/1/categories = %d, want 200", status)
+	}
+	status, _ = doRequest(t, router, http.MethodPost, "/api/posts/1/categories",
+		map[string]interface{}{"category_ids": []int{99}}, nil)
+	if status != http.StatusUnprocessableEntity {
+		t.Errorf("attach unknown category = %d, want 422", status)
+	}
+
+	status, _ = doRequest(t, router, http.MethodGet, "/api/posts/1", nil, &post)
+	if status != http.StatusOK || len(post.Categories) != 1 || post.Categories[0].Name != "Go" {
+		t.Errorf("GET /api/posts/1 = %d %+v, want the Go category", status, post)
+	}
+
+	var page struct {
+		Items   []json.RawMessage `json:"items"`
+		HasMore bool              `json:"has_more"`
+	}
+	status, _ = doRequest(t, router, http.MethodGet, "/api/categories/1/posts", nil, &page)
+	if status != http.StatusOK || len(page.Items) != 1 {
+		t.Errorf("GET /api/categories/1/posts = %d with %d items, want 1", status, len(page.Items))
+	}
+
+	if status, _ := doRequest(t, router, http.MethodGet, "/api/posts?cursor=bogus", nil, nil); status != http.StatusBadRequest {
+		t.Errorf("bad cursor = %d, want 400", status)
+	}
+
+	status, _ = doRequest(t, router, http.MethodPost, "/api/posts/1/status",
+		map[string]string{"status": "review"}, nil)
+	if status != http.StatusConflict {
+		t.Errorf("published -> review = %d, want 409", status)
+	}
+	// A claimed author in the body is ignored
+	status, _ = doRequest(t, router, http.MethodPost, "/api/posts/1/revisions/1/restore",
+		map[string]int{"author_id": 2}, nil)
+	if status != http.StatusOK {
+		t.Errorf("POST /api/posts/1/revisions/1/restore = %d, want 200", status)
+	}
+	var revisions []struct {
+		AuthorID *int `json:"author_id"`
+	}
+	status, _ = doRequest(t, router, http.MethodGet, "/api/posts/1/revisions", nil, &revisions)
+	if status != http.StatusOK || len(revisions) != 3 {
+		t.Errorf("GET /api/posts/1/revisions = %d with %d revisions, want 3", status, len(revisions))
+	}
+	for _, revision := range revisions {
+		if revision.AuthorID == nil || *revision.AuthorID != 1 {
+			t.Errorf("revision author = %v, want the owner 1", revision.AuthorID)
+		}
+	}
+
+	var matches []json.RawMessage
+	status, _ = doRequest(t, router, http.MethodGet, "/api/search/posts?q=hello&category_id=1", nil, &matches)
+	if status != http.StatusOK || len(matches) != 1 {
+		t.Errorf("GET /api/search/posts = %d with %d matches, want 1", status, len(matches))
+	}
+}
+
+func TestCategoryEndpoints(t *testing.T) {
+	router, cleanup := setupTestRouter(t)
+	defer cleanup()
+
+	var category struct {
+		ID     uint   `json:"id"`
+		Name   string `json:"name"`
+		Color  string `json:"color"`
+		Active bool   `json:"active"`
+	}
+	status, _ := doRequest(t, router, http.MethodPost, "/api/categories",
+		map[string]string{"name": "Databases"}, &category)
+	if status != http.StatusCreated || category.Color == "" {
+		t.Fatalf("POST /api/categories = %d %+v, want 201 with a default color", status, category)
+	}
+
+	if status, _ := doRequest(t, router, http.MethodPost, "/api/categories",
+		map[string]string{"name": "Databases"}, nil); status != http.StatusConflict {
+		t.Errorf("duplicate category = %d, want 409", status)
+	}
+
+	status, _ = doRequest(t, router, http.MethodPatch, "/api/categories/1",
+		map[string]interface{}{"active": false}, &category)
+	if status != http.StatusOK || category.Active || category.Name != "Databases" {
+		t.Errorf("PATCH /api/categories/1 = %d %+v", status, category)
+	}
+
+	if status, _ := doRequest(t, router, http.MethodPatch, "/api/categories/1",
+		map[string]string{"color": "blue"}, nil); status != http.StatusBadRequest {
+		t.Errorf("invalid color = %d, want 400", status)
+	}
+}
@@ -0,0 +1,243 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"lab04-backend/models"
+	"lab04-backend/repository"
+)
+
+// categoryIDsRequest is the body of the post category endpoints
+type categoryIDsRequest struct {
+	CategoryIDs []uint `json:"category_ids"`
+}
+
+// ListPosts handles GET /api/posts?limit=&cursor=.
+// At most one of published=true, user_id or category_id narrows the list.
+func (h *Handler) ListPosts(w http.ResponseWriter, r *http.Request) {
+	page, err := pageRequest(r)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	query := r.URL.Query()
+	var posts *repository.Page[models.Post]
+	switch {
+	case query.Get("user_id") != "":
+		userID, convErr := strconv.Atoi(query.Get("user_id"))
+		if convErr != nil {
+			h.writeError(w, http.StatusBadRequest, "user_id must be an integer")
+			return
+		}
+		posts, err = h.posts.GetByUserIDPage(r.Context(), userID, page)
+	case query.Get("category_id") != "":
+		categoryID, convErr := strconv.ParseUint(query.Get("category_id"), 10, 0)
+		if convErr != nil {
+			h.writeError(w, http.StatusBadRequest, "category_id must be an integer")
+			return
+		}
+		posts, err = h.posts.GetByCategoryIDPage(r.Context(), uint(categoryID), page)
+	case query.Get("published") == "true":
+		posts, err = h.posts.GetPublishedPage(r.Context(), page)
+	default:
+		posts, err = h.posts.GetAllPage(r.Context(), page)
+	}
+	if err != nil {
+		h.writeStoreError(w, err)
+		return
+	}
+	h.writePostPage(w, r, posts)
+}
+
+// CreatePost handles POST /api/posts
+func (h *Handler) CreatePost(w http.ResponseWriter, r *http.Request) {
+	var req models.CreatePostRequest
+	if err := h.parseJSON(w, r, &req); err != nil {
+		h.writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if err := req.Validate(); err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	post, err := h.posts.CreateContext(r.Context(), &req)
+	if err != nil {
+		h.writeStoreError(w, err)
+		return
+	}
+	h.writeData(w, http.StatusCreated, post)
+}
+
+// GetPost handles GET /api/posts/{id}; the post includes its categories
+func (h *Handler) GetPost(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	post, err := h.posts.GetByIDContext(r.Context(), id)
+	if err != nil {
+		h.writeStoreError(w, err)
+		return
+	}
+	posts := []models.Post{*post}
+	if err := h.categories.LoadForPostsContext(r.Context(), posts); err != nil {
+		h.writeStoreError(w, err)
+		return
+	}
+	h.writeData(w, http.StatusOK, posts[0])
+}
+
+// UpdatePost handles PUT and PATCH /api/posts/{id}.
+// Only the fields present in the body are changed.
+func (h *Handler) UpdatePost(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var req models.UpdatePostRequest
+	if err := h.parseJSON(w, r, &req); err != nil {
+		h.writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if err := req.Validate(); err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// The API has no authentication, so EditorID stays unset and the
+	// revision is attributed to the post owner
+	post, err := h.posts.UpdateContext(r.Context(), id, &req)
+	if err != nil {
+		h.writeStoreError(w, err)
+		return
+	}
+	h.writeData(w, http.StatusOK, post)
+}
+
+// DeletePost handles DELETE /api/posts/{id} (soft delete)
+func (h *Handler) DeletePost(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.posts.DeleteContext(r.Context(), id); err != nil {
+		h.writeStoreError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetPostCategories handles GET /api/posts/{id}/categories
+func (h *Handler) GetPostCategories(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	h.writePostCategories(w, r, id)
+}
+
+// AttachPostCategories handles POST /api/posts/{id}/categories
+func (h *Handler) AttachPostCategories(w http.ResponseWriter, r *http.Request) {
+	id, req, ok := h.parseCategoryIDs(w, r)
+	if !ok {
+		return
+	}
+	if err := h.categories.AttachCategoriesContext(r.Context(), id, req.CategoryIDs...); err != nil {
+		h.writeTaggingError(w, err)
+		return
+	}
+	h.writePostCategories(w, r, id)
+}
+
+// ReplacePostCategories handles PUT /api/posts/{id}/categories
+func (h *Handler) ReplacePostCategories(w http.ResponseWriter, r *http.Request) {
+	id, req, ok := h.parseCategoryIDs(w, r)
+	if !ok {
+		return
+	}
+	if err := h.categories.ReplaceCategoriesContext(r.Context(), id, req.CategoryIDs...); err != nil {
+		h.writeTaggingError(w, err)
+		return
+	}
+	h.writePostCategories(w, r, id)
+}
+
+// DetachPostCategory handles DELETE /api/posts/{id}/categories/{categoryID}
+func (h *Handler) DetachPostCategory(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	categoryID, err := pathID(r, "categoryID")
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.categories.DetachCategoriesContext(r.Context(), id, uint(categoryID)); err != nil {
+		h.writeStoreError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) parseCategoryIDs(w http.ResponseWriter, r *http.Request) (int, categoryIDsRequest, bool) {
+	var req categoryIDsRequest
+	id, err := pathID(r, "id")
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return 0, req, false
+	}
+	if err := h.parseJSON(w, r, &req); err != nil {
+		h.writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return 0, req, false
+	}
+	if _, err := h.posts.GetByIDContext(r.Context(), id); err != nil {
+		h.writeStoreError(w, err)
+		return 0, req, false
+	}
+	return id, req, true
+}
+
+// writeTaggingError reports unknown categories as 422 rather than 404;
+// parseCategoryIDs has already checked that the post exists
+func (h *Handler) writeTaggingError(w http.ResponseWriter, err error) {
+	if status, _ := storeErrorStatus(err); status == http.StatusNotFound {
+		h.writeError(w, http.StatusUnprocessableEntity, "category does not exist")
+		return
+	}
+	h.writeStoreError(w, err)
+}
+
+func (h *Handler) writePostCategories(w http.ResponseWriter, r *http.Request, postID int) {
+	if _, err := h.posts.GetByIDContext(r.Context(), postID); err != nil {
+		h.writeStoreError(w, err)
+		return
+	}
+	categories, err := h.categories.GetByPostIDContext(r.Context(), postID)
+	if err != nil {
+		h.writeStoreError(w, err)
+		return
+	}
+	h.writeData(w, http.StatusOK, categories)
+}
+
+// writePostPage loads the categories of the posts on the page and writes it
+func (h *Handler) writePostPage(w http.ResponseWriter, r *http.Request, posts *repository.Page[models.Post]) {
+	if err := h.categories.LoadForPostsContext(r.Context(), posts.Items); err != nil {
+		h.writeStoreError(w, err)
+		return
+	}
+	h.writeData(w, http.StatusOK, posts)
+}
@@ -0,0 +1,167 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"lab04-backend/models"
+)
+
+// transitionRequest is the body of the status endpoint
+type transitionRequest struct {
+	Status models.PostStatus `json:"status"`
+}
+
+// scheduleRequest is the body of the schedule endpoint; null unschedules
+type scheduleRequest struct {
+	PublishAt *time.Time `json:"publish_at"`
+}
+
+// ListRevisions handles GET /api/posts/{id}/revisions
+func (h *Handler) ListRevisions(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.existingPostID(w, r)
+	if !ok {
+		return
+	}
+
+	revisions, err := h.posts.GetRevisionsContext(r.Context(), id)
+	if err != nil {
+		h.writeStoreError(w, err)
+		return
+	}
+	h.writeData(w, http.StatusOK, revisions)
+}
+
+// GetRevision handles GET /api/posts/{id}/revisions/{revision}
+func (h *Handler) GetRevision(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.existingPostID(w, r)
+	if !ok {
+		return
+	}
+	revision, err := pathID(r, "revision")
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	rev, err := h.posts.GetRevisionContext(r.Context(), id, revision)
+	if err != nil {
+		h.writeStoreError(w, err)
+		return
+	}
+	h.writeData(w, http.StatusOK, rev)
+}
+
+// DiffRevisions handles GET /api/posts/{id}/diff?from=&to=
+func (h *Handler) DiffRevisions(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.existingPostID(w, r)
+	if !ok {
+		return
+	}
+	from, errFrom := strconv.Atoi(r.URL.Query().Get("from"))
+	to, errTo := strconv.Atoi(r.URL.Query().Get("to"))
+	if errFrom != nil || errTo != nil {
+		h.writeError(w, http.StatusBadRequest, "from and to must be revision numbers")
+		return
+	}
+
+	diff, err := h.posts.DiffRevisionsContext(r.Context(), id, from, to)
+	if err != nil {
+		h.writeStoreError(w, err)
+		return
+	}
+	h.writeData(w, http.StatusOK, diff)
+}
+
+// RestoreRevision handles POST /api/posts/{id}/revisions/{revision}/restore
+func (h *Handler) RestoreRevision(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	revision, err := pathID(r, "revision")
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// As with updates, the API has no authentication, so the restore is
+	// attributed to the post owner
+	post, err := h.posts.RestoreRevisionContext(r.Context(), id, revision, 0)
+	if err != nil {
+		h.writeStoreError(w, err)
+		return
+	}
+	h.writeData(w, http.StatusOK, post)
+}
+
+// TransitionPost handles POST /api/posts/{id}/status.
+// Moves that the workflow does not allow return 409.
+func (h *Handler) TransitionPost(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var req transitionRequest
+	if err := h.parseJSON(w, r, &req); err != nil {
+		h.writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if !req.Status.Valid() {
+		h.writeError(w, http.StatusBadRequest, "status must be draft, review or published")
+		return
+	}
+
+	post, err := h.posts.TransitionContext(r.Context(), id, req.Status)
+	if err != nil {
+		h.writeStoreError(w, err)
+		return
+	}
+	h.writeData(w, http.StatusOK, post)
+}
+
+// SchedulePost handles PUT /api/posts/{id}/schedule.
+// Only posts in review can be scheduled.
+func (h *Handler) SchedulePost(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var req scheduleRequest
+	if err := h.parseJSON(w, r, &req); err != nil {
+		h.writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	var at time.Time
+	if req.PublishAt != nil {
+		at = *req.PublishAt
+	}
+	post, err := h.posts.ScheduleContext(r.Context(), id, at)
+	if err != nil {
+		h.writeStoreError(w, err)
+		return
+	}
+	h.writeData(w, http.StatusOK, post)
+}
+
+// existingPostID reads the post ID from the path and checks that the post
+// exists, writing the error response otherwise
+func (h *Handler) existingPostID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return 0, false
+	}
+	if _, err := h.posts.GetByIDContext(r.Context(), id); err != nil {
+		h.writeStoreError(w, err)
+		return 0, false
+	}
+	return id, true
+}
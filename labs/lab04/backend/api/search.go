@@ -0,0 +1,148 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"lab04-backend/repository"
+)
+
+// SearchPosts handles GET /api/search/posts.
+// Query parameters: q, user_id, published, min_words, category_id
+// (repeatable or comma separated), limit, offset, order_by, order_dir.
+// Passing cursor switches to keyset pagination and returns a page.
+func (h *Handler) SearchPosts(w http.ResponseWriter, r *http.Request) {
+	filters, err := searchFilters(r.URL.Query())
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if _, paged := r.URL.Query()["cursor"]; paged {
+		page, err := h.search.SearchPostsPage(r.Context(), filters)
+		if err != nil {
+			h.writeStoreError(w, err)
+			return
+		}
+		h.writePostPage(w, r, page)
+		return
+	}
+
+	matches, err := h.search.SearchPostMatches(r.Context(), filters)
+	if err != nil {
+		h.writeStoreError(w, err)
+		return
+	}
+	h.writeData(w, http.StatusOK, matches)
+}
+
+// SearchUsers handles GET /api/search/users?q=&limit=
+func (h *Handler) SearchUsers(w http.ResponseWriter, r *http.Request) {
+	limit, err := optionalInt(r.URL.Query(), "limit")
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	users, err := h.search.SearchUsers(r.Context(), r.URL.Query().Get("q"), limit)
+	if err != nil {
+		h.writeStoreError(w, err)
+		return
+	}
+	h.writeData(w, http.StatusOK, users)
+}
+
+// GetStats handles GET /api/stats
+func (h *Handler) GetStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := h.search.GetPostStats(r.Context())
+	if err != nil {
+		h.writeStoreError(w, err)
+		return
+	}
+	h.writeData(w, http.StatusOK, stats)
+}
+
+// GetTopUsers handles GET /api/stats/top-users?limit=
+func (h *Handler) GetTopUsers(w http.ResponseWriter, r *http.Request) {
+	limit, err := optionalInt(r.URL.Query(), "limit")
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	users, err := h.search.GetTopUsers(r.Context(), limit)
+	if err != nil {
+		h.writeStoreError(w, err)
+		return
+	}
+	h.writeData(w, http.StatusOK, users)
+}
+
+// searchFilters parses the search query parameters
+func searchFilters(query url.Values) (repository.SearchFilters, error) {
+	filters := repository.SearchFilters{
+		Query:    query.Get("q"),
+		Cursor:   query.Get("cursor"),
+		OrderBy:  query.Get("order_by"),
+		OrderDir: query.Get("order_dir"),
+	}
+
+	var err error
+	if filters.Limit, err = optionalInt(query, "limit"); err != nil {
+		return filters, err
+	}
+	if filters.Offset, err = optionalInt(query, "offset"); err != nil {
+		return filters, err
+	}
+
+	if raw := query.Get("user_id"); raw != "" {
+		userID, err := strconv.Atoi(raw)
+		if err != nil {
+			return filters, errors.New("user_id must be an integer")
+		}
+		filters.UserID = &userID
+	}
+	if raw := query.Get("published"); raw != "" {
+		published, err := strconv.ParseBool(raw)
+		if err != nil {
+			return filters, errors.New("published must be true or false")
+		}
+		filters.Published = &published
+	}
+	if raw := query.Get("min_words"); raw != "" {
+		minWords, err := strconv.Atoi(raw)
+		if err != nil {
+			return filters, errors.New("min_words must be an integer")
+		}
+		filters.MinWordCount = &minWords
+	}
+
+	for _, raw := range query["category_id"] {
+		for _, part := range strings.Split(raw, ",") {
+			categoryID, err := strconv.ParseUint(strings.TrimSpace(part), 10, 0)
+			if err != nil {
+				return filters, errors.New("category_id must be a list of integers")
+			}
+			filters.CategoryIDs = append(filters.CategoryIDs, uint(categoryID))
+		}
+	}
+
+	return filters, nil
+}
+
+// optionalInt parses a non-negative integer query parameter, 0 if absent
+func optionalInt(query url.Values, name string) (int, error) {
+	raw := query.Get(name)
+	if raw == "" {
+		return 0, nil
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative integer", name)
+	}
+	return value, nil
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"net/http"
+
+	"lab04-backend/models"
+)
+
+// ListUsers handles GET /api/users?limit=&cursor=
+func (h *Handler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	page, err := pageRequest(r)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	users, err := h.users.GetAllPage(r.Context(), page)
+	if err != nil {
+		h.writeStoreError(w, err)
+		return
+	}
+	h.writeData(w, http.StatusOK, users)
+}
+
+// CreateUser handles POST /api/users
+func (h *Handler) CreateUser(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateUserRequest
+	if err := h.parseJSON(w, r, &req); err != nil {
+		h.writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if err := req.Validate(); err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	user, err := h.users.CreateContext(r.Context(), &req)
+	if err != nil {
+		h.writeStoreError(w, err)
+		return
+	}
+	h.writeData(w, http.StatusCreated, user)
+}
+
+// GetUser handles GET /api/users/{id}
+func (h *Handler) GetUser(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	user, err := h.users.GetByIDContext(r.Context(), id)
+	if err != nil {
+		h.writeStoreError(w, err)
+		return
+	}
+	h.writeData(w, http.StatusOK, user)
+}
+
+// UpdateUser handles PUT and PATCH /api/users/{id}.
+// Only the fields present in the body are changed.
+func (h *Handler) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var req models.UpdateUserRequest
+	if err := h.parseJSON(w, r, &req); err != nil {
+		h.writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if err := req.Validate(); err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	user, err := h.users.UpdateContext(r.Context(), id, &req)
+	if err != nil {
+		h.writeStoreError(w, err)
+		return
+	}
+	h.writeData(w, http.StatusOK, user)
+}
+
+// DeleteUser handles DELETE /api/users/{id} (soft delete)
+func (h *Handler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.users.DeleteContext(r.Context(), id); err != nil {
+		h.writeStoreError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListUserPosts handles GET /api/users/{id}/posts?limit=&cursor=
+func (h *Handler) ListUserPosts(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	page, err := pageRequest(r)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if _, err := h.users.GetByIDContext(r.Context(), id); err != nil {
+		h.writeStoreError(w, err)
+		return
+	}
+	posts, err := h.posts.GetByUserIDPage(r.Context(), id, page)
+	if err != nil {
+		h.writeStoreError(w, err)
+		return
+	}
+	h.writePostPage(w, r, posts)
+}
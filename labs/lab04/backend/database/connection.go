@@ -1,11 +1,12 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"time"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 )
 
 // Config holds database configuration
@@ -15,8 +16,17 @@ type Config struct {
 	MaxIdleConns    int
 	ConnMaxLifetime time.Duration
 	ConnMaxIdleTime time.Duration
+	// QueryTimeout bounds each query of the repositories built with
+	// repository.WithConfig; zero disables it
+	QueryTimeout time.Duration
+	// Instrumentation, if set, records every statement run on the pool
+	Instrumentation *Instrumentation
 }
 
+// DefaultQueryTimeout is the per-query timeout used by repositories
+// unless configured otherwise
+const DefaultQueryTimeout = 5 * time.Second
+
 // DefaultConfig returns a default database configuration
 func DefaultConfig() *Config {
 	return &Config{
@@ -25,34 +35,60 @@ func DefaultConfig() *Config {
 		MaxIdleConns:    5,
 		ConnMaxLifetime: 5 * time.Minute,
 		ConnMaxIdleTime: 2 * time.Minute,
+		QueryTimeout:    DefaultQueryTimeout,
 	}
 }
 
-// TODO: Implement InitDB function
+// InitDB opens the SQLite database using DefaultConfig
 func InitDB() (*sql.DB, error) {
-	// TODO: Initialize database connection with SQLite
-	// - Open database connection using sqlite3 driver
-	// - Apply connection pool configuration from DefaultConfig()
-	// - Test connection with Ping()
-	// - Return the database connection or error
-	return nil, fmt.Errorf("TODO: implement InitDB function")
+	return InitDBWithConfig(DefaultConfig())
 }
 
-// TODO: Implement InitDBWithConfig function
+// InitDBWithConfig opens the SQLite database with a custom configuration.
+// Foreign keys are enabled on every connection so ON DELETE CASCADE works.
 func InitDBWithConfig(config *Config) (*sql.DB, error) {
-	// TODO: Initialize database connection with custom configuration
-	// - Open database connection using the provided config
-	// - Apply all connection pool settings
-	// - Test connection with Ping()
-	// - Return the database connection or error
-	return nil, fmt.Errorf("TODO: implement InitDBWithConfig function")
+	if config == nil {
+		return nil, fmt.Errorf("database config cannot be nil")
+	}
+
+	dsn := config.DatabasePath + "?_foreign_keys=on"
+	var db *sql.DB
+	if config.Instrumentation != nil {
+		db = sql.OpenDB(&instrumentedConnector{dsn: dsn, driver: &sqlite3.SQLiteDriver{}, inst: config.Instrumentation})
+	} else {
+		var err error
+		if db, err = sql.Open("sqlite3", dsn); err != nil {
+			return nil, fmt.Errorf("failed to open database: %v", err)
+		}
+	}
+
+	db.SetMaxOpenConns(config.MaxOpenConns)
+	db.SetMaxIdleConns(config.MaxIdleConns)
+	db.SetConnMaxLifetime(config.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(config.ConnMaxIdleTime)
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to ping database: %v", err)
+	}
+
+	return db, nil
 }
 
-// TODO: Implement CloseDB function
+// CloseDB closes the database connection
 func CloseDB(db *sql.DB) error {
-	// TODO: Properly close database connection
-	// - Check if db is not nil
-	// - Close the database connection
-	// - Return any error that occurs
-	return fmt.Errorf("TODO: implement CloseDB function")
+	if db == nil {
+		return fmt.Errorf("database connection cannot be nil")
+	}
+	return db.Close()
+}
+
+// WithQueryTimeout derives a context that is cancelled after timeout.
+// A zero or negative timeout returns ctx unchanged; an earlier deadline
+// already set on ctx wins over the timeout.
+func WithQueryTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
 }
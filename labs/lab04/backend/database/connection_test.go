@@ -1,6 +1,7 @@
 package database
 
 import (
+	"errors"
 	"os"
 	"testing"
 	"time"
@@ -158,6 +159,30 @@ func TestMigrate(t *testing.T) {
 	}
 }
 
+func TestMigrate_SearchIndexWithoutFTS5(t *testing.T) {
+	testDB := "./test_migrate_fts.db"
+	defer os.Remove(testDB)
+	os.Remove(testDB)
+
+	db, err := InitDBWithConfig(&Config{DatabasePath: testDB, MaxOpenConns: 1, MaxIdleConns: 1})
+	if err != nil {
+		t.Fatalf("InitDBWithConfig() failed: %v", err)
+	}
+	defer CloseDB(db)
+
+	if available, _ := FTS5Available(db); available {
+		t.Skip("FTS5 is compiled in")
+	}
+
+	// Stands in for the index left by a build with FTS5
+	if _, err := db.Exec("CREATE TABLE posts_fts (title TEXT, content TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	if err := RunMigrations(db); !errors.Is(err, ErrSearchIndexNeedsFTS5) {
+		t.Errorf("RunMigrations() error = %v, want ErrSearchIndexNeedsFTS5", err)
+	}
+}
+
 func TestCloseDB(t *testing.T) {
 	// Test closing nil database
 	err := CloseDB(nil)
@@ -0,0 +1,28 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// InitGORM wraps an existing SQLite connection pool with GORM, so the
+// GORM and database/sql repositories share one pool and can share one
+// transaction
+func InitGORM(db *sql.DB) (*gorm.DB, error) {
+	if db == nil {
+		return nil, fmt.Errorf("database connection cannot be nil")
+	}
+
+	gormDB, err := gorm.Open(sqlite.Dialector{Conn: db}, &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize gorm: %v", err)
+	}
+
+	return gormDB, nil
+}
@@ -0,0 +1,136 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Query event sources
+const (
+	SourceSQL  = "sql"
+	SourceGORM = "gorm"
+)
+
+// QueryEvent describes one executed statement
+type QueryEvent struct {
+	Source string
+	Query  string
+	// Fingerprint is Query with literals and whitespace normalised, so
+	// executions of the same statement share one metrics entry
+	Fingerprint string
+	// Args are the bound arguments after redaction
+	Args     []string
+	Duration time.Duration
+	// RowsAffected is the affected row count of an exec, or the number of
+	// rows read from a query; -1 when unknown
+	RowsAffected int64
+	Err          error
+}
+
+// Instrumentation records every statement run through an instrumented
+// connection (see Config.Instrumentation) or GORM (see GORMPlugin)
+type Instrumentation struct {
+	// SlowThreshold logs statements taking at least this long; zero
+	// disables slow-query logging
+	SlowThreshold time.Duration
+	// Logger receives slow-query lines; nil uses the standard logger
+	Logger *log.Logger
+	// Metrics aggregates durations per fingerprint; may be nil
+	Metrics *QueryMetrics
+	// RedactArg renders one argument for events and logs; nil uses
+	// RedactArg from this package
+	RedactArg func(arg interface{}) string
+	// OnQuery, if set, is called with every event
+	OnQuery func(QueryEvent)
+}
+
+// NewInstrumentation returns instrumentation with a fresh metrics
+// registry that logs statements slower than slowThreshold
+func NewInstrumentation(slowThreshold time.Duration) *Instrumentation {
+	return &Instrumentation{SlowThreshold: slowThreshold, Metrics: NewQueryMetrics()}
+}
+
+// record builds the event for a finished statement and dispatches it
+func (in *Instrumentation) record(source, query string, args []interface{}, started time.Time, rows int64, err error) {
+	event := QueryEvent{
+		Source:       source,
+		Query:        query,
+		Fingerprint:  Fingerprint(query),
+		Args:         in.redact(args),
+		Duration:     time.Since(started),
+		RowsAffected: rows,
+		Err:          err,
+	}
+
+	if in.Metrics != nil {
+		in.Metrics.Observe(event)
+	}
+	if in.SlowThreshold > 0 && event.Duration >= in.SlowThreshold {
+		in.logf("slow query [%s] %s: %s args=%v rows=%d", event.Source, event.Duration, event.Query, event.Args, event.RowsAffected)
+	}
+	if in.OnQuery != nil {
+		in.OnQuery(event)
+	}
+}
+
+func (in *Instrumentation) redact(args []interface{}) []string {
+	redact := in.RedactArg
+	if redact == nil {
+		redact = RedactArg
+	}
+	out := make([]string, len(args))
+	for i, arg := range args {
+		out[i] = redact(arg)
+	}
+	return out
+}
+
+func (in *Instrumentation) logf(format string, args ...interface{}) {
+	if in.Logger != nil {
+		in.Logger.Printf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
+
+// RedactArg renders an argument without leaking user data: numbers,
+// booleans, times and NULL are shown, strings and bytes only by length
+func RedactArg(arg interface{}) string {
+	switch v := arg.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return fmt.Sprintf("<string len=%d>", len(v))
+	case []byte:
+		return fmt.Sprintf("<bytes len=%d>", len(v))
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return fmt.Sprint(v)
+	default:
+		return fmt.Sprintf("<%T>", v)
+	}
+}
+
+var (
+	stringLiteral  = regexp.MustCompile(`'(?:[^']|'')*'`)
+	numberLiteral  = regexp.MustCompile(`\b\d+(?:\.\d+)?\b`)
+	dollarParam    = regexp.MustCompile(`\$\d+`)
+	placeholderSet = regexp.MustCompile(`\(\s*\?(?:\s*,\s*\?)+\s*\)`)
+	whitespace     = regexp.MustCompile(`\s+`)
+)
+
+// Fingerprint normalises a statement so that executions differing only
+// in literal values, placeholder counts of IN lists or whitespace map to
+// the same string
+func Fingerprint(query string) string {
+	fp := stringLiteral.ReplaceAllString(query, "?")
+	fp = dollarParam.ReplaceAllString(fp, "?")
+	fp = numberLiteral.ReplaceAllString(fp, "?")
+	fp = placeholderSet.ReplaceAllString(fp, "(?+)")
+	fp = whitespace.ReplaceAllString(fp, " ")
+	return strings.TrimSpace(fp)
+}
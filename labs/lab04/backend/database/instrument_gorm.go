@@ -0,0 +1,69 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// gormStartKey stores the statement start time on the GORM instance
+const gormStartKey = "lab04:instrument_start"
+
+// gormPlugin records GORM operations through an Instrumentation
+type gormPlugin struct {
+	inst *Instrumentation
+}
+
+// GORMPlugin returns a gorm.Plugin recording every GORM operation with
+// Source set to SourceGORM. Install it with gormDB.Use. When the *sql.DB
+// under GORM is itself instrumented, each statement is recorded twice,
+// once per source.
+func (in *Instrumentation) GORMPlugin() gorm.Plugin {
+	return &gormPlugin{inst: in}
+}
+
+func (p *gormPlugin) Name() string {
+	return "lab04:instrumentation"
+}
+
+func (p *gormPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	processors := []struct {
+		name   string
+		before func(string, func(*gorm.DB)) error
+		after  func(string, func(*gorm.DB)) error
+	}{
+		{"create", cb.Create().Before("gorm:create").Register, cb.Create().After("gorm:create").Register},
+		{"query", cb.Query().Before("gorm:query").Register, cb.Query().After("gorm:query").Register},
+		{"update", cb.Update().Before("gorm:update").Register, cb.Update().After("gorm:update").Register},
+		{"delete", cb.Delete().Before("gorm:delete").Register, cb.Delete().After("gorm:delete").Register},
+		{"row", cb.Row().Before("gorm:row").Register, cb.Row().After("gorm:row").Register},
+		{"raw", cb.Raw().Before("gorm:raw").Register, cb.Raw().After("gorm:raw").Register},
+	}
+
+	for _, proc := range processors {
+		if err := proc.before("lab04:before_"+proc.name, p.before); err != nil {
+			return err
+		}
+		if err := proc.after("lab04:after_"+proc.name, p.after); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *gormPlugin) before(db *gorm.DB) {
+	db.InstanceSet(gormStartKey, time.Now())
+}
+
+func (p *gormPlugin) after(db *gorm.DB) {
+	value, ok := db.InstanceGet(gormStartKey)
+	if !ok {
+		return
+	}
+	started, ok := value.(time.Time)
+	if !ok || db.Statement.SQL.Len() == 0 {
+		return
+	}
+	p.inst.record(SourceGORM, db.Statement.SQL.String(), db.Statement.Vars, started, db.RowsAffected, db.Error)
+}
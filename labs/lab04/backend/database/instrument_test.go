@@ -0,0 +1,194 @@
+package database
+
+import (
+	"bytes"
+	"database/sql"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFingerprint(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT * FROM users WHERE id = 42", "SELECT * FROM users WHERE id = ?"},
+		{"SELECT * FROM users\n\tWHERE email = 'a@b.c'", "SELECT * FROM users WHERE email = ?"},
+		{"SELECT * FROM posts WHERE id IN (?, ?, ?)", "SELECT * FROM posts WHERE id IN (?+)"},
+		{"SELECT * FROM posts WHERE id IN (?,?)", "SELECT * FROM posts WHERE id IN (?+)"},
+		{"UPDATE posts SET title = $1 WHERE id = $2", "UPDATE posts SET title = ? WHERE id = ?"},
+		{"SELECT * FROM t2 WHERE name = 'it''s'", "SELECT * FROM t2 WHERE name = ?"},
+	}
+
+	for _, tt := range tests {
+		if got := Fingerprint(tt.query); got != tt.want {
+			t.Errorf("Fingerprint(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestRedactArg(t *testing.T) {
+	tests := []struct {
+		arg  interface{}
+		want string
+	}{
+		{nil, "NULL"},
+		{int64(7), "7"},
+		{true, "true"},
+		{"secret@example.com", "<string len=18>"},
+		{[]byte("abc"), "<bytes len=3>"},
+	}
+
+	for _, tt := range tests {
+		if got := RedactArg(tt.arg); got != tt.want {
+			t.Errorf("RedactArg(%#v) = %q, want %q", tt.arg, got, tt.want)
+		}
+	}
+}
+
+func TestQueryMetrics(t *testing.T) {
+	metrics := NewQueryMetrics()
+	metrics.Observe(QueryEvent{Source: SourceSQL, Fingerprint: "a", Duration: 500 * time.Microsecond, RowsAffected: 2})
+	metrics.Observe(QueryEvent{Source: SourceSQL, Fingerprint: "a", Duration: 30 * time.Millisecond, RowsAffected: -1})
+	metrics.Observe(QueryEvent{Source: SourceSQL, Fingerprint: "b", Duration: 10 * time.Second, Err: os.ErrClosed})
+
+	stats := metrics.Snapshot()
+	if len(stats) != 2 {
+		t.Fatalf("Snapshot() returned %d entries, want 2", len(stats))
+	}
+	if stats[0].Fingerprint != "b" || stats[0].Errors != 1 || stats[0].Buckets[len(QueryDurationBuckets)] != 1 {
+		t.Errorf("slowest entry = %+v, want b with one error in the overflow bucket", stats[0])
+	}
+
+	a := stats[1]
+	if a.Count != 2 || a.Rows != 2 || a.Max != 30*time.Millisecond {
+		t.Errorf("entry a = %+v, want count 2, rows 2, max 30ms", a)
+	}
+	if a.Buckets[0] != 1 || a.Buckets[bucketIndex(30*time.Millisecond)] != 1 {
+		t.Errorf("entry a buckets = %v", a.Buckets)
+	}
+
+	metrics.Reset()
+	if len(metrics.Snapshot()) != 0 {
+		t.Error("Reset() should discard all stats")
+	}
+}
+
+func setupInstrumentedDB(t *testing.T, inst *Instrumentation) *sql.DB {
+	testDB := "./test_instrument.db"
+	os.Remove(testDB)
+
+	config := DefaultConfig()
+	config.DatabasePath = testDB
+	config.Instrumentation = inst
+
+	db, err := InitDBWithConfig(config)
+	if err != nil {
+		t.Fatalf("InitDBWithConfig() failed: %v", err)
+	}
+	t.Cleanup(func() {
+		CloseDB(db)
+		os.Remove(testDB)
+	})
+	return db
+}
+
+func TestInstrumentedDB(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		events []QueryEvent
+	)
+	var logs bytes.Buffer
+	inst := NewInstrumentation(time.Nanosecond)
+	inst.Logger = log.New(&logs, "", 0)
+	inst.OnQuery = func(e QueryEvent) {
+		mu.Lock()
+		events = append(events, e)
+		mu.Unlock()
+	}
+
+	db := setupInstrumentedDB(t, inst)
+	if _, err := db.Exec(`CREATE TABLE notes (id INTEGER PRIMARY KEY, body TEXT NOT NULL)`); err != nil {
+		t.Fatalf("create table failed: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := db.Exec(`INSERT INTO notes (body) VALUES (?)`, "private note"); err != nil {
+			t.Fatalf("insert failed: %v", err)
+		}
+	}
+	rows, err := db.Query(`SELECT id, body FROM notes WHERE id IN (?, ?)`, 1, 2)
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	for rows.Next() {
+	}
+	rows.Close()
+
+	var insert, selectEvent *QueryEvent
+	for i := range events {
+		switch {
+		case strings.HasPrefix(events[i].Query, "INSERT INTO notes"):
+			insert = &events[i]
+		case strings.HasPrefix(events[i].Query, "SELECT id, body FROM notes"):
+			selectEvent = &events[i]
+		}
+	}
+	if insert == nil || selectEvent == nil {
+		t.Fatalf("missing insert or select event in %d events", len(events))
+	}
+	if insert.Source != SourceSQL || insert.RowsAffected != 1 {
+		t.Errorf("insert event = %+v, want one affected row", insert)
+	}
+	if len(insert.Args) != 1 || insert.Args[0] != "<string len=12>" {
+		t.Errorf("insert args = %v, want the body redacted", insert.Args)
+	}
+	if selectEvent.RowsAffected != 2 || selectEvent.Fingerprint != "SELECT id, body FROM notes WHERE id IN (?+)" {
+		t.Errorf("select event = %+v, want 2 rows and a normalised fingerprint", selectEvent)
+	}
+
+	if !strings.Contains(logs.String(), "slow query [sql]") || strings.Contains(logs.String(), "private note") {
+		t.Errorf("slow query log should name the statement but not its arguments:\n%s", logs.String())
+	}
+
+	var inserts int64
+	for _, s := range inst.Metrics.Snapshot() {
+		if s.Source == SourceSQL && s.Fingerprint == "INSERT INTO notes (body) VALUES (?)" {
+			inserts = s.Count
+		}
+	}
+	if inserts != 3 {
+		t.Errorf("metrics counted %d inserts, want 3", inserts)
+	}
+
+	gormDB, err := InitGORM(db)
+	if err != nil {
+		t.Fatalf("InitGORM() failed: %v", err)
+	}
+	if err := gormDB.Use(inst.GORMPlugin()); err != nil {
+		t.Fatalf("Use(GORMPlugin()) failed: %v", err)
+	}
+	events = nil
+	var count int64
+	if err := gormDB.Table("notes").Where("body = ?", "private note").Count(&count).Error; err != nil {
+		t.Fatalf("gorm count failed: %v", err)
+	}
+	if count != 3 {
+		t.Errorf("gorm count = %d, want 3", count)
+	}
+	var gormEvents int
+	for _, e := range events {
+		if e.Source == SourceGORM {
+			gormEvents++
+			if !strings.Contains(e.Query, "count(*)") || len(e.Args) != 1 {
+				t.Errorf("gorm event = %+v, want the count query with one argument", e)
+			}
+		}
+	}
+	if gormEvents != 1 {
+		t.Errorf("recorded %d gorm events, want 1", gormEvents)
+	}
+}
@@ -3,6 +3,7 @@ package database
 import (
 	"database/sql"
 	"fmt"
+	"os"
 
 	"github.com/pressly/goose/v3"
 )
@@ -18,17 +19,30 @@ func RunMigrations(db *sql.DB) error {
 		return fmt.Errorf("failed to set goose dialect: %v", err)
 	}
 
-	// Get path to migrations directory (relative to backend directory)
-	migrationsDir := "../migrations"
-
 	// Run migrations from the migrations directory
-	if err := goose.Up(db, migrationsDir); err != nil {
+	if err := goose.Up(db, migrationsDir()); err != nil {
 		return fmt.Errorf("failed to run migrations: %v", err)
 	}
 
+	// The FTS5 index depends on a build tag, so it is managed outside goose
+	if err := EnsurePostSearchIndex(db); err != nil {
+		return err
+	}
+
 	return nil
 }
 
+// migrationsDir locates the migrations directory both from the backend
+// directory (go run .) and from a package directory (go test ./...)
+func migrationsDir() string {
+	for _, dir := range []string{"migrations", "../migrations"} {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir
+		}
+	}
+	return "../migrations"
+}
+
 // TODO: Implement this function
 // RollbackMigration rolls back the last migration using goose
 func RollbackMigration(db *sql.DB) error {
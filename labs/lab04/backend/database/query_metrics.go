@@ -0,0 +1,132 @@
+package database
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// QueryDurationBuckets are the upper bounds of the latency histogram
+// buckets; slower queries fall in a final overflow bucket
+var QueryDurationBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+}
+
+// QueryStats is a snapshot of the metrics of one query fingerprint
+type QueryStats struct {
+	Fingerprint string        `json:"fingerprint"`
+	Source      string        `json:"source"`
+	Count       int64         `json:"count"`
+	Errors      int64         `json:"errors"`
+	Rows        int64         `json:"rows"`
+	Total       time.Duration `json:"total_ns"`
+	Max         time.Duration `json:"max_ns"`
+	// Buckets[i] counts queries no slower than QueryDurationBuckets[i];
+	// the last entry counts the slower ones
+	Buckets []int64 `json:"buckets"`
+}
+
+// Mean returns the average duration
+func (s QueryStats) Mean() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Total / time.Duration(s.Count)
+}
+
+// QueryMetrics is an in-process registry of per-fingerprint latency
+// histograms. It is safe for concurrent use.
+type QueryMetrics struct {
+	mu    sync.Mutex
+	stats map[string]*QueryStats
+}
+
+// NewQueryMetrics creates an empty registry
+func NewQueryMetrics() *QueryMetrics {
+	return &QueryMetrics{stats: make(map[string]*QueryStats)}
+}
+
+// Observe adds an event to the histogram of its fingerprint and source
+func (m *QueryMetrics) Observe(event QueryEvent) {
+	key := event.Source + "\x00" + event.Fingerprint
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.stats[key]
+	if !ok {
+		s = &QueryStats{
+			Fingerprint: event.Fingerprint,
+			Source:      event.Source,
+			Buckets:     make([]int64, len(QueryDurationBuckets)+1),
+		}
+		m.stats[key] = s
+	}
+
+	s.Count++
+	s.Total += event.Duration
+	if event.Duration > s.Max {
+		s.Max = event.Duration
+	}
+	if event.Err != nil {
+		s.Errors++
+	}
+	if event.RowsAffected > 0 {
+		s.Rows += event.RowsAffected
+	}
+	s.Buckets[bucketIndex(event.Duration)]++
+}
+
+func bucketIndex(d time.Duration) int {
+	return sort.Search(len(QueryDurationBuckets), func(i int) bool {
+		return d <= QueryDurationBuckets[i]
+	})
+}
+
+// Snapshot returns a copy of all stats, most total time first
+func (m *QueryMetrics) Snapshot() []QueryStats {
+	m.mu.Lock()
+	out := make([]QueryStats, 0, len(m.stats))
+	for _, s := range m.stats {
+		c := *s
+		c.Buckets = append([]int64(nil), s.Buckets...)
+		out = append(out, c)
+	}
+	m.mu.Unlock()
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Total != out[j].Total {
+			return out[i].Total > out[j].Total
+		}
+		return out[i].Fingerprint < out[j].Fingerprint
+	})
+	return out
+}
+
+// Reset discards all recorded stats
+func (m *QueryMetrics) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stats = make(map[string]*QueryStats)
+}
+
+// ServeHTTP writes the snapshot as JSON, so the registry can be mounted
+// as a debug endpoint
+func (m *QueryMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"buckets_ns": QueryDurationBuckets,
+		"queries":    m.Snapshot(),
+	})
+}
@@ -0,0 +1,104 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// PostSearchTable is the FTS5 virtual table indexing posts.title and posts.content
+const PostSearchTable = "posts_fts"
+
+// postSearchIndexStatements create the external-content FTS5 table and the
+// triggers that keep it in sync with posts. Every statement is idempotent.
+var postSearchIndexStatements = []string{
+	`CREATE VIRTUAL TABLE IF NOT EXISTS posts_fts USING fts5(
+		title,
+		content,
+		content='posts',
+		content_rowid='id',
+		tokenize='porter unicode61'
+	)`,
+	`CREATE TRIGGER IF NOT EXISTS posts_fts_after_insert AFTER INSERT ON posts BEGIN
+		INSERT INTO posts_fts(rowid, title, content) VALUES (new.id, new.title, new.content);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS posts_fts_after_delete AFTER DELETE ON posts BEGIN
+		INSERT INTO posts_fts(posts_fts, rowid, title, content) VALUES ('delete', old.id, old.title, old.content);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS posts_fts_after_update AFTER UPDATE OF title, content ON posts BEGIN
+		INSERT INTO posts_fts(posts_fts, rowid, title, content) VALUES ('delete', old.id, old.title, old.content);
+		INSERT INTO posts_fts(rowid, title, content) VALUES (new.id, new.title, new.content);
+	END`,
+}
+
+// FTS5Available reports whether the linked SQLite was compiled with FTS5.
+// go-sqlite3 only enables it with the sqlite_fts5 build tag.
+func FTS5Available(db *sql.DB) (bool, error) {
+	var used bool
+	if err := db.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&used); err != nil {
+		return false, fmt.Errorf("failed to check sqlite compile options: %v", err)
+	}
+	return used, nil
+}
+
+// HasPostSearchIndex reports whether the posts_fts table exists
+func HasPostSearchIndex(db *sql.DB) (bool, error) {
+	var count int
+	err := db.QueryRow(
+		"SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?",
+		PostSearchTable,
+	).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("failed to look up search index: %v", err)
+	}
+	return count > 0, nil
+}
+
+// ErrSearchIndexNeedsFTS5 is returned when a build without FTS5 opens a
+// database whose search index was created by a build with it. Its sync
+// triggers would make every write to posts fail with "no such module:
+// fts5", and SQLite cannot drop the index without the module.
+var ErrSearchIndexNeedsFTS5 = errors.New("database has an FTS5 search index but SQLite was built without FTS5; build with -tags sqlite_fts5")
+
+// EnsurePostSearchIndex creates the posts full-text index and its sync
+// triggers when SQLite supports FTS5. Existing posts are indexed the first
+// time the table is created. Without FTS5 search falls back to LIKE
+// matching, unless the database already has the index, which returns
+// ErrSearchIndexNeedsFTS5.
+func EnsurePostSearchIndex(db *sql.DB) error {
+	available, err := FTS5Available(db)
+	if err != nil {
+		return err
+	}
+
+	exists, err := HasPostSearchIndex(db)
+	if err != nil {
+		return err
+	}
+	if !available {
+		if exists {
+			return ErrSearchIndexNeedsFTS5
+		}
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin search index transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range postSearchIndexStatements {
+		if _, err := tx.Exec(stmt); err != nil {
+			return fmt.Errorf("failed to create search index: %v", err)
+		}
+	}
+
+	if !exists {
+		if _, err := tx.Exec("INSERT INTO posts_fts(posts_fts) VALUES ('rebuild')"); err != nil {
+			return fmt.Errorf("failed to build search index: %v", err)
+		}
+	}
+
+	return tx.Commit()
+}
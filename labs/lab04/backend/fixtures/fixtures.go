@@ -0,0 +1,326 @@
+// Package fixtures loads test data into the lab04 schema. A Set is read
+// from YAML or JSON files, or produced by Generate, and inserted in
+// foreign-key order: users, categories, posts, then post_categories.
+package fixtures
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"lab04-backend/models"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Set is the contents of one or more fixture files. IDs are optional;
+// rows without one get the next autoincrement value, but only rows with
+// an explicit ID can be referenced by other rows.
+type Set struct {
+	Users          []User         `json:"users" yaml:"users"`
+	Categories     []Category     `json:"categories" yaml:"categories"`
+	Posts          []Post         `json:"posts" yaml:"posts"`
+	PostCategories []PostCategory `json:"post_categories" yaml:"post_categories"`
+}
+
+// User is a row of the users table
+type User struct {
+	ID        int        `json:"id" yaml:"id"`
+	Name      string     `json:"name" yaml:"name"`
+	Email     string     `json:"email" yaml:"email"`
+	CreatedAt *time.Time `json:"created_at" yaml:"created_at"`
+	DeletedAt *time.Time `json:"deleted_at" yaml:"deleted_at"`
+}
+
+// Category is a row of the categories table
+type Category struct {
+	ID          uint   `json:"id" yaml:"id"`
+	Name        string `json:"name" yaml:"name"`
+	Description string `json:"description" yaml:"description"`
+	// Color defaults to models.DefaultCategoryColor
+	Color string `json:"color" yaml:"color"`
+	// Active defaults to true
+	Active    *bool      `json:"active" yaml:"active"`
+	CreatedAt *time.Time `json:"created_at" yaml:"created_at"`
+}
+
+// Post is a row of the posts table. Every post also gets revision 1 in
+// post_revisions, as if it had been created through PostRepository.
+type Post struct {
+	ID      int    `json:"id" yaml:"id"`
+	UserID  int    `json:"user_id" yaml:"user_id"`
+	Title   string `json:"title" yaml:"title"`
+	Content string `json:"content" yaml:"content"`
+	// Status defaults to published or draft following Published
+	Published bool              `json:"published" yaml:"published"`
+	Status    models.PostStatus `json:"status" yaml:"status"`
+	PublishAt *time.Time        `json:"publish_at" yaml:"publish_at"`
+	CreatedAt *time.Time        `json:"created_at" yaml:"created_at"`
+	DeletedAt *time.Time        `json:"deleted_at" yaml:"deleted_at"`
+	// CategoryIDs is shorthand for PostCategories entries of this post
+	CategoryIDs []uint `json:"category_ids" yaml:"category_ids"`
+}
+
+// PostCategory is a row of the post_categories join table
+type PostCategory struct {
+	PostID     int  `json:"post_id" yaml:"post_id"`
+	CategoryID uint `json:"category_id" yaml:"category_id"`
+}
+
+// Tables lists the tables managed by fixtures in foreign-key order
+var Tables = []string{"users", "categories", "posts", "post_revisions", "post_categories"}
+
+// Parse decodes a fixture document; format is "yaml" or "json"
+func Parse(data []byte, format string) (*Set, error) {
+	var set Set
+	switch strings.ToLower(format) {
+	case "yaml", "yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&set); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("failed to parse yaml fixtures: %v", err)
+		}
+	case "json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&set); err != nil {
+			return nil, fmt.Errorf("failed to parse json fixtures: %v", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported fixture format %q", format)
+	}
+	return &set, nil
+}
+
+// LoadFiles reads and merges fixture files. The format of each file is
+// taken from its extension: .yaml, .yml or .json.
+func LoadFiles(paths ...string) (*Set, error) {
+	merged := &Set{}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read fixtures: %v", err)
+		}
+		set, err := Parse(data, strings.TrimPrefix(filepath.Ext(path), "."))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		merged.Merge(set)
+	}
+	return merged, nil
+}
+
+// Merge appends the rows of other to s
+func (s *Set) Merge(other *Set) {
+	s.Users = append(s.Users, other.Users...)
+	s.Categories = append(s.Categories, other.Categories...)
+	s.Posts = append(s.Posts, other.Posts...)
+	s.PostCategories = append(s.PostCategories, other.PostCategories...)
+}
+
+// Insert writes the set in one transaction, parents before children
+func Insert(ctx context.Context, db *sql.DB, set *Set) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin fixtures transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := insertUsers(ctx, tx, set.Users); err != nil {
+		return err
+	}
+	if err := insertCategories(ctx, tx, set.Categories); err != nil {
+		return err
+	}
+	if err := insertPosts(ctx, tx, set.Posts); err != nil {
+		return err
+	}
+	if err := insertPostCategories(ctx, tx, set); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit fixtures: %v", err)
+	}
+	return nil
+}
+
+// Reset deletes all rows of Tables, children first, and restarts their
+// autoincrement counters so fixture IDs are predictable
+func Reset(ctx context.Context, db *sql.DB) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin reset transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	for i := len(Tables) - 1; i >= 0; i-- {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM "+Tables[i]); err != nil {
+			return fmt.Errorf("failed to reset %s: %v", Tables[i], err)
+		}
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(Tables)), ", ")
+	args := make([]interface{}, len(Tables))
+	for i, table := range Tables {
+		args[i] = table
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM sqlite_sequence WHERE name IN ("+placeholders+")", args...); err != nil {
+		return fmt.Errorf("failed to reset sequences: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit reset: %v", err)
+	}
+	return nil
+}
+
+// Apply resets the fixture tables and loads the given files, leaving the
+// database with exactly their contents
+func Apply(ctx context.Context, db *sql.DB, paths ...string) (*Set, error) {
+	set, err := LoadFiles(paths...)
+	if err != nil {
+		return nil, err
+	}
+	if err := Reset(ctx, db); err != nil {
+		return nil, err
+	}
+	if err := Insert(ctx, db, set); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+func insertUsers(ctx context.Context, tx *sql.Tx, users []User) error {
+	stmt, err := tx.PrepareContext(ctx,
+		`INSERT INTO users (id, name, email, created_at, updated_at, deleted_at)
+		 VALUES (?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare user fixtures: %v", err)
+	}
+	defer stmt.Close()
+
+	for i, user := range users {
+		created := timeOrNow(user.CreatedAt)
+		if _, err := stmt.ExecContext(ctx, nullID(user.ID), user.Name, user.Email, created, created, user.DeletedAt); err != nil {
+			return fmt.Errorf("failed to insert user fixture %d (%s): %v", i, user.Email, err)
+		}
+	}
+	return nil
+}
+
+func insertCategories(ctx context.Context, tx *sql.Tx, categories []Category) error {
+	stmt, err := tx.PrepareContext(ctx,
+		`INSERT INTO categories (id, name, description, color, active, created_at, updated_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare category fixtures: %v", err)
+	}
+	defer stmt.Close()
+
+	for i, category := range categories {
+		color := category.Color
+		if color == "" {
+			color = models.DefaultCategoryColor
+		}
+		active := category.Active == nil || *category.Active
+		created := timeOrNow(category.CreatedAt)
+		if _, err := stmt.ExecContext(ctx, nullID(int(category.ID)), category.Name, category.Description,
+			color, active, created, created); err != nil {
+			return fmt.Errorf("failed to insert category fixture %d (%s): %v", i, category.Name, err)
+		}
+	}
+	return nil
+}
+
+func insertPosts(ctx context.Context, tx *sql.Tx, posts []Post) error {
+	postStmt, err := tx.PrepareContext(ctx,
+		`INSERT INTO posts (id, user_id, title, content, published, status, publish_at, created_at, updated_at, deleted_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare post fixtures: %v", err)
+	}
+	defer postStmt.Close()
+
+	revisionStmt, err := tx.PrepareContext(ctx,
+		`INSERT INTO post_revisions (post_id, revision, title, content, author_id, created_at)
+		 VALUES (?, 1, ?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare revision fixtures: %v", err)
+	}
+	defer revisionStmt.Close()
+
+	for i, post := range posts {
+		status := post.Status
+		if status == "" {
+			status = models.StatusForPublished(post.Published)
+		}
+		if !status.Valid() {
+			return fmt.Errorf("post fixture %d (%s): invalid status %q", i, post.Title, status)
+		}
+
+		created := timeOrNow(post.CreatedAt)
+		result, err := postStmt.ExecContext(ctx, nullID(post.ID), post.UserID, post.Title, post.Content,
+			status == models.PostPublished, status, post.PublishAt, created, created, post.DeletedAt)
+		if err != nil {
+			return fmt.Errorf("failed to insert post fixture %d (%s): %v", i, post.Title, err)
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("failed to read post fixture id: %v", err)
+		}
+		if _, err := revisionStmt.ExecContext(ctx, id, post.Title, post.Content, post.UserID, created); err != nil {
+			return fmt.Errorf("failed to insert revision of post fixture %d (%s): %v", i, post.Title, err)
+		}
+	}
+	return nil
+}
+
+func insertPostCategories(ctx context.Context, tx *sql.Tx, set *Set) error {
+	stmt, err := tx.PrepareContext(ctx,
+		`INSERT INTO post_categories (post_id, category_id, created_at) VALUES (?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare post category fixtures: %v", err)
+	}
+	defer stmt.Close()
+
+	links := append([]PostCategory(nil), set.PostCategories...)
+	for i, post := range set.Posts {
+		if len(post.CategoryIDs) > 0 && post.ID == 0 {
+			return fmt.Errorf("post fixture %d (%s): category_ids need an explicit post id", i, post.Title)
+		}
+		for _, categoryID := range post.CategoryIDs {
+			links = append(links, PostCategory{PostID: post.ID, CategoryID: categoryID})
+		}
+	}
+
+	now := time.Now()
+	for _, link := range links {
+		if _, err := stmt.ExecContext(ctx, link.PostID, link.CategoryID, now); err != nil {
+			return fmt.Errorf("failed to link post %d to category %d: %v", link.PostID, link.CategoryID, err)
+		}
+	}
+	return nil
+}
+
+// nullID lets SQLite assign the ID when the fixture leaves it out
+func nullID(id int) interface{} {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
+
+func timeOrNow(t *time.Time) time.Time {
+	if t == nil {
+		return time.Now()
+	}
+	return *t
+}
@@ -0,0 +1,149 @@
+package fixtures
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"reflect"
+	"testing"
+
+	"lab04-backend/database"
+)
+
+func setupFixturesDB(t *testing.T) *sql.DB {
+	testDB := "./test_fixtures.db"
+	os.Remove(testDB)
+
+	db, err := database.InitDBWithConfig(&database.Config{
+		DatabasePath: testDB,
+		MaxOpenConns: 5,
+		MaxIdleConns: 1,
+	})
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	t.Cleanup(func() {
+		database.CloseDB(db)
+		os.Remove(testDB)
+	})
+	if err := database.RunMigrations(db); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+	return db
+}
+
+func countRows(t *testing.T, db *sql.DB, query string, args ...interface{}) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow(query, args...).Scan(&n); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	return n
+}
+
+func TestParse(t *testing.T) {
+	set, err := Parse([]byte(`{"users": [{"id": 7, "name": "Json", "email": "json@example.com"}]}`), "json")
+	if err != nil {
+		t.Fatalf("Parse(json) failed: %v", err)
+	}
+	if len(set.Users) != 1 || set.Users[0].ID != 7 {
+		t.Errorf("Parse(json) = %+v, want one user with id 7", set)
+	}
+
+	if _, err := Parse([]byte("users:\n  - nmae: typo\n"), "yaml"); err == nil {
+		t.Error("Parse(yaml) should reject unknown fields")
+	}
+	if _, err := Parse([]byte("users: []"), "toml"); err == nil {
+		t.Error("Parse should reject unknown formats")
+	}
+	if set, err := Parse(nil, "yaml"); err != nil || len(set.Users) != 0 {
+		t.Errorf("Parse(empty yaml) = %+v, %v, want an empty set", set, err)
+	}
+}
+
+func TestApply(t *testing.T) {
+	db := setupFixturesDB(t)
+	ctx := context.Background()
+
+	set, err := Apply(ctx, db, "testdata/blog.yaml", "testdata/extra.json")
+	if err != nil {
+		t.Fatalf("Apply() failed: %v", err)
+	}
+	if len(set.Posts) != 3 {
+		t.Errorf("Apply() loaded %d posts, want 3", len(set.Posts))
+	}
+
+	if n := countRows(t, db, "SELECT COUNT(*) FROM post_categories"); n != 3 {
+		t.Errorf("post_categories has %d rows, want 3", n)
+	}
+	if n := countRows(t, db, "SELECT COUNT(*) FROM post_revisions WHERE revision = 1"); n != 3 {
+		t.Errorf("post_revisions has %d first revisions, want 3", n)
+	}
+	if n := countRows(t, db, "SELECT COUNT(*) FROM posts WHERE status = 'review' AND publish_at IS NOT NULL AND NOT published"); n != 1 {
+		t.Errorf("found %d scheduled posts in review, want 1", n)
+	}
+	if n := countRows(t, db, "SELECT COUNT(*) FROM categories WHERE color = '#007bff' AND NOT active"); n != 1 {
+		t.Errorf("found %d inactive categories with the default color, want 1", n)
+	}
+
+	// Applying again replaces the data instead of conflicting with it
+	if _, err := Apply(ctx, db, "testdata/blog.yaml"); err != nil {
+		t.Fatalf("second Apply() failed: %v", err)
+	}
+	if n := countRows(t, db, "SELECT COUNT(*) FROM posts"); n != 2 {
+		t.Errorf("posts has %d rows after re-applying, want 2", n)
+	}
+
+	// Reset restarts the autoincrement counters
+	if err := Reset(ctx, db); err != nil {
+		t.Fatalf("Reset() failed: %v", err)
+	}
+	if err := Insert(ctx, db, &Set{Users: []User{{Name: "Fresh", Email: "fresh@example.com"}}}); err != nil {
+		t.Fatalf("Insert() failed: %v", err)
+	}
+	if n := countRows(t, db, "SELECT id FROM users WHERE email = ?", "fresh@example.com"); n != 1 {
+		t.Errorf("first user after Reset() has id %d, want 1", n)
+	}
+}
+
+func TestInsertRollsBackOnError(t *testing.T) {
+	db := setupFixturesDB(t)
+
+	err := Insert(context.Background(), db, &Set{
+		Users: []User{{ID: 1, Name: "Owner", Email: "owner@example.com"}},
+		Posts: []Post{{ID: 1, UserID: 42, Title: "Orphan"}},
+	})
+	if err == nil {
+		t.Fatal("Insert() should fail for a post of a missing user")
+	}
+	if n := countRows(t, db, "SELECT COUNT(*) FROM users"); n != 0 {
+		t.Errorf("users has %d rows after a failed Insert(), want 0", n)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	opts := GenerateOptions{Seed: 42, Users: 5, PostsPerUser: 4}
+	set := Generate(opts)
+	if !reflect.DeepEqual(set, Generate(opts)) {
+		t.Fatal("Generate() should be deterministic for equal options")
+	}
+	if reflect.DeepEqual(set.Posts, Generate(GenerateOptions{Seed: 43, Users: 5, PostsPerUser: 4}).Posts) {
+		t.Error("Generate() should vary with the seed")
+	}
+	if len(set.Users) != 5 || len(set.Posts) != 20 || len(set.Categories) != len(fakeTopics) {
+		t.Fatalf("Generate() = %d users, %d posts, %d categories", len(set.Users), len(set.Posts), len(set.Categories))
+	}
+
+	db := setupFixturesDB(t)
+	if err := Insert(context.Background(), db, set); err != nil {
+		t.Fatalf("Insert(generated) failed: %v", err)
+	}
+	for userID := 1; userID <= 5; userID++ {
+		if n := countRows(t, db, "SELECT COUNT(*) FROM posts WHERE user_id = ?", userID); n != 4 {
+			t.Errorf("user %d has %d posts, want 4", userID, n)
+		}
+	}
+	if n := countRows(t, db, "SELECT COUNT(DISTINCT created_at) FROM posts"); n != 20 {
+		t.Errorf("generated posts share timestamps: %d distinct of 20", n)
+	}
+}
@@ -0,0 +1,138 @@
+package fixtures
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// GenerateEpoch is the created_at of the first generated row; later rows
+// are spaced a minute apart so keyset pagination sees distinct timestamps
+var GenerateEpoch = time.Date(2024, time.January, 1, 9, 0, 0, 0, time.UTC)
+
+// GenerateOptions sizes a generated data set
+type GenerateOptions struct {
+	// Seed makes the output reproducible; equal options give equal sets
+	Seed         int64
+	Users        int
+	PostsPerUser int
+	// Categories defaults to len(fakeTopics); each post is tagged with
+	// one or two of them
+	Categories int
+	// PublishedRatio is the share of published posts, 0.8 by default
+	PublishedRatio float64
+}
+
+var (
+	fakeFirstNames = []string{"Alice", "Bob", "Carol", "Dave", "Erin", "Frank", "Grace", "Heidi", "Ivan", "Judy", "Mallory", "Niaj", "Olivia", "Peggy", "Rupert", "Sybil", "Trent", "Victor", "Walter", "Yasmin"}
+	fakeLastNames  = []string{"Archer", "Baker", "Carter", "Dawson", "Ellis", "Fisher", "Garcia", "Hughes", "Ivanova", "Jensen", "Khan", "Lopez", "Moreau", "Novak", "Okafor", "Petrov", "Quinn", "Rossi", "Silva", "Tanaka"}
+	fakeTopics     = []string{"Golang", "Databases", "Flutter", "Testing", "Security", "Performance", "Design", "DevOps", "Networking", "Career"}
+	fakeWords      = []string{
+		"goroutines", "channels", "interfaces", "generics", "migrations", "indexes", "queries", "transactions",
+		"widgets", "layouts", "benchmarks", "profiling", "latency", "caching", "deployment", "containers",
+		"encryption", "tokens", "sessions", "schemas", "pipelines", "workers", "retries", "timeouts",
+		"simple", "fast", "reliable", "practical", "modern", "careful", "small", "robust",
+		"with", "and", "for", "the", "about", "using", "without", "in",
+	}
+	fakeTitlePatterns = []string{"Getting started with %s", "Advanced %s patterns", "%s in production", "Notes on %s", "Why %s matters", "Debugging %s"}
+	fakeColors        = []string{"#007bff", "#28a745", "#dc3545", "#ffc107", "#17a2b8", "#6f42c1", "#fd7e14", "#20c997", "#e83e8c", "#6c757d"}
+)
+
+// Generate builds a deterministic fake data set of opts.Users users with
+// opts.PostsPerUser posts each, for load testing searches and pagination.
+// IDs are assigned from 1, so the set must be inserted after Reset.
+func Generate(opts GenerateOptions) *Set {
+	rng := rand.New(rand.NewSource(opts.Seed))
+	categories := opts.Categories
+	if categories <= 0 || categories > len(fakeTopics) {
+		categories = len(fakeTopics)
+	}
+	publishedRatio := opts.PublishedRatio
+	if publishedRatio == 0 {
+		publishedRatio = 0.8
+	}
+
+	set := &Set{
+		Users:      make([]User, 0, opts.Users),
+		Categories: make([]Category, 0, categories),
+		Posts:      make([]Post, 0, opts.Users*opts.PostsPerUser),
+	}
+
+	clock := GenerateEpoch
+	tick := func() *time.Time {
+		t := clock
+		clock = clock.Add(time.Minute)
+		return &t
+	}
+
+	for i := 0; i < categories; i++ {
+		set.Categories = append(set.Categories, Category{
+			ID:          uint(i + 1),
+			Name:        fakeTopics[i],
+			Description: fmt.Sprintf("Posts about %s", strings.ToLower(fakeTopics[i])),
+			Color:       fakeColors[i%len(fakeColors)],
+			CreatedAt:   tick(),
+		})
+	}
+
+	for i := 0; i < opts.Users; i++ {
+		first := fakeFirstNames[rng.Intn(len(fakeFirstNames))]
+		last := fakeLastNames[rng.Intn(len(fakeLastNames))]
+		set.Users = append(set.Users, User{
+			ID:        i + 1,
+			Name:      first + " " + last,
+			Email:     fmt.Sprintf("%s.%s.%d@example.com", strings.ToLower(first), strings.ToLower(last), i+1),
+			CreatedAt: tick(),
+		})
+	}
+
+	// Interleave authors so posts of one user are spread over time
+	for p := 0; p < opts.PostsPerUser; p++ {
+		for u := 0; u < opts.Users; u++ {
+			topic := rng.Intn(categories)
+			post := Post{
+				ID:          len(set.Posts) + 1,
+				UserID:      u + 1,
+				Title:       fmt.Sprintf(fakeTitlePatterns[rng.Intn(len(fakeTitlePatterns))], fakeTopics[topic]),
+				Content:     fakeContent(rng, fakeTopics[topic]),
+				Published:   rng.Float64() < publishedRatio,
+				CreatedAt:   tick(),
+				CategoryIDs: []uint{uint(topic + 1)},
+			}
+			if extra := rng.Intn(categories); extra != topic && rng.Intn(2) == 0 {
+				post.CategoryIDs = append(post.CategoryIDs, uint(extra+1))
+			}
+			set.Posts = append(set.Posts, post)
+		}
+	}
+
+	return set
+}
+
+// fakeContent writes a few sentences mentioning the topic
+func fakeContent(rng *rand.Rand, topic string) string {
+	sentences := 2 + rng.Intn(4)
+	var b strings.Builder
+	for s := 0; s < sentences; s++ {
+		if s > 0 {
+			b.WriteString(" ")
+		}
+		words := 6 + rng.Intn(8)
+		mention := rng.Intn(words)
+		for w := 0; w < words; w++ {
+			word := fakeWords[rng.Intn(len(fakeWords))]
+			if w == mention {
+				word = strings.ToLower(topic)
+			}
+			if w == 0 {
+				word = strings.ToUpper(word[:1]) + word[1:]
+			} else {
+				b.WriteString(" ")
+			}
+			b.WriteString(word)
+		}
+		b.WriteString(".")
+	}
+	return b.String()
+}
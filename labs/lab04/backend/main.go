@@ -1,9 +1,14 @@
 package main
 
 import (
-	"fmt"
+	"context"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
 
+	"lab04-backend/api"
 	"lab04-backend/database"
 	"lab04-backend/repository"
 
@@ -11,27 +16,92 @@ import (
 )
 
 func main() {
-	// TODO: Initialize database connection
-	db, err := database.InitDB()
+	// Log slow statements and collect per-query latency histograms
+	config := database.DefaultConfig()
+	config.Instrumentation = database.NewInstrumentation(100 * time.Millisecond)
+
+	db, err := database.InitDBWithConfig(config)
 	if err != nil {
 		log.Fatal("Failed to initialize database:", err)
 	}
 	defer db.Close()
 
-	// TODO: Run migrations (using goose-based approach)
 	if err := database.RunMigrations(db); err != nil {
 		log.Fatal("Failed to run migrations:", err)
 	}
 
-	// TODO: Create repository instances
-	userRepo := repository.NewUserRepository(db)
-	postRepo := repository.NewPostRepository(db)
+	// The search index needs the sqlite_fts5 build tag; without it search
+	// silently degrades to LIKE matching, so say so
+	fts5, err := database.FTS5Available(db)
+	if err != nil {
+		log.Fatal("Failed to check FTS5 support:", err)
+	}
+	if !fts5 {
+		if os.Getenv("LAB04_REQUIRE_FTS5") == "1" {
+			log.Fatal("SQLite was built without FTS5; build with -tags sqlite_fts5")
+		}
+		log.Print("WARNING: SQLite was built without FTS5 (build with -tags sqlite_fts5); post search falls back to unranked LIKE matching, " +
+			"and this database can no longer be opened by this build once an FTS5 build has migrated it")
+	}
+
+	gormDB, err := database.InitGORM(db)
+	if err != nil {
+		log.Fatal("Failed to initialize GORM:", err)
+	}
+
+	// Every repository query is bounded by config.QueryTimeout
+	withConfig := repository.WithConfig(config)
+	posts := repository.NewPostRepository(db, withConfig)
+	handler := api.NewHandler(
+		repository.NewUserRepository(db, withConfig),
+		posts,
+		repository.NewCategoryRepository(gormDB, withConfig),
+		repository.NewSearchService(db, withConfig),
+	)
 
-	// Demo operations
-	fmt.Println("Database initialized successfully!")
-	fmt.Printf("User repository: %T\n", userRepo)
-	fmt.Printf("Post repository: %T\n", postRepo)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
 
-	// TODO: Add some demo data operations here
-	// You can test your CRUD operations
+	// Publish posts scheduled with publish_at in the background
+	go repository.NewPublisher(posts, repository.DefaultPublishInterval).Run(ctx)
+
+	router := handler.SetupRoutes()
+
+	// Query histograms expose statement shapes, so they are only served on
+	// a separate listener that must be enabled, e.g. LAB04_DEBUG_ADDR=127.0.0.1:6060
+	if addr := os.Getenv("LAB04_DEBUG_ADDR"); addr != "" {
+		debugMux := http.NewServeMux()
+		debugMux.Handle("GET /debug/queries", config.Instrumentation.Metrics)
+		debugServer := &http.Server{Addr: addr, Handler: debugMux, ReadTimeout: 15 * time.Second}
+		go func() {
+			<-ctx.Done()
+			debugServer.Close()
+		}()
+		go func() {
+			log.Printf("Query metrics served on http://%s/debug/queries", addr)
+			if err := debugServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Print("Debug server failed: ", err)
+			}
+		}()
+	}
+
+	server := &http.Server{
+		Addr:         ":8080",
+		Handler:      router,
+		ReadTimeout:  15 * time.Second,
+		WriteTimeout: 15 * time.Second,
+		IdleTimeout:  60 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("Blog API listening on %s", server.Addr)
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Fatal("Server failed:", err)
+	}
 }
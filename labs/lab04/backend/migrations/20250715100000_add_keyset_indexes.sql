@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Composite indexes backing keyset pagination on (created_at, id)
+CREATE INDEX idx_users_created_at_id ON users(created_at, id);
+CREATE INDEX idx_posts_created_at_id ON posts(created_at, id);
+CREATE INDEX idx_posts_user_id_created_at_id ON posts(user_id, created_at, id);
+CREATE INDEX idx_posts_published_created_at_id ON posts(published, created_at, id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+-- Drop the keyset pagination indexes
+DROP INDEX IF EXISTS idx_posts_published_created_at_id;
+DROP INDEX IF EXISTS idx_posts_user_id_created_at_id;
+DROP INDEX IF EXISTS idx_posts_created_at_id;
+DROP INDEX IF EXISTS idx_users_created_at_id;
+-- +goose StatementEnd
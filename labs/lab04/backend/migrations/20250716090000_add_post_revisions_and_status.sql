@@ -0,0 +1,38 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Workflow status and scheduled publishing for posts
+ALTER TABLE posts ADD COLUMN status VARCHAR(20) NOT NULL DEFAULT 'draft'
+    CHECK (status IN ('draft', 'review', 'published'));
+ALTER TABLE posts ADD COLUMN publish_at DATETIME NULL;
+UPDATE posts SET status = CASE WHEN published THEN 'published' ELSE 'draft' END;
+
+-- Create index for the scheduled publisher
+CREATE INDEX idx_posts_status_publish_at ON posts(status, publish_at);
+
+-- Create post_revisions table recording every edit of title and content
+CREATE TABLE post_revisions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    post_id INTEGER NOT NULL,
+    revision INTEGER NOT NULL,
+    title VARCHAR(200) NOT NULL,
+    content TEXT,
+    author_id INTEGER NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (post_id, revision),
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+    FOREIGN KEY (author_id) REFERENCES users(id) ON DELETE SET NULL
+);
+
+-- Existing posts start with their current text as revision 1
+INSERT INTO post_revisions (post_id, revision, title, content, author_id, created_at)
+SELECT id, 1, title, COALESCE(content, ''), user_id, updated_at FROM posts;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+-- Drop the revisions table and the workflow columns
+DROP TABLE post_revisions;
+DROP INDEX IF EXISTS idx_posts_status_publish_at;
+ALTER TABLE posts DROP COLUMN publish_at;
+ALTER TABLE posts DROP COLUMN status;
+-- +goose StatementEnd
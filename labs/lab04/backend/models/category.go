@@ -1,6 +1,9 @@
 package models
 
 import (
+	"errors"
+	"regexp"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
@@ -37,91 +40,144 @@ type UpdateCategoryRequest struct {
 	Active      *bool   `json:"active,omitempty"`
 }
 
-// TODO: Implement GORM model methods and hooks
+// DefaultCategoryColor is used when a category is created without a color
+const DefaultCategoryColor = "#007bff"
+
+var hexColorRegex = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
 
 // TableName specifies the table name for GORM (optional - GORM auto-infers)
 func (Category) TableName() string {
 	return "categories"
 }
 
-// TODO: Implement BeforeCreate hook
+// BeforeCreate validates the category and fills in defaults
 func (c *Category) BeforeCreate(tx *gorm.DB) error {
-	// TODO: GORM BeforeCreate hook
-	// - Validate data before creation
-	// - Set default values
-	// - Perform any pre-creation logic
-	// Example: if c.Color == "" { c.Color = "#007bff" }
-	return nil
+	c.Name = strings.TrimSpace(c.Name)
+	if c.Color == "" {
+		c.Color = DefaultCategoryColor
+	}
+	return validateCategoryFields(c.Name, c.Description, c.Color)
 }
 
-// TODO: Implement AfterCreate hook
+// AfterCreate is a no-op hook kept as an extension point
 func (c *Category) AfterCreate(tx *gorm.DB) error {
-	// TODO: GORM AfterCreate hook
-	// - Log creation
-	// - Send notifications
-	// - Update cache
-	// Example: log.Printf("Category created: %s", c.Name)
 	return nil
 }
 
-// TODO: Implement BeforeUpdate hook
+// BeforeUpdate validates the category before it is saved
 func (c *Category) BeforeUpdate(tx *gorm.DB) error {
-	// TODO: GORM BeforeUpdate hook
-	// - Validate changes
-	// - Prevent certain updates
-	// - Clean up related data
-	return nil
+	if c.Name == "" {
+		// Partial updates through Updates() leave the struct empty
+		return nil
+	}
+	return validateCategoryFields(c.Name, c.Description, c.Color)
 }
 
-// TODO: Implement Validate method for CreateCategoryRequest
+// Validate checks the create request fields
 func (req *CreateCategoryRequest) Validate() error {
-	// TODO: Add validation logic for GORM model
-	// - Name should be unique (checked at database level via GORM)
-	// - Color should be valid hex color
-	// - Description should not exceed limits
-	// Example using validator package:
-	// return validator.New().Struct(req)
+	return validateCategoryFields(req.Name, req.Description, req.Color)
+}
+
+// Validate checks only the fields present in the update request
+func (req *UpdateCategoryRequest) Validate() error {
+	if req.Name != nil {
+		if err := validateCategoryName(*req.Name); err != nil {
+			return err
+		}
+	}
+	if req.Description != nil {
+		if err := validateCategoryDescription(*req.Description); err != nil {
+			return err
+		}
+	}
+	if req.Color != nil {
+		return validateCategoryColor(*req.Color)
+	}
 	return nil
 }
 
-// TODO: Implement ToCategory method
+// ApplyTo copies the fields present in the update request onto c
+func (req *UpdateCategoryRequest) ApplyTo(c *Category) {
+	if req.Name != nil {
+		c.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Description != nil {
+		c.Description = *req.Description
+	}
+	if req.Color != nil {
+		c.Color = *req.Color
+	}
+	if req.Active != nil {
+		c.Active = *req.Active
+	}
+}
+
+// ToCategory converts the request to an active Category
 func (req *CreateCategoryRequest) ToCategory() *Category {
-	// TODO: Convert request to GORM model
-	// - Map fields from request to model
-	// - Set default values
-	// Example:
-	// return &Category{
-	//     Name:        req.Name,
-	//     Description: req.Description,
-	//     Color:       req.Color,
-	//     Active:      true,
-	// }
-	return nil
+	return &Category{
+		Name:        strings.TrimSpace(req.Name),
+		Description: req.Description,
+		Color:       req.Color,
+		Active:      true,
+	}
 }
 
-// TODO: Implement GORM scopes (reusable query logic)
+// ActiveCategories is a GORM scope for active categories
 func ActiveCategories(db *gorm.DB) *gorm.DB {
-	// TODO: GORM scope for active categories
-	// return db.Where("active = ?", true)
-	return db
+	return db.Where("active = ?", true)
 }
 
+// CategoriesWithPosts is a GORM scope for categories tagged on at least
+// one post that is not soft-deleted and whose author is not either
 func CategoriesWithPosts(db *gorm.DB) *gorm.DB {
-	// TODO: GORM scope for categories with posts
-	// return db.Joins("Posts").Where("posts.id IS NOT NULL")
-	return db
+	return db.Where("EXISTS (SELECT 1 FROM post_categories JOIN posts ON posts.id = post_categories.post_id " +
+		"WHERE post_categories.category_id = categories.id AND posts.deleted_at IS NULL AND " + ActiveAuthorCondition + ")")
 }
 
-// TODO: Implement model validation methods
+// IsActive reports whether the category is active
 func (c *Category) IsActive() bool {
-	// TODO: Check if category is active
 	return c.Active
 }
 
+// PostCount returns the number of posts in this category, not counting
+// soft-deleted posts or the posts of soft-deleted users
 func (c *Category) PostCount(db *gorm.DB) (int64, error) {
-	// TODO: Get post count for this category using GORM association
-	// var count int64
-	// err := db.Model(c).Association("Posts").Count(&count)
-	// return count, err
-	return 0, nil
+	var count int64
+	err := db.Table("post_categories").
+		Joins("JOIN posts ON posts.id = post_categories.post_id").
+		Where("post_categories.category_id = ? AND posts.deleted_at IS NULL AND "+ActiveAuthorCondition, c.ID).
+		Count(&count).Error
+	return count, err
+}
+
+func validateCategoryFields(name, description, color string) error {
+	if err := validateCategoryName(name); err != nil {
+		return err
+	}
+	if err := validateCategoryDescription(description); err != nil {
+		return err
+	}
+	return validateCategoryColor(color)
+}
+
+func validateCategoryName(name string) error {
+	name = strings.TrimSpace(name)
+	if len(name) < 2 || len(name) > 100 {
+		return errors.New("name must be between 2 and 100 characters")
+	}
+	return nil
+}
+
+func validateCategoryDescription(description string) error {
+	if len(description) > 500 {
+		return errors.New("description must not exceed 500 characters")
+	}
+	return nil
+}
+
+func validateCategoryColor(color string) error {
+	if color != "" && !hexColorRegex.MatchString(color) {
+		return errors.New("color must be a hex color like #1a2b3c")
+	}
+	return nil
 }
@@ -2,6 +2,8 @@ package models
 
 import (
 	"database/sql"
+	"errors"
+	"strings"
 	"time"
 )
 
@@ -14,60 +16,114 @@ type Post struct {
 	Published bool      `json:"published" db:"published"`
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+	// DeletedAt is set when the post is soft-deleted
+	DeletedAt *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
+	// Status is the workflow state; Published mirrors Status == PostPublished
+	Status PostStatus `json:"status" db:"status"`
+	// PublishAt schedules a post in review for automatic publishing
+	PublishAt *time.Time `json:"publish_at,omitempty" db:"publish_at"`
+
+	// Categories is only filled in when loaded explicitly, for example by
+	// CategoryRepository.LoadForPosts
+	Categories []Category `json:"categories,omitempty" db:"-" gorm:"many2many:post_categories;"`
 }
 
+// ActiveAuthorCondition is an SQL condition on posts that hides the posts
+// of soft-deleted users
+const ActiveAuthorCondition = "posts.user_id IN (SELECT id FROM users WHERE deleted_at IS NULL)"
+
 // CreatePostRequest represents the payload for creating a post
 type CreatePostRequest struct {
-	UserID    int    `json:"user_id"`
-	Title     string `json:"title"`
-	Content   string `json:"content"`
-	Published bool   `json:"published"`
+	UserID  int    `json:"user_id"`
+	Title   string `json:"title"`
+	Content string `json:"content"`
+	// A true Published is rejected with ErrInvalidTransition: new posts
+	// start as drafts and must go through review
+	Published bool `json:"published"`
 }
 
 // UpdatePostRequest represents the payload for updating a post
 type UpdatePostRequest struct {
-	Title     *string `json:"title,omitempty"`
-	Content   *string `json:"content,omitempty"`
-	Published *bool   `json:"published,omitempty"`
+	Title   *string `json:"title,omitempty"`
+	Content *string `json:"content,omitempty"`
+	// Published moves the post to published or back to draft, subject to
+	// the workflow transitions
+	Published *bool `json:"published,omitempty"`
+	// EditorID is recorded as the author of the revision; defaults to the
+	// post owner. It is set by the server, never from the request body.
+	EditorID *int `json:"-"`
+}
+
+// IsDeleted reports whether the post has been soft-deleted
+func (p *Post) IsDeleted() bool {
+	return p.DeletedAt != nil
 }
 
-// TODO: Implement Validate method for Post
+// Validate checks the post fields
 func (p *Post) Validate() error {
-	// TODO: Add validation logic
-	// - Title should not be empty and should be at least 5 characters
-	// - Content should not be empty if published is true
-	// - UserID should be greater than 0
-	// Return appropriate errors if validation fails
-	return nil
+	return validatePostFields(p.UserID, p.Title, p.Content, p.Published)
 }
 
-// TODO: Implement Validate method for CreatePostRequest
+// Validate checks the create request fields
 func (req *CreatePostRequest) Validate() error {
-	// TODO: Add validation logic
-	// - Title should not be empty and should be at least 5 characters
-	// - UserID should be greater than 0
-	// - Content should not be empty if published is true
-	// Return appropriate errors if validation fails
-	return nil
+	return validatePostFields(req.UserID, req.Title, req.Content, req.Published)
 }
 
-// TODO: Implement ToPost method for CreatePostRequest
+// ToPost converts CreatePostRequest to Post with current timestamps
 func (req *CreatePostRequest) ToPost() *Post {
-	// TODO: Convert CreatePostRequest to Post
-	// Set timestamps to current time
-	return nil
+	now := time.Now()
+	return &Post{
+		UserID:    req.UserID,
+		Title:     req.Title,
+		Content:   req.Content,
+		Published: req.Published,
+		Status:    StatusForPublished(req.Published),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
 }
 
-// TODO: Implement ScanRow method for Post
+// ScanRow scans a single posts row (id, user_id, title, content, published,
+// created_at, updated_at, deleted_at, status, publish_at)
 func (p *Post) ScanRow(row *sql.Row) error {
-	// TODO: Scan database row into Post struct
-	// Handle the case where row might be nil
-	return nil
+	if row == nil {
+		return errors.New("row cannot be nil")
+	}
+	return row.Scan(&p.ID, &p.UserID, &p.Title, &p.Content, &p.Published, &p.CreatedAt, &p.UpdatedAt, &p.DeletedAt, &p.Status, &p.PublishAt)
 }
 
-// TODO: Implement ScanRows method for Post slice
+// ScanPosts scans all rows into a Post slice and closes rows
 func ScanPosts(rows *sql.Rows) ([]Post, error) {
-	// TODO: Scan multiple database rows into Post slice
-	// Make sure to close rows and handle errors properly
-	return nil, nil
+	defer rows.Close()
+
+	posts := make([]Post, 0)
+	for rows.Next() {
+		var p Post
+		if err := rows.Scan(&p.ID, &p.UserID, &p.Title, &p.Content, &p.Published, &p.CreatedAt, &p.UpdatedAt, &p.DeletedAt, &p.Status, &p.PublishAt); err != nil {
+			return nil, err
+		}
+		posts = append(posts, p)
+	}
+	return posts, rows.Err()
+}
+
+// Validate checks only the fields present in the update request
+func (req *UpdatePostRequest) Validate() error {
+	if req.Title != nil && len(strings.TrimSpace(*req.Title)) < 5 {
+		return errors.New("title must be at least 5 characters")
+	}
+	return nil
+}
+
+func validatePostFields(userID int, title, content string, published bool) error {
+	if userID <= 0 {
+		return errors.New("user_id must be greater than 0")
+	}
+	if len(strings.TrimSpace(title)) < 5 {
+		return errors.New("title must be at least 5 characters")
+	}
+	if published && strings.TrimSpace(content) == "" {
+		return errors.New("content is required for published posts")
+	}
+	return nil
 }
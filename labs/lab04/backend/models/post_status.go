@@ -0,0 +1,63 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+)
+
+// PostStatus is the editorial workflow state of a post
+type PostStatus string
+
+// Post workflow states. A post moves draft → review → published and may be
+// sent back to draft from review or published.
+const (
+	PostDraft     PostStatus = "draft"
+	PostReview    PostStatus = "review"
+	PostPublished PostStatus = "published"
+)
+
+// ErrInvalidTransition is returned when a status change is not allowed
+var ErrInvalidTransition = errors.New("invalid status transition")
+
+// postTransitions lists the allowed target states for each state
+var postTransitions = map[PostStatus][]PostStatus{
+	PostDraft:     {PostReview},
+	PostReview:    {PostDraft, PostPublished},
+	PostPublished: {PostDraft},
+}
+
+// Valid reports whether s is a known status
+func (s PostStatus) Valid() bool {
+	_, ok := postTransitions[s]
+	return ok
+}
+
+// CanTransitionTo reports whether a post in status s may move to next
+func (s PostStatus) CanTransitionTo(next PostStatus) bool {
+	for _, allowed := range postTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckTransition returns ErrInvalidTransition, wrapped with both states,
+// if s may not move to next
+func (s PostStatus) CheckTransition(next PostStatus) error {
+	if !next.Valid() {
+		return fmt.Errorf("%w: unknown status %q", ErrInvalidTransition, next)
+	}
+	if !s.CanTransitionTo(next) {
+		return fmt.Errorf("%w: %s to %s", ErrInvalidTransition, s, next)
+	}
+	return nil
+}
+
+// StatusForPublished maps the legacy Published flag to a status
+func StatusForPublished(published bool) PostStatus {
+	if published {
+		return PostPublished
+	}
+	return PostDraft
+}
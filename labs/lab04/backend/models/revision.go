@@ -0,0 +1,147 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// PostRevision is a snapshot of a post's title and content after an edit
+type PostRevision struct {
+	ID       int    `json:"id" db:"id"`
+	PostID   int    `json:"post_id" db:"post_id"`
+	Revision int    `json:"revision" db:"revision"`
+	Title    string `json:"title" db:"title"`
+	Content  string `json:"content" db:"content"`
+	// AuthorID is nil once the author's account has been removed
+	AuthorID  *int      `json:"author_id,omitempty" db:"author_id"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// DiffOp marks a diff line as kept, inserted or deleted
+type DiffOp string
+
+// Diff operations, in unified diff notation
+const (
+	DiffEqual  DiffOp = "="
+	DiffInsert DiffOp = "+"
+	DiffDelete DiffOp = "-"
+)
+
+// DiffLine is one line of a line-based diff
+type DiffLine struct {
+	Op   DiffOp `json:"op"`
+	Text string `json:"text"`
+}
+
+// RevisionDiff describes the changes between two revisions of a post
+type RevisionDiff struct {
+	PostID  int        `json:"post_id"`
+	From    int        `json:"from"`
+	To      int        `json:"to"`
+	Title   []DiffLine `json:"title"`
+	Content []DiffLine `json:"content"`
+}
+
+// ErrDiffTooLarge is returned when the changed parts of two texts have
+// too many lines to compare
+var ErrDiffTooLarge = errors.New("revisions differ in too many lines to diff")
+
+// maxDiffCells bounds the LCS table of DiffLines, 4M cells or 32 MiB.
+// Lines shared at the start or end of both texts do not count.
+const maxDiffCells = 1 << 22
+
+// DiffRevisions compares the title and content of two revisions line by line
+func DiffRevisions(from, to *PostRevision) (*RevisionDiff, error) {
+	title, err := DiffLines(from.Title, to.Title)
+	if err != nil {
+		return nil, err
+	}
+	content, err := DiffLines(from.Content, to.Content)
+	if err != nil {
+		return nil, err
+	}
+	return &RevisionDiff{
+		PostID:  to.PostID,
+		From:    from.Revision,
+		To:      to.Revision,
+		Title:   title,
+		Content: content,
+	}, nil
+}
+
+// DiffLines returns the shortest line-based edit script turning a into b,
+// computed from the longest common subsequence of lines. It returns
+// ErrDiffTooLarge rather than compare changed regions of more than
+// maxDiffCells line pairs.
+func DiffLines(a, b string) ([]DiffLine, error) {
+	x, y := splitLines(a), splitLines(b)
+
+	// An edit usually touches a few lines in the middle, so the lines
+	// both texts start and end with are kept without building the table
+	prefix := 0
+	for prefix < len(x) && prefix < len(y) && x[prefix] == y[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(x)-prefix && suffix < len(y)-prefix && x[len(x)-1-suffix] == y[len(y)-1-suffix] {
+		suffix++
+	}
+	head, tail := x[:prefix], x[len(x)-suffix:]
+	x, y = x[prefix:len(x)-suffix], y[prefix:len(y)-suffix]
+	if len(x) > 0 && len(y) > maxDiffCells/len(x) {
+		return nil, ErrDiffTooLarge
+	}
+
+	// lcs[i][j] is the LCS length of x[i:] and y[j:]
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	diff := make([]DiffLine, 0, len(head)+len(x)+len(y)+len(tail))
+	for _, line := range head {
+		diff = append(diff, DiffLine{Op: DiffEqual, Text: line})
+	}
+	i, j := 0, 0
+	for i < len(x) && j < len(y) {
+		switch {
+		case x[i] == y[j]:
+			diff = append(diff, DiffLine{Op: DiffEqual, Text: x[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			diff = append(diff, DiffLine{Op: DiffDelete, Text: x[i]})
+			i++
+		default:
+			diff = append(diff, DiffLine{Op: DiffInsert, Text: y[j]})
+			j++
+		}
+	}
+	for ; i < len(x); i++ {
+		diff = append(diff, DiffLine{Op: DiffDelete, Text: x[i]})
+	}
+	for ; j < len(y); j++ {
+		diff = append(diff, DiffLine{Op: DiffInsert, Text: y[j]})
+	}
+	for _, line := range tail {
+		diff = append(diff, DiffLine{Op: DiffEqual, Text: line})
+	}
+	return diff, nil
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want []DiffLine
+	}{
+		{
+			name: "identical",
+			a:    "one\ntwo\n",
+			b:    "one\ntwo",
+			want: []DiffLine{{DiffEqual, "one"}, {DiffEqual, "two"}},
+		},
+		{
+			name: "from empty",
+			a:    "",
+			b:    "one",
+			want: []DiffLine{{DiffInsert, "one"}},
+		},
+		{
+			name: "change in the middle",
+			a:    "one\ntwo\nthree\nfour",
+			b:    "one\n2\nthree\nthree and a half\nfour",
+			want: []DiffLine{
+				{DiffEqual, "one"},
+				{DiffDelete, "two"},
+				{DiffInsert, "2"},
+				{DiffEqual, "three"},
+				{DiffInsert, "three and a half"},
+				{DiffEqual, "four"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DiffLines(tt.a, tt.b)
+			if err != nil {
+				t.Fatalf("DiffLines() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DiffLines() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffLines_TooLarge(t *testing.T) {
+	lines := func(prefix string, n int) string {
+		var b strings.Builder
+		for i := 0; i < n; i++ {
+			b.WriteString(prefix)
+			b.WriteString(strings.Repeat("x", i%7))
+			b.WriteString("\n")
+		}
+		return b.String()
+	}
+
+	// Shared lines around a small edit do not count towards the limit
+	shared := lines("same", 10000)
+	diff, err := DiffLines(shared+"old\n"+shared, shared+"new\n"+shared)
+	if err != nil {
+		t.Fatalf("DiffLines() of a small edit error = %v", err)
+	}
+	if len(diff) != 20002 {
+		t.Errorf("DiffLines() returned %d lines, want 20002", len(diff))
+	}
+
+	if _, err := DiffLines(lines("a", 3000), lines("b", 3000)); !errors.Is(err, ErrDiffTooLarge) {
+		t.Errorf("DiffLines() of a rewrite error = %v, want ErrDiffTooLarge", err)
+	}
+}
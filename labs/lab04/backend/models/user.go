@@ -2,6 +2,9 @@ package models
 
 import (
 	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
 	"time"
 )
 
@@ -12,8 +15,13 @@ type User struct {
 	Email     string    `json:"email" db:"email"`
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+	// DeletedAt is set when the user is soft-deleted
+	DeletedAt *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
 }
 
+// emailRegex is a pragmatic check for the email format
+var emailRegex = regexp.MustCompile(`^[a-zA-Z0-9._%+\-]+@[a-zA-Z0-9.\-]+\.[a-zA-Z]{2,}$`)
+
 // CreateUserRequest represents the payload for creating a user
 type CreateUserRequest struct {
 	Name  string `json:"name"`
@@ -26,41 +34,75 @@ type UpdateUserRequest struct {
 	Email *string `json:"email,omitempty"`
 }
 
-// TODO: Implement Validate method for User
+// IsDeleted reports whether the user has been soft-deleted
+func (u *User) IsDeleted() bool {
+	return u.DeletedAt != nil
+}
+
+// Validate checks the user name and email
 func (u *User) Validate() error {
-	// TODO: Add validation logic
-	// - Name should not be empty and should be at least 2 characters
-	// - Email should be valid format
-	// Return appropriate errors if validation fails
-	return nil
+	return validateUserFields(u.Name, u.Email)
 }
 
-// TODO: Implement Validate method for CreateUserRequest
+// Validate checks the create request fields
 func (req *CreateUserRequest) Validate() error {
-	// TODO: Add validation logic
-	// - Name should not be empty and should be at least 2 characters
-	// - Email should be valid format and not empty
-	// Return appropriate errors if validation fails
-	return nil
+	return validateUserFields(req.Name, req.Email)
 }
 
-// TODO: Implement ToUser method for CreateUserRequest
+// ToUser converts CreateUserRequest to User with current timestamps
 func (req *CreateUserRequest) ToUser() *User {
-	// TODO: Convert CreateUserRequest to User
-	// Set timestamps to current time
-	return nil
+	now := time.Now()
+	return &User{
+		Name:      req.Name,
+		Email:     req.Email,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
 }
 
-// TODO: Implement ScanRow method for User
+// ScanRow scans a single users row (id, name, email, created_at, updated_at, deleted_at)
 func (u *User) ScanRow(row *sql.Row) error {
-	// TODO: Scan database row into User struct
-	// Handle the case where row might be nil
-	return nil
+	if row == nil {
+		return errors.New("row cannot be nil")
+	}
+	return row.Scan(&u.ID, &u.Name, &u.Email, &u.CreatedAt, &u.UpdatedAt, &u.DeletedAt)
 }
 
-// TODO: Implement ScanRows method for User slice
+// ScanUsers scans all rows into a User slice and closes rows
 func ScanUsers(rows *sql.Rows) ([]User, error) {
-	// TODO: Scan multiple database rows into User slice
-	// Make sure to close rows and handle errors properly
-	return nil, nil
+	defer rows.Close()
+
+	users := make([]User, 0)
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.ID, &u.Name, &u.Email, &u.CreatedAt, &u.UpdatedAt, &u.DeletedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// Validate checks only the fields present in the update request
+func (req *UpdateUserRequest) Validate() error {
+	if req.Name != nil && len(strings.TrimSpace(*req.Name)) < 2 {
+		return errors.New("name must be at least 2 characters")
+	}
+	if req.Email != nil && !emailRegex.MatchString(*req.Email) {
+		return errors.New("invalid email format")
+	}
+	return nil
+}
+
+func validateUserFields(name, email string) error {
+	if len(strings.TrimSpace(name)) < 2 {
+		return errors.New("name must be at least 2 characters")
+	}
+	if email == "" {
+		return errors.New("email is required")
+	}
+	if !emailRegex.MatchString(email) {
+		return errors.New("invalid email format")
+	}
+	return nil
 }
@@ -1,8 +1,10 @@
 package repository
 
 import (
-	"fmt"
+	"context"
+	"time"
 
+	"lab04-backend/database"
 	"lab04-backend/models"
 
 	"gorm.io/gorm"
@@ -11,157 +13,386 @@ import (
 // CategoryRepository handles database operations for categories using GORM
 // This repository demonstrates GORM ORM approach for database operations
 type CategoryRepository struct {
-	db *gorm.DB
+	db           *gorm.DB
+	queryTimeout time.Duration
 }
 
 // NewCategoryRepository creates a new CategoryRepository with GORM
-func NewCategoryRepository(gormDB *gorm.DB) *CategoryRepository {
-	return &CategoryRepository{db: gormDB}
+func NewCategoryRepository(gormDB *gorm.DB, opts ...RepositoryOption) *CategoryRepository {
+	o := buildRepositoryOptions(opts)
+	return &CategoryRepository{db: gormDB, queryTimeout: o.queryTimeout}
 }
 
-// TODO: Implement Create method using GORM
+// session returns a GORM session bound to ctx with the query timeout applied
+func (r *CategoryRepository) session(ctx context.Context) (*gorm.DB, context.CancelFunc) {
+	ctx, cancel := database.WithQueryTimeout(ctx, r.queryTimeout)
+	return r.db.WithContext(ctx), cancel
+}
+
+// Create inserts a new category; GORM fills in ID and timestamps
 func (r *CategoryRepository) Create(category *models.Category) error {
-	// TODO: Create a new category using GORM
-	// - Use GORM's Create method: r.db.Create(category)
-	// - GORM automatically handles ID generation and timestamps
-	// - No need for manual SQL or RETURNING clauses
-	// Example: result := r.db.Create(category)
-	// return result.Error
-	//
-	// Notice how much simpler this is compared to manual SQL!
-	return fmt.Errorf("TODO: implement Create method with GORM")
-}
-
-// TODO: Implement GetByID method using GORM
+	return r.CreateContext(context.Background(), category)
+}
+
+// CreateContext is Create with a caller-supplied context
+func (r *CategoryRepository) CreateContext(ctx context.Context, category *models.Category) error {
+	db, cancel := r.session(ctx)
+	defer cancel()
+
+	return db.Create(category).Error
+}
+
+// GetByID returns the category or gorm.ErrRecordNotFound
 func (r *CategoryRepository) GetByID(id uint) (*models.Category, error) {
-	// TODO: Get category by ID using GORM
-	// - Use GORM's First method: r.db.First(&category, id)
-	// - GORM automatically generates the WHERE clause
-	// - Returns gorm.ErrRecordNotFound if not found
-	// Example:
-	// var category models.Category
-	// result := r.db.First(&category, id)
-	// return &category, result.Error
-	//
-	// Much cleaner than manual row scanning!
-	return nil, fmt.Errorf("TODO: implement GetByID method with GORM")
-}
-
-// TODO: Implement GetAll method using GORM
+	return r.GetByIDContext(context.Background(), id)
+}
+
+// GetByIDContext is GetByID with a caller-supplied context
+func (r *CategoryRepository) GetByIDContext(ctx context.Context, id uint) (*models.Category, error) {
+	db, cancel := r.session(ctx)
+	defer cancel()
+
+	var category models.Category
+	if err := db.First(&category, id).Error; err != nil {
+		return nil, err
+	}
+	return &category, nil
+}
+
+// GetAll returns all categories ordered by name
 func (r *CategoryRepository) GetAll() ([]models.Category, error) {
-	// TODO: Get all categories using GORM
-	// - Use GORM's Find method: r.db.Find(&categories)
-	// - GORM automatically handles the slice allocation
-	// - Can add Order() for sorting: r.db.Order("name").Find(&categories)
-	// Example:
-	// var categories []models.Category
-	// result := r.db.Order("name").Find(&categories)
-	// return categories, result.Error
-	return nil, fmt.Errorf("TODO: implement GetAll method with GORM")
-}
-
-// TODO: Implement Update method using GORM
+	return r.GetAllContext(context.Background())
+}
+
+// GetAllContext is GetAll with a caller-supplied context
+func (r *CategoryRepository) GetAllContext(ctx context.Context) ([]models.Category, error) {
+	db, cancel := r.session(ctx)
+	defer cancel()
+
+	var categories []models.Category
+	err := db.Order("name").Find(&categories).Error
+	return categories, err
+}
+
+// Update saves all fields of the category
 func (r *CategoryRepository) Update(category *models.Category) error {
-	// TODO: Update category using GORM
-	// - Use GORM's Save method: r.db.Save(category)
-	// - GORM automatically updates only changed fields
-	// - Handles updated_at timestamp automatically
-	// - Alternative: r.db.Model(category).Updates(updates)
-	//
-	// Example:
-	// result := r.db.Save(category)
-	// return result.Error
-	return fmt.Errorf("TODO: implement Update method with GORM")
-}
-
-// TODO: Implement Delete method using GORM
+	return r.UpdateContext(context.Background(), category)
+}
+
+// UpdateContext is Update with a caller-supplied context
+func (r *CategoryRepository) UpdateContext(ctx context.Context, category *models.Category) error {
+	db, cancel := r.session(ctx)
+	defer cancel()
+
+	return db.Save(category).Error
+}
+
+// Delete soft-deletes the category through its DeletedAt field
 func (r *CategoryRepository) Delete(id uint) error {
-	// TODO: Delete category using GORM
-	// - Use GORM's Delete method: r.db.Delete(&models.Category{}, id)
-	// - GORM can do soft delete if model has DeletedAt field
-	// - For hard delete: r.db.Unscoped().Delete(&models.Category{}, id)
-	//
-	// Example:
-	// result := r.db.Delete(&models.Category{}, id)
-	// return result.Error
-	return fmt.Errorf("TODO: implement Delete method with GORM")
-}
-
-// TODO: Implement FindByName method using GORM
+	return r.DeleteContext(context.Background(), id)
+}
+
+// DeleteContext is Delete with a caller-supplied context
+func (r *CategoryRepository) DeleteContext(ctx context.Context, id uint) error {
+	db, cancel := r.session(ctx)
+	defer cancel()
+
+	result := db.Delete(&models.Category{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// FindByName returns the category with an exact name match
 func (r *CategoryRepository) FindByName(name string) (*models.Category, error) {
-	// TODO: Find category by name using GORM
-	// - Use GORM's Where method: r.db.Where("name = ?", name).First(&category)
-	// - GORM handles SQL injection protection automatically
-	// - Can use struct for conditions: r.db.Where(&models.Category{Name: name}).First(&category)
-	//
-	// Example:
-	// var category models.Category
-	// result := r.db.Where("name = ?", name).First(&category)
-	// return &category, result.Error
-	return nil, fmt.Errorf("TODO: implement FindByName method with GORM")
-}
-
-// TODO: Implement SearchCategories method using GORM
+	return r.FindByNameContext(context.Background(), name)
+}
+
+// FindByNameContext is FindByName with a caller-supplied context
+func (r *CategoryRepository) FindByNameContext(ctx context.Context, name string) (*models.Category, error) {
+	db, cancel := r.session(ctx)
+	defer cancel()
+
+	var category models.Category
+	if err := db.Where("name = ?", name).First(&category).Error; err != nil {
+		return nil, err
+	}
+	return &category, nil
+}
+
+// SearchCategories returns categories whose name contains query
 func (r *CategoryRepository) SearchCategories(query string, limit int) ([]models.Category, error) {
-	// TODO: Search categories using GORM
-	// - Use GORM's Where with LIKE: r.db.Where("name LIKE ?", "%"+query+"%")
-	// - Add Limit: .Limit(limit)
-	// - Add Order: .Order("name")
-	//
-	// Example:
-	// var categories []models.Category
-	// result := r.db.Where("name LIKE ?", "%"+query+"%").
-	//               Order("name").
-	//               Limit(limit).
-	//               Find(&categories)
-	// return categories, result.Error
-	return nil, fmt.Errorf("TODO: implement SearchCategories method with GORM")
-}
-
-// TODO: Implement GetCategoriesWithPosts method using GORM associations
+	return r.SearchCategoriesContext(context.Background(), query, limit)
+}
+
+// SearchCategoriesContext is SearchCategories with a caller-supplied context
+func (r *CategoryRepository) SearchCategoriesContext(ctx context.Context, query string, limit int) ([]models.Category, error) {
+	db, cancel := r.session(ctx)
+	defer cancel()
+
+	var categories []models.Category
+	err := db.Where("name LIKE ?", "%"+query+"%").
+		Order("name").
+		Limit(limit).
+		Find(&categories).Error
+	return categories, err
+}
+
+// GetCategoriesWithPosts returns categories with their posts preloaded.
+// Soft-deleted posts and the posts of soft-deleted users are left out.
 func (r *CategoryRepository) GetCategoriesWithPosts() ([]models.Category, error) {
-	// TODO: Get categories with associated posts using GORM
-	// - Use GORM's Preload to load associations: r.db.Preload("Posts").Find(&categories)
-	// - GORM automatically handles the JOINs and relationships
-	// - Much simpler than manual JOIN queries!
-	//
-	// Example:
-	// var categories []models.Category
-	// result := r.db.Preload("Posts").Find(&categories)
-	// return categories, result.Error
-	//
-	// This assumes Category model has Posts relationship defined
-	return nil, fmt.Errorf("TODO: implement GetCategoriesWithPosts method with GORM Preload")
-}
-
-// TODO: Implement Count method using GORM
+	return r.GetCategoriesWithPostsContext(context.Background())
+}
+
+// GetCategoriesWithPostsContext is GetCategoriesWithPosts with a caller-supplied context
+func (r *CategoryRepository) GetCategoriesWithPostsContext(ctx context.Context) ([]models.Category, error) {
+	db, cancel := r.session(ctx)
+	defer cancel()
+
+	var categories []models.Category
+	err := db.Preload("Posts", "posts.deleted_at IS NULL AND "+models.ActiveAuthorCondition).Find(&categories).Error
+	return categories, err
+}
+
+// Count returns the number of categories
 func (r *CategoryRepository) Count() (int64, error) {
-	// TODO: Count categories using GORM
-	// - Use GORM's Count method: r.db.Model(&models.Category{}).Count(&count)
-	// - GORM returns int64 for count operations
-	//
-	// Example:
-	// var count int64
-	// result := r.db.Model(&models.Category{}).Count(&count)
-	// return count, result.Error
-	return 0, fmt.Errorf("TODO: implement Count method with GORM")
-}
-
-// TODO: Implement Transaction example using GORM
+	return r.CountContext(context.Background())
+}
+
+// CountContext is Count with a caller-supplied context
+func (r *CategoryRepository) CountContext(ctx context.Context) (int64, error) {
+	db, cancel := r.session(ctx)
+	defer cancel()
+
+	var count int64
+	err := db.Model(&models.Category{}).Count(&count).Error
+	return count, err
+}
+
+// CreateWithTransaction creates all categories or none
 func (r *CategoryRepository) CreateWithTransaction(categories []models.Category) error {
-	// TODO: Create multiple categories in a transaction using GORM
-	// - Use GORM's Transaction method: r.db.Transaction(func(tx *gorm.DB) error {...})
-	// - GORM automatically handles rollback on error
-	// - Much simpler than manual transaction management!
-	//
-	// Example:
-	// return r.db.Transaction(func(tx *gorm.DB) error {
-	//     for _, category := range categories {
-	//         if err := tx.Create(&category).Error; err != nil {
-	//             return err // GORM will rollback automatically
-	//         }
-	//     }
-	//     return nil // GORM will commit automatically
-	// })
-	return fmt.Errorf("TODO: implement CreateWithTransaction method with GORM")
+	return r.CreateWithTransactionContext(context.Background(), categories)
+}
+
+// CreateWithTransactionContext is CreateWithTransaction with a caller-supplied context.
+// The timeout covers the whole transaction rather than each insert.
+func (r *CategoryRepository) CreateWithTransactionContext(ctx context.Context, categories []models.Category) error {
+	db, cancel := r.session(ctx)
+	defer cancel()
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for i := range categories {
+			if err := tx.Create(&categories[i]).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// CategoryPostCount is a category with the number of posts tagged with it
+type CategoryPostCount struct {
+	models.Category
+	PostCount int64 `json:"post_count"`
+}
+
+// AttachCategories tags the post with the given categories. Categories
+// the post already has are left as they are.
+// gorm.ErrRecordNotFound is returned if the post or any category does not
+// exist or is soft-deleted.
+func (r *CategoryRepository) AttachCategories(postID int, categoryIDs ...uint) error {
+	return r.AttachCategoriesContext(context.Background(), postID, categoryIDs...)
+}
+
+// AttachCategoriesContext is AttachCategories with a caller-supplied context
+func (r *CategoryRepository) AttachCategoriesContext(ctx context.Context, postID int, categoryIDs ...uint) error {
+	db, cancel := r.session(ctx)
+	defer cancel()
+
+	categoryIDs = uniqueIDs(categoryIDs)
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := checkTaggable(tx, postID, categoryIDs); err != nil {
+			return err
+		}
+		return insertPostCategories(tx, postID, categoryIDs)
+	})
+}
+
+// DetachCategories removes the given categories from the post. Removing a
+// category the post does not have is not an error.
+func (r *CategoryRepository) DetachCategories(postID int, categoryIDs ...uint) error {
+	return r.DetachCategoriesContext(context.Background(), postID, categoryIDs...)
+}
+
+// DetachCategoriesContext is DetachCategories with a caller-supplied context
+func (r *CategoryRepository) DetachCategoriesContext(ctx context.Context, postID int, categoryIDs ...uint) error {
+	if len(categoryIDs) == 0 {
+		return nil
+	}
+
+	db, cancel := r.session(ctx)
+	defer cancel()
+
+	return db.Exec("DELETE FROM post_categories WHERE post_id = ? AND category_id IN ?", postID, categoryIDs).Error
+}
+
+// ReplaceCategories sets the categories of the post to exactly categoryIDs.
+// An empty list removes all categories.
+func (r *CategoryRepository) ReplaceCategories(postID int, categoryIDs ...uint) error {
+	return r.ReplaceCategoriesContext(context.Background(), postID, categoryIDs...)
+}
+
+// ReplaceCategoriesContext is ReplaceCategories with a caller-supplied context
+func (r *CategoryRepository) ReplaceCategoriesContext(ctx context.Context, postID int, categoryIDs ...uint) error {
+	db, cancel := r.session(ctx)
+	defer cancel()
+
+	categoryIDs = uniqueIDs(categoryIDs)
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := checkTaggable(tx, postID, categoryIDs); err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM post_categories WHERE post_id = ?", postID).Error; err != nil {
+			return err
+		}
+		return insertPostCategories(tx, postID, categoryIDs)
+	})
+}
+
+// GetByPostID returns the categories of a post ordered by name
+func (r *CategoryRepository) GetByPostID(postID int) ([]models.Category, error) {
+	return r.GetByPostIDContext(context.Background(), postID)
+}
+
+// GetByPostIDContext is GetByPostID with a caller-supplied context
+func (r *CategoryRepository) GetByPostIDContext(ctx context.Context, postID int) ([]models.Category, error) {
+	db, cancel := r.session(ctx)
+	defer cancel()
+
+	var categories []models.Category
+	err := db.Joins("JOIN post_categories ON post_categories.category_id = categories.id").
+		Where("post_categories.post_id = ?", postID).
+		Order("categories.name").
+		Find(&categories).Error
+	return categories, err
+}
+
+// LoadForPosts fills in the Categories field of every post with one query
+func (r *CategoryRepository) LoadForPosts(posts []models.Post) error {
+	return r.LoadForPostsContext(context.Background(), posts)
+}
+
+// LoadForPostsContext is LoadForPosts with a caller-supplied context
+func (r *CategoryRepository) LoadForPostsContext(ctx context.Context, posts []models.Post) error {
+	if len(posts) == 0 {
+		return nil
+	}
+
+	db, cancel := r.session(ctx)
+	defer cancel()
+
+	postIDs := make([]int, len(posts))
+	for i := range posts {
+		postIDs[i] = posts[i].ID
+	}
+
+	var rows []struct {
+		models.Category
+		PostID int
+	}
+	err := db.Model(&models.Category{}).
+		Select("categories.*, post_categories.post_id").
+		Joins("JOIN post_categories ON post_categories.category_id = categories.id").
+		Where("post_categories.post_id IN ?", postIDs).
+		Order("categories.name").
+		Scan(&rows).Error
+	if err != nil {
+		return err
+	}
+
+	byPost := make(map[int][]models.Category, len(posts))
+	for _, row := range rows {
+		byPost[row.PostID] = append(byPost[row.PostID], row.Category)
+	}
+	for i := range posts {
+		posts[i].Categories = byPost[posts[i].ID]
+	}
+	return nil
+}
+
+// GetPostCounts returns every category with its number of posts, ordered
+// by name. Soft-deleted posts are not counted.
+func (r *CategoryRepository) GetPostCounts() ([]CategoryPostCount, error) {
+	return r.GetPostCountsContext(context.Background())
+}
+
+// GetPostCountsContext is GetPostCounts with a caller-supplied context
+func (r *CategoryRepository) GetPostCountsContext(ctx context.Context) ([]CategoryPostCount, error) {
+	db, cancel := r.session(ctx)
+	defer cancel()
+
+	var counts []CategoryPostCount
+	err := db.Model(&models.Category{}).
+		Select("categories.*, COUNT(posts.id) AS post_count").
+		Joins("LEFT JOIN post_categories ON post_categories.category_id = categories.id").
+		Joins("LEFT JOIN posts ON posts.id = post_categories.post_id AND posts.deleted_at IS NULL AND " + models.ActiveAuthorCondition).
+		Group("categories.id").
+		Order("categories.name").
+		Scan(&counts).Error
+	return counts, err
+}
+
+// checkTaggable verifies that the post and all categories exist and are
+// not soft-deleted
+func checkTaggable(tx *gorm.DB, postID int, categoryIDs []uint) error {
+	var posts int64
+	err := tx.Table("posts").Where("id = ? AND deleted_at IS NULL", postID).Count(&posts).Error
+	if err != nil {
+		return err
+	}
+	if posts == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	if len(categoryIDs) == 0 {
+		return nil
+	}
+	var categories int64
+	if err := tx.Model(&models.Category{}).Where("id IN ?", categoryIDs).Count(&categories).Error; err != nil {
+		return err
+	}
+	if categories != int64(len(categoryIDs)) {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func insertPostCategories(tx *gorm.DB, postID int, categoryIDs []uint) error {
+	for _, categoryID := range categoryIDs {
+		err := tx.Exec(
+			"INSERT INTO post_categories (post_id, category_id) VALUES (?, ?) ON CONFLICT DO NOTHING",
+			postID, categoryID,
+		).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// uniqueIDs drops duplicate IDs, keeping the first occurrence
+func uniqueIDs(ids []uint) []uint {
+	seen := make(map[uint]bool, len(ids))
+	unique := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
 }
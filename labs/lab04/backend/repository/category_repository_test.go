@@ -1,7 +1,14 @@
 package repository
 
 import (
+	"context"
+	"errors"
 	"testing"
+
+	"lab04-backend/database"
+	"lab04-backend/models"
+
+	"gorm.io/gorm"
 )
 
 // TestCategoryRepository tests the GORM ORM approach
@@ -246,6 +253,209 @@ func TestGORMScopes(t *testing.T) {
 	})
 }
 
+func TestCategoryRepository_Tagging(t *testing.T) {
+	_, db, cleanup := setupUnitOfWork(t)
+	defer cleanup()
+
+	gormDB, err := database.InitGORM(db)
+	if err != nil {
+		t.Fatalf("Failed to initialize gorm: %v", err)
+	}
+	categoryRepo := NewCategoryRepository(gormDB)
+	postRepo := NewPostRepository(db)
+
+	user, err := NewUserRepository(db).Create(&models.CreateUserRequest{Name: "Tagger", Email: "tagger@example.com"})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	var posts []*models.Post
+	for _, title := range []string{"Tagged post one", "Tagged post two"} {
+		post, err := postRepo.Create(&models.CreatePostRequest{UserID: user.ID, Title: title})
+		if err != nil {
+			t.Fatalf("Failed to create post: %v", err)
+		}
+		posts = append(posts, post)
+	}
+	categories := []models.Category{{Name: "Go"}, {Name: "Databases"}, {Name: "Unused"}}
+	if err := categoryRepo.CreateWithTransaction(categories); err != nil {
+		t.Fatalf("Failed to create categories: %v", err)
+	}
+	goID, dbID, unusedID := categories[0].ID, categories[1].ID, categories[2].ID
+
+	if err := categoryRepo.AttachCategories(posts[0].ID, goID, dbID, goID); err != nil {
+		t.Fatalf("AttachCategories() failed: %v", err)
+	}
+	if err := categoryRepo.AttachCategories(posts[1].ID, goID); err != nil {
+		t.Fatalf("AttachCategories() failed: %v", err)
+	}
+	// Attaching again is a no-op
+	if err := categoryRepo.AttachCategories(posts[1].ID, goID); err != nil {
+		t.Fatalf("AttachCategories() twice failed: %v", err)
+	}
+	if err := categoryRepo.AttachCategories(posts[0].ID, 999); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("AttachCategories() with unknown category error = %v, want ErrRecordNotFound", err)
+	}
+	if err := categoryRepo.AttachCategories(999, goID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("AttachCategories() with unknown post error = %v, want ErrRecordNotFound", err)
+	}
+
+	tagged, err := categoryRepo.GetByPostID(posts[0].ID)
+	if err != nil {
+		t.Fatalf("GetByPostID() failed: %v", err)
+	}
+	if len(tagged) != 2 || tagged[0].Name != "Databases" {
+		t.Errorf("GetByPostID() = %+v, want Databases and Go", tagged)
+	}
+
+	inGo, err := postRepo.GetByCategoryID(goID)
+	if err != nil {
+		t.Fatalf("GetByCategoryID() failed: %v", err)
+	}
+	if len(inGo) != 2 {
+		t.Errorf("GetByCategoryID(Go) returned %d posts, want 2", len(inGo))
+	}
+	if err := categoryRepo.LoadForPosts(inGo); err != nil {
+		t.Fatalf("LoadForPosts() failed: %v", err)
+	}
+	for _, post := range inGo {
+		want := 1
+		if post.ID == posts[0].ID {
+			want = 2
+		}
+		if len(post.Categories) != want {
+			t.Errorf("post %d has %d categories loaded, want %d", post.ID, len(post.Categories), want)
+		}
+	}
+
+	counts, err := categoryRepo.GetPostCounts()
+	if err != nil {
+		t.Fatalf("GetPostCounts() failed: %v", err)
+	}
+	got := make(map[string]int64)
+	for _, c := range counts {
+		got[c.Name] = c.PostCount
+	}
+	if got["Go"] != 2 || got["Databases"] != 1 || got["Unused"] != 0 {
+		t.Errorf("GetPostCounts() = %v, want Go 2, Databases 1, Unused 0", got)
+	}
+
+	var withPosts []models.Category
+	if err := gormDB.Scopes(models.CategoriesWithPosts).Find(&withPosts).Error; err != nil {
+		t.Fatalf("CategoriesWithPosts scope failed: %v", err)
+	}
+	if len(withPosts) != 2 {
+		t.Errorf("CategoriesWithPosts returned %d categories, want 2", len(withPosts))
+	}
+
+	if err := categoryRepo.ReplaceCategories(posts[0].ID, unusedID); err != nil {
+		t.Fatalf("ReplaceCategories() failed: %v", err)
+	}
+	if err := categoryRepo.DetachCategories(posts[1].ID, goID); err != nil {
+		t.Fatalf("DetachCategories() failed: %v", err)
+	}
+	goCount, err := categories[0].PostCount(gormDB)
+	if err != nil {
+		t.Fatalf("PostCount() failed: %v", err)
+	}
+	if goCount != 0 {
+		t.Errorf("Go PostCount() = %d after replace and detach, want 0", goCount)
+	}
+
+	page, err := postRepo.GetByCategoryIDPage(context.Background(), unusedID, PageRequest{})
+	if err != nil {
+		t.Fatalf("GetByCategoryIDPage() failed: %v", err)
+	}
+	if len(page.Items) != 1 || page.Items[0].ID != posts[0].ID {
+		t.Errorf("GetByCategoryIDPage() = %+v, want the replaced post", page.Items)
+	}
+
+	found, err := NewSearchService(db).SearchPosts(context.Background(), SearchFilters{CategoryIDs: []uint{unusedID, dbID}})
+	if err != nil {
+		t.Fatalf("SearchPosts() failed: %v", err)
+	}
+	if len(found) != 1 || found[0].ID != posts[0].ID {
+		t.Errorf("SearchPosts(CategoryIDs) = %+v, want the replaced post", found)
+	}
+
+	// The posts of a soft-deleted author no longer count
+	if err := NewUserRepository(db).Delete(user.ID); err != nil {
+		t.Fatalf("Failed to delete user: %v", err)
+	}
+	unusedCount, err := categories[2].PostCount(gormDB)
+	if err != nil {
+		t.Fatalf("PostCount() failed: %v", err)
+	}
+	if unusedCount != 0 {
+		t.Errorf("Unused PostCount() = %d after deleting the author, want 0", unusedCount)
+	}
+	withPosts = nil
+	if err := gormDB.Scopes(models.CategoriesWithPosts).Find(&withPosts).Error; err != nil {
+		t.Fatalf("CategoriesWithPosts scope failed: %v", err)
+	}
+	if len(withPosts) != 0 {
+		t.Errorf("CategoriesWithPosts returned %+v after deleting the author, want none", withPosts)
+	}
+}
+
+func TestCategoryRepository_GetCategoriesWithPosts(t *testing.T) {
+	_, db, cleanup := setupUnitOfWork(t)
+	defer cleanup()
+
+	gormDB, err := database.InitGORM(db)
+	if err != nil {
+		t.Fatalf("Failed to initialize gorm: %v", err)
+	}
+	categoryRepo := NewCategoryRepository(gormDB)
+	postRepo := NewPostRepository(db)
+	userRepo := NewUserRepository(db)
+
+	author, err := userRepo.Create(&models.CreateUserRequest{Name: "Author", Email: "author@example.com"})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	leaver, err := userRepo.Create(&models.CreateUserRequest{Name: "Leaver", Email: "leaver@example.com"})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	category := models.Category{Name: "Go"}
+	if err := categoryRepo.Create(&category); err != nil {
+		t.Fatalf("Failed to create category: %v", err)
+	}
+
+	var posts []*models.Post
+	for _, req := range []models.CreatePostRequest{
+		{UserID: author.ID, Title: "Live post"},
+		{UserID: author.ID, Title: "Trashed post"},
+		{UserID: leaver.ID, Title: "Post of a deleted user"},
+	} {
+		post, err := postRepo.Create(&req)
+		if err != nil {
+			t.Fatalf("Failed to create post: %v", err)
+		}
+		if err := categoryRepo.AttachCategories(post.ID, category.ID); err != nil {
+			t.Fatalf("AttachCategories() failed: %v", err)
+		}
+		posts = append(posts, post)
+	}
+	if err := postRepo.Delete(posts[1].ID); err != nil {
+		t.Fatalf("Failed to delete post: %v", err)
+	}
+	if err := userRepo.Delete(leaver.ID); err != nil {
+		t.Fatalf("Failed to delete user: %v", err)
+	}
+
+	categories, err := categoryRepo.GetCategoriesWithPosts()
+	if err != nil {
+		t.Fatalf("GetCategoriesWithPosts() failed: %v", err)
+	}
+	if len(categories) != 1 {
+		t.Fatalf("GetCategoriesWithPosts() returned %d categories, want 1", len(categories))
+	}
+	if got := categories[0].Posts; len(got) != 1 || got[0].ID != posts[0].ID {
+		t.Errorf("GetCategoriesWithPosts() preloaded %+v, want only the live post", got)
+	}
+}
+
 // BenchmarkGORMVsSQL benchmarks GORM vs raw SQL performance
 func BenchmarkGORMVsSQL(b *testing.B) {
 	// TODO: Compare GORM vs raw SQL performance
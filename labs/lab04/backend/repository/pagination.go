@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"lab04-backend/models"
+)
+
+// ErrInvalidCursor is returned when a page cursor cannot be decoded
+var ErrInvalidCursor = errors.New("invalid page cursor")
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// Page is one page of a keyset-paginated listing. Pass NextCursor back in
+// PageRequest.Cursor to fetch the following page.
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	HasMore    bool   `json:"has_more"`
+}
+
+// PageRequest selects a page. An empty Cursor starts from the beginning.
+type PageRequest struct {
+	Limit  int
+	Cursor string
+}
+
+// pageCursor is the keyset position of the last row of a page
+type pageCursor struct {
+	CreatedAt time.Time `json:"c"`
+	ID        int       `json:"i"`
+}
+
+// encodeCursor turns a keyset position into an opaque URL-safe token.
+// RFC 3339 keeps the original offset, so the time binds back to the exact
+// text stored by go-sqlite3.
+func encodeCursor(createdAt time.Time, id int) string {
+	data, _ := json.Marshal(pageCursor{CreatedAt: createdAt, ID: id})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(token string) (*pageCursor, error) {
+	if token == "" {
+		return nil, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var c pageCursor
+	if err := json.Unmarshal(data, &c); err != nil || c.ID <= 0 {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+func (req PageRequest) limit() int {
+	if req.Limit <= 0 {
+		return defaultPageSize
+	}
+	if req.Limit > maxPageSize {
+		return maxPageSize
+	}
+	return req.Limit
+}
+
+// keysetCondition returns the WHERE condition selecting rows after the
+// cursor for an ORDER BY created_at, id in the given direction
+func keysetCondition(table string, desc bool) string {
+	op := ">"
+	if desc {
+		op = "<"
+	}
+	return "(" + table + ".created_at, " + table + ".id) " + op + " (?, ?)"
+}
+
+// keysetOrder returns the ORDER BY clause matching keysetCondition
+func keysetOrder(table string, desc bool) string {
+	dir := "ASC"
+	if desc {
+		dir = "DESC"
+	}
+	return table + ".created_at " + dir + ", " + table + ".id " + dir
+}
+
+// newPage trims the extra row fetched to detect further pages and builds
+// the cursor from the last item kept
+func newPage[T any](items []T, limit int, key func(T) (time.Time, int)) *Page[T] {
+	page := &Page[T]{Items: items}
+	if len(items) > limit {
+		page.Items = items[:limit]
+		page.HasMore = true
+	}
+	if page.HasMore {
+		createdAt, id := key(page.Items[len(page.Items)-1])
+		page.NextCursor = encodeCursor(createdAt, id)
+	}
+	return page
+}
+
+func userKey(u models.User) (time.Time, int) {
+	return u.CreatedAt, u.ID
+}
+
+func postKey(p models.Post) (time.Time, int) {
+	return p.CreatedAt, p.ID
+}
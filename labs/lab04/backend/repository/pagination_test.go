@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"lab04-backend/models"
+)
+
+func TestPostRepository_GetAllPage(t *testing.T) {
+	repo, user, cleanup := setupPostTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	for i := 0; i < 5; i++ {
+		req := &models.CreatePostRequest{
+			UserID:  user.ID,
+			Title:   fmt.Sprintf("Paged post %d", i),
+			Content: "content",
+		}
+		if i%2 == 0 {
+			createPublishedPost(t, repo, req)
+		} else if _, err := repo.Create(req); err != nil {
+			t.Fatalf("Create() failed: %v", err)
+		}
+	}
+
+	var seen []int
+	page := PageRequest{Limit: 2}
+	for pages := 0; ; pages++ {
+		if pages > 5 {
+			t.Fatal("pagination did not terminate")
+		}
+		result, err := repo.GetAllPage(ctx, page)
+		if err != nil {
+			t.Fatalf("GetAllPage() failed: %v", err)
+		}
+		for _, p := range result.Items {
+			seen = append(seen, p.ID)
+		}
+		if !result.HasMore {
+			if result.NextCursor != "" {
+				t.Error("last page should not have a cursor")
+			}
+			break
+		}
+		page.Cursor = result.NextCursor
+	}
+
+	if len(seen) != 5 {
+		t.Fatalf("paged through %d posts, want 5", len(seen))
+	}
+	for i := 1; i < len(seen); i++ {
+		if seen[i] >= seen[i-1] {
+			t.Errorf("posts not newest first: %v", seen)
+			break
+		}
+	}
+
+	published, err := repo.GetPublishedPage(ctx, PageRequest{Limit: 10})
+	if err != nil {
+		t.Fatalf("GetPublishedPage() failed: %v", err)
+	}
+	if len(published.Items) != 3 || published.HasMore {
+		t.Errorf("GetPublishedPage() = %d items (has more %v), want 3", len(published.Items), published.HasMore)
+	}
+
+	if _, err := repo.GetAllPage(ctx, PageRequest{Cursor: "not-a-cursor"}); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("GetAllPage() with bad cursor error = %v, want ErrInvalidCursor", err)
+	}
+}
+
+func TestUserRepository_GetAllPage(t *testing.T) {
+	repo, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	for i := 0; i < 3; i++ {
+		_, err := repo.Create(&models.CreateUserRequest{
+			Name:  fmt.Sprintf("Paged User %d", i),
+			Email: fmt.Sprintf("paged%d@example.com", i),
+		})
+		if err != nil {
+			t.Fatalf("Create() failed: %v", err)
+		}
+	}
+
+	first, err := repo.GetAllPage(context.Background(), PageRequest{Limit: 2})
+	if err != nil {
+		t.Fatalf("GetAllPage() failed: %v", err)
+	}
+	if len(first.Items) != 2 || !first.HasMore || first.NextCursor == "" {
+		t.Fatalf("first page = %+v, want 2 items and a cursor", first)
+	}
+
+	second, err := repo.GetAllPage(context.Background(), PageRequest{Limit: 2, Cursor: first.NextCursor})
+	if err != nil {
+		t.Fatalf("GetAllPage() failed: %v", err)
+	}
+	if len(second.Items) != 1 || second.HasMore {
+		t.Errorf("second page = %+v, want 1 item and no more", second)
+	}
+	if second.Items[0].ID <= first.Items[1].ID {
+		t.Errorf("second page should continue after ID %d", first.Items[1].ID)
+	}
+}
@@ -1,101 +1,388 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
+	"lab04-backend/database"
 	"lab04-backend/models"
+
+	"github.com/georgysavva/scany/v2/sqlscan"
 )
 
 // PostRepository handles database operations for posts
 // This repository demonstrates SCANY MAPPING approach for result scanning
 type PostRepository struct {
-	db *sql.DB
+	db           DBTX
+	queryTimeout time.Duration
 }
 
 // NewPostRepository creates a new PostRepository
-func NewPostRepository(db *sql.DB) *PostRepository {
-	return &PostRepository{db: db}
+func NewPostRepository(db *sql.DB, opts ...RepositoryOption) *PostRepository {
+	o := buildRepositoryOptions(opts)
+	return &PostRepository{db: db, queryTimeout: o.queryTimeout}
 }
 
-// TODO: Implement Create method using scany for result mapping
+// postColumns lists the posts columns mapped by models.Post
+const postColumns = "id, user_id, title, content, published, created_at, updated_at, deleted_at, status, publish_at"
+
+// inCategoryCondition selects posts tagged with the category bound to its placeholder
+const inCategoryCondition = "posts.id IN (SELECT post_id FROM post_categories WHERE category_id = ?)"
+
+// Create inserts a new post and scans the RETURNING row with scany
 func (r *PostRepository) Create(req *models.CreatePostRequest) (*models.Post, error) {
-	// TODO: Create a new post in the database using scany for result mapping
-	// - Validate the request using req.Validate()
-	// - Insert into posts table with RETURNING clause
-	// - Use sqlscan.Get() to scan the RETURNING result into a Post struct
-	// Example: sqlscan.Get(context.Background(), r.db, &post, query, args...)
-	// This eliminates manual row scanning compared to user repository
-	return nil, fmt.Errorf("TODO: implement Create method with scany mapping")
-}
-
-// TODO: Implement GetByID method using scany
-func (r *PostRepository) GetByID(id int) (*models.Post, error) {
-	// TODO: Get post by ID from database using scany
-	// - Use sqlscan.Get() instead of manual row.Scan()
-	// Example: sqlscan.Get(context.Background(), r.db, &post, "SELECT * FROM posts WHERE id = $1", id)
-	// Notice how this eliminates the need for manual field scanning
-	return nil, fmt.Errorf("TODO: implement GetByID method with scany")
-}
-
-// TODO: Implement GetByUserID method using scany
-func (r *PostRepository) GetByUserID(userID int) ([]models.Post, error) {
-	// TODO: Get all posts by user ID using scany
-	// - Use sqlscan.Select() for multiple rows instead of manual rows.Next() loop
-	// Example: sqlscan.Select(context.Background(), r.db, &posts, query, userID)
-	// This eliminates manual iteration and scanning
-	return nil, fmt.Errorf("TODO: implement GetByUserID method with scany")
-}
-
-// TODO: Implement GetPublished method using scany
-func (r *PostRepository) GetPublished() ([]models.Post, error) {
-	// TODO: Get all published posts using scany
-	// - Use sqlscan.Select() for multiple rows
-	// - Query posts where published = true
-	// - Order by created_at DESC
-	return nil, fmt.Errorf("TODO: implement GetPublished method with scany")
-}
-
-// TODO: Implement GetAll method using scany
-func (r *PostRepository) GetAll() ([]models.Post, error) {
-	// TODO: Get all posts from database using scany
-	// - Use sqlscan.Select() instead of manual rows iteration
-	// Example: sqlscan.Select(context.Background(), r.db, &posts, "SELECT * FROM posts ORDER BY created_at DESC")
-	// Compare this simplicity with manual scanning in user repository
-	return nil, fmt.Errorf("TODO: implement GetAll method with scany")
-}
-
-// TODO: Implement Update method using scany
+	return r.CreateContext(context.Background(), req)
+}
+
+// CreateContext is Create with a caller-supplied context
+func (r *PostRepository) CreateContext(ctx context.Context, req *models.CreatePostRequest) (*models.Post, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	// New posts start as drafts, so the legacy flag is held to the state
+	// machine like any other transition
+	if req.Published {
+		if err := models.PostDraft.CheckTransition(models.PostPublished); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, cancel := database.WithQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	p := req.ToPost()
+	var post models.Post
+	err := runInTx(ctx, r.db, func(db DBTX) error {
+		err := sqlscan.Get(ctx, db, &post,
+			`INSERT INTO posts (user_id, title, content, published, status, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+			RETURNING `+postColumns,
+			p.UserID, p.Title, p.Content, p.Published, p.Status, p.CreatedAt, p.UpdatedAt,
+		)
+		if err != nil {
+			return err
+		}
+		return insertRevision(ctx, db, &post, post.UserID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &post, nil
+}
+
+// GetByID returns the post with the given ID or sql.ErrNoRows.
+// Soft-deleted posts are excluded unless WithTrashed is passed.
+func (r *PostRepository) GetByID(id int, opts ...QueryOption) (*models.Post, error) {
+	return r.GetByIDContext(context.Background(), id, opts...)
+}
+
+// GetByIDContext is GetByID with a caller-supplied context
+func (r *PostRepository) GetByIDContext(ctx context.Context, id int, opts ...QueryOption) (*models.Post, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	o := buildQueryOptions(opts)
+	var post models.Post
+	err := sqlscan.Get(ctx, r.db, &post,
+		"SELECT "+postColumns+" FROM posts WHERE id = ? AND "+o.postCondition(),
+		id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &post, nil
+}
+
+// GetByUserID returns all posts of a user, newest first
+func (r *PostRepository) GetByUserID(userID int, opts ...QueryOption) ([]models.Post, error) {
+	return r.GetByUserIDContext(context.Background(), userID, opts...)
+}
+
+// GetByUserIDContext is GetByUserID with a caller-supplied context
+func (r *PostRepository) GetByUserIDContext(ctx context.Context, userID int, opts ...QueryOption) ([]models.Post, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	o := buildQueryOptions(opts)
+	posts := make([]models.Post, 0)
+	err := sqlscan.Select(ctx, r.db, &posts,
+		"SELECT "+postColumns+" FROM posts WHERE user_id = ? AND "+o.postCondition()+
+			" ORDER BY created_at DESC, id DESC",
+		userID,
+	)
+	return posts, err
+}
+
+// GetPublished returns all published posts, newest first
+func (r *PostRepository) GetPublished(opts ...QueryOption) ([]models.Post, error) {
+	return r.GetPublishedContext(context.Background(), opts...)
+}
+
+// GetPublishedContext is GetPublished with a caller-supplied context
+func (r *PostRepository) GetPublishedContext(ctx context.Context, opts ...QueryOption) ([]models.Post, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	o := buildQueryOptions(opts)
+	posts := make([]models.Post, 0)
+	err := sqlscan.Select(ctx, r.db, &posts,
+		"SELECT "+postColumns+" FROM posts WHERE published = ? AND "+o.postCondition()+
+			" ORDER BY created_at DESC, id DESC",
+		true,
+	)
+	return posts, err
+}
+
+// GetAll returns all posts, newest first
+func (r *PostRepository) GetAll(opts ...QueryOption) ([]models.Post, error) {
+	return r.GetAllContext(context.Background(), opts...)
+}
+
+// GetAllContext is GetAll with a caller-supplied context
+func (r *PostRepository) GetAllContext(ctx context.Context, opts ...QueryOption) ([]models.Post, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	o := buildQueryOptions(opts)
+	posts := make([]models.Post, 0)
+	err := sqlscan.Select(ctx, r.db, &posts,
+		"SELECT "+postColumns+" FROM posts WHERE "+o.postCondition()+
+			" ORDER BY created_at DESC, id DESC",
+	)
+	return posts, err
+}
+
+// GetByCategoryID returns all posts tagged with the category, newest first
+func (r *PostRepository) GetByCategoryID(categoryID uint, opts ...QueryOption) ([]models.Post, error) {
+	return r.GetByCategoryIDContext(context.Background(), categoryID, opts...)
+}
+
+// GetByCategoryIDContext is GetByCategoryID with a caller-supplied context
+func (r *PostRepository) GetByCategoryIDContext(ctx context.Context, categoryID uint, opts ...QueryOption) ([]models.Post, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	o := buildQueryOptions(opts)
+	posts := make([]models.Post, 0)
+	err := sqlscan.Select(ctx, r.db, &posts,
+		"SELECT "+postColumns+" FROM posts WHERE "+inCategoryCondition+" AND "+o.postCondition()+
+			" ORDER BY created_at DESC, id DESC",
+		categoryID,
+	)
+	return posts, err
+}
+
+// GetAllPage returns one page of posts, newest first
+func (r *PostRepository) GetAllPage(ctx context.Context, page PageRequest, opts ...QueryOption) (*Page[models.Post], error) {
+	return r.listPage(ctx, nil, nil, page, opts)
+}
+
+// GetPublishedPage returns one page of published posts, newest first
+func (r *PostRepository) GetPublishedPage(ctx context.Context, page PageRequest, opts ...QueryOption) (*Page[models.Post], error) {
+	return r.listPage(ctx, []string{"posts.published = ?"}, []interface{}{true}, page, opts)
+}
+
+// GetByUserIDPage returns one page of a user's posts, newest first
+func (r *PostRepository) GetByUserIDPage(ctx context.Context, userID int, page PageRequest, opts ...QueryOption) (*Page[models.Post], error) {
+	return r.listPage(ctx, []string{"posts.user_id = ?"}, []interface{}{userID}, page, opts)
+}
+
+// GetByCategoryIDPage returns one page of the posts tagged with the category, newest first
+func (r *PostRepository) GetByCategoryIDPage(ctx context.Context, categoryID uint, page PageRequest, opts ...QueryOption) (*Page[models.Post], error) {
+	return r.listPage(ctx, []string{inCategoryCondition}, []interface{}{categoryID}, page, opts)
+}
+
+// listPage runs a keyset-paginated posts query ordered by created_at DESC, id DESC
+func (r *PostRepository) listPage(ctx context.Context, conditions []string, args []interface{}, page PageRequest, opts []QueryOption) (*Page[models.Post], error) {
+	cursor, err := decodeCursor(page.Cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := database.WithQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	o := buildQueryOptions(opts)
+	conditions = append(conditions, o.postCondition())
+	if cursor != nil {
+		conditions = append(conditions, keysetCondition("posts", true))
+		args = append(args, cursor.CreatedAt, cursor.ID)
+	}
+
+	limit := page.limit()
+	args = append(args, limit+1)
+
+	posts := make([]models.Post, 0)
+	err = sqlscan.Select(ctx, r.db, &posts,
+		"SELECT "+postColumns+" FROM posts WHERE "+strings.Join(conditions, " AND ")+
+			" ORDER BY "+keysetOrder("posts", true)+" LIMIT ?",
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return newPage(posts, limit, postKey), nil
+}
+
+// Update applies the non-nil fields of req and returns the updated post
+// using RETURNING, so no separate SELECT is needed
 func (r *PostRepository) Update(id int, req *models.UpdatePostRequest) (*models.Post, error) {
-	// TODO: Update post in database using scany
-	// - Build dynamic UPDATE query based on non-nil fields in req
-	// - Update updated_at timestamp
-	// - Use sqlscan.Get() with RETURNING clause to get updated post
-	// This avoids a separate SELECT query after UPDATE
-	return nil, fmt.Errorf("TODO: implement Update method with scany")
+	return r.UpdateContext(context.Background(), id, req)
+}
+
+// UpdateContext is Update with a caller-supplied context
+func (r *PostRepository) UpdateContext(ctx context.Context, id int, req *models.UpdatePostRequest) (*models.Post, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+
+	// The legacy flag is a transition to published or draft and follows
+	// the state machine; setting it to the current state changes nothing
+	var from models.PostStatus
+	if req.Published != nil {
+		current, err := r.GetByIDContext(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if to := models.StatusForPublished(*req.Published); to != current.Status {
+			if err := current.Status.CheckTransition(to); err != nil {
+				return nil, err
+			}
+			from = current.Status
+		}
+	}
+
+	ctx, cancel := database.WithQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	setClauses := []string{"updated_at = ?"}
+	args := []interface{}{time.Now()}
+
+	if req.Title != nil {
+		setClauses = append(setClauses, "title = ?")
+		args = append(args, *req.Title)
+	}
+	if req.Content != nil {
+		setClauses = append(setClauses, "content = ?")
+		args = append(args, *req.Content)
+	}
+	where := "id = ?"
+	whereArgs := []interface{}{id}
+	if from != "" {
+		setClauses = append(setClauses, "published = ?", "status = ?", "publish_at = NULL")
+		args = append(args, *req.Published, models.StatusForPublished(*req.Published))
+		// The status condition rejects a concurrent transition of the same post
+		where += " AND status = ?"
+		whereArgs = append(whereArgs, from)
+	}
+	args = append(args, whereArgs...)
+
+	var post models.Post
+	err := runInTx(ctx, r.db, func(db DBTX) error {
+		err := sqlscan.Get(ctx, db, &post,
+			"UPDATE posts SET "+strings.Join(setClauses, ", ")+
+				" WHERE "+where+" AND deleted_at IS NULL RETURNING "+postColumns,
+			args...,
+		)
+		if errors.Is(err, sql.ErrNoRows) && from != "" {
+			return fmt.Errorf("%w: post %d changed status concurrently", models.ErrInvalidTransition, id)
+		}
+		if err != nil || (req.Title == nil && req.Content == nil) {
+			return err
+		}
+
+		editorID := post.UserID
+		if req.EditorID != nil {
+			editorID = *req.EditorID
+		}
+		return insertRevision(ctx, db, &post, editorID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &post, nil
 }
 
-// TODO: Implement Delete method (standard SQL)
+// Delete soft-deletes the post by setting deleted_at
 func (r *PostRepository) Delete(id int) error {
-	// TODO: Delete post from database
-	// - Delete from posts table by ID
-	// - Return error if post doesn't exist
-	// Note: Delete operations typically don't need scany since no data is returned
-	return fmt.Errorf("TODO: implement Delete method")
-}
-
-// TODO: Implement Count method (standard SQL)
-func (r *PostRepository) Count() (int, error) {
-	// TODO: Count total number of posts
-	// - Return count of posts in database
-	// - Can use standard QueryRow.Scan() for single values like count
-	return 0, fmt.Errorf("TODO: implement Count method")
-}
-
-// TODO: Implement CountByUserID method (standard SQL)
-func (r *PostRepository) CountByUserID(userID int) (int, error) {
-	// TODO: Count posts by user ID
-	// - Return count of posts for specific user
-	// - Use standard QueryRow.Scan() for single integer result
-	return 0, fmt.Errorf("TODO: implement CountByUserID method")
+	return r.DeleteContext(context.Background(), id)
+}
+
+// DeleteContext is Delete with a caller-supplied context
+func (r *PostRepository) DeleteContext(ctx context.Context, id int) error {
+	ctx, cancel := database.WithQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	return execAffectingOne(ctx, r.db,
+		"UPDATE posts SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL",
+		time.Now(), id,
+	)
+}
+
+// Restore clears deleted_at on a soft-deleted post
+func (r *PostRepository) Restore(id int) error {
+	return r.RestoreContext(context.Background(), id)
+}
+
+// RestoreContext is Restore with a caller-supplied context
+func (r *PostRepository) RestoreContext(ctx context.Context, id int) error {
+	ctx, cancel := database.WithQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	return execAffectingOne(ctx, r.db,
+		"UPDATE posts SET deleted_at = NULL, updated_at = ? WHERE id = ? AND deleted_at IS NOT NULL",
+		time.Now(), id,
+	)
+}
+
+// ForceDelete permanently removes the post, trashed or not
+func (r *PostRepository) ForceDelete(id int) error {
+	return r.ForceDeleteContext(context.Background(), id)
+}
+
+// ForceDeleteContext is ForceDelete with a caller-supplied context
+func (r *PostRepository) ForceDeleteContext(ctx context.Context, id int) error {
+	ctx, cancel := database.WithQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	return execAffectingOne(ctx, r.db, "DELETE FROM posts WHERE id = ?", id)
+}
+
+// Count returns the number of posts
+func (r *PostRepository) Count(opts ...QueryOption) (int, error) {
+	return r.CountContext(context.Background(), opts...)
+}
+
+// CountContext is Count with a caller-supplied context
+func (r *PostRepository) CountContext(ctx context.Context, opts ...QueryOption) (int, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	o := buildQueryOptions(opts)
+	var count int
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM posts WHERE "+o.postCondition()).Scan(&count)
+	return count, err
+}
+
+// CountByUserID returns the number of posts written by a user
+func (r *PostRepository) CountByUserID(userID int, opts ...QueryOption) (int, error) {
+	return r.CountByUserIDContext(context.Background(), userID, opts...)
+}
+
+// CountByUserIDContext is CountByUserID with a caller-supplied context
+func (r *PostRepository) CountByUserIDContext(ctx context.Context, userID int, opts ...QueryOption) (int, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	o := buildQueryOptions(opts)
+	var count int
+	err := r.db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM posts WHERE user_id = ? AND "+o.postCondition(),
+		userID,
+	).Scan(&count)
+	return count, err
 }
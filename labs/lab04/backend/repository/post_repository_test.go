@@ -0,0 +1,173 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+
+	"lab04-backend/models"
+)
+
+func setupPostTestDB(t *testing.T) (*PostRepository, *models.User, func()) {
+	userRepo, cleanup := setupTestDB(t)
+
+	user, err := userRepo.Create(&models.CreateUserRequest{Name: "Post Author", Email: "author@example.com"})
+	if err != nil {
+		cleanup()
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	return NewPostRepository(userRepo.db.(*sql.DB)), user, cleanup
+}
+
+// createPublishedPost creates a post and takes it through review to published
+func createPublishedPost(t *testing.T, repo *PostRepository, req *models.CreatePostRequest) *models.Post {
+	t.Helper()
+	post, err := repo.Create(req)
+	if err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+	for _, status := range []models.PostStatus{models.PostReview, models.PostPublished} {
+		if post, err = repo.Transition(post.ID, status); err != nil {
+			t.Fatalf("Transition(%s) failed: %v", status, err)
+		}
+	}
+	return post
+}
+
+func TestPostRepository_CreateAndGet(t *testing.T) {
+	repo, user, cleanup := setupPostTestDB(t)
+	defer cleanup()
+
+	post, err := repo.Create(&models.CreatePostRequest{
+		UserID:  user.ID,
+		Title:   "Hello World",
+		Content: "First post content",
+	})
+	if err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+	if post.ID == 0 {
+		t.Error("Create() should set post ID")
+	}
+
+	found, err := repo.GetByID(post.ID)
+	if err != nil {
+		t.Fatalf("GetByID() failed: %v", err)
+	}
+	if found.Title != post.Title {
+		t.Errorf("GetByID() title = %v, want %v", found.Title, post.Title)
+	}
+
+	if _, err := repo.Create(&models.CreatePostRequest{UserID: user.ID, Title: "Hey"}); err == nil {
+		t.Error("Create() should reject short titles")
+	}
+
+	// New posts are drafts and cannot skip review
+	_, err = repo.Create(&models.CreatePostRequest{UserID: user.ID, Title: "Straight to print", Content: "content", Published: true})
+	if !errors.Is(err, models.ErrInvalidTransition) {
+		t.Errorf("Create(Published) error = %v, want ErrInvalidTransition", err)
+	}
+}
+
+func TestPostRepository_SoftDelete(t *testing.T) {
+	repo, user, cleanup := setupPostTestDB(t)
+	defer cleanup()
+
+	post := createPublishedPost(t, repo, &models.CreatePostRequest{
+		UserID:  user.ID,
+		Title:   "Soon to be trashed",
+		Content: "content",
+	})
+
+	if err := repo.Delete(post.ID); err != nil {
+		t.Fatalf("Delete() failed: %v", err)
+	}
+
+	if _, err := repo.GetByID(post.ID); err == nil {
+		t.Error("GetByID() should not return soft-deleted post")
+	}
+
+	for name, fetch := range map[string]func(...QueryOption) ([]models.Post, error){
+		"GetAll":       repo.GetAll,
+		"GetPublished": repo.GetPublished,
+		"GetByUserID": func(opts ...QueryOption) ([]models.Post, error) {
+			return repo.GetByUserID(user.ID, opts...)
+		},
+	} {
+		posts, err := fetch()
+		if err != nil {
+			t.Fatalf("%s() failed: %v", name, err)
+		}
+		if len(posts) != 0 {
+			t.Errorf("%s() returned %d posts, want 0", name, len(posts))
+		}
+
+		posts, err = fetch(WithTrashed())
+		if err != nil {
+			t.Fatalf("%s(WithTrashed) failed: %v", name, err)
+		}
+		if len(posts) != 1 {
+			t.Errorf("%s(WithTrashed) returned %d posts, want 1", name, len(posts))
+		}
+	}
+
+	if count, _ := repo.CountByUserID(user.ID); count != 0 {
+		t.Errorf("CountByUserID() = %d, want 0", count)
+	}
+
+	title := "Updated while trashed"
+	if _, err := repo.Update(post.ID, &models.UpdatePostRequest{Title: &title}); err == nil {
+		t.Error("Update() should not modify soft-deleted post")
+	}
+
+	if err := repo.Restore(post.ID); err != nil {
+		t.Fatalf("Restore() failed: %v", err)
+	}
+	if count, _ := repo.Count(); count != 1 {
+		t.Errorf("Count() after Restore = %d, want 1", count)
+	}
+
+	if err := repo.ForceDelete(post.ID); err != nil {
+		t.Fatalf("ForceDelete() failed: %v", err)
+	}
+	if count, _ := repo.Count(WithTrashed()); count != 0 {
+		t.Errorf("Count(WithTrashed) after ForceDelete = %d, want 0", count)
+	}
+}
+
+func TestPostRepository_SoftDeletedAuthor(t *testing.T) {
+	repo, user, cleanup := setupPostTestDB(t)
+	defer cleanup()
+	users := NewUserRepository(repo.db.(*sql.DB))
+
+	post := createPublishedPost(t, repo, &models.CreatePostRequest{
+		UserID:  user.ID,
+		Title:   "Written by a leaver",
+		Content: "content",
+	})
+
+	if err := users.Delete(user.ID); err != nil {
+		t.Fatalf("Delete() user failed: %v", err)
+	}
+
+	if _, err := repo.GetByID(post.ID); err == nil {
+		t.Error("GetByID() should not return posts of a soft-deleted user")
+	}
+	if posts, err := repo.GetPublished(); err != nil || len(posts) != 0 {
+		t.Errorf("GetPublished() = %d posts, %v; want 0", len(posts), err)
+	}
+	if count, _ := repo.Count(); count != 0 {
+		t.Errorf("Count() = %d, want 0", count)
+	}
+	if _, err := repo.GetByID(post.ID, WithTrashed()); err != nil {
+		t.Errorf("GetByID(WithTrashed) failed: %v", err)
+	}
+
+	if err := users.Restore(user.ID); err != nil {
+		t.Fatalf("Restore() user failed: %v", err)
+	}
+	if _, err := repo.GetByID(post.ID); err != nil {
+		t.Errorf("GetByID() after restoring the user failed: %v", err)
+	}
+}
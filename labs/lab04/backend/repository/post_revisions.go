@@ -0,0 +1,242 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"lab04-backend/database"
+	"lab04-backend/models"
+
+	"github.com/georgysavva/scany/v2/sqlscan"
+)
+
+// revisionColumns lists the post_revisions columns mapped by models.PostRevision
+const revisionColumns = "id, post_id, revision, title, content, author_id, created_at"
+
+// insertRevision records the current title and content of post as its
+// next revision
+func insertRevision(ctx context.Context, db DBTX, post *models.Post, authorID int) error {
+	_, err := db.ExecContext(ctx,
+		`INSERT INTO post_revisions (post_id, revision, title, content, author_id, created_at)
+		SELECT ?, COALESCE(MAX(revision), 0) + 1, ?, ?, ?, ?
+		FROM post_revisions WHERE post_id = ?`,
+		post.ID, post.Title, post.Content, authorID, time.Now(), post.ID,
+	)
+	return err
+}
+
+// GetRevisions returns all revisions of a post, oldest first
+func (r *PostRepository) GetRevisions(postID int) ([]models.PostRevision, error) {
+	return r.GetRevisionsContext(context.Background(), postID)
+}
+
+// GetRevisionsContext is GetRevisions with a caller-supplied context
+func (r *PostRepository) GetRevisionsContext(ctx context.Context, postID int) ([]models.PostRevision, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	revisions := make([]models.PostRevision, 0)
+	err := sqlscan.Select(ctx, r.db, &revisions,
+		"SELECT "+revisionColumns+" FROM post_revisions WHERE post_id = ? ORDER BY revision",
+		postID,
+	)
+	return revisions, err
+}
+
+// GetRevision returns one revision of a post or sql.ErrNoRows
+func (r *PostRepository) GetRevision(postID, revision int) (*models.PostRevision, error) {
+	return r.GetRevisionContext(context.Background(), postID, revision)
+}
+
+// GetRevisionContext is GetRevision with a caller-supplied context
+func (r *PostRepository) GetRevisionContext(ctx context.Context, postID, revision int) (*models.PostRevision, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	return getRevision(ctx, r.db, postID, revision)
+}
+
+func getRevision(ctx context.Context, db DBTX, postID, revision int) (*models.PostRevision, error) {
+	var rev models.PostRevision
+	err := sqlscan.Get(ctx, db, &rev,
+		"SELECT "+revisionColumns+" FROM post_revisions WHERE post_id = ? AND revision = ?",
+		postID, revision,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &rev, nil
+}
+
+// DiffRevisions compares two revisions of a post line by line. Revisions
+// too far apart to compare return models.ErrDiffTooLarge.
+func (r *PostRepository) DiffRevisions(postID, from, to int) (*models.RevisionDiff, error) {
+	return r.DiffRevisionsContext(context.Background(), postID, from, to)
+}
+
+// DiffRevisionsContext is DiffRevisions with a caller-supplied context
+func (r *PostRepository) DiffRevisionsContext(ctx context.Context, postID, from, to int) (*models.RevisionDiff, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	fromRev, err := getRevision(ctx, r.db, postID, from)
+	if err != nil {
+		return nil, err
+	}
+	toRev, err := getRevision(ctx, r.db, postID, to)
+	if err != nil {
+		return nil, err
+	}
+	return models.DiffRevisions(fromRev, toRev)
+}
+
+// RestoreRevision copies the title and content of an old revision back
+// onto the post. The restore is itself recorded as a new revision by
+// authorID, or by the post owner when authorID is 0.
+func (r *PostRepository) RestoreRevision(postID, revision, authorID int) (*models.Post, error) {
+	return r.RestoreRevisionContext(context.Background(), postID, revision, authorID)
+}
+
+// RestoreRevisionContext is RestoreRevision with a caller-supplied context
+func (r *PostRepository) RestoreRevisionContext(ctx context.Context, postID, revision, authorID int) (*models.Post, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	var post models.Post
+	err := runInTx(ctx, r.db, func(db DBTX) error {
+		rev, err := getRevision(ctx, db, postID, revision)
+		if err != nil {
+			return err
+		}
+
+		err = sqlscan.Get(ctx, db, &post,
+			"UPDATE posts SET title = ?, content = ?, updated_at = ? WHERE id = ? AND deleted_at IS NULL RETURNING "+postColumns,
+			rev.Title, rev.Content, time.Now(), postID,
+		)
+		if err != nil {
+			return err
+		}
+
+		if authorID == 0 {
+			authorID = post.UserID
+		}
+		return insertRevision(ctx, db, &post, authorID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &post, nil
+}
+
+// Transition moves the post to another workflow status. It returns an
+// error wrapping models.ErrInvalidTransition if the state machine does not
+// allow the move. Leaving review clears any scheduled publish time.
+func (r *PostRepository) Transition(id int, to models.PostStatus) (*models.Post, error) {
+	return r.TransitionContext(context.Background(), id, to)
+}
+
+// TransitionContext is Transition with a caller-supplied context
+func (r *PostRepository) TransitionContext(ctx context.Context, id int, to models.PostStatus) (*models.Post, error) {
+	current, err := r.GetByIDContext(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := current.Status.CheckTransition(to); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := database.WithQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	// The status condition rejects a concurrent transition of the same post
+	post, err := r.updateStatus(ctx,
+		"status = ?, published = ?, publish_at = NULL, updated_at = ?",
+		"id = ? AND status = ?",
+		to, to == models.PostPublished, time.Now(), id, current.Status,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w: post %d changed status concurrently", models.ErrInvalidTransition, id)
+		}
+		return nil, err
+	}
+	return post, nil
+}
+
+// Schedule sets the time at which a post in review is published by
+// PublishDue. A zero time removes the schedule. Posts not in review return
+// an error wrapping models.ErrInvalidTransition.
+func (r *PostRepository) Schedule(id int, at time.Time) (*models.Post, error) {
+	return r.ScheduleContext(context.Background(), id, at)
+}
+
+// ScheduleContext is Schedule with a caller-supplied context
+func (r *PostRepository) ScheduleContext(ctx context.Context, id int, at time.Time) (*models.Post, error) {
+	current, err := r.GetByIDContext(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if current.Status != models.PostReview {
+		return nil, fmt.Errorf("%w: only posts in review can be scheduled, post is %s", models.ErrInvalidTransition, current.Status)
+	}
+
+	ctx, cancel := database.WithQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	// Stored in UTC so PublishDue can compare the text timestamps
+	var publishAt interface{}
+	if !at.IsZero() {
+		publishAt = at.UTC()
+	}
+
+	post, err := r.updateStatus(ctx,
+		"publish_at = ?, updated_at = ?",
+		"id = ? AND status = ?",
+		publishAt, time.Now(), id, models.PostReview,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w: post %d left review concurrently", models.ErrInvalidTransition, id)
+		}
+		return nil, err
+	}
+	return post, nil
+}
+
+// PublishDue publishes every post in review whose publish time is at or
+// before now and returns how many were published
+func (r *PostRepository) PublishDue(now time.Time) (int64, error) {
+	return r.PublishDueContext(context.Background(), now)
+}
+
+// PublishDueContext is PublishDue with a caller-supplied context
+func (r *PostRepository) PublishDueContext(ctx context.Context, now time.Time) (int64, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	result, err := r.db.ExecContext(ctx,
+		`UPDATE posts SET status = ?, published = ?, publish_at = NULL, updated_at = ?
+		WHERE status = ? AND publish_at IS NOT NULL AND publish_at <= ? AND deleted_at IS NULL`,
+		models.PostPublished, true, time.Now(), models.PostReview, now.UTC(),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to publish scheduled posts: %v", err)
+	}
+	return result.RowsAffected()
+}
+
+// updateStatus runs an UPDATE of one non-deleted post and returns it
+func (r *PostRepository) updateStatus(ctx context.Context, set, where string, args ...interface{}) (*models.Post, error) {
+	var post models.Post
+	err := sqlscan.Get(ctx, r.db, &post,
+		"UPDATE posts SET "+set+" WHERE "+where+" AND deleted_at IS NULL RETURNING "+postColumns,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &post, nil
+}
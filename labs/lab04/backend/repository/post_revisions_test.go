@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"lab04-backend/models"
+)
+
+func TestPostRepository_Revisions(t *testing.T) {
+	repo, user, cleanup := setupPostTestDB(t)
+	defer cleanup()
+
+	post, err := repo.Create(&models.CreatePostRequest{UserID: user.ID, Title: "First title", Content: "line one\nline two"})
+	if err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+
+	content := "line one\nline 2\nline three"
+	if _, err := repo.Update(post.ID, &models.UpdatePostRequest{Content: &content}); err != nil {
+		t.Fatalf("Update() failed: %v", err)
+	}
+	// Toggling the flag alone is not an edit
+	published := true
+	if _, err := repo.Update(post.ID, &models.UpdatePostRequest{Published: &published}); !errors.Is(err, models.ErrInvalidTransition) {
+		t.Errorf("Update(Published) of a draft error = %v, want ErrInvalidTransition", err)
+	}
+	if _, err := repo.Transition(post.ID, models.PostReview); err != nil {
+		t.Fatalf("Transition(review) failed: %v", err)
+	}
+	if _, err := repo.Update(post.ID, &models.UpdatePostRequest{Published: &published}); err != nil {
+		t.Fatalf("Update() failed: %v", err)
+	}
+
+	revisions, err := repo.GetRevisions(post.ID)
+	if err != nil {
+		t.Fatalf("GetRevisions() failed: %v", err)
+	}
+	if len(revisions) != 2 {
+		t.Fatalf("GetRevisions() returned %d revisions, want 2", len(revisions))
+	}
+	if revisions[1].Revision != 2 || revisions[1].Content != content || *revisions[1].AuthorID != user.ID {
+		t.Errorf("second revision = %+v", revisions[1])
+	}
+
+	diff, err := repo.DiffRevisions(post.ID, 1, 2)
+	if err != nil {
+		t.Fatalf("DiffRevisions() failed: %v", err)
+	}
+	want := []models.DiffLine{
+		{Op: models.DiffEqual, Text: "line one"},
+		{Op: models.DiffDelete, Text: "line two"},
+		{Op: models.DiffInsert, Text: "line 2"},
+		{Op: models.DiffInsert, Text: "line three"},
+	}
+	if len(diff.Content) != len(want) {
+		t.Fatalf("DiffRevisions() content = %+v, want %+v", diff.Content, want)
+	}
+	for i := range want {
+		if diff.Content[i] != want[i] {
+			t.Errorf("diff line %d = %+v, want %+v", i, diff.Content[i], want[i])
+		}
+	}
+
+	restored, err := repo.RestoreRevision(post.ID, 1, 0)
+	if err != nil {
+		t.Fatalf("RestoreRevision() failed: %v", err)
+	}
+	if restored.Content != "line one\nline two" || !restored.Published {
+		t.Errorf("RestoreRevision() = %+v, want the original content, still published", restored)
+	}
+	if revisions, _ := repo.GetRevisions(post.ID); len(revisions) != 3 {
+		t.Errorf("restore should record revision 3, have %d revisions", len(revisions))
+	}
+
+	if _, err := repo.RestoreRevision(post.ID, 99, 0); err == nil {
+		t.Error("RestoreRevision() of a missing revision should fail")
+	}
+}
+
+func TestPostRepository_Workflow(t *testing.T) {
+	repo, user, cleanup := setupPostTestDB(t)
+	defer cleanup()
+
+	post, err := repo.Create(&models.CreatePostRequest{UserID: user.ID, Title: "Workflow post", Content: "text"})
+	if err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+	if post.Status != models.PostDraft {
+		t.Fatalf("new post status = %s, want draft", post.Status)
+	}
+
+	if _, err := repo.Transition(post.ID, models.PostPublished); !errors.Is(err, models.ErrInvalidTransition) {
+		t.Errorf("draft -> published error = %v, want ErrInvalidTransition", err)
+	}
+	if _, err := repo.Schedule(post.ID, time.Now()); !errors.Is(err, models.ErrInvalidTransition) {
+		t.Errorf("scheduling a draft error = %v, want ErrInvalidTransition", err)
+	}
+
+	if _, err := repo.Transition(post.ID, models.PostReview); err != nil {
+		t.Fatalf("draft -> review failed: %v", err)
+	}
+	scheduled, err := repo.Schedule(post.ID, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Schedule() failed: %v", err)
+	}
+	if scheduled.PublishAt == nil {
+		t.Fatal("Schedule() should set publish_at")
+	}
+
+	publisher := NewPublisher(repo, time.Minute)
+	if n, err := publisher.RunOnce(context.Background()); err != nil || n != 0 {
+		t.Errorf("RunOnce() before the schedule = %d, %v; want 0", n, err)
+	}
+
+	publisher.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	if n, err := publisher.RunOnce(context.Background()); err != nil || n != 1 {
+		t.Errorf("RunOnce() after the schedule = %d, %v; want 1", n, err)
+	}
+
+	found, err := repo.GetByID(post.ID)
+	if err != nil {
+		t.Fatalf("GetByID() failed: %v", err)
+	}
+	if found.Status != models.PostPublished || !found.Published || found.PublishAt != nil {
+		t.Errorf("published post = %+v, want published without a schedule", found)
+	}
+
+	if _, err := repo.Transition(post.ID, models.PostDraft); err != nil {
+		t.Errorf("published -> draft failed: %v", err)
+	}
+
+	// The legacy flag set to the current state is not a transition
+	unpublished := false
+	if draft, err := repo.Update(post.ID, &models.UpdatePostRequest{Published: &unpublished}); err != nil || draft.Status != models.PostDraft {
+		t.Errorf("Update(Published=false) of a draft = %+v, %v; want it to stay a draft", draft, err)
+	}
+}
@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// DefaultPublishInterval is how often Publisher checks for due posts
+const DefaultPublishInterval = time.Minute
+
+// Publisher periodically publishes posts whose scheduled publish time
+// has passed
+type Publisher struct {
+	posts    *PostRepository
+	interval time.Duration
+	now      func() time.Time
+}
+
+// NewPublisher creates a Publisher checking every interval, or every
+// DefaultPublishInterval when interval is not positive
+func NewPublisher(posts *PostRepository, interval time.Duration) *Publisher {
+	if interval <= 0 {
+		interval = DefaultPublishInterval
+	}
+	return &Publisher{posts: posts, interval: interval, now: time.Now}
+}
+
+// RunOnce publishes all posts due now and returns how many were published
+func (p *Publisher) RunOnce(ctx context.Context) (int64, error) {
+	return p.posts.PublishDueContext(ctx, p.now())
+}
+
+// Run publishes due posts immediately and then on every tick until ctx is
+// done. Failures are logged and retried on the next tick.
+func (p *Publisher) Run(ctx context.Context) error {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		if n, err := p.RunOnce(ctx); err != nil {
+			log.Printf("scheduled publisher: %v", err)
+		} else if n > 0 {
+			log.Printf("scheduled publisher: published %d posts", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"time"
+
+	"lab04-backend/database"
+	"lab04-backend/models"
+)
+
+// trashedMode controls how soft-deleted rows are treated by read queries
+type trashedMode int
+
+const (
+	excludeTrashed trashedMode = iota
+	includeTrashed
+	onlyTrashed
+)
+
+// queryOptions holds per-call settings for repository read methods
+type queryOptions struct {
+	trashed trashedMode
+}
+
+// QueryOption customizes a repository read query
+type QueryOption func(*queryOptions)
+
+// WithTrashed includes soft-deleted rows in the result
+func WithTrashed() QueryOption {
+	return func(o *queryOptions) {
+		o.trashed = includeTrashed
+	}
+}
+
+// OnlyTrashed returns soft-deleted rows only
+func OnlyTrashed() QueryOption {
+	return func(o *queryOptions) {
+		o.trashed = onlyTrashed
+	}
+}
+
+func buildQueryOptions(opts []QueryOption) queryOptions {
+	var o queryOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// deletedCondition returns the WHERE condition on the given deleted_at
+// column that matches the configured trashed mode
+func (o queryOptions) deletedCondition(column string) string {
+	switch o.trashed {
+	case includeTrashed:
+		return "1 = 1"
+	case onlyTrashed:
+		return column + " IS NOT NULL"
+	default:
+		return column + " IS NULL"
+	}
+}
+
+// postCondition is deletedCondition on posts.deleted_at that, by default,
+// also hides the posts of soft-deleted authors. WithTrashed and OnlyTrashed
+// look at posts regardless of their author.
+func (o queryOptions) postCondition() string {
+	if o.trashed != excludeTrashed {
+		return o.deletedCondition("posts.deleted_at")
+	}
+	return o.deletedCondition("posts.deleted_at") + " AND " + models.ActiveAuthorCondition
+}
+
+// repositoryOptions holds settings shared by all calls of a repository
+type repositoryOptions struct {
+	queryTimeout time.Duration
+}
+
+// RepositoryOption customizes a repository at construction time
+type RepositoryOption func(*repositoryOptions)
+
+// WithQueryTimeout bounds every query of the repository. A zero or
+// negative duration disables the timeout. Deadlines already on the
+// caller's context still apply when they are earlier.
+func WithQueryTimeout(timeout time.Duration) RepositoryOption {
+	return func(o *repositoryOptions) {
+		o.queryTimeout = timeout
+	}
+}
+
+// WithConfig applies the repository settings of config, currently its
+// QueryTimeout
+func WithConfig(config *database.Config) RepositoryOption {
+	return WithQueryTimeout(config.QueryTimeout)
+}
+
+func buildRepositoryOptions(opts []RepositoryOption) repositoryOptions {
+	o := repositoryOptions{queryTimeout: database.DefaultQueryTimeout}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
@@ -3,18 +3,25 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
+	"unicode"
 
+	"lab04-backend/database"
 	"lab04-backend/models"
 
 	"github.com/Masterminds/squirrel"
+	"github.com/georgysavva/scany/v2/sqlscan"
 )
 
 // SearchService handles dynamic search operations using Squirrel query builder
 // This service demonstrates SQUIRREL QUERY BUILDER approach for dynamic SQL
 type SearchService struct {
-	db   *sql.DB
-	psql squirrel.StatementBuilderType
+	db           *sql.DB
+	psql         squirrel.StatementBuilderType
+	queryTimeout time.Duration
 }
 
 // SearchFilters represents search parameters
@@ -23,83 +30,246 @@ type SearchFilters struct {
 	UserID       *int   // Filter by user ID
 	Published    *bool  // Filter by published status
 	MinWordCount *int   // Minimum word count in content
+	CategoryIDs  []uint // Posts tagged with any of these categories
 	Limit        int    // Results limit (default 50)
 	Offset       int    // Results offset (for pagination)
-	OrderBy      string // Order by field (title, created_at, updated_at)
+	Cursor       string // Keyset cursor for SearchPostsPage
+	OrderBy      string // Order by field (title, created_at, updated_at, relevance)
 	OrderDir     string // Order direction (ASC, DESC)
 }
 
+// ErrUnsupportedOrder is returned when the filters ask for an ordering the
+// search cannot provide
+var ErrUnsupportedOrder = errors.New("unsupported search order")
+
+// PostMatch is a post returned by a full-text search together with its
+// relevance and a highlighted excerpt of the content
+type PostMatch struct {
+	models.Post
+	// Rank is the bm25 score; lower means more relevant
+	Rank float64 `db:"rank" json:"rank"`
+	// Snippet is an excerpt of the content with matches wrapped in
+	// SnippetStart/SnippetEnd
+	Snippet string `db:"snippet" json:"snippet"`
+}
+
+// Snippet highlight markers
+const (
+	SnippetStart    = "<mark>"
+	SnippetEnd      = "</mark>"
+	snippetEllipsis = "…"
+	snippetTokens   = 12
+)
+
+const (
+	defaultSearchLimit = 50
+	maxSearchLimit     = 500
+)
+
+// sortableColumns maps SearchFilters.OrderBy values to posts columns
+var sortableColumns = map[string]string{
+	"title":      "posts.title",
+	"created_at": "posts.created_at",
+	"updated_at": "posts.updated_at",
+}
+
+// qualifiedPostColumns is postColumns prefixed with the table name, for
+// queries that join posts with other tables
+var qualifiedPostColumns = []string{
+	"posts.id", "posts.user_id", "posts.title", "posts.content", "posts.published",
+	"posts.created_at", "posts.updated_at", "posts.deleted_at", "posts.status", "posts.publish_at",
+}
+
 // NewSearchService creates a new SearchService
-func NewSearchService(db *sql.DB) *SearchService {
+func NewSearchService(db *sql.DB, opts ...RepositoryOption) *SearchService {
+	o := buildRepositoryOptions(opts)
 	return &SearchService{
-		db:   db,
-		psql: squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar),
+		db:           db,
+		psql:         squirrel.StatementBuilder.PlaceholderFormat(placeholderFormatFor(db)),
+		queryTimeout: o.queryTimeout,
 	}
 }
 
-// TODO: Implement SearchPosts method using Squirrel query builder
+// placeholderFormatFor picks the bind variable style of the database driver:
+// "$1" for PostgreSQL drivers and "?" for SQLite and everything else
+func placeholderFormatFor(db *sql.DB) squirrel.PlaceholderFormat {
+	driverType := strings.ToLower(fmt.Sprintf("%T", db.Driver()))
+	switch {
+	case strings.Contains(driverType, "pq."), strings.Contains(driverType, "pgx"):
+		return squirrel.Dollar
+	default:
+		return squirrel.Question
+	}
+}
+
+// SearchPosts returns posts matching the filters. When filters.Query is
+// set results are ordered by relevance unless OrderBy says otherwise.
 func (s *SearchService) SearchPosts(ctx context.Context, filters SearchFilters) ([]models.Post, error) {
-	// TODO: Build dynamic query using Squirrel instead of string concatenation
-	//
-	// Start with base query:
-	// query := s.psql.Select("id", "user_id", "title", "content", "published", "created_at", "updated_at").
-	//              From("posts")
-	//
-	// Add WHERE conditions dynamically:
-	// - If filters.Query: add ILIKE conditions for title and content
-	// - If filters.UserID: add user_id = ?
-	// - If filters.Published: add published = ?
-	// - If filters.MinWordCount: add word count condition
-	//
-	// Add ORDER BY dynamically:
-	// - Use OrderBy() and validate sort fields
-	//
-	// Add LIMIT/OFFSET:
-	// - Use Limit() and Offset()
-	//
-	// Build final SQL:
-	// sql, args, err := query.ToSql()
-	//
-	// Execute with scany:
-	// var posts []models.Post
-	// err = sqlscan.Select(ctx, s.db, &posts, sql, args...)
-	//
-	// This demonstrates the power of combining Squirrel (dynamic queries)
-	// with scany (automatic result mapping)
-
-	return nil, fmt.Errorf("TODO: implement SearchPosts with Squirrel query builder")
-}
-
-// TODO: Implement SearchUsers method using Squirrel
+	matches, err := s.SearchPostMatches(ctx, filters)
+	if err != nil {
+		return nil, err
+	}
+
+	posts := make([]models.Post, len(matches))
+	for i, match := range matches {
+		posts[i] = match.Post
+	}
+	return posts, nil
+}
+
+// SearchPostMatches is SearchPosts that also returns rank and snippet.
+// filters.Query goes through the posts_fts index when it exists and falls
+// back to LIKE matching otherwise; in that case Rank is always 0.
+func (s *SearchService) SearchPostMatches(ctx context.Context, filters SearchFilters) ([]PostMatch, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx, s.queryTimeout)
+	defer cancel()
+
+	query, ranked, err := s.buildPostSearch(filters)
+	if err != nil {
+		return nil, err
+	}
+	query = applySearchOrder(query, filters, ranked)
+	query = applySearchPage(query, filters)
+
+	return s.selectPostMatches(ctx, query, filters, ranked)
+}
+
+// SearchPostsPage is SearchPosts with keyset pagination on
+// (created_at, id), newest first. Limit is the page size and Cursor
+// continues from a previous page; OrderBy and Offset are not supported.
+func (s *SearchService) SearchPostsPage(ctx context.Context, filters SearchFilters) (*Page[models.Post], error) {
+	if filters.OrderBy != "" && filters.OrderBy != "created_at" {
+		return nil, fmt.Errorf("%w: keyset search only orders by created_at, got %q", ErrUnsupportedOrder, filters.OrderBy)
+	}
+	cursor, err := decodeCursor(filters.Cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := database.WithQueryTimeout(ctx, s.queryTimeout)
+	defer cancel()
+
+	query, ranked, err := s.buildPostSearch(filters)
+	if err != nil {
+		return nil, err
+	}
+	if cursor != nil {
+		query = query.Where(keysetCondition("posts", true), cursor.CreatedAt, cursor.ID)
+	}
+	limit := PageRequest{Limit: filters.Limit}.limit()
+	query = query.OrderBy(keysetOrder("posts", true)).Limit(uint64(limit + 1))
+
+	matches, err := s.selectPostMatches(ctx, query, filters, ranked)
+	if err != nil {
+		return nil, err
+	}
+
+	posts := make([]models.Post, len(matches))
+	for i, match := range matches {
+		posts[i] = match.Post
+	}
+	return newPage(posts, limit, postKey), nil
+}
+
+// buildPostSearch builds the filtered posts query without ORDER BY or
+// LIMIT. ranked reports whether it goes through the posts_fts index.
+func (s *SearchService) buildPostSearch(filters SearchFilters) (query squirrel.SelectBuilder, ranked bool, err error) {
+	if terms := searchTerms(filters.Query); len(terms) > 0 {
+		if ranked, err = database.HasPostSearchIndex(s.db); err != nil {
+			return query, false, err
+		}
+	}
+
+	if ranked {
+		query = s.psql.Select(qualifiedPostColumns...).
+			Column("bm25(posts_fts) AS rank").
+			Column(fmt.Sprintf("snippet(posts_fts, 1, '%s', '%s', '%s', %d) AS snippet",
+				SnippetStart, SnippetEnd, snippetEllipsis, snippetTokens)).
+			From("posts_fts").
+			Join("posts ON posts.id = posts_fts.rowid").
+			Where("posts_fts MATCH ?", ftsMatchExpression(searchTerms(filters.Query)))
+
+		// The MATCH clause replaces the LIKE conditions on Query
+		indexed := filters
+		indexed.Query = ""
+		return s.BuildDynamicQuery(query, indexed), true, nil
+	}
+
+	query = s.psql.Select(qualifiedPostColumns...).
+		Column("0 AS rank").
+		Column("'' AS snippet").
+		From("posts")
+	return s.BuildDynamicQuery(query, filters), false, nil
+}
+
+// selectPostMatches runs a query built by buildPostSearch
+func (s *SearchService) selectPostMatches(ctx context.Context, query squirrel.SelectBuilder, filters SearchFilters, ranked bool) ([]PostMatch, error) {
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build search query: %v", err)
+	}
+
+	matches := make([]PostMatch, 0)
+	if err := sqlscan.Select(ctx, s.db, &matches, sqlStr, args...); err != nil {
+		return nil, err
+	}
+
+	if terms := searchTerms(filters.Query); !ranked && len(terms) > 0 {
+		for i := range matches {
+			matches[i].Snippet = fallbackSnippet(matches[i].Content, terms)
+		}
+	}
+	return matches, nil
+}
+
+// SearchUsers returns users whose name contains nameQuery, ordered by name
 func (s *SearchService) SearchUsers(ctx context.Context, nameQuery string, limit int) ([]models.User, error) {
-	// TODO: Build user search query with Squirrel
-	// query := s.psql.Select("id", "name", "email", "created_at", "updated_at").
-	//              From("users").
-	//              Where(squirrel.Like{"name": "%" + nameQuery + "%"}).
-	//              OrderBy("name").
-	//              Limit(uint64(limit))
-	//
-	// sql, args, err := query.ToSql()
-	// var users []models.User
-	// err = sqlscan.Select(ctx, s.db, &users, sql, args...)
+	ctx, cancel := database.WithQueryTimeout(ctx, s.queryTimeout)
+	defer cancel()
+
+	query := s.psql.Select("id", "name", "email", "created_at", "updated_at", "deleted_at").
+		From("users").
+		Where(squirrel.Like{"name": "%" + nameQuery + "%"}).
+		Where("deleted_at IS NULL").
+		OrderBy("name").
+		Limit(uint64(normalizeLimit(limit)))
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build user search query: %v", err)
+	}
 
-	return nil, fmt.Errorf("TODO: implement SearchUsers with Squirrel")
+	users := make([]models.User, 0)
+	err = sqlscan.Select(ctx, s.db, &users, sqlStr, args...)
+	return users, err
 }
 
-// TODO: Implement GetPostStats method using Squirrel with JOINs
+// GetPostStats returns aggregated statistics over non-deleted posts of
+// non-deleted users
 func (s *SearchService) GetPostStats(ctx context.Context) (*PostStats, error) {
-	// TODO: Build complex query with JOINs using Squirrel
-	// query := s.psql.Select(
-	//     "COUNT(p.id) as total_posts",
-	//     "COUNT(CASE WHEN p.published = true THEN 1 END) as published_posts",
-	//     "COUNT(DISTINCT p.user_id) as active_users",
-	//     "AVG(LENGTH(p.content)) as avg_content_length",
-	// ).From("posts p").
-	//   Join("users u ON p.user_id = u.id")
-	//
-	// This shows how Squirrel handles complex queries better than string building
+	ctx, cancel := database.WithQueryTimeout(ctx, s.queryTimeout)
+	defer cancel()
+
+	query := s.psql.Select(
+		"COUNT(p.id) AS total_posts",
+		"COUNT(CASE WHEN p.published THEN 1 END) AS published_posts",
+		"COUNT(DISTINCT p.user_id) AS active_users",
+		"COALESCE(AVG(LENGTH(p.content)), 0) AS avg_content_length",
+	).From("posts p").
+		Join("users u ON p.user_id = u.id").
+		Where("p.deleted_at IS NULL").
+		Where("u.deleted_at IS NULL")
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build post stats query: %v", err)
+	}
 
-	return nil, fmt.Errorf("TODO: implement GetPostStats with Squirrel JOINs")
+	var stats PostStats
+	if err := sqlscan.Get(ctx, s.db, &stats, sqlStr, args...); err != nil {
+		return nil, err
+	}
+	return &stats, nil
 }
 
 // PostStats represents aggregated post statistics
@@ -110,54 +280,77 @@ type PostStats struct {
 	AvgContentLength float64 `db:"avg_content_length"`
 }
 
-// TODO: Implement BuildDynamicQuery helper method
+// BuildDynamicQuery adds the WHERE conditions of filters to baseQuery.
+// baseQuery must select from posts; Query is matched with LIKE.
 func (s *SearchService) BuildDynamicQuery(baseQuery squirrel.SelectBuilder, filters SearchFilters) squirrel.SelectBuilder {
-	// TODO: Demonstrate how to build queries step by step with Squirrel
-	//
-	// query := baseQuery
-	//
-	// if filters.Query != "" {
-	//     searchTerm := "%" + filters.Query + "%"
-	//     query = query.Where(squirrel.Or{
-	//         squirrel.ILike{"title": searchTerm},
-	//         squirrel.ILike{"content": searchTerm},
-	//     })
-	// }
-	//
-	// if filters.UserID != nil {
-	//     query = query.Where(squirrel.Eq{"user_id": *filters.UserID})
-	// }
-	//
-	// if filters.Published != nil {
-	//     query = query.Where(squirrel.Eq{"published": *filters.Published})
-	// }
-	//
-	// This modular approach makes dynamic queries much cleaner
-	// than string concatenation used in manual SQL approaches
-
-	return baseQuery
-}
-
-// TODO: Implement GetTopUsers method using Squirrel with complex aggregation
+	query := baseQuery.Where("posts.deleted_at IS NULL").Where(models.ActiveAuthorCondition)
+
+	if filters.Query != "" {
+		searchTerm := "%" + filters.Query + "%"
+		query = query.Where(squirrel.Or{
+			squirrel.Like{"posts.title": searchTerm},
+			squirrel.Like{"posts.content": searchTerm},
+		})
+	}
+
+	if filters.UserID != nil {
+		query = query.Where(squirrel.Eq{"posts.user_id": *filters.UserID})
+	}
+
+	if filters.Published != nil {
+		query = query.Where(squirrel.Eq{"posts.published": *filters.Published})
+	}
+
+	if len(filters.CategoryIDs) > 0 {
+		// Built without s.psql so the outer query numbers the placeholders
+		tagged := squirrel.Select("post_id").
+			From("post_categories").
+			Where(squirrel.Eq{"category_id": filters.CategoryIDs})
+		query = query.Where(squirrel.Expr("posts.id IN (?)", tagged))
+	}
+
+	if filters.MinWordCount != nil {
+		// Words are counted as single-space separated runs of text
+		query = query.Where(
+			"(CASE WHEN TRIM(COALESCE(posts.content, '')) = '' THEN 0 "+
+				"ELSE LENGTH(TRIM(posts.content)) - LENGTH(REPLACE(TRIM(posts.content), ' ', '')) + 1 END) >= ?",
+			*filters.MinWordCount,
+		)
+	}
+
+	return query
+}
+
+// GetTopUsers returns users ranked by their number of posts
 func (s *SearchService) GetTopUsers(ctx context.Context, limit int) ([]UserWithStats, error) {
-	// TODO: Build complex aggregation query with Squirrel
-	// query := s.psql.Select(
-	//     "u.id",
-	//     "u.name",
-	//     "u.email",
-	//     "COUNT(p.id) as post_count",
-	//     "COUNT(CASE WHEN p.published = true THEN 1 END) as published_count",
-	//     "MAX(p.created_at) as last_post_date",
-	// ).From("users u").
-	//   LeftJoin("posts p ON u.id = p.user_id").
-	//   GroupBy("u.id", "u.name", "u.email").
-	//   OrderBy("post_count DESC").
-	//   Limit(uint64(limit))
-	//
-	// Notice how Squirrel makes complex queries more readable
-	// compared to building SQL strings manually
-
-	return nil, fmt.Errorf("TODO: implement GetTopUsers with Squirrel aggregation")
+	ctx, cancel := database.WithQueryTimeout(ctx, s.queryTimeout)
+	defer cancel()
+
+	query := s.psql.Select(
+		"u.id",
+		"u.name",
+		"u.email",
+		"u.created_at",
+		"u.updated_at",
+		"u.deleted_at",
+		"COUNT(p.id) AS post_count",
+		"COUNT(CASE WHEN p.published THEN 1 END) AS published_count",
+		"COALESCE(MAX(p.created_at), '') AS last_post_date",
+	).From("users u").
+		LeftJoin("posts p ON u.id = p.user_id AND p.deleted_at IS NULL").
+		Where("u.deleted_at IS NULL").
+		GroupBy("u.id", "u.name", "u.email").
+		OrderBy("post_count DESC", "u.id").
+		Limit(uint64(normalizeLimit(limit)))
+
+	sqlStr, args, err := query.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build top users query: %v", err)
+	}
+
+	users := make([]UserWithStats, 0)
+	err = sqlscan.Select(ctx, s.db, &users, sqlStr, args...)
+	return users, err
 }
 
 // UserWithStats represents a user with post statistics
@@ -167,3 +360,98 @@ type UserWithStats struct {
 	PublishedCount int    `db:"published_count"`
 	LastPostDate   string `db:"last_post_date"`
 }
+
+// applySearchOrder adds the ORDER BY clause. Unknown OrderBy values fall
+// back to relevance for indexed searches and created_at otherwise.
+func applySearchOrder(query squirrel.SelectBuilder, filters SearchFilters, ranked bool) squirrel.SelectBuilder {
+	dir := "DESC"
+	if strings.EqualFold(filters.OrderDir, "ASC") {
+		dir = "ASC"
+	}
+
+	column, ok := sortableColumns[filters.OrderBy]
+	if !ok {
+		if ranked {
+			// bm25 scores are negative; the most relevant row sorts first
+			return query.OrderBy("rank", "posts.id")
+		}
+		column = "posts.created_at"
+	}
+	return query.OrderBy(column+" "+dir, "posts.id "+dir)
+}
+
+func applySearchPage(query squirrel.SelectBuilder, filters SearchFilters) squirrel.SelectBuilder {
+	query = query.Limit(uint64(normalizeLimit(filters.Limit)))
+	if filters.Offset > 0 {
+		query = query.Offset(uint64(filters.Offset))
+	}
+	return query
+}
+
+func normalizeLimit(limit int) int {
+	if limit <= 0 {
+		return defaultSearchLimit
+	}
+	if limit > maxSearchLimit {
+		return maxSearchLimit
+	}
+	return limit
+}
+
+// searchTerms splits free text into lowercase words, dropping punctuation
+// so user input can never break the FTS5 query syntax
+func searchTerms(query string) []string {
+	return strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// ftsMatchExpression builds an FTS5 query that requires every term,
+// matching each one as a prefix
+func ftsMatchExpression(terms []string) string {
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = `"` + term + `"*`
+	}
+	return strings.Join(quoted, " AND ")
+}
+
+// fallbackSnippet highlights the first term found in content when the
+// FTS5 index is not available
+func fallbackSnippet(content string, terms []string) string {
+	const radius = 40
+
+	lower := strings.ToLower(content)
+	if len(lower) != len(content) {
+		// Case folding changed byte offsets; match case-sensitively instead
+		lower = content
+	}
+	for _, term := range terms {
+		idx := strings.Index(lower, term)
+		if idx < 0 {
+			continue
+		}
+		start, end := idx-radius, idx+len(term)+radius
+		prefix, suffix := snippetEllipsis, snippetEllipsis
+		if start <= 0 {
+			start, prefix = 0, ""
+		}
+		if end >= len(content) {
+			end, suffix = len(content), ""
+		}
+		// Keep the window on valid UTF-8 boundaries
+		for start > 0 && !isRuneStart(content[start]) {
+			start--
+		}
+		for end < len(content) && !isRuneStart(content[end]) {
+			end++
+		}
+		return prefix + content[start:idx] + SnippetStart + content[idx:idx+len(term)] + SnippetEnd +
+			content[idx+len(term):end] + suffix
+	}
+	return ""
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
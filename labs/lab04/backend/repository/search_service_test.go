@@ -1,142 +1,280 @@
 package repository
 
 import (
+	"context"
+	"database/sql"
+	"os"
+	"strings"
 	"testing"
 
 	"lab04-backend/database"
+	"lab04-backend/fixtures"
+	"lab04-backend/models"
+
+	"github.com/Masterminds/squirrel"
 )
 
-// TestSearchService tests the Squirrel query builder approach
-func TestSearchService(t *testing.T) {
-	// Initialize database for testing
-	db, err := database.InitDB()
+// setupSearchService creates a fresh database loaded with testdata/search.yaml
+func setupSearchService(t *testing.T) (*SearchService, *sql.DB, []models.User, func()) {
+	testDB := "./test_search_service.db"
+	os.Remove(testDB)
+
+	db, err := database.InitDBWithConfig(&database.Config{
+		DatabasePath: testDB,
+		MaxOpenConns: 5,
+		MaxIdleConns: 1,
+	})
 	if err != nil {
 		t.Fatalf("Failed to initialize database: %v", err)
 	}
-	defer database.CloseDB(db)
+	cleanup := func() {
+		database.CloseDB(db)
+		os.Remove(testDB)
+	}
 
-	// Run migrations
 	if err := database.RunMigrations(db); err != nil {
+		cleanup()
 		t.Fatalf("Failed to run migrations: %v", err)
 	}
 
-	// Create service instance
-	searchService := NewSearchService(db)
+	if _, err := fixtures.Apply(context.Background(), db, "testdata/search.yaml"); err != nil {
+		cleanup()
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+	users, err := NewUserRepository(db).GetAll()
+	if err != nil {
+		cleanup()
+		t.Fatalf("Failed to list users: %v", err)
+	}
+
+	return NewSearchService(db), db, users, cleanup
+}
+
+// TestSearchService tests the Squirrel query builder approach
+func TestSearchService(t *testing.T) {
+	searchService, db, users, cleanup := setupSearchService(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	published := true
 
-	// TODO: Test SearchPosts with various filters
 	t.Run("SearchPosts with filters", func(t *testing.T) {
-		// TODO: Test dynamic query building with Squirrel
-		// - Test empty filters (should return all posts)
-		// - Test search by query string
-		// - Test filter by user ID
-		// - Test filter by published status
-		// - Test pagination (limit/offset)
-		// - Test sorting (order by different fields)
-		//
-		// Example test structure:
-		// filters := SearchFilters{
-		//     Query: "golang",
-		//     Published: &[]bool{true}[0],
-		//     Limit: 10,
-		//     OrderBy: "created_at",
-		//     OrderDir: "DESC",
-		// }
-		// posts, err := searchService.SearchPosts(context.Background(), filters)
-		// assert.NoError(t, err)
-		// assert.LessOrEqual(t, len(posts), 10)
-
-		// Use searchService to avoid "declared and not used" error
-		_ = searchService
-		t.Skip("TODO: implement SearchPosts test with Squirrel filters")
+		posts, err := searchService.SearchPosts(ctx, SearchFilters{})
+		if err != nil {
+			t.Fatalf("SearchPosts() failed: %v", err)
+		}
+		if len(posts) != 4 {
+			t.Errorf("SearchPosts() with empty filters returned %d posts, want 4", len(posts))
+		}
+
+		posts, err = searchService.SearchPosts(ctx, SearchFilters{Query: "golang", Published: &published})
+		if err != nil {
+			t.Fatalf("SearchPosts() failed: %v", err)
+		}
+		if len(posts) != 3 {
+			t.Errorf("SearchPosts(golang, published) returned %d posts, want 3", len(posts))
+		}
+
+		posts, err = searchService.SearchPosts(ctx, SearchFilters{UserID: &users[1].ID})
+		if err != nil {
+			t.Fatalf("SearchPosts() failed: %v", err)
+		}
+		if len(posts) != 1 || posts[0].UserID != users[1].ID {
+			t.Errorf("SearchPosts(UserID) returned %+v, want the single post of user %d", posts, users[1].ID)
+		}
+
+		minWords := 9
+		posts, err = searchService.SearchPosts(ctx, SearchFilters{MinWordCount: &minWords})
+		if err != nil {
+			t.Fatalf("SearchPosts() failed: %v", err)
+		}
+		if len(posts) != 1 {
+			t.Errorf("SearchPosts(MinWordCount) returned %d posts, want 1", len(posts))
+		}
+
+		page, err := searchService.SearchPosts(ctx, SearchFilters{Limit: 2, Offset: 1, OrderBy: "title", OrderDir: "ASC"})
+		if err != nil {
+			t.Fatalf("SearchPosts() failed: %v", err)
+		}
+		if len(page) != 2 || page[0].Title != "Draft about Flutter" {
+			t.Errorf("SearchPosts(page) returned %+v, want 2 posts starting with the second title", page)
+		}
+
+		// Punctuation in the query must not break the full-text syntax
+		if _, err := searchService.SearchPosts(ctx, SearchFilters{Query: `golang" OR (`}); err != nil {
+			t.Errorf("SearchPosts() with punctuation failed: %v", err)
+		}
+	})
+
+	t.Run("SearchPostMatches ranking and snippets", func(t *testing.T) {
+		matches, err := searchService.SearchPostMatches(ctx, SearchFilters{Query: "golang"})
+		if err != nil {
+			t.Fatalf("SearchPostMatches() failed: %v", err)
+		}
+		if len(matches) != 3 {
+			t.Fatalf("SearchPostMatches() returned %d matches, want 3", len(matches))
+		}
+		for _, match := range matches {
+			if !strings.Contains(match.Snippet, SnippetStart) {
+				t.Errorf("Snippet %q should highlight the match", match.Snippet)
+			}
+		}
+
+		indexed, err := database.HasPostSearchIndex(db)
+		if err != nil {
+			t.Fatalf("HasPostSearchIndex() failed: %v", err)
+		}
+		if !indexed {
+			t.Skip("FTS5 not compiled in; run with -tags sqlite_fts5 to test ranking")
+		}
+
+		// The reading list only mentions golang once in the content
+		if matches[len(matches)-1].Title != "Reading list for summer" {
+			t.Errorf("least relevant match = %q, want the reading list", matches[len(matches)-1].Title)
+		}
+		for i := 1; i < len(matches); i++ {
+			if matches[i-1].Rank > matches[i].Rank {
+				t.Errorf("matches not ordered by rank: %v > %v", matches[i-1].Rank, matches[i].Rank)
+			}
+		}
+
+		// Triggers keep the index in sync with edits
+		title := "Rust ownership explained"
+		content := "Borrowing rules"
+		postRepo := NewPostRepository(db)
+		if _, err := postRepo.Update(matches[0].ID, &models.UpdatePostRequest{Title: &title, Content: &content}); err != nil {
+			t.Fatalf("Update() failed: %v", err)
+		}
+		rust, err := searchService.SearchPosts(ctx, SearchFilters{Query: "borrowing"})
+		if err != nil || len(rust) != 1 {
+			t.Errorf("SearchPosts(borrowing) = %d posts, %v; want 1 post", len(rust), err)
+		}
+	})
+
+	t.Run("SearchPostsPage", func(t *testing.T) {
+		first, err := searchService.SearchPostsPage(ctx, SearchFilters{UserID: &users[0].ID, Limit: 2})
+		if err != nil {
+			t.Fatalf("SearchPostsPage() failed: %v", err)
+		}
+		if len(first.Items) != 2 || !first.HasMore {
+			t.Fatalf("first page = %+v, want 2 posts and more", first)
+		}
+
+		second, err := searchService.SearchPostsPage(ctx, SearchFilters{UserID: &users[0].ID, Limit: 2, Cursor: first.NextCursor})
+		if err != nil {
+			t.Fatalf("SearchPostsPage() failed: %v", err)
+		}
+		if len(second.Items) != 1 || second.HasMore || second.NextCursor != "" {
+			t.Errorf("second page = %+v, want the last post only", second)
+		}
+
+		if _, err := searchService.SearchPostsPage(ctx, SearchFilters{OrderBy: "title"}); err == nil {
+			t.Error("SearchPostsPage() should reject ordering other than created_at")
+		}
 	})
 
-	// TODO: Test SearchUsers functionality
 	t.Run("SearchUsers", func(t *testing.T) {
-		// TODO: Test user search with Squirrel
-		// - Test exact name matches
-		// - Test partial name matches with LIKE
-		// - Test case insensitive search
-		// - Test limit functionality
-
-		_ = searchService
-		t.Skip("TODO: implement SearchUsers test with Squirrel")
+		found, err := searchService.SearchUsers(ctx, "alice", 10)
+		if err != nil {
+			t.Fatalf("SearchUsers() failed: %v", err)
+		}
+		if len(found) != 1 || found[0].Name != "Alice Writer" {
+			t.Errorf("SearchUsers(alice) = %+v, want Alice Writer", found)
+		}
+
+		found, err = searchService.SearchUsers(ctx, "e", 2)
+		if err != nil {
+			t.Fatalf("SearchUsers() failed: %v", err)
+		}
+		if len(found) != 2 {
+			t.Errorf("SearchUsers() with limit 2 returned %d users", len(found))
+		}
 	})
 
-	// TODO: Test GetPostStats with complex aggregation
 	t.Run("GetPostStats", func(t *testing.T) {
-		// TODO: Test complex aggregation query
-		// - Insert test data (users and posts)
-		// - Test aggregation calculations
-		// - Verify JOIN functionality
-		// - Test with no data (empty tables)
-
-		_ = searchService
-		t.Skip("TODO: implement GetPostStats test with Squirrel JOINs")
+		stats, err := searchService.GetPostStats(ctx)
+		if err != nil {
+			t.Fatalf("GetPostStats() failed: %v", err)
+		}
+		if stats.TotalPosts != 4 || stats.PublishedPosts != 3 || stats.ActiveUsers != 2 {
+			t.Errorf("GetPostStats() = %+v, want 4 total, 3 published, 2 active users", stats)
+		}
+		if stats.AvgContentLength <= 0 {
+			t.Error("GetPostStats() AvgContentLength should be positive")
+		}
 	})
 
-	// TODO: Test GetTopUsers with aggregation and sorting
 	t.Run("GetTopUsers", func(t *testing.T) {
-		// TODO: Test user ranking with post statistics
-		// - Insert users with different post counts
-		// - Test ordering by post count
-		// - Test LEFT JOIN behavior (users with no posts)
-		// - Test limit functionality
-
-		_ = searchService
-		t.Skip("TODO: implement GetTopUsers test with Squirrel aggregation")
+		top, err := searchService.GetTopUsers(ctx, 10)
+		if err != nil {
+			t.Fatalf("GetTopUsers() failed: %v", err)
+		}
+		if len(top) != 3 {
+			t.Fatalf("GetTopUsers() returned %d users, want 3", len(top))
+		}
+		if top[0].ID != users[0].ID || top[0].PostCount != 3 || top[0].PublishedCount != 2 {
+			t.Errorf("GetTopUsers()[0] = %+v, want Alice with 3 posts", top[0])
+		}
+		if top[2].PostCount != 0 || top[2].LastPostDate != "" {
+			t.Errorf("GetTopUsers()[2] = %+v, want a user without posts", top[2])
+		}
 	})
 
-	// TODO: Test BuildDynamicQuery helper
 	t.Run("BuildDynamicQuery", func(t *testing.T) {
-		// TODO: Test query building step by step
-		// - Test with different filter combinations
-		// - Verify generated SQL syntax
-		// - Test parameter binding
-		//
-		// Example:
-		// baseQuery := searchService.psql.Select("*").From("posts")
-		// filters := SearchFilters{Query: "test", Published: &[]bool{true}[0]}
-		// query := searchService.BuildDynamicQuery(baseQuery, filters)
-		// sql, args, err := query.ToSql()
-		// assert.NoError(t, err)
-		// assert.Contains(t, sql, "WHERE")
-		// assert.Contains(t, sql, "published")
-
-		_ = searchService
-		t.Skip("TODO: implement BuildDynamicQuery test")
+		baseQuery := searchService.psql.Select("*").From("posts")
+		query := searchService.BuildDynamicQuery(baseQuery, SearchFilters{Query: "test", Published: &published})
+		sqlStr, args, err := query.ToSql()
+		if err != nil {
+			t.Fatalf("ToSql() failed: %v", err)
+		}
+		if !strings.Contains(sqlStr, "WHERE") || !strings.Contains(sqlStr, "posts.published = ?") {
+			t.Errorf("BuildDynamicQuery() sql = %s", sqlStr)
+		}
+		if strings.Contains(sqlStr, "$1") {
+			t.Errorf("BuildDynamicQuery() should use SQLite placeholders, got %s", sqlStr)
+		}
+		if len(args) != 3 {
+			t.Errorf("BuildDynamicQuery() args = %v, want 3", args)
+		}
 	})
 }
 
 // TestSquirrelQueryBuilder tests Squirrel query building functionality
 func TestSquirrelQueryBuilder(t *testing.T) {
-	// TODO: Test Squirrel query builder patterns
 	t.Run("Basic Query Building", func(t *testing.T) {
-		// TODO: Test basic Squirrel functionality
-		// - Test SELECT with WHERE conditions
-		// - Test dynamic WHERE building
-		// - Test ORDER BY, LIMIT, OFFSET
-		// - Test parameter placeholder generation
-		//
-		// Example:
-		// psql := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)
-		// query := psql.Select("id", "name").From("users").Where(squirrel.Eq{"active": true})
-		// sql, args, err := query.ToSql()
-		// assert.NoError(t, err)
-		// assert.Equal(t, "SELECT id, name FROM users WHERE active = $1", sql)
-		// assert.Equal(t, []interface{}{true}, args)
-
-		t.Skip("TODO: implement basic Squirrel query building tests")
+		psql := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)
+		query := psql.Select("id", "name").From("users").Where(squirrel.Eq{"active": true})
+		sqlStr, args, err := query.ToSql()
+		if err != nil {
+			t.Fatalf("ToSql() failed: %v", err)
+		}
+		if sqlStr != "SELECT id, name FROM users WHERE active = $1" {
+			t.Errorf("ToSql() = %s", sqlStr)
+		}
+		if len(args) != 1 || args[0] != true {
+			t.Errorf("ToSql() args = %v", args)
+		}
 	})
 
 	t.Run("Complex Query Building", func(t *testing.T) {
-		// TODO: Test complex Squirrel features
-		// - Test JOINs
-		// - Test subqueries
-		// - Test complex WHERE conditions (OR, AND, IN)
-		// - Test aggregation functions
-		// - Test GROUP BY and HAVING
-
-		t.Skip("TODO: implement complex Squirrel query tests")
+		query := squirrel.Select("u.id", "COUNT(p.id) AS post_count").
+			From("users u").
+			LeftJoin("posts p ON u.id = p.user_id").
+			Where(squirrel.Or{squirrel.Eq{"u.id": []int{1, 2}}, squirrel.Like{"u.name": "A%"}}).
+			GroupBy("u.id").
+			Having("COUNT(p.id) > ?", 0)
+		sqlStr, args, err := query.ToSql()
+		if err != nil {
+			t.Fatalf("ToSql() failed: %v", err)
+		}
+		want := "SELECT u.id, COUNT(p.id) AS post_count FROM users u LEFT JOIN posts p ON u.id = p.user_id " +
+			"WHERE (u.id IN (?,?) OR u.name LIKE ?) GROUP BY u.id HAVING COUNT(p.id) > ?"
+		if sqlStr != want {
+			t.Errorf("ToSql() = %s, want %s", sqlStr, want)
+		}
+		if len(args) != 4 {
+			t.Errorf("ToSql() args = %v, want 4", args)
+		}
 	})
 }
 
@@ -153,3 +291,51 @@ func BenchmarkSquirrelVsManualSQL(b *testing.B) {
 		b.Skip("TODO: implement manual SQL benchmark")
 	})
 }
+
+// BenchmarkSearchService runs searches over a generated data set of 200
+// users with 25 posts each. Use -tags sqlite_fts5 to measure the
+// full-text index instead of the LIKE fallback.
+func BenchmarkSearchService(b *testing.B) {
+	testDB := "./bench_search_service.db"
+	os.Remove(testDB)
+	defer os.Remove(testDB)
+
+	db, err := database.InitDBWithConfig(&database.Config{
+		DatabasePath: testDB,
+		MaxOpenConns: 5,
+		MaxIdleConns: 1,
+	})
+	if err != nil {
+		b.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer database.CloseDB(db)
+	if err := database.RunMigrations(db); err != nil {
+		b.Fatalf("Failed to run migrations: %v", err)
+	}
+
+	ctx := context.Background()
+	set := fixtures.Generate(fixtures.GenerateOptions{Seed: 1, Users: 200, PostsPerUser: 25})
+	if err := fixtures.Insert(ctx, db, set); err != nil {
+		b.Fatalf("Failed to insert generated data: %v", err)
+	}
+
+	searchService := NewSearchService(db)
+	published := true
+	benchmarks := []struct {
+		name    string
+		filters SearchFilters
+	}{
+		{"query", SearchFilters{Query: "goroutines", Limit: 20}},
+		{"query published", SearchFilters{Query: "golang caching", Published: &published, Limit: 20}},
+		{"category", SearchFilters{CategoryIDs: []uint{3}, Limit: 20}},
+	}
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := searchService.SearchPostMatches(ctx, bm.filters); err != nil {
+					b.Fatalf("SearchPostMatches() failed: %v", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// DBTX is the subset of *sql.DB and *sql.Tx used by the SQL repositories,
+// so the same repository code runs inside or outside a transaction
+type DBTX interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// UnitOfWork runs a function against repositories that all share one
+// database transaction
+type UnitOfWork struct {
+	db     *sql.DB
+	gormDB *gorm.DB
+	opts   repositoryOptions
+}
+
+// Repositories is the set of repositories bound to a single transaction
+type Repositories struct {
+	Users      *UserRepository
+	Posts      *PostRepository
+	Categories *CategoryRepository
+
+	tx    *sql.Tx
+	depth int
+}
+
+// NewUnitOfWork creates a UnitOfWork. gormDB must wrap the same *sql.DB
+// (see database.InitGORM) for categories to join the transaction.
+// The options are applied to every transaction-bound repository.
+func NewUnitOfWork(db *sql.DB, gormDB *gorm.DB, opts ...RepositoryOption) *UnitOfWork {
+	return &UnitOfWork{db: db, gormDB: gormDB, opts: buildRepositoryOptions(opts)}
+}
+
+// WithTx begins a transaction, passes transaction-bound repositories to fn
+// and commits if fn returns nil. Any error or panic rolls everything back.
+func (u *UnitOfWork) WithTx(ctx context.Context, fn func(repos *Repositories) error) (err error) {
+	tx, err := u.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+
+	gormTx := u.gormDB.WithContext(ctx)
+	gormTx.Statement.ConnPool = tx
+
+	repos := &Repositories{
+		Users:      &UserRepository{db: tx, queryTimeout: u.opts.queryTimeout},
+		Posts:      &PostRepository{db: tx, queryTimeout: u.opts.queryTimeout},
+		Categories: &CategoryRepository{db: gormTx, queryTimeout: u.opts.queryTimeout},
+		tx:         tx,
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(repos); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return fmt.Errorf("%v (rollback failed: %v)", err, rbErr)
+		}
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return nil
+}
+
+// WithTx runs fn inside a savepoint of the current transaction. If fn
+// fails only the work done since the savepoint is rolled back and the
+// error is returned, so the caller may recover and continue.
+func (r *Repositories) WithTx(ctx context.Context, fn func(repos *Repositories) error) (err error) {
+	nested := *r
+	nested.depth++
+	savepoint := fmt.Sprintf("sp_%d", nested.depth)
+
+	if _, err := r.tx.ExecContext(ctx, "SAVEPOINT "+savepoint); err != nil {
+		return fmt.Errorf("failed to create savepoint: %v", err)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			r.rollbackTo(savepoint)
+			panic(p)
+		}
+	}()
+
+	if err := fn(&nested); err != nil {
+		if rbErr := r.rollbackTo(savepoint); rbErr != nil {
+			return fmt.Errorf("%v (rollback to savepoint failed: %v)", err, rbErr)
+		}
+		return err
+	}
+
+	if _, err := r.tx.ExecContext(ctx, "RELEASE SAVEPOINT "+savepoint); err != nil {
+		return fmt.Errorf("failed to release savepoint: %v", err)
+	}
+	return nil
+}
+
+// rollbackTo undoes the work since the savepoint and removes it
+func (r *Repositories) rollbackTo(savepoint string) error {
+	ctx := context.Background()
+	if _, err := r.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+savepoint); err != nil {
+		return err
+	}
+	_, err := r.tx.ExecContext(ctx, "RELEASE SAVEPOINT "+savepoint)
+	return err
+}
+
+// runInTx runs fn in a new transaction when db is a *sql.DB. When db is
+// already a transaction, as inside UnitOfWork.WithTx, fn joins it.
+func runInTx(ctx context.Context, db DBTX, fn func(db DBTX) error) error {
+	sqlDB, ok := db.(*sql.DB)
+	if !ok {
+		return fn(db)
+	}
+
+	tx, err := sqlDB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"testing"
+
+	"lab04-backend/database"
+	"lab04-backend/models"
+)
+
+func setupUnitOfWork(t *testing.T) (*UnitOfWork, *sql.DB, func()) {
+	testDB := "./test_unit_of_work.db"
+	os.Remove(testDB)
+
+	db, err := database.InitDBWithConfig(&database.Config{
+		DatabasePath: testDB,
+		MaxOpenConns: 5,
+		MaxIdleConns: 1,
+	})
+	if err != nil {
+		t.Fatalf("Failed to initialize test database: %v", err)
+	}
+	if err := database.RunMigrations(db); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+
+	gormDB, err := database.InitGORM(db)
+	if err != nil {
+		t.Fatalf("Failed to initialize gorm: %v", err)
+	}
+
+	cleanup := func() {
+		database.CloseDB(db)
+		os.Remove(testDB)
+	}
+	return NewUnitOfWork(db, gormDB), db, cleanup
+}
+
+func countRows(t *testing.T, db *sql.DB, table string) int {
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&count); err != nil {
+		t.Fatalf("Failed to count %s: %v", table, err)
+	}
+	return count
+}
+
+func TestUnitOfWork_Commit(t *testing.T) {
+	uow, db, cleanup := setupUnitOfWork(t)
+	defer cleanup()
+
+	err := uow.WithTx(context.Background(), func(repos *Repositories) error {
+		user, err := repos.Users.Create(&models.CreateUserRequest{Name: "Tx User", Email: "tx@example.com"})
+		if err != nil {
+			return err
+		}
+		if _, err := repos.Posts.Create(&models.CreatePostRequest{UserID: user.ID, Title: "First post"}); err != nil {
+			return err
+		}
+		return repos.Categories.Create(&models.Category{Name: "Go"})
+	})
+	if err != nil {
+		t.Fatalf("WithTx() failed: %v", err)
+	}
+
+	for _, table := range []string{"users", "posts", "categories"} {
+		if got := countRows(t, db, table); got != 1 {
+			t.Errorf("%s count = %d, want 1", table, got)
+		}
+	}
+}
+
+func TestUnitOfWork_Rollback(t *testing.T) {
+	uow, db, cleanup := setupUnitOfWork(t)
+	defer cleanup()
+
+	errBoom := errors.New("boom")
+	err := uow.WithTx(context.Background(), func(repos *Repositories) error {
+		user, err := repos.Users.Create(&models.CreateUserRequest{Name: "Tx User", Email: "tx@example.com"})
+		if err != nil {
+			return err
+		}
+		if _, err := repos.Posts.Create(&models.CreatePostRequest{UserID: user.ID, Title: "First post"}); err != nil {
+			return err
+		}
+		if err := repos.Categories.Create(&models.Category{Name: "Go"}); err != nil {
+			return err
+		}
+		return errBoom
+	})
+	if !errors.Is(err, errBoom) {
+		t.Fatalf("WithTx() error = %v, want %v", err, errBoom)
+	}
+
+	for _, table := range []string{"users", "posts", "categories"} {
+		if got := countRows(t, db, table); got != 0 {
+			t.Errorf("%s count = %d, want 0 after rollback", table, got)
+		}
+	}
+}
+
+func TestUnitOfWork_NestedSavepoint(t *testing.T) {
+	uow, db, cleanup := setupUnitOfWork(t)
+	defer cleanup()
+
+	err := uow.WithTx(context.Background(), func(repos *Repositories) error {
+		if _, err := repos.Users.Create(&models.CreateUserRequest{Name: "Outer", Email: "outer@example.com"}); err != nil {
+			return err
+		}
+
+		// The inner failure only undoes work done inside the savepoint
+		nestedErr := repos.WithTx(context.Background(), func(inner *Repositories) error {
+			if _, err := inner.Users.Create(&models.CreateUserRequest{Name: "Inner", Email: "inner@example.com"}); err != nil {
+				return err
+			}
+			return inner.WithTx(context.Background(), func(innermost *Repositories) error {
+				return errors.New("innermost failed")
+			})
+		})
+		if nestedErr == nil {
+			t.Error("nested WithTx() should propagate the inner error")
+		}
+
+		return repos.Categories.Create(&models.Category{Name: "Kept"})
+	})
+	if err != nil {
+		t.Fatalf("WithTx() failed: %v", err)
+	}
+
+	if got := countRows(t, db, "users"); got != 1 {
+		t.Errorf("users count = %d, want 1", got)
+	}
+	if got := countRows(t, db, "categories"); got != 1 {
+		t.Errorf("categories count = %d, want 1", got)
+	}
+}
@@ -1,82 +1,279 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
-	"fmt"
+	"strings"
+	"time"
 
+	"lab04-backend/database"
 	"lab04-backend/models"
 )
 
 // UserRepository handles database operations for users
 // This repository demonstrates MANUAL SQL approach with database/sql package
 type UserRepository struct {
-	db *sql.DB
+	db           DBTX
+	queryTimeout time.Duration
 }
 
 // NewUserRepository creates a new UserRepository
-func NewUserRepository(db *sql.DB) *UserRepository {
-	return &UserRepository{db: db}
+func NewUserRepository(db *sql.DB, opts ...RepositoryOption) *UserRepository {
+	o := buildRepositoryOptions(opts)
+	return &UserRepository{db: db, queryTimeout: o.queryTimeout}
 }
 
-// TODO: Implement Create method
+// userColumns is the column list matching models.User.ScanRow
+const userColumns = "id, name, email, created_at, updated_at, deleted_at"
+
+// Create inserts a new user and returns it with ID and timestamps
 func (r *UserRepository) Create(req *models.CreateUserRequest) (*models.User, error) {
-	// TODO: Create a new user in the database
-	// - Validate the request
-	// - Insert into users table
-	// - Return the created user with ID and timestamps
-	// Use RETURNING clause to get the generated ID and timestamps
-	return nil, fmt.Errorf("TODO: implement Create method")
-}
-
-// TODO: Implement GetByID method
-func (r *UserRepository) GetByID(id int) (*models.User, error) {
-	// TODO: Get user by ID from database
-	// - Query users table by ID
-	// - Return user or sql.ErrNoRows if not found
-	// - Handle scanning properly
-	return nil, fmt.Errorf("TODO: implement GetByID method")
-}
-
-// TODO: Implement GetByEmail method
-func (r *UserRepository) GetByEmail(email string) (*models.User, error) {
-	// TODO: Get user by email from database
-	// - Query users table by email
-	// - Return user or sql.ErrNoRows if not found
-	// - Handle scanning properly
-	return nil, fmt.Errorf("TODO: implement GetByEmail method")
-}
-
-// TODO: Implement GetAll method
-func (r *UserRepository) GetAll() ([]models.User, error) {
-	// TODO: Get all users from database
-	// - Query all users ordered by created_at
-	// - Return slice of users
-	// - Handle empty result properly
-	return nil, fmt.Errorf("TODO: implement GetAll method")
-}
-
-// TODO: Implement Update method
+	return r.CreateContext(context.Background(), req)
+}
+
+// CreateContext is Create with a caller-supplied context
+func (r *UserRepository) CreateContext(ctx context.Context, req *models.CreateUserRequest) (*models.User, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := database.WithQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	user := req.ToUser()
+	row := r.db.QueryRowContext(ctx,
+		`INSERT INTO users (name, email, created_at, updated_at)
+		VALUES (?, ?, ?, ?)
+		RETURNING `+userColumns,
+		user.Name, user.Email, user.CreatedAt, user.UpdatedAt,
+	)
+	if err := user.ScanRow(row); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// GetByID returns the user with the given ID or sql.ErrNoRows.
+// Soft-deleted users are excluded unless WithTrashed is passed.
+func (r *UserRepository) GetByID(id int, opts ...QueryOption) (*models.User, error) {
+	return r.GetByIDContext(context.Background(), id, opts...)
+}
+
+// GetByIDContext is GetByID with a caller-supplied context
+func (r *UserRepository) GetByIDContext(ctx context.Context, id int, opts ...QueryOption) (*models.User, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	o := buildQueryOptions(opts)
+	row := r.db.QueryRowContext(ctx,
+		"SELECT "+userColumns+" FROM users WHERE id = ? AND "+o.deletedCondition("deleted_at"),
+		id,
+	)
+
+	var user models.User
+	if err := user.ScanRow(row); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetByEmail returns the user with the given email or sql.ErrNoRows
+func (r *UserRepository) GetByEmail(email string, opts ...QueryOption) (*models.User, error) {
+	return r.GetByEmailContext(context.Background(), email, opts...)
+}
+
+// GetByEmailContext is GetByEmail with a caller-supplied context
+func (r *UserRepository) GetByEmailContext(ctx context.Context, email string, opts ...QueryOption) (*models.User, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	o := buildQueryOptions(opts)
+	row := r.db.QueryRowContext(ctx,
+		"SELECT "+userColumns+" FROM users WHERE email = ? AND "+o.deletedCondition("deleted_at"),
+		email,
+	)
+
+	var user models.User
+	if err := user.ScanRow(row); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetAll returns all users ordered by created_at
+func (r *UserRepository) GetAll(opts ...QueryOption) ([]models.User, error) {
+	return r.GetAllContext(context.Background(), opts...)
+}
+
+// GetAllContext is GetAll with a caller-supplied context
+func (r *UserRepository) GetAllContext(ctx context.Context, opts ...QueryOption) ([]models.User, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	o := buildQueryOptions(opts)
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT "+userColumns+" FROM users WHERE "+o.deletedCondition("deleted_at")+" ORDER BY created_at, id",
+	)
+	if err != nil {
+		return nil, err
+	}
+	return models.ScanUsers(rows)
+}
+
+// GetAllPage returns one page of users ordered by created_at, id.
+// It uses keyset pagination, so deep pages cost the same as the first.
+func (r *UserRepository) GetAllPage(ctx context.Context, page PageRequest, opts ...QueryOption) (*Page[models.User], error) {
+	cursor, err := decodeCursor(page.Cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := database.WithQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	o := buildQueryOptions(opts)
+	conditions := []string{o.deletedCondition("users.deleted_at")}
+	var args []interface{}
+	if cursor != nil {
+		conditions = append(conditions, keysetCondition("users", false))
+		args = append(args, cursor.CreatedAt, cursor.ID)
+	}
+
+	limit := page.limit()
+	args = append(args, limit+1)
+
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT "+userColumns+" FROM users WHERE "+strings.Join(conditions, " AND ")+
+			" ORDER BY "+keysetOrder("users", false)+" LIMIT ?",
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	users, err := models.ScanUsers(rows)
+	if err != nil {
+		return nil, err
+	}
+	return newPage(users, limit, userKey), nil
+}
+
+// Update applies the non-nil fields of req and returns the updated user
 func (r *UserRepository) Update(id int, req *models.UpdateUserRequest) (*models.User, error) {
-	// TODO: Update user in database
-	// - Build dynamic UPDATE query based on non-nil fields in req
-	// - Update updated_at timestamp
-	// - Return updated user
-	// - Handle case where user doesn't exist
-	return nil, fmt.Errorf("TODO: implement Update method")
+	return r.UpdateContext(context.Background(), id, req)
+}
+
+// UpdateContext is Update with a caller-supplied context
+func (r *UserRepository) UpdateContext(ctx context.Context, id int, req *models.UpdateUserRequest) (*models.User, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := database.WithQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	setClauses := []string{"updated_at = ?"}
+	args := []interface{}{time.Now()}
+
+	if req.Name != nil {
+		setClauses = append(setClauses, "name = ?")
+		args = append(args, *req.Name)
+	}
+	if req.Email != nil {
+		setClauses = append(setClauses, "email = ?")
+		args = append(args, *req.Email)
+	}
+	args = append(args, id)
+
+	row := r.db.QueryRowContext(ctx,
+		"UPDATE users SET "+strings.Join(setClauses, ", ")+
+			" WHERE id = ? AND deleted_at IS NULL RETURNING "+userColumns,
+		args...,
+	)
+
+	var user models.User
+	if err := user.ScanRow(row); err != nil {
+		return nil, err
+	}
+	return &user, nil
 }
 
-// TODO: Implement Delete method
+// Delete soft-deletes the user by setting deleted_at.
+// The user's posts are left untouched but hidden from post queries until
+// Restore; ForceDelete cascades to them. The email stays taken until
+// ForceDelete, so it cannot be reused by a new user.
 func (r *UserRepository) Delete(id int) error {
-	// TODO: Delete user from database
-	// - Delete from users table by ID
-	// - Return error if user doesn't exist
-	// - Consider cascading deletes for posts
-	return fmt.Errorf("TODO: implement Delete method")
-}
-
-// TODO: Implement Count method
-func (r *UserRepository) Count() (int, error) {
-	// TODO: Count total number of users
-	// - Return count of users in database
-	return 0, fmt.Errorf("TODO: implement Count method")
+	return r.DeleteContext(context.Background(), id)
+}
+
+// DeleteContext is Delete with a caller-supplied context
+func (r *UserRepository) DeleteContext(ctx context.Context, id int) error {
+	ctx, cancel := database.WithQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	return execAffectingOne(ctx, r.db,
+		"UPDATE users SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL",
+		time.Now(), id,
+	)
+}
+
+// Restore clears deleted_at on a soft-deleted user
+func (r *UserRepository) Restore(id int) error {
+	return r.RestoreContext(context.Background(), id)
+}
+
+// RestoreContext is Restore with a caller-supplied context
+func (r *UserRepository) RestoreContext(ctx context.Context, id int) error {
+	ctx, cancel := database.WithQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	return execAffectingOne(ctx, r.db,
+		"UPDATE users SET deleted_at = NULL, updated_at = ? WHERE id = ? AND deleted_at IS NOT NULL",
+		time.Now(), id,
+	)
+}
+
+// ForceDelete permanently removes the user, trashed or not
+func (r *UserRepository) ForceDelete(id int) error {
+	return r.ForceDeleteContext(context.Background(), id)
+}
+
+// ForceDeleteContext is ForceDelete with a caller-supplied context
+func (r *UserRepository) ForceDeleteContext(ctx context.Context, id int) error {
+	ctx, cancel := database.WithQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	return execAffectingOne(ctx, r.db, "DELETE FROM users WHERE id = ?", id)
+}
+
+// Count returns the number of users
+func (r *UserRepository) Count(opts ...QueryOption) (int, error) {
+	return r.CountContext(context.Background(), opts...)
+}
+
+// CountContext is Count with a caller-supplied context
+func (r *UserRepository) CountContext(ctx context.Context, opts ...QueryOption) (int, error) {
+	ctx, cancel := database.WithQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	o := buildQueryOptions(opts)
+	var count int
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE "+o.deletedCondition("deleted_at")).Scan(&count)
+	return count, err
+}
+
+// execAffectingOne runs a write statement and returns sql.ErrNoRows
+// when no row matched
+func execAffectingOne(ctx context.Context, db DBTX, query string, args ...interface{}) error {
+	result, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
 }
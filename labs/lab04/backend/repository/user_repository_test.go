@@ -1,8 +1,12 @@
 package repository
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"os"
 	"testing"
+	"time"
 
 	"lab04-backend/database"
 	"lab04-backend/models"
@@ -320,3 +324,124 @@ func TestUserRepository_Count(t *testing.T) {
 		t.Errorf("Count() returned %d, want %d", count, len(userRequests))
 	}
 }
+
+func TestUserRepository_SoftDelete(t *testing.T) {
+	repo, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	user, err := repo.Create(&models.CreateUserRequest{Name: "Soft User", Email: "soft@example.com"})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	if err := repo.Delete(user.ID); err != nil {
+		t.Fatalf("Delete() failed: %v", err)
+	}
+
+	// Deleting twice should fail since the user is already trashed
+	if err := repo.Delete(user.ID); err == nil {
+		t.Error("Delete() should return error for already deleted user")
+	}
+
+	if _, err := repo.GetByEmail(user.Email); err == nil {
+		t.Error("GetByEmail() should not return soft-deleted user")
+	}
+
+	// The email stays taken until the user is force-deleted
+	if _, err := repo.Create(&models.CreateUserRequest{Name: "Soft User Again", Email: user.Email}); err == nil {
+		t.Error("Create() should reject the email of a soft-deleted user")
+	}
+
+	trashed, err := repo.GetByID(user.ID, WithTrashed())
+	if err != nil {
+		t.Fatalf("GetByID(WithTrashed) failed: %v", err)
+	}
+	if !trashed.IsDeleted() {
+		t.Error("GetByID(WithTrashed) should return user with DeletedAt set")
+	}
+
+	if count, _ := repo.Count(); count != 0 {
+		t.Errorf("Count() = %d, want 0", count)
+	}
+	if count, _ := repo.Count(OnlyTrashed()); count != 1 {
+		t.Errorf("Count(OnlyTrashed) = %d, want 1", count)
+	}
+
+	if err := repo.Restore(user.ID); err != nil {
+		t.Fatalf("Restore() failed: %v", err)
+	}
+	restored, err := repo.GetByID(user.ID)
+	if err != nil {
+		t.Fatalf("GetByID() after Restore failed: %v", err)
+	}
+	if restored.IsDeleted() {
+		t.Error("Restore() should clear DeletedAt")
+	}
+
+	if err := repo.ForceDelete(user.ID); err != nil {
+		t.Fatalf("ForceDelete() failed: %v", err)
+	}
+	if _, err := repo.GetByID(user.ID, WithTrashed()); err == nil {
+		t.Error("ForceDelete() should remove the row permanently")
+	}
+}
+
+func TestUserRepository_Context(t *testing.T) {
+	repo, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	user, err := repo.CreateContext(ctx, &models.CreateUserRequest{Name: "Ctx User", Email: "ctx@example.com"})
+	if err != nil {
+		t.Fatalf("CreateContext() failed: %v", err)
+	}
+
+	if _, err := repo.GetByIDContext(ctx, user.ID); err != nil {
+		t.Errorf("GetByIDContext() failed: %v", err)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	if _, err := repo.GetByIDContext(cancelled, user.ID); !errors.Is(err, context.Canceled) {
+		t.Errorf("GetByIDContext() with cancelled context error = %v, want %v", err, context.Canceled)
+	}
+	if _, err := repo.GetAllContext(cancelled); !errors.Is(err, context.Canceled) {
+		t.Errorf("GetAllContext() with cancelled context error = %v, want %v", err, context.Canceled)
+	}
+	if err := repo.DeleteContext(cancelled, user.ID); !errors.Is(err, context.Canceled) {
+		t.Errorf("DeleteContext() with cancelled context error = %v, want %v", err, context.Canceled)
+	}
+
+	// A nanosecond query timeout expires before the query can run
+	timedOut := NewUserRepository(repo.db.(*sql.DB), WithQueryTimeout(time.Nanosecond))
+	if _, err := timedOut.CountContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("CountContext() with expired timeout error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestRepositories_ConfigQueryTimeout(t *testing.T) {
+	repo, cleanup := setupTestDB(t)
+	defer cleanup()
+	db := repo.db.(*sql.DB)
+
+	config := database.DefaultConfig()
+	config.QueryTimeout = time.Nanosecond
+	withConfig := WithConfig(config)
+
+	if _, err := NewUserRepository(db, withConfig).GetAll(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("UserRepository.GetAll() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if _, err := NewPostRepository(db, withConfig).Count(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("PostRepository.Count() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if _, err := NewSearchService(db, withConfig).GetPostStats(context.Background()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("SearchService.GetPostStats() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// A zero QueryTimeout disables the timeout
+	config.QueryTimeout = 0
+	if _, err := NewUserRepository(db, WithConfig(config)).GetAll(); err != nil {
+		t.Errorf("UserRepository.GetAll() without timeout failed: %v", err)
+	}
+}
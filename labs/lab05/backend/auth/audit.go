@@ -0,0 +1,245 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Audit event types
+const (
+	EventRegistered       = "registered"
+	EventLoginSuccess     = "login_success"
+	EventLoginFailure     = "login_failure"
+	EventLoginThrottled   = "login_throttled"
+	EventLockout          = "lockout"
+	EventUnlock           = "unlock"
+	EventLogout           = "logout"
+	EventPasswordChanged  = "password_changed"
+	EventEmailChanged     = "email_changed"
+	EventMFAChallenge     = "mfa_challenge"
+	EventMFAEnabled       = "mfa_enabled"
+	EventMFADisabled      = "mfa_disabled"
+	EventRecoveryCodeUsed = "recovery_code_used"
+
+	EventEmailVerified          = "email_verified"
+	EventEmailChangeRequested   = "email_change_requested"
+	EventPasswordResetRequested = "password_reset_requested"
+	EventPasswordReset          = "password_reset"
+
+	EventIdentityLinked   = "identity_linked"
+	EventIdentityUnlinked = "identity_unlinked"
+
+	EventSessionRevoked = "session_revoked"
+)
+
+// AuditEvent is one security-relevant action. UserID is 0 when the
+// account is unknown.
+type AuditEvent struct {
+	ID     int64     `json:"id"`
+	Time   time.Time `json:"time"`
+	Type   string    `json:"type"`
+	UserID int       `json:"user_id,omitempty"`
+	Email  string    `json:"email,omitempty"`
+	IP     string    `json:"ip,omitempty"`
+	Detail string    `json:"detail,omitempty"`
+}
+
+// AuditQuery filters events; zero fields match everything. Results are
+// newest first.
+type AuditQuery struct {
+	Email string
+	IP    string
+	Types []string
+	Since time.Time
+	Until time.Time
+	// Limit defaults to DefaultAuditLimit
+	Limit int
+}
+
+// DefaultAuditLimit caps queries without a Limit
+const DefaultAuditLimit = 100
+
+// AuditLog stores auth events
+type AuditLog interface {
+	// Record assigns the event ID
+	Record(ctx context.Context, event *AuditEvent) error
+	Query(ctx context.Context, query AuditQuery) ([]AuditEvent, error)
+}
+
+func (q AuditQuery) limit() int {
+	if q.Limit <= 0 {
+		return DefaultAuditLimit
+	}
+	return q.Limit
+}
+
+func (q AuditQuery) matches(event AuditEvent) bool {
+	if q.Email != "" && !strings.EqualFold(event.Email, q.Email) {
+		return false
+	}
+	if q.IP != "" && event.IP != q.IP {
+		return false
+	}
+	if len(q.Types) > 0 && !containsString(q.Types, event.Type) {
+		return false
+	}
+	if !q.Since.IsZero() && event.Time.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !event.Time.Before(q.Until) {
+		return false
+	}
+	return true
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// maxMemoryAuditEvents is how many events MemoryAuditLog keeps
+const maxMemoryAuditEvents = 10000
+
+// MemoryAuditLog is an AuditLog for tests and single-process setups. It
+// keeps the most recent maxMemoryAuditEvents events and drops older ones.
+type MemoryAuditLog struct {
+	mu        sync.RWMutex
+	events    []AuditEvent
+	lastID    int64
+	maxEvents int
+}
+
+// NewMemoryAuditLog creates an empty log
+func NewMemoryAuditLog() *MemoryAuditLog {
+	return &MemoryAuditLog{maxEvents: maxMemoryAuditEvents}
+}
+
+func (l *MemoryAuditLog) Record(ctx context.Context, event *AuditEvent) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lastID++
+	event.ID = l.lastID
+	if len(l.events) >= l.maxEvents {
+		l.events = l.events[len(l.events)-l.maxEvents+1:]
+	}
+	l.events = append(l.events, *event)
+	return nil
+}
+
+func (l *MemoryAuditLog) Query(ctx context.Context, query AuditQuery) ([]AuditEvent, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	var events []AuditEvent
+	for i := len(l.events) - 1; i >= 0 && len(events) < query.limit(); i-- {
+		if query.matches(l.events[i]) {
+			events = append(events, l.events[i])
+		}
+	}
+	return events, nil
+}
+
+// auditSchema indexes events by email and by IP, the two filters admins
+// look up most
+const auditSchema = `CREATE TABLE IF NOT EXISTS auth_audit (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	at INTEGER NOT NULL,
+	type VARCHAR(32) NOT NULL,
+	user_id INTEGER NOT NULL DEFAULT 0,
+	email VARCHAR(255) NOT NULL DEFAULT '',
+	ip VARCHAR(64) NOT NULL DEFAULT '',
+	detail TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS idx_auth_audit_email ON auth_audit(email, at);
+CREATE INDEX IF NOT EXISTS idx_auth_audit_ip ON auth_audit(ip, at)`
+
+// SQLAuditLog is an AuditLog over an auth_audit table. Events are never
+// deleted; times are stored as Unix nanoseconds and emails lowercased.
+type SQLAuditLog struct {
+	db *sql.DB
+}
+
+// NewSQLAuditLog creates the auth_audit table if needed
+func NewSQLAuditLog(db *sql.DB) (*SQLAuditLog, error) {
+	if db == nil {
+		return nil, errors.New("db must not be nil")
+	}
+	if _, err := db.Exec(auditSchema); err != nil {
+		return nil, fmt.Errorf("failed to create auth_audit: %v", err)
+	}
+	return &SQLAuditLog{db: db}, nil
+}
+
+func (l *SQLAuditLog) Record(ctx context.Context, event *AuditEvent) error {
+	result, err := l.db.ExecContext(ctx,
+		`INSERT INTO auth_audit (at, type, user_id, email, ip, detail) VALUES (?, ?, ?, ?, ?, ?)`,
+		event.Time.UnixNano(), event.Type, event.UserID, strings.ToLower(event.Email), event.IP, event.Detail,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record audit event: %v", err)
+	}
+	if event.ID, err = result.LastInsertId(); err != nil {
+		return fmt.Errorf("failed to read audit event ID: %v", err)
+	}
+	return nil
+}
+
+func (l *SQLAuditLog) Query(ctx context.Context, query AuditQuery) ([]AuditEvent, error) {
+	var where []string
+	var args []interface{}
+	if query.Email != "" {
+		where = append(where, "email = ?")
+		args = append(args, strings.ToLower(query.Email))
+	}
+	if query.IP != "" {
+		where = append(where, "ip = ?")
+		args = append(args, query.IP)
+	}
+	if len(query.Types) > 0 {
+		where = append(where, "type IN (?"+strings.Repeat(", ?", len(query.Types)-1)+")")
+		for _, t := range query.Types {
+			args = append(args, t)
+		}
+	}
+	if !query.Since.IsZero() {
+		where = append(where, "at >= ?")
+		args = append(args, query.Since.UnixNano())
+	}
+	if !query.Until.IsZero() {
+		where = append(where, "at < ?")
+		args = append(args, query.Until.UnixNano())
+	}
+
+	statement := `SELECT id, at, type, user_id, email, ip, detail FROM auth_audit`
+	if len(where) > 0 {
+		statement += " WHERE " + strings.Join(where, " AND ")
+	}
+	statement += " ORDER BY id DESC LIMIT ?"
+	args = append(args, query.limit())
+
+	rows, err := l.db.QueryContext(ctx, statement, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit log: %v", err)
+	}
+	defer rows.Close()
+
+	var events []AuditEvent
+	for rows.Next() {
+		var event AuditEvent
+		var at int64
+		if err := rows.Scan(&event.ID, &at, &event.Type, &event.UserID, &event.Email, &event.IP, &event.Detail); err != nil {
+			return nil, fmt.Errorf("failed to scan audit event: %v", err)
+		}
+		event.Time = time.Unix(0, at)
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
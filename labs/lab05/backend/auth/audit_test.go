@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"lab05/internal/sqlitetest"
+)
+
+func newSQLAuditLog(t *testing.T) *SQLAuditLog {
+	log, err := NewSQLAuditLog(sqlitetest.Open(t))
+	if err != nil {
+		t.Fatalf("NewSQLAuditLog() failed: %v", err)
+	}
+	return log
+}
+
+func TestAuditLogs(t *testing.T) {
+	logs := map[string]func(t *testing.T) AuditLog{
+		"memory": func(t *testing.T) AuditLog { return NewMemoryAuditLog() },
+		"sql":    func(t *testing.T) AuditLog { return newSQLAuditLog(t) },
+	}
+
+	for name, newLog := range logs {
+		t.Run(name, func(t *testing.T) {
+			log := newLog(t)
+			ctx := context.Background()
+			start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+			for i, event := range []AuditEvent{
+				{Type: EventLoginFailure, Email: "jane@example.com", IP: "10.0.0.1"},
+				{Type: EventLoginFailure, Email: "john@example.com", IP: "10.0.0.1"},
+				{Type: EventLockout, UserID: 1, Email: "jane@example.com", IP: "10.0.0.1"},
+				{Type: EventLoginSuccess, UserID: 1, Email: "jane@example.com", IP: "10.0.0.2"},
+			} {
+				event.Time = start.Add(time.Duration(i) * time.Minute)
+				if err := log.Record(ctx, &event); err != nil || event.ID == 0 {
+					t.Fatalf("Record() = %v, ID %d", err, event.ID)
+				}
+			}
+
+			tests := []struct {
+				name  string
+				query AuditQuery
+				want  []string
+			}{
+				{"all newest first", AuditQuery{}, []string{EventLoginSuccess, EventLockout, EventLoginFailure, EventLoginFailure}},
+				{"by email", AuditQuery{Email: "JANE@example.com"}, []string{EventLoginSuccess, EventLockout, EventLoginFailure}},
+				{"by ip and type", AuditQuery{IP: "10.0.0.1", Types: []string{EventLoginFailure}}, []string{EventLoginFailure, EventLoginFailure}},
+				{"time range", AuditQuery{Since: start.Add(time.Minute), Until: start.Add(3 * time.Minute)}, []string{EventLockout, EventLoginFailure}},
+				{"limit", AuditQuery{Limit: 1}, []string{EventLoginSuccess}},
+			}
+			for _, tt := range tests {
+				events, err := log.Query(ctx, tt.query)
+				if err != nil {
+					t.Fatalf("%s: Query() failed: %v", tt.name, err)
+				}
+				var got []string
+				for _, event := range events {
+					got = append(got, event.Type)
+				}
+				if len(got) != len(tt.want) {
+					t.Errorf("%s: Query() = %v, want %v", tt.name, got, tt.want)
+					continue
+				}
+				for i := range got {
+					if got[i] != tt.want[i] {
+						t.Errorf("%s: Query() = %v, want %v", tt.name, got, tt.want)
+						break
+					}
+				}
+			}
+
+			events, _ := log.Query(ctx, AuditQuery{Types: []string{EventLockout}})
+			if len(events) != 1 || events[0].UserID != 1 || !events[0].Time.Equal(start.Add(2*time.Minute)) {
+				t.Errorf("lockout event = %+v", events)
+			}
+		})
+	}
+}
+
+func TestMemoryAuditLog_MaxEvents(t *testing.T) {
+	log := NewMemoryAuditLog()
+	log.maxEvents = 3
+	ctx := context.Background()
+
+	for i := 1; i <= 5; i++ {
+		event := AuditEvent{Type: EventLoginFailure, Detail: fmt.Sprint(i)}
+		if err := log.Record(ctx, &event); err != nil || event.ID != int64(i) {
+			t.Fatalf("Record() = %v, ID %d, want ID %d", err, event.ID, i)
+		}
+	}
+	events, _ := log.Query(ctx, AuditQuery{})
+	if len(events) != 3 || events[0].Detail != "5" || events[2].Detail != "3" {
+		t.Errorf("Query() = %+v, want the 3 newest events", events)
+	}
+}
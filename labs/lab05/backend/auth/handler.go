@@ -0,0 +1,553 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"lab05/jwtservice"
+	"lab05/oidc"
+	"lab05/security"
+	"lab05/userdomain"
+)
+
+// Handler serves the auth endpoints:
+//
+//	POST /auth/register  {email, name, password}        201 user
+//	POST /auth/login     {email, password}              200 {user, tokens} or {user, mfa_required, mfa_token}
+//	POST /auth/login/mfa {mfa_token, code}              200 {user, tokens}
+//	POST /auth/refresh   {refresh_token}                200 tokens
+//	POST /auth/logout    bearer                         204
+//	GET  /auth/me        bearer                         200 user
+//	PUT  /auth/password  bearer {current_password, new_password}  200 tokens
+//	PUT  /auth/email     bearer {password, email}       202 user with pending_email
+//	POST /auth/email/verify         {token}             200 user
+//	POST /auth/email/verify/resend  bearer              202
+//	POST /auth/password/forgot      {email}             202
+//	POST /auth/password/reset       {token, password}   204
+//	GET    /auth/oidc/{provider}/login     302 to the provider
+//	POST   /auth/oidc/{provider}/link      bearer       200 {authorization_url}
+//	GET    /auth/oidc/{provider}/callback  ?code&state  200 {user, tokens} or {user, mfa_required, mfa_token}
+//	GET    /auth/identities                bearer       200 identities
+//	DELETE /auth/identities/{provider}     bearer       204
+//	GET    /auth/sessions       bearer                  200 sessions
+//	DELETE /auth/sessions       bearer                  204, ends every session
+//	DELETE /auth/sessions/{id}  bearer                  204
+//	POST   /auth/mfa/totp          bearer               200 {secret, provisioning_uri}
+//	POST   /auth/mfa/totp/confirm  bearer {code}        200 {recovery_codes}
+//	DELETE /auth/mfa/totp          bearer {password, code}  204
+//
+// and, for tokens with the admin role:
+//
+//	POST /auth/admin/unlock  {email} or {ip}            204
+//	GET  /auth/admin/audit   ?email&ip&type&since&until&limit  200 events
+//
+// Throttled logins answer 429 with Retry-After. The client IP is the
+// connection's remote address; put a proxy that rewrites it in front
+// when running behind a load balancer.
+type Handler struct {
+	service *Service
+	mux     *http.ServeMux
+}
+
+// NewHandler routes the endpoints to service
+func NewHandler(service *Service) *Handler {
+	h := &Handler{service: service, mux: http.NewServeMux()}
+	authenticated := func(next http.Handler) http.Handler {
+		return service.Tokens().Middleware()(h.touchSession(next))
+	}
+	admin := func(next http.Handler) http.Handler {
+		return service.Tokens().Middleware(jwtservice.RequireRoles(AdminRole))(h.touchSession(next))
+	}
+
+	h.mux.HandleFunc("POST /auth/register", h.register)
+	h.mux.HandleFunc("POST /auth/login", h.login)
+	h.mux.HandleFunc("POST /auth/login/mfa", h.completeLogin)
+	h.mux.HandleFunc("POST /auth/refresh", h.refresh)
+	h.mux.Handle("POST /auth/logout", authenticated(http.HandlerFunc(h.logout)))
+	h.mux.Handle("GET /auth/me", authenticated(http.HandlerFunc(h.me)))
+	h.mux.Handle("PUT /auth/password", authenticated(http.HandlerFunc(h.changePassword)))
+	h.mux.Handle("PUT /auth/email", authenticated(http.HandlerFunc(h.changeEmail)))
+	h.mux.HandleFunc("POST /auth/email/verify", h.verifyEmail)
+	h.mux.Handle("POST /auth/email/verify/resend", authenticated(http.HandlerFunc(h.resendVerification)))
+	h.mux.HandleFunc("POST /auth/password/forgot", h.forgotPassword)
+	h.mux.HandleFunc("POST /auth/password/reset", h.resetPassword)
+	h.mux.HandleFunc("GET /auth/oidc/{provider}/login", h.beginOIDCLogin)
+	h.mux.Handle("POST /auth/oidc/{provider}/link", authenticated(http.HandlerFunc(h.beginOIDCLink)))
+	h.mux.HandleFunc("GET /auth/oidc/{provider}/callback", h.oidcCallback)
+	h.mux.Handle("GET /auth/identities", authenticated(http.HandlerFunc(h.identities)))
+	h.mux.Handle("DELETE /auth/identities/{provider}", authenticated(http.HandlerFunc(h.unlinkIdentity)))
+	h.mux.Handle("GET /auth/sessions", authenticated(http.HandlerFunc(h.sessions)))
+	h.mux.Handle("DELETE /auth/sessions", authenticated(http.HandlerFunc(h.revokeAllSessions)))
+	h.mux.Handle("DELETE /auth/sessions/{id}", authenticated(http.HandlerFunc(h.revokeSession)))
+	h.mux.Handle("POST /auth/mfa/totp", authenticated(http.HandlerFunc(h.beginTOTP)))
+	h.mux.Handle("POST /auth/mfa/totp/confirm", authenticated(http.HandlerFunc(h.confirmTOTP)))
+	h.mux.Handle("DELETE /auth/mfa/totp", authenticated(http.HandlerFunc(h.disableTOTP)))
+	h.mux.Handle("POST /auth/admin/unlock", admin(http.HandlerFunc(h.unlock)))
+	h.mux.Handle("GET /auth/admin/audit", admin(http.HandlerFunc(h.auditEvents)))
+	return h
+}
+
+// AdminRole grants the admin endpoints
+const AdminRole = "admin"
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		ip = host
+	}
+	ctx := ContextWithUserAgent(ContextWithClientIP(r.Context(), ip), r.UserAgent())
+	h.mux.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// touchSession records authenticated requests as activity in the caller's
+// session
+func (h *Handler) touchSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if claims, ok := jwtservice.ClaimsFromContext(r.Context()); ok {
+			h.service.TouchSession(r.Context(), claims)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (h *Handler) register(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email    string `json:"email"`
+		Name     string `json:"name"`
+		Password string `json:"password"`
+	}
+	if !decode(w, r, &req) {
+		return
+	}
+	user, err := h.service.Register(r.Context(), req.Email, req.Name, req.Password)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, user)
+}
+
+func (h *Handler) login(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+	if !decode(w, r, &req) {
+		return
+	}
+	result, err := h.service.Login(r.Context(), req.Email, req.Password)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (h *Handler) completeLogin(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		MFAToken string `json:"mfa_token"`
+		Code     string `json:"code"`
+	}
+	if !decode(w, r, &req) {
+		return
+	}
+	result, err := h.service.CompleteLogin(r.Context(), req.MFAToken, req.Code)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (h *Handler) refresh(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if !decode(w, r, &req) {
+		return
+	}
+	pair, err := h.service.Refresh(r.Context(), req.RefreshToken)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, pair)
+}
+
+func (h *Handler) logout(w http.ResponseWriter, r *http.Request) {
+	claims, _ := jwtservice.ClaimsFromContext(r.Context())
+	if err := h.service.Logout(r.Context(), claims); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) me(w http.ResponseWriter, r *http.Request) {
+	claims, _ := jwtservice.ClaimsFromContext(r.Context())
+	user, err := h.service.Me(r.Context(), claims)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, user)
+}
+
+func (h *Handler) changePassword(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	if !decode(w, r, &req) {
+		return
+	}
+	claims, _ := jwtservice.ClaimsFromContext(r.Context())
+	pair, err := h.service.ChangePassword(r.Context(), claims, req.CurrentPassword, req.NewPassword)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, pair)
+}
+
+func (h *Handler) changeEmail(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Password string `json:"password"`
+		Email    string `json:"email"`
+	}
+	if !decode(w, r, &req) {
+		return
+	}
+	claims, _ := jwtservice.ClaimsFromContext(r.Context())
+	user, err := h.service.ChangeEmail(r.Context(), claims, req.Password, req.Email)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, user)
+}
+
+func (h *Handler) verifyEmail(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token string `json:"token"`
+	}
+	if !decode(w, r, &req) {
+		return
+	}
+	user, err := h.service.VerifyEmail(r.Context(), req.Token)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, user)
+}
+
+func (h *Handler) resendVerification(w http.ResponseWriter, r *http.Request) {
+	claims, _ := jwtservice.ClaimsFromContext(r.Context())
+	if err := h.service.ResendVerification(r.Context(), claims); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *Handler) forgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if !decode(w, r, &req) {
+		return
+	}
+	if err := h.service.RequestPasswordReset(r.Context(), req.Email); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *Handler) resetPassword(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if !decode(w, r, &req) {
+		return
+	}
+	if err := h.service.ResetPassword(r.Context(), req.Token, req.Password); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// oidcStateCookie binds a redirect to the provider to the browser that
+// started it, so a callback URL planted by someone else cannot sign the
+// victim in to the attacker's account
+const oidcStateCookie = "oidc_state"
+
+func (h *Handler) beginOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	request, err := h.service.BeginOIDCLogin(r.Context(), r.PathValue("provider"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	setOIDCStateCookie(w, r, request.State)
+	http.Redirect(w, r, request.URL, http.StatusFound)
+}
+
+func (h *Handler) beginOIDCLink(w http.ResponseWriter, r *http.Request) {
+	claims, _ := jwtservice.ClaimsFromContext(r.Context())
+	request, err := h.service.BeginOIDCLink(r.Context(), claims, r.PathValue("provider"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	setOIDCStateCookie(w, r, request.State)
+	writeJSON(w, http.StatusOK, map[string]string{"authorization_url": request.URL})
+}
+
+func (h *Handler) oidcCallback(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: "/auth/oidc/", MaxAge: -1})
+	if code := params.Get("error"); code != "" {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "sign-in was cancelled or refused: " + code})
+		return
+	}
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || params.Get("state") == "" || cookie.Value != params.Get("state") {
+		writeError(w, ErrInvalidOIDCState)
+		return
+	}
+	result, err := h.service.CompleteOIDC(r.Context(), r.PathValue("provider"), params.Get("state"), params.Get("code"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func setOIDCStateCookie(w http.ResponseWriter, r *http.Request, state string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/auth/oidc/",
+		MaxAge:   int(OIDCStateTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (h *Handler) identities(w http.ResponseWriter, r *http.Request) {
+	claims, _ := jwtservice.ClaimsFromContext(r.Context())
+	identities, err := h.service.Identities(r.Context(), claims)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if identities == nil {
+		identities = []userdomain.Identity{}
+	}
+	writeJSON(w, http.StatusOK, identities)
+}
+
+func (h *Handler) unlinkIdentity(w http.ResponseWriter, r *http.Request) {
+	claims, _ := jwtservice.ClaimsFromContext(r.Context())
+	if err := h.service.UnlinkIdentity(r.Context(), claims, r.PathValue("provider")); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) sessions(w http.ResponseWriter, r *http.Request) {
+	claims, _ := jwtservice.ClaimsFromContext(r.Context())
+	sessions, err := h.service.Sessions(r.Context(), claims)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, sessions)
+}
+
+func (h *Handler) revokeSession(w http.ResponseWriter, r *http.Request) {
+	claims, _ := jwtservice.ClaimsFromContext(r.Context())
+	if err := h.service.RevokeSession(r.Context(), claims, r.PathValue("id")); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) revokeAllSessions(w http.ResponseWriter, r *http.Request) {
+	claims, _ := jwtservice.ClaimsFromContext(r.Context())
+	if err := h.service.RevokeAllSessions(r.Context(), claims); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) beginTOTP(w http.ResponseWriter, r *http.Request) {
+	claims, _ := jwtservice.ClaimsFromContext(r.Context())
+	enrollment, err := h.service.BeginTOTPEnrollment(r.Context(), claims)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, enrollment)
+}
+
+func (h *Handler) confirmTOTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Code string `json:"code"`
+	}
+	if !decode(w, r, &req) {
+		return
+	}
+	claims, _ := jwtservice.ClaimsFromContext(r.Context())
+	codes, err := h.service.ConfirmTOTPEnrollment(r.Context(), claims, req.Code)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string][]string{"recovery_codes": codes})
+}
+
+func (h *Handler) disableTOTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Password string `json:"password"`
+		Code     string `json:"code"`
+	}
+	if !decode(w, r, &req) {
+		return
+	}
+	claims, _ := jwtservice.ClaimsFromContext(r.Context())
+	if err := h.service.DisableTOTP(r.Context(), claims, req.Password, req.Code); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) unlock(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+		IP    string `json:"ip"`
+	}
+	if !decode(w, r, &req) {
+		return
+	}
+	claims, _ := jwtservice.ClaimsFromContext(r.Context())
+	switch {
+	case req.Email != "":
+		h.service.Unlock(r.Context(), claims, req.Email)
+	case req.IP != "":
+		h.service.UnlockIP(r.Context(), claims, req.IP)
+	default:
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "email or ip is required"})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) auditEvents(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	query := AuditQuery{Email: params.Get("email"), IP: params.Get("ip")}
+	if types := params.Get("type"); types != "" {
+		query.Types = strings.Split(types, ",")
+	}
+	for name, field := range map[string]*time.Time{"since": &query.Since, "until": &query.Until} {
+		if value := params.Get(name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, errorResponse{Error: name + " must be an RFC 3339 time"})
+				return
+			}
+			*field = t
+		}
+	}
+	if value := params.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "limit must be a positive integer"})
+			return
+		}
+		query.Limit = limit
+	}
+
+	events, err := h.service.AuditEvents(r.Context(), query)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if events == nil {
+		events = []AuditEvent{}
+	}
+	writeJSON(w, http.StatusOK, events)
+}
+
+// decode reads a JSON body of at most 1 MiB, answering 400 on failure
+func decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid JSON body"})
+		return false
+	}
+	return true
+}
+
+// errorResponse is the body of every failure. Violations lists broken
+// password rules so the UI can show each one.
+type errorResponse struct {
+	Error      string               `json:"error"`
+	Violations []security.Violation `json:"violations,omitempty"`
+}
+
+// writeError maps service errors to statuses; unexpected errors are not
+// echoed to the client
+func writeError(w http.ResponseWriter, err error) {
+	var policyErr *security.PolicyError
+	var throttled *ThrottledError
+	var oauthErr *oidc.Error
+	switch {
+	case errors.As(err, &throttled):
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+		writeJSON(w, http.StatusTooManyRequests, errorResponse{Error: throttled.Error()})
+	case errors.As(err, &policyErr):
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "password does not meet the policy", Violations: policyErr.Violations})
+	case errors.Is(err, ErrInvalidInput), errors.Is(err, ErrInvalidLink), errors.Is(err, ErrInvalidOIDCState):
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+	case errors.As(err, &oauthErr), errors.Is(err, oidc.ErrInvalidIDToken):
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "sign-in with the identity provider failed"})
+	case errors.Is(err, ErrAccountExists), errors.Is(err, userdomain.ErrIdentityLinked):
+		writeJSON(w, http.StatusConflict, errorResponse{Error: err.Error()})
+	case errors.Is(err, ErrUnknownProvider), errors.Is(err, userdomain.ErrIdentityNotFound), errors.Is(err, ErrSessionNotFound):
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: err.Error()})
+	case errors.Is(err, ErrInvalidCredentials), errors.Is(err, ErrInvalidMFACode):
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: err.Error()})
+	case errors.Is(err, userdomain.ErrEmailTaken):
+		writeJSON(w, http.StatusConflict, errorResponse{Error: err.Error()})
+	case errors.Is(err, userdomain.ErrUserNotFound):
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: err.Error()})
+	case errors.Is(err, jwtservice.ErrInvalidToken), errors.Is(err, jwtservice.ErrTokenExpired),
+		errors.Is(err, jwtservice.ErrTokenRevoked), errors.Is(err, jwtservice.ErrTokenReused),
+		errors.Is(err, jwtservice.ErrInvalidClaims), errors.Is(err, jwtservice.ErrEmptyToken):
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "invalid or expired token"})
+	default:
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "internal server error"})
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
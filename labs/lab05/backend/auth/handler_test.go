@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"lab05/security"
+)
+
+func TestHandler(t *testing.T) {
+	service, _ := newTestService(t)
+	server := httptest.NewServer(NewHandler(service))
+	defer server.Close()
+
+	call := func(method, path, token string, body interface{}, out interface{}) int {
+		t.Helper()
+		payload, _ := json.Marshal(body)
+		req, _ := http.NewRequest(method, server.URL+path, bytes.NewReader(payload))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", method, path, err)
+		}
+		defer resp.Body.Close()
+		if out != nil {
+			json.NewDecoder(resp.Body).Decode(out)
+		}
+		return resp.StatusCode
+	}
+
+	var failure errorResponse
+	if status := call("POST", "/auth/register", "", map[string]string{"email": "jane@example.com", "name": "Jane Roe", "password": "password"}, &failure); status != http.StatusBadRequest {
+		t.Errorf("register(weak) = %d, want 400", status)
+	}
+	if len(failure.Violations) == 0 || failure.Violations[0].Code != security.ViolationMissingUpper {
+		t.Errorf("register(weak) violations = %+v", failure.Violations)
+	}
+
+	var registered map[string]interface{}
+	if status := call("POST", "/auth/register", "", map[string]string{"email": "jane@example.com", "name": "Jane Roe", "password": "Password123"}, &registered); status != http.StatusCreated {
+		t.Fatalf("register = %d, want 201", status)
+	}
+	if _, leaked := registered["password"]; leaked || registered["email"] != "jane@example.com" {
+		t.Errorf("register body = %v", registered)
+	}
+	if status := call("POST", "/auth/register", "", map[string]string{"email": "jane@example.com", "name": "Jane Roe", "password": "Password123"}, nil); status != http.StatusConflict {
+		t.Errorf("register(duplicate) = %d, want 409", status)
+	}
+
+	if status := call("POST", "/auth/login", "", map[string]string{"email": "jane@example.com", "password": "nope"}, nil); status != http.StatusUnauthorized {
+		t.Errorf("login(wrong password) = %d, want 401", status)
+	}
+	var login LoginResult
+	if status := call("POST", "/auth/login", "", map[string]string{"email": "jane@example.com", "password": "Password123"}, &login); status != http.StatusOK || login.TokenPair == nil {
+		t.Fatalf("login = %d, %+v", status, login)
+	}
+	access := login.AccessToken
+
+	if status := call("GET", "/auth/me", "", nil, nil); status != http.StatusUnauthorized {
+		t.Errorf("me without token = %d, want 401", status)
+	}
+	var me map[string]interface{}
+	if status := call("GET", "/auth/me", access, nil, &me); status != http.StatusOK || me["name"] != "Jane Roe" {
+		t.Errorf("me = %d, %v", status, me)
+	}
+
+	if status := call("PUT", "/auth/email", access, map[string]string{"password": "Password123", "email": "jane@new.example.com"}, &me); status != http.StatusAccepted || me["pending_email"] != "jane@new.example.com" {
+		t.Errorf("change email = %d, %v", status, me)
+	}
+
+	var pair map[string]interface{}
+	if status := call("PUT", "/auth/password", access, map[string]string{"current_password": "Password123", "new_password": "NewPassword456"}, &pair); status != http.StatusOK {
+		t.Fatalf("change password = %d", status)
+	}
+	if status := call("GET", "/auth/me", access, nil, nil); status != http.StatusUnauthorized {
+		t.Errorf("me with the pre-change token = %d, want 401", status)
+	}
+	access = pair["access_token"].(string)
+
+	var refreshed map[string]interface{}
+	if status := call("POST", "/auth/refresh", "", map[string]string{"refresh_token": pair["refresh_token"].(string)}, &refreshed); status != http.StatusOK {
+		t.Fatalf("refresh = %d", status)
+	}
+	if status := call("POST", "/auth/logout", refreshed["access_token"].(string), nil, nil); status != http.StatusNoContent {
+		t.Errorf("logout = %d, want 204", status)
+	}
+	if status := call("GET", "/auth/me", access, nil, nil); status != http.StatusUnauthorized {
+		t.Errorf("me after logout = %d, want 401", status)
+	}
+}
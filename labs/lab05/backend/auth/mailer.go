@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Message is a plain-text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers verification and password reset emails. Production code
+// wraps an SMTP server or mail API; ConsoleMailer and FileMailer stand in
+// during development and tests.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// ConsoleMailer writes messages to a writer such as os.Stdout
+type ConsoleMailer struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewConsoleMailer creates a mailer that prints to w
+func NewConsoleMailer(w io.Writer) *ConsoleMailer {
+	return &ConsoleMailer{w: w}
+}
+
+func (m *ConsoleMailer) Send(ctx context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return writeMessage(m.w, msg)
+}
+
+// FileMailer appends messages to a file, which it creates if needed
+type FileMailer struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFileMailer creates a mailer that appends to path
+func NewFileMailer(path string) *FileMailer {
+	return &FileMailer{path: path}
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	file, err := os.OpenFile(m.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open mail file: %v", err)
+	}
+	if err := writeMessage(file, msg); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// writeMessage formats msg like a minimal RFC 5322 message followed by a
+// separator line
+func writeMessage(w io.Writer, msg Message) error {
+	_, err := fmt.Fprintf(w, "Date: %s\nTo: %s\nSubject: %s\n\n%s\n----\n",
+		time.Now().Format(time.RFC1123Z), msg.To, msg.Subject, msg.Body)
+	if err != nil {
+		return fmt.Errorf("failed to write mail: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"lab05/jwtservice"
+	"lab05/security"
+	"lab05/userdomain"
+)
+
+// RecoveryCodeCount is the number of recovery codes issued at enrolment
+const RecoveryCodeCount = 10
+
+// DefaultTOTPIssuer names the service in authenticator apps
+const DefaultTOTPIssuer = "lab05"
+
+// ErrInvalidMFACode is returned for a wrong, expired or replayed TOTP code
+// or an unknown recovery code
+var ErrInvalidMFACode = errors.New("invalid two-factor code")
+
+// LoginResult is the outcome of a correct password. Users without a
+// second factor get TokenPair; the others get an MFAToken to exchange
+// with CompleteLogin.
+type LoginResult struct {
+	User *userdomain.User `json:"user"`
+	*jwtservice.TokenPair
+	MFARequired  bool       `json:"mfa_required,omitempty"`
+	MFAToken     string     `json:"mfa_token,omitempty"`
+	MFAExpiresAt *time.Time `json:"mfa_expires_at,omitempty"`
+}
+
+// TOTPEnrollment is shown once to set up an authenticator app
+type TOTPEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// WithTOTPIssuer sets the issuer shown in authenticator apps
+func WithTOTPIssuer(issuer string) Option {
+	return func(s *Service) {
+		s.totpIssuer = issuer
+	}
+}
+
+// BeginTOTPEnrollment creates a TOTP secret for the user of claims. It
+// takes effect once ConfirmTOTPEnrollment sees a code made from it, so
+// a mistyped secret cannot lock the user out.
+func (s *Service) BeginTOTPEnrollment(ctx context.Context, claims *jwtservice.Claims) (*TOTPEnrollment, error) {
+	user, err := s.users.GetByID(ctx, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabled {
+		return nil, fmt.Errorf("%w: two-factor authentication is already enabled", ErrInvalidInput)
+	}
+	totp, err := security.NewTOTP()
+	if err != nil {
+		return nil, err
+	}
+	user.TOTPSecret = totp.EncodedSecret()
+	user.TOTPLastStep = 0
+	if err := s.users.Update(ctx, user); err != nil {
+		return nil, err
+	}
+	return &TOTPEnrollment{
+		Secret:          totp.EncodedSecret(),
+		ProvisioningURI: totp.ProvisioningURI(s.totpIssuer, user.Email),
+	}, nil
+}
+
+// ConfirmTOTPEnrollment enables TOTP when code matches the pending secret
+// and returns the recovery codes, which are stored hashed and never shown
+// again
+func (s *Service) ConfirmTOTPEnrollment(ctx context.Context, claims *jwtservice.Claims, code string) ([]string, error) {
+	user, err := s.users.GetByID(ctx, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabled || user.TOTPSecret == "" {
+		return nil, fmt.Errorf("%w: no two-factor enrolment is pending", ErrInvalidInput)
+	}
+	totp, err := security.ParseTOTP(user.TOTPSecret)
+	if err != nil {
+		return nil, err
+	}
+	step, ok := totp.Verify(code, s.now(), security.DefaultTOTPSkew, user.TOTPLastStep)
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	codes, err := security.GenerateRecoveryCodes(RecoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		if hashes[i], err = s.passwords.HashPassword(code); err != nil {
+			return nil, err
+		}
+	}
+
+	user.TOTPEnabled = true
+	user.TOTPLastStep = step
+	user.RecoveryCodes = hashes
+	user.UpdatedAt = s.now()
+	if err := s.users.Update(ctx, user); err != nil {
+		return nil, err
+	}
+	s.record(ctx, AuditEvent{Type: EventMFAEnabled, UserID: user.ID, Email: user.Email})
+	return codes, nil
+}
+
+// DisableTOTP turns TOTP off after checking the password and a second
+// factor
+func (s *Service) DisableTOTP(ctx context.Context, claims *jwtservice.Claims, password, code string) error {
+	user, err := s.reauthenticate(ctx, claims, password)
+	if err != nil {
+		return err
+	}
+	if !user.TOTPEnabled {
+		return fmt.Errorf("%w: two-factor authentication is not enabled", ErrInvalidInput)
+	}
+	if err := s.checkSecondFactor(ctx, user, code); err != nil {
+		return err
+	}
+
+	user.TOTPEnabled = false
+	user.TOTPSecret = ""
+	user.TOTPLastStep = 0
+	user.RecoveryCodes = nil
+	user.UpdatedAt = s.now()
+	if err := s.users.Update(ctx, user); err != nil {
+		return err
+	}
+	s.record(ctx, AuditEvent{Type: EventMFADisabled, UserID: user.ID, Email: user.Email})
+	return nil
+}
+
+// CompleteLogin exchanges the mfa_pending token of Login and a TOTP or
+// recovery code for a token pair. Wrong codes count as failed logins.
+func (s *Service) CompleteLogin(ctx context.Context, mfaToken, code string) (*LoginResult, error) {
+	claims, err := s.tokens.ValidateMFAToken(ctx, mfaToken)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.users.GetByID(ctx, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkThrottle(ctx, user.Email); err != nil {
+		return nil, err
+	}
+	if err := s.checkSecondFactor(ctx, user, code); err != nil {
+		return nil, err
+	}
+	if s.throttle != nil {
+		s.throttle.Success(user.Email)
+	}
+	if s.tokens.CanRevoke() {
+		if err := s.tokens.RevokeTokenContext(ctx, mfaToken); err != nil {
+			return nil, err
+		}
+	}
+
+	pair, err := s.startSession(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	s.record(ctx, AuditEvent{Type: EventLoginSuccess, UserID: user.ID, Email: user.Email, Detail: "second factor"})
+	return &LoginResult{User: user, TokenPair: pair}, nil
+}
+
+// challenge issues the mfa_pending token for a user whose password was
+// correct
+func (s *Service) challenge(ctx context.Context, user *userdomain.User) (*LoginResult, error) {
+	token, expiresAt, err := s.tokens.GenerateMFAToken(user.ID, user.Email)
+	if err != nil {
+		return nil, err
+	}
+	s.record(ctx, AuditEvent{Type: EventMFAChallenge, UserID: user.ID, Email: user.Email})
+	return &LoginResult{User: user, MFARequired: true, MFAToken: token, MFAExpiresAt: &expiresAt}, nil
+}
+
+// checkSecondFactor accepts a TOTP code not used before or an unused
+// recovery code, which it then consumes
+func (s *Service) checkSecondFactor(ctx context.Context, user *userdomain.User, code string) error {
+	totp, err := security.ParseTOTP(user.TOTPSecret)
+	if err != nil {
+		return err
+	}
+	if step, ok := totp.Verify(code, s.now(), security.DefaultTOTPSkew, user.TOTPLastStep); ok {
+		user.TOTPLastStep = step
+		return s.users.Update(ctx, user)
+	}
+
+	normalized := security.NormalizeRecoveryCode(code)
+	for i, hash := range user.RecoveryCodes {
+		if s.passwords.VerifyPassword(normalized, hash) {
+			user.RecoveryCodes = append(user.RecoveryCodes[:i:i], user.RecoveryCodes[i+1:]...)
+			if err := s.users.Update(ctx, user); err != nil {
+				return err
+			}
+			s.record(ctx, AuditEvent{
+				Type: EventRecoveryCodeUsed, UserID: user.ID, Email: user.Email,
+				Detail: fmt.Sprintf("%d recovery codes left", len(user.RecoveryCodes)),
+			})
+			return nil
+		}
+	}
+
+	s.fail(ctx, user.ID, user.Email, "wrong second factor")
+	return ErrInvalidMFACode
+}
@@ -0,0 +1,224 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"lab05/jwtservice"
+	"lab05/security"
+	"lab05/userdomain"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// fakeClock drives both the auth service and its JWT service
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func newMFATestService(t *testing.T, opts ...Option) (*Service, *fakeClock) {
+	t.Helper()
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	passwords, _ := security.NewPasswordServiceWithConfig(security.HasherConfig{
+		Algorithm:  security.AlgorithmBcrypt,
+		BcryptCost: bcrypt.MinCost,
+		Argon2:     security.DefaultArgon2Params,
+	})
+	tokens, _ := jwtservice.NewJWTService("test-secret",
+		jwtservice.WithClock(clock.Now),
+		jwtservice.WithRevocationStore(jwtservice.NewMemoryRevocationStore()),
+	)
+	opts = append([]Option{WithClock(clock.Now), WithTOTPIssuer("Lab Test"), WithMailer(NewConsoleMailer(io.Discard))}, opts...)
+	service, err := NewService(userdomain.NewMemoryRepository(), passwords, tokens, opts...)
+	if err != nil {
+		t.Fatalf("NewService() failed: %v", err)
+	}
+	return service, clock
+}
+
+func TestService_TOTP(t *testing.T) {
+	service, clock := newMFATestService(t)
+	ctx := context.Background()
+
+	user, _ := service.Register(ctx, "jane@example.com", "Jane Roe", "Password123")
+	claims := &jwtservice.Claims{UserID: user.ID, Email: user.Email}
+
+	enrollment, err := service.BeginTOTPEnrollment(ctx, claims)
+	if err != nil {
+		t.Fatalf("BeginTOTPEnrollment() failed: %v", err)
+	}
+	if !strings.HasPrefix(enrollment.ProvisioningURI, "otpauth://totp/Lab%20Test:jane@example.com?") {
+		t.Errorf("ProvisioningURI = %s", enrollment.ProvisioningURI)
+	}
+	totp, _ := security.ParseTOTP(enrollment.Secret)
+
+	// Unconfirmed enrolment does not change login
+	if result, err := service.Login(ctx, "jane@example.com", "Password123"); err != nil || result.MFARequired {
+		t.Fatalf("Login() before confirmation = %+v, %v", result, err)
+	}
+
+	if _, err := service.ConfirmTOTPEnrollment(ctx, claims, "000000"); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("ConfirmTOTPEnrollment(wrong) error = %v", err)
+	}
+	recoveryCodes, err := service.ConfirmTOTPEnrollment(ctx, claims, totp.Code(clock.now))
+	if err != nil || len(recoveryCodes) != RecoveryCodeCount {
+		t.Fatalf("ConfirmTOTPEnrollment() = %v, %v", recoveryCodes, err)
+	}
+	if _, err := service.BeginTOTPEnrollment(ctx, claims); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("BeginTOTPEnrollment() when enabled error = %v, want ErrInvalidInput", err)
+	}
+
+	login := func() *LoginResult {
+		t.Helper()
+		result, err := service.Login(ctx, "jane@example.com", "Password123")
+		if err != nil || !result.MFARequired || result.TokenPair != nil || result.MFAToken == "" {
+			t.Fatalf("Login() with TOTP = %+v, %v, want an mfa_pending token only", result, err)
+		}
+		return result
+	}
+
+	// The code used to confirm cannot be replayed, but the next step's can
+	pending := login()
+	if _, err := service.CompleteLogin(ctx, pending.MFAToken, totp.Code(clock.now)); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("CompleteLogin(replayed code) error = %v", err)
+	}
+	clock.now = clock.now.Add(30 * time.Second)
+	result, err := service.CompleteLogin(ctx, pending.MFAToken, totp.Code(clock.now))
+	if err != nil || result.TokenPair == nil {
+		t.Fatalf("CompleteLogin() = %+v, %v", result, err)
+	}
+	if _, err := service.Tokens().ValidateToken(result.AccessToken); err != nil {
+		t.Errorf("access token after CompleteLogin: %v", err)
+	}
+	clock.now = clock.now.Add(30 * time.Second)
+	if _, err := service.CompleteLogin(ctx, pending.MFAToken, totp.Code(clock.now)); !errors.Is(err, jwtservice.ErrTokenRevoked) {
+		t.Errorf("CompleteLogin(used mfa token) error = %v, want ErrTokenRevoked", err)
+	}
+
+	// Recovery codes work once, in any case
+	pending = login()
+	if _, err := service.CompleteLogin(ctx, pending.MFAToken, strings.ToUpper(recoveryCodes[3])); err != nil {
+		t.Fatalf("CompleteLogin(recovery code) failed: %v", err)
+	}
+	pending = login()
+	if _, err := service.CompleteLogin(ctx, pending.MFAToken, recoveryCodes[3]); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("CompleteLogin(used recovery code) error = %v", err)
+	}
+
+	// The mfa_pending token expires
+	pending = login()
+	clock.now = clock.now.Add(jwtservice.DefaultMFATokenTTL + time.Second)
+	if _, err := service.CompleteLogin(ctx, pending.MFAToken, totp.Code(clock.now)); !errors.Is(err, jwtservice.ErrTokenExpired) {
+		t.Errorf("CompleteLogin(expired mfa token) error = %v, want ErrTokenExpired", err)
+	}
+
+	clock.now = clock.now.Add(30 * time.Second)
+	if err := service.DisableTOTP(ctx, claims, "Password123", totp.Code(clock.now)); err != nil {
+		t.Fatalf("DisableTOTP() failed: %v", err)
+	}
+	if result, err := service.Login(ctx, "jane@example.com", "Password123"); err != nil || result.MFARequired {
+		t.Errorf("Login() after DisableTOTP = %+v, %v", result, err)
+	}
+
+	events, _ := service.AuditEvents(ctx, AuditQuery{Types: []string{EventMFAEnabled, EventRecoveryCodeUsed, EventMFADisabled}})
+	if len(events) != 3 || events[1].Detail != "9 recovery codes left" {
+		t.Errorf("MFA audit events = %+v", events)
+	}
+}
+
+func TestService_TOTPLockoutAcrossLogins(t *testing.T) {
+	service, clock := newMFATestService(t,
+		WithThrottle(NewThrottle(ThrottleConfig{MaxAccountFailures: 5, LockoutDuration: time.Hour, FailureWindow: time.Hour})))
+	ctx := context.Background()
+
+	user, _ := service.Register(ctx, "jane@example.com", "Jane Roe", "Password123")
+	claims := &jwtservice.Claims{UserID: user.ID, Email: user.Email}
+	enrollment, _ := service.BeginTOTPEnrollment(ctx, claims)
+	totp, _ := security.ParseTOTP(enrollment.Secret)
+	if _, err := service.ConfirmTOTPEnrollment(ctx, claims, totp.Code(clock.now)); err != nil {
+		t.Fatalf("ConfirmTOTPEnrollment() failed: %v", err)
+	}
+
+	// A correct password does not forgive the wrong codes of earlier logins
+	var throttled *ThrottledError
+	for round := 0; round < 5; round++ {
+		pending, err := service.Login(ctx, "jane@example.com", "Password123")
+		if errors.As(err, &throttled) {
+			if !throttled.Locked || round < 2 {
+				t.Fatalf("Login() round %d error = %v, want a lock after 5 wrong codes", round, err)
+			}
+			return
+		}
+		if err != nil {
+			t.Fatalf("Login() round %d failed: %v", round, err)
+		}
+		for i := 0; i < 3; i++ {
+			service.CompleteLogin(ctx, pending.MFAToken, "000000")
+		}
+	}
+	t.Fatal("wrong codes spread across fresh logins never locked the account")
+}
+
+func TestHandler_TOTP(t *testing.T) {
+	service, clock := newMFATestService(t)
+	handler := NewHandler(service)
+	user, _ := service.Register(context.Background(), "jane@example.com", "Jane Roe", "Password123")
+	access, _ := service.Tokens().GenerateToken(user.ID, user.Email)
+
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do("POST", "/auth/mfa/totp", access, "")
+	secret := regexpGroup(t, `"secret":"([A-Z2-7]+)"`, rec.Body.String())
+	totp, _ := security.ParseTOTP(secret)
+	if rec := do("POST", "/auth/mfa/totp/confirm", access, `{"code":"`+totp.Code(clock.now)+`"}`); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "recovery_codes") {
+		t.Fatalf("confirm = %d %s", rec.Code, rec.Body.String())
+	}
+
+	rec = do("POST", "/auth/login", "", `{"email":"jane@example.com","password":"Password123"}`)
+	if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), "access_token") {
+		t.Fatalf("login = %d %s, want an mfa challenge only", rec.Code, rec.Body.String())
+	}
+	mfaToken := regexpGroup(t, `"mfa_token":"([^"]+)"`, rec.Body.String())
+
+	if rec := do("POST", "/auth/login/mfa", "", `{"mfa_token":"`+mfaToken+`","code":"123456"}`); rec.Code != http.StatusUnauthorized {
+		t.Errorf("login/mfa with a wrong code = %d, want 401", rec.Code)
+	}
+	clock.now = clock.now.Add(30 * time.Second)
+	if rec := do("POST", "/auth/login/mfa", "", `{"mfa_token":"`+mfaToken+`","code":"`+totp.Code(clock.now)+`"}`); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "access_token") {
+		t.Errorf("login/mfa = %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := do("GET", "/auth/me", mfaToken, ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("me with an mfa_pending token = %d, want 401", rec.Code)
+	}
+
+	clock.now = clock.now.Add(30 * time.Second)
+	if rec := do("DELETE", "/auth/mfa/totp", access, `{"password":"Password123","code":"`+totp.Code(clock.now)+`"}`); rec.Code != http.StatusNoContent {
+		t.Errorf("disable = %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func regexpGroup(t *testing.T, pattern, s string) string {
+	t.Helper()
+	match := regexp.MustCompile(pattern).FindStringSubmatch(s)
+	if match == nil {
+		t.Fatalf("%s not found in %s", pattern, s)
+	}
+	return match[1]
+}
@@ -0,0 +1,303 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"lab05/jwtservice"
+	"lab05/oidc"
+	"lab05/userdomain"
+)
+
+// OIDCStateTTL is how long a user may take at the identity provider
+const OIDCStateTTL = 10 * time.Minute
+
+// ErrUnknownProvider is returned for a provider name not configured with
+// WithOIDCProvider
+var ErrUnknownProvider = errors.New("unknown identity provider")
+
+// ErrInvalidOIDCState is returned for a callback whose state was not
+// issued to this browser, was used already or expired
+var ErrInvalidOIDCState = errors.New("invalid or expired sign-in state")
+
+// ErrAccountExists is returned when a provider's email belongs to an
+// account the identity cannot be linked to automatically. The user signs
+// in with their password and links the provider from there.
+var ErrAccountExists = errors.New("an account with this email exists; sign in and link the provider")
+
+// WithOIDCProvider enables "Sign in with name" through provider
+func WithOIDCProvider(name string, provider *oidc.Provider) Option {
+	return func(s *Service) {
+		if s.oidcProviders == nil {
+			s.oidcProviders = make(map[string]*oidc.Provider)
+		}
+		s.oidcProviders[name] = provider
+	}
+}
+
+// WithIdentityRepository stores linked identities in identities instead of
+// memory
+func WithIdentityRepository(identities userdomain.IdentityRepository) Option {
+	return func(s *Service) {
+		s.identities = identities
+	}
+}
+
+// oidcState is what a callback needs from the redirect that started it
+type oidcState struct {
+	provider string
+	nonce    string
+	verifier string
+	// linkUserID is the user linking the identity, or 0 for a login
+	linkUserID int
+	expiresAt  time.Time
+}
+
+// oidcStates keeps started redirects in memory. A redirect started in one
+// process must come back to the same one.
+type oidcStates struct {
+	mu      sync.Mutex
+	pending map[string]oidcState
+}
+
+func (st *oidcStates) put(key string, state oidcState, now time.Time) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.pending == nil {
+		st.pending = make(map[string]oidcState)
+	}
+	for k, pending := range st.pending {
+		if now.After(pending.expiresAt) {
+			delete(st.pending, k)
+		}
+	}
+	st.pending[key] = state
+}
+
+// take removes and returns the state for key if it has not expired
+func (st *oidcStates) take(key string, now time.Time) (oidcState, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	state, ok := st.pending[key]
+	delete(st.pending, key)
+	return state, ok && !now.After(state.expiresAt)
+}
+
+// OIDCProviders lists the configured provider names
+func (s *Service) OIDCProviders() []string {
+	names := make([]string, 0, len(s.oidcProviders))
+	for name := range s.oidcProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// BeginOIDCLogin starts signing in with provider. Send the browser to the
+// returned URL and bind State to it, e.g. in a cookie, for the callback.
+func (s *Service) BeginOIDCLogin(ctx context.Context, provider string) (*oidc.AuthRequest, error) {
+	return s.beginOIDC(provider, 0)
+}
+
+// BeginOIDCLink starts linking an identity at provider to the user of
+// claims, like BeginOIDCLogin
+func (s *Service) BeginOIDCLink(ctx context.Context, claims *jwtservice.Claims, provider string) (*oidc.AuthRequest, error) {
+	return s.beginOIDC(provider, claims.UserID)
+}
+
+func (s *Service) beginOIDC(name string, linkUserID int) (*oidc.AuthRequest, error) {
+	provider, ok := s.oidcProviders[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	request, err := provider.AuthCodeURL()
+	if err != nil {
+		return nil, err
+	}
+	s.oidcStates.put(request.State, oidcState{
+		provider:   name,
+		nonce:      request.Nonce,
+		verifier:   request.CodeVerifier,
+		linkUserID: linkUserID,
+		expiresAt:  s.now().Add(OIDCStateTTL),
+	}, s.now())
+	return request, nil
+}
+
+// CompleteOIDC handles the provider's callback: it exchanges code, verifies
+// the ID token and finds the linked user. For a login it returns a token
+// pair or, for users with TOTP, an MFA challenge like Login. An unknown
+// identity is linked to the account with the same email when both the
+// provider and we have verified that email, and gets a new account when
+// no account has the email. For a link only User is set.
+func (s *Service) CompleteOIDC(ctx context.Context, name, state, code string) (*LoginResult, error) {
+	pending, ok := s.oidcStates.take(state, s.now())
+	if !ok || pending.provider != name {
+		return nil, ErrInvalidOIDCState
+	}
+	provider, ok := s.oidcProviders[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	token, err := provider.Exchange(ctx, code, pending.verifier)
+	if err != nil {
+		return nil, err
+	}
+	idToken, err := provider.VerifyIDToken(ctx, token.IDToken, pending.nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	if pending.linkUserID != 0 {
+		user, err := s.linkIdentity(ctx, name, idToken, pending.linkUserID)
+		if err != nil {
+			return nil, err
+		}
+		return &LoginResult{User: user}, nil
+	}
+
+	user, err := s.oidcUser(ctx, name, idToken)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabled {
+		return s.challenge(ctx, user)
+	}
+	pair, err := s.startSession(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	s.record(ctx, AuditEvent{Type: EventLoginSuccess, UserID: user.ID, Email: user.Email, Detail: "via " + name})
+	return &LoginResult{User: user, TokenPair: pair}, nil
+}
+
+// Identities lists the identities linked to the user of claims
+func (s *Service) Identities(ctx context.Context, claims *jwtservice.Claims) ([]userdomain.Identity, error) {
+	return s.identities.ListIdentities(ctx, claims.UserID)
+}
+
+// UnlinkIdentity removes the user's identity at provider. The password
+// keeps working, and so does a reset for accounts created by a provider.
+func (s *Service) UnlinkIdentity(ctx context.Context, claims *jwtservice.Claims, provider string) error {
+	if err := s.identities.Unlink(ctx, claims.UserID, provider); err != nil {
+		return err
+	}
+	s.record(ctx, AuditEvent{Type: EventIdentityUnlinked, UserID: claims.UserID, Email: claims.Email, Detail: provider})
+	return nil
+}
+
+// oidcUser finds, links or creates the user of a verified ID token
+func (s *Service) oidcUser(ctx context.Context, provider string, idToken *oidc.IDToken) (*userdomain.User, error) {
+	identity, err := s.identities.GetIdentity(ctx, provider, idToken.Subject)
+	if err == nil {
+		return s.users.GetByID(ctx, identity.UserID)
+	}
+	if !errors.Is(err, userdomain.ErrIdentityNotFound) {
+		return nil, err
+	}
+	if idToken.Email == "" {
+		return nil, fmt.Errorf("%w: %s did not share an email address", ErrInvalidInput, provider)
+	}
+
+	user, err := s.users.GetByEmail(ctx, idToken.Email)
+	switch {
+	case err == nil:
+		// Only two verified owners of the same mailbox are the same person
+		if !idToken.EmailVerified || !user.EmailVerified {
+			return nil, ErrAccountExists
+		}
+	case errors.Is(err, userdomain.ErrUserNotFound):
+		if user, err = s.createOIDCUser(ctx, provider, idToken); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+	return s.linkIdentity(ctx, provider, idToken, user.ID)
+}
+
+// createOIDCUser registers the person behind idToken. The account gets a
+// random password, which a password reset can replace.
+func (s *Service) createOIDCUser(ctx context.Context, provider string, idToken *oidc.IDToken) (*userdomain.User, error) {
+	if err := userdomain.ValidateEmail(idToken.Email); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidInput, err)
+	}
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return nil, fmt.Errorf("failed to generate password: %v", err)
+	}
+	hash, err := s.passwords.HashPassword(base64.RawURLEncoding.EncodeToString(random))
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+	user := &userdomain.User{
+		Email:         strings.ToLower(strings.TrimSpace(idToken.Email)),
+		Name:          oidcName(idToken),
+		Password:      hash,
+		EmailVerified: idToken.EmailVerified,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if err := s.users.Create(ctx, user); err != nil {
+		return nil, err
+	}
+	s.record(ctx, AuditEvent{Type: EventRegistered, UserID: user.ID, Email: user.Email, Detail: "via " + provider})
+	if !user.EmailVerified {
+		if err := s.sendVerification(ctx, user, user.Email); err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+// oidcName picks a name that passes ValidateName
+func oidcName(idToken *oidc.IDToken) string {
+	local, _, _ := strings.Cut(idToken.Email, "@")
+	for _, name := range []string{idToken.Name, local} {
+		if userdomain.ValidateName(name) == nil {
+			return strings.TrimSpace(name)
+		}
+	}
+	return "New user"
+}
+
+// linkIdentity links the identity of idToken to userID. Linking an
+// identity the user already has is a no-op.
+func (s *Service) linkIdentity(ctx context.Context, provider string, idToken *oidc.IDToken, userID int) (*userdomain.User, error) {
+	user, err := s.users.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := s.identities.GetIdentity(ctx, provider, idToken.Subject)
+	if err == nil {
+		if existing.UserID != userID {
+			return nil, userdomain.ErrIdentityLinked
+		}
+		return user, nil
+	}
+	if !errors.Is(err, userdomain.ErrIdentityNotFound) {
+		return nil, err
+	}
+
+	err = s.identities.Link(ctx, &userdomain.Identity{
+		Provider:  provider,
+		Subject:   idToken.Subject,
+		UserID:    userID,
+		Email:     idToken.Email,
+		CreatedAt: s.now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.record(ctx, AuditEvent{Type: EventIdentityLinked, UserID: user.ID, Email: user.Email, Detail: provider})
+	return user, nil
+}
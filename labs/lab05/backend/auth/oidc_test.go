@@ -0,0 +1,243 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"lab05/jwtservice"
+	"lab05/oidc"
+	"lab05/oidc/oidctest"
+	"lab05/security"
+	"lab05/userdomain"
+)
+
+const oidcCallbackURL = "http://lab05.test/auth/oidc/mock/callback"
+
+func newOIDCTestService(t *testing.T, opts ...Option) (*Service, *oidctest.Provider, *recordingMailer) {
+	t.Helper()
+	idp := oidctest.NewProvider("lab05", "secret")
+	t.Cleanup(idp.Close)
+	provider, err := oidc.Discover(context.Background(), idp.Config(oidcCallbackURL))
+	if err != nil {
+		t.Fatalf("Discover() failed: %v", err)
+	}
+	mailer := &recordingMailer{}
+	service, _ := newTestService(t, append([]Option{WithOIDCProvider("mock", provider), WithMailer(mailer)}, opts...)...)
+	return service, idp, mailer
+}
+
+// followToProvider sends the browser to an authorization URL and returns
+// the callback URL the provider redirects back to
+func followToProvider(t *testing.T, authorizationURL string) *url.URL {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authorizationURL)
+	if err != nil {
+		t.Fatalf("GET %s failed: %v", authorizationURL, err)
+	}
+	resp.Body.Close()
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || !strings.HasPrefix(callback.String(), oidcCallbackURL) {
+		t.Fatalf("provider redirected to %q", resp.Header.Get("Location"))
+	}
+	return callback
+}
+
+// oidcLogin signs in through the provider
+func oidcLogin(t *testing.T, service *Service) (*LoginResult, error) {
+	t.Helper()
+	request, err := service.BeginOIDCLogin(context.Background(), "mock")
+	if err != nil {
+		t.Fatalf("BeginOIDCLogin() failed: %v", err)
+	}
+	return oidcCallback(t, service, request)
+}
+
+// oidcLink links the provider's current user to the user of claims
+func oidcLink(t *testing.T, service *Service, claims *jwtservice.Claims) (*LoginResult, error) {
+	t.Helper()
+	request, err := service.BeginOIDCLink(context.Background(), claims, "mock")
+	if err != nil {
+		t.Fatalf("BeginOIDCLink() failed: %v", err)
+	}
+	return oidcCallback(t, service, request)
+}
+
+func oidcCallback(t *testing.T, service *Service, request *oidc.AuthRequest) (*LoginResult, error) {
+	t.Helper()
+	callback := followToProvider(t, request.URL).Query()
+	return service.CompleteOIDC(context.Background(), "mock", callback.Get("state"), callback.Get("code"))
+}
+
+func TestService_OIDCLogin(t *testing.T) {
+	service, idp, mailer := newOIDCTestService(t)
+	ctx := context.Background()
+
+	if _, err := service.BeginOIDCLogin(ctx, "other"); !errors.Is(err, ErrUnknownProvider) {
+		t.Errorf("BeginOIDCLogin(other) error = %v, want ErrUnknownProvider", err)
+	}
+
+	// An unknown identity gets a new account
+	result, err := oidcLogin(t, service)
+	if err != nil || result.TokenPair == nil {
+		t.Fatalf("CompleteOIDC() = %+v, %v", result, err)
+	}
+	if user := result.User; user.Email != "jane@example.com" || user.Name != "Jane Roe" || !user.EmailVerified {
+		t.Errorf("created user = %+v", user)
+	}
+	if claims, err := service.Tokens().ValidateToken(result.AccessToken); err != nil || claims.UserID != result.User.ID {
+		t.Errorf("ValidateToken(access) = %+v, %v", claims, err)
+	}
+	if _, err := service.Login(ctx, "jane@example.com", ""); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Login(no password) error = %v, want ErrInvalidCredentials", err)
+	}
+
+	again, err := oidcLogin(t, service)
+	if err != nil || again.User.ID != result.User.ID {
+		t.Errorf("second CompleteOIDC() = %+v, %v, want the same user", again, err)
+	}
+
+	// States work once, for their provider only
+	request, _ := service.BeginOIDCLogin(ctx, "mock")
+	callback := followToProvider(t, request.URL).Query()
+	if _, err := service.CompleteOIDC(ctx, "other", callback.Get("state"), callback.Get("code")); !errors.Is(err, ErrInvalidOIDCState) {
+		t.Errorf("CompleteOIDC(other provider) error = %v, want ErrInvalidOIDCState", err)
+	}
+	if _, err := service.CompleteOIDC(ctx, "mock", callback.Get("state"), callback.Get("code")); !errors.Is(err, ErrInvalidOIDCState) {
+		t.Errorf("CompleteOIDC(used state) error = %v, want ErrInvalidOIDCState", err)
+	}
+
+	idp.Modify(func(claims jwt.MapClaims) { claims["nonce"] = "replayed" })
+	if _, err := oidcLogin(t, service); !errors.Is(err, oidc.ErrInvalidIDToken) {
+		t.Errorf("CompleteOIDC(wrong nonce) error = %v, want ErrInvalidIDToken", err)
+	}
+	idp.Modify(nil)
+
+	// An existing account is linked only when both sides verified the email
+	john, _ := service.Register(ctx, "john@example.com", "John Doe", "Password123")
+	idp.SetUser(oidctest.User{Subject: "user-2", Email: "john@example.com", EmailVerified: true, Name: "John"})
+	if _, err := oidcLogin(t, service); !errors.Is(err, ErrAccountExists) {
+		t.Errorf("CompleteOIDC(unverified local email) error = %v, want ErrAccountExists", err)
+	}
+	_, token := mailer.last(t, "john@example.com")
+	service.VerifyEmail(ctx, token)
+	if linked, err := oidcLogin(t, service); err != nil || linked.User.ID != john.ID {
+		t.Errorf("CompleteOIDC(verified emails) = %+v, %v, want John's account", linked, err)
+	}
+
+	// Unverified provider emails get a verification mail
+	idp.SetUser(oidctest.User{Subject: "user-3", Email: "x@example.com"})
+	created, err := oidcLogin(t, service)
+	if err != nil || created.User.EmailVerified || created.User.Name != "New user" {
+		t.Errorf("CompleteOIDC(unverified provider email) = %+v, %v", created, err)
+	}
+	if msg, _ := mailer.last(t, "x@example.com"); msg.Subject != "Confirm your email address" {
+		t.Errorf("mail to x@example.com = %+v", msg)
+	}
+
+	events, _ := service.AuditEvents(ctx, AuditQuery{Types: []string{EventIdentityLinked}})
+	if len(events) != 3 {
+		t.Errorf("identity_linked events = %+v, want 3", events)
+	}
+}
+
+func TestService_OIDCLink(t *testing.T) {
+	service, idp, _ := newOIDCTestService(t)
+	ctx := context.Background()
+
+	jane, _ := service.Register(ctx, "jane@example.com", "Jane Roe", "Password123")
+	john, _ := service.Register(ctx, "john@example.com", "John Doe", "Password123")
+	janeClaims := &jwtservice.Claims{UserID: jane.ID, Email: jane.Email}
+	johnClaims := &jwtservice.Claims{UserID: john.ID, Email: john.Email}
+
+	// Linking ignores the provider's email
+	idp.SetUser(oidctest.User{Subject: "user-9", Email: "jane.roe@work.example.com"})
+	result, err := oidcLink(t, service, janeClaims)
+	if err != nil || result.User.ID != jane.ID || result.TokenPair != nil {
+		t.Fatalf("CompleteOIDC(link) = %+v, %v", result, err)
+	}
+	identities, _ := service.Identities(ctx, janeClaims)
+	if len(identities) != 1 || identities[0].Subject != "user-9" || identities[0].Email != "jane.roe@work.example.com" {
+		t.Errorf("Identities() = %+v", identities)
+	}
+	if _, err := oidcLink(t, service, johnClaims); !errors.Is(err, userdomain.ErrIdentityLinked) {
+		t.Errorf("CompleteOIDC(link another user's identity) error = %v, want ErrIdentityLinked", err)
+	}
+
+	// A linked identity signs in, through TOTP when enabled
+	enrollment, _ := service.BeginTOTPEnrollment(ctx, janeClaims)
+	totp, _ := security.ParseTOTP(enrollment.Secret)
+	service.ConfirmTOTPEnrollment(ctx, janeClaims, totp.Code(time.Now()))
+	result, err = oidcLogin(t, service)
+	if err != nil || !result.MFARequired || result.TokenPair != nil {
+		t.Errorf("CompleteOIDC(TOTP user) = %+v, %v, want an MFA challenge", result, err)
+	}
+
+	if err := service.UnlinkIdentity(ctx, janeClaims, "mock"); err != nil {
+		t.Fatalf("UnlinkIdentity() failed: %v", err)
+	}
+	if err := service.UnlinkIdentity(ctx, janeClaims, "mock"); !errors.Is(err, userdomain.ErrIdentityNotFound) {
+		t.Errorf("UnlinkIdentity(again) error = %v, want ErrIdentityNotFound", err)
+	}
+}
+
+func TestHandler_OIDC(t *testing.T) {
+	service, _, _ := newOIDCTestService(t)
+	handler := NewHandler(service)
+
+	do := func(method, target, token string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := do("GET", "/auth/oidc/other/login", "", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("login(unknown provider) = %d, want 404", rec.Code)
+	}
+	rec := do("GET", "/auth/oidc/mock/login", "", nil)
+	cookies := rec.Result().Cookies()
+	if rec.Code != http.StatusFound || len(cookies) != 1 || !cookies[0].HttpOnly {
+		t.Fatalf("login = %d with cookies %+v", rec.Code, cookies)
+	}
+	callback := followToProvider(t, rec.Header().Get("Location"))
+
+	if rec := do("GET", callback.String(), "", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("callback without the state cookie = %d, want 400", rec.Code)
+	}
+	if rec := do("GET", "/auth/oidc/mock/callback?error=access_denied&state=x", "", cookies[0]); rec.Code != http.StatusBadRequest {
+		t.Errorf("callback(access_denied) = %d, want 400", rec.Code)
+	}
+	rec = do("GET", callback.String(), "", cookies[0])
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "access_token") {
+		t.Fatalf("callback = %d %s", rec.Code, rec.Body.String())
+	}
+	access := regexpGroup(t, `"access_token":"([^"]+)"`, rec.Body.String())
+
+	if rec := do("GET", "/auth/identities", access, nil); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"provider":"mock"`) {
+		t.Errorf("identities = %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := do("POST", "/auth/oidc/mock/link", access, nil); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "authorization_url") {
+		t.Errorf("link = %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := do("DELETE", "/auth/identities/mock", access, nil); rec.Code != http.StatusNoContent {
+		t.Errorf("unlink = %d", rec.Code)
+	}
+	if rec := do("GET", "/auth/identities", access, nil); rec.Body.String() != "[]\n" {
+		t.Errorf("identities after unlink = %s", rec.Body.String())
+	}
+}
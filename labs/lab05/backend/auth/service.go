@@ -0,0 +1,397 @@
+// Package auth ties userdomain, security and jwtservice together into
+// registration, login and account management
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"lab05/jwtservice"
+	"lab05/oidc"
+	"lab05/security"
+	"lab05/userdomain"
+)
+
+// ErrInvalidCredentials is returned for an unknown email or a wrong
+// password alike, so callers cannot probe which accounts exist
+var ErrInvalidCredentials = errors.New("invalid email or password")
+
+// ErrInvalidInput wraps validation failures of user-supplied data. The
+// underlying error, such as a *security.PolicyError, stays reachable
+// with errors.As.
+var ErrInvalidInput = errors.New("invalid input")
+
+// Service registers users, logs them in and manages their accounts
+type Service struct {
+	users     userdomain.Repository
+	passwords *security.PasswordService
+	tokens    *jwtservice.JWTService
+	throttle  *Throttle
+	audit     AuditLog
+	now       func() time.Time
+	// totpIssuer names the service in authenticator apps
+	totpIssuer string
+	// mailer, linkTokens and linkKey send and check emailed links
+	mailer           Mailer
+	linkTokens       OneTimeTokenStore
+	linkKey          []byte
+	linkBaseURL      string
+	verifyEmailTTL   time.Duration
+	resetPasswordTTL time.Duration
+	// identities links accounts at oidcProviders to users
+	identities    userdomain.IdentityRepository
+	oidcProviders map[string]*oidc.Provider
+	oidcStates    oidcStates
+	// sessions lists the logins of users for them to end
+	sessions SessionStore
+	// dummyHash is verified for unknown emails so that login takes as
+	// long as for known ones
+	dummyHash string
+}
+
+// Option configures a Service
+type Option func(*Service)
+
+// WithThrottle replaces the default throttle; nil disables throttling
+func WithThrottle(throttle *Throttle) Option {
+	return func(s *Service) {
+		s.throttle = throttle
+	}
+}
+
+// WithAuditLog stores auth events in log instead of a MemoryAuditLog,
+// which only keeps the most recent events
+func WithAuditLog(log AuditLog) Option {
+	return func(s *Service) {
+		s.audit = log
+	}
+}
+
+// WithClock replaces time.Now for throttling and audit timestamps
+func WithClock(now func() time.Time) Option {
+	return func(s *Service) {
+		s.now = now
+	}
+}
+
+// NewService creates a service that throttles logins with
+// DefaultThrottleConfig, keeps the latest audit events in memory and
+// prints emails to stdout unless opts say otherwise.
+// tokens needs a revocation store for Logout and ChangePassword to end
+// sessions.
+func NewService(users userdomain.Repository, passwords *security.PasswordService, tokens *jwtservice.JWTService, opts ...Option) (*Service, error) {
+	if users == nil || passwords == nil || tokens == nil {
+		return nil, errors.New("auth service needs a repository, password service and JWT service")
+	}
+	dummyHash, err := passwords.HashPassword("dummy password for timing")
+	if err != nil {
+		return nil, err
+	}
+	linkKey := make([]byte, 32)
+	if _, err := rand.Read(linkKey); err != nil {
+		return nil, fmt.Errorf("failed to generate link key: %v", err)
+	}
+	s := &Service{
+		users:            users,
+		passwords:        passwords,
+		tokens:           tokens,
+		throttle:         NewThrottle(DefaultThrottleConfig()),
+		audit:            NewMemoryAuditLog(),
+		now:              time.Now,
+		dummyHash:        dummyHash,
+		totpIssuer:       DefaultTOTPIssuer,
+		mailer:           NewConsoleMailer(os.Stdout),
+		linkTokens:       NewMemoryTokenStore(),
+		linkKey:          linkKey,
+		linkBaseURL:      DefaultLinkBaseURL,
+		verifyEmailTTL:   DefaultVerifyEmailTTL,
+		resetPasswordTTL: DefaultResetPasswordTTL,
+		identities:       userdomain.NewMemoryIdentityRepository(),
+		sessions:         NewMemorySessionStore(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.audit == nil {
+		return nil, errors.New("auth service needs an audit log")
+	}
+	if s.identities == nil {
+		return nil, errors.New("auth service needs an identity repository")
+	}
+	if s.sessions == nil {
+		return nil, errors.New("auth service needs a session store")
+	}
+	if s.mailer == nil || s.linkTokens == nil || len(s.linkKey) == 0 {
+		return nil, errors.New("auth service needs a mailer, token store and link key")
+	}
+	return s, nil
+}
+
+// Tokens returns the JWT service that issues and validates tokens
+func (s *Service) Tokens() *jwtservice.JWTService {
+	return s.tokens
+}
+
+// Register validates and stores a new user with a hashed password and
+// emails a link to verify the address
+func (s *Service) Register(ctx context.Context, email, name, password string) (*userdomain.User, error) {
+	user, err := userdomain.NewUser(email, name, password)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidInput, err)
+	}
+	if user.Password, err = s.passwords.HashPassword(password); err != nil {
+		return nil, err
+	}
+	if err := s.users.Create(ctx, user); err != nil {
+		return nil, err
+	}
+	s.record(ctx, AuditEvent{Type: EventRegistered, UserID: user.ID, Email: user.Email})
+	if err := s.sendVerification(ctx, user, user.Email); err != nil {
+		// The account exists; the user can ask for another link
+		log.Printf("auth: failed to issue verification link for user %d: %v", user.ID, err)
+	}
+	return user, nil
+}
+
+// Login checks the password and starts a token family for the session,
+// or, for users with TOTP, returns an mfa_pending token for CompleteLogin.
+// Hashes made with outdated parameters are replaced on the way. Repeated
+// failures for the email or the client IP of ctx (see ContextWithClientIP)
+// return a *ThrottledError without checking the password.
+func (s *Service) Login(ctx context.Context, email, password string) (*LoginResult, error) {
+	if err := s.checkThrottle(ctx, email); err != nil {
+		return nil, err
+	}
+	user, err := s.users.GetByEmail(ctx, email)
+	if errors.Is(err, userdomain.ErrUserNotFound) {
+		s.passwords.VerifyPassword(password, s.dummyHash)
+		s.fail(ctx, 0, email, "unknown account")
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkPassword(ctx, user, password); err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabled {
+		return s.challenge(ctx, user)
+	}
+
+	pair, err := s.startSession(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	s.record(ctx, AuditEvent{Type: EventLoginSuccess, UserID: user.ID, Email: user.Email})
+	return &LoginResult{User: user, TokenPair: pair}, nil
+}
+
+// Refresh exchanges a refresh token for a new pair and records the
+// activity in its session
+func (s *Service) Refresh(ctx context.Context, refreshToken string) (*jwtservice.TokenPair, error) {
+	pair, err := s.tokens.RefreshContext(ctx, refreshToken)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.touchSession(ctx, pair.FamilyID, pair.RefreshExpiresAt); err != nil {
+		return nil, err
+	}
+	return pair, nil
+}
+
+// Logout ends the session of an access token by revoking its family, so
+// its refresh token stops working too
+func (s *Service) Logout(ctx context.Context, claims *jwtservice.Claims) error {
+	if claims.FamilyID == "" {
+		return fmt.Errorf("%w: token has no session to end", ErrInvalidInput)
+	}
+	if err := s.endSession(ctx, claims.FamilyID); err != nil {
+		return err
+	}
+	s.record(ctx, AuditEvent{Type: EventLogout, UserID: claims.UserID, Email: claims.Email})
+	return nil
+}
+
+// Me returns the user an access token was issued to
+func (s *Service) Me(ctx context.Context, claims *jwtservice.Claims) (*userdomain.User, error) {
+	return s.users.GetByID(ctx, claims.UserID)
+}
+
+// ChangePassword replaces the password after checking the current one.
+// The session of claims is ended and a new token pair returned, so a
+// stolen refresh token of this session stops working.
+func (s *Service) ChangePassword(ctx context.Context, claims *jwtservice.Claims, current, next string) (*jwtservice.TokenPair, error) {
+	user, err := s.reauthenticate(ctx, claims, current)
+	if err != nil {
+		return nil, err
+	}
+	if err := userdomain.PasswordPolicy.Validate(next, user.Name, user.Email); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidInput, err)
+	}
+
+	if user.Password, err = s.passwords.HashPassword(next); err != nil {
+		return nil, err
+	}
+	user.UpdatedAt = s.now()
+	if err := s.users.Update(ctx, user); err != nil {
+		return nil, err
+	}
+	if claims.FamilyID != "" {
+		if err := s.endSession(ctx, claims.FamilyID); err != nil {
+			return nil, err
+		}
+	}
+	s.record(ctx, AuditEvent{Type: EventPasswordChanged, UserID: user.ID, Email: user.Email})
+	return s.startSession(ctx, user)
+}
+
+// ChangeEmail checks the password and emails a verification link to the
+// new address, which replaces the current one once VerifyEmail sees the
+// link. The current address is told about the request.
+func (s *Service) ChangeEmail(ctx context.Context, claims *jwtservice.Claims, password, email string) (*userdomain.User, error) {
+	user, err := s.reauthenticate(ctx, claims, password)
+	if err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(strings.TrimSpace(email), user.Email) {
+		return user, nil
+	}
+	if err := user.RequestEmailChange(email); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidInput, err)
+	}
+	if _, err := s.users.GetByEmail(ctx, user.PendingEmail); err == nil {
+		return nil, userdomain.ErrEmailTaken
+	} else if !errors.Is(err, userdomain.ErrUserNotFound) {
+		return nil, err
+	}
+	if err := s.users.Update(ctx, user); err != nil {
+		return nil, err
+	}
+	if err := s.sendVerification(ctx, user, user.PendingEmail); err != nil {
+		return nil, err
+	}
+	s.mail(ctx, Message{
+		To:      user.Email,
+		Subject: "Your email address is being changed",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone signed in to your account asked to change its email to %s. "+
+			"Nothing changes until the new address is confirmed. If this was not you, reset your password.",
+			user.Name, user.PendingEmail),
+	})
+	s.record(ctx, AuditEvent{Type: EventEmailChangeRequested, UserID: user.ID, Email: user.Email, Detail: "new email " + user.PendingEmail})
+	return user, nil
+}
+
+// Unlock lifts the lockout and backoff of an account, for admins
+func (s *Service) Unlock(ctx context.Context, admin *jwtservice.Claims, email string) {
+	if s.throttle != nil {
+		s.throttle.Unlock(email)
+	}
+	s.record(ctx, AuditEvent{Type: EventUnlock, Email: email, Detail: fmt.Sprintf("by user %d", admin.UserID)})
+}
+
+// UnlockIP lifts the block of a client IP, for admins
+func (s *Service) UnlockIP(ctx context.Context, admin *jwtservice.Claims, ip string) {
+	if s.throttle != nil {
+		s.throttle.UnlockIP(ip)
+	}
+	s.record(ctx, AuditEvent{Type: EventUnlock, Detail: fmt.Sprintf("ip %s by user %d", ip, admin.UserID)})
+}
+
+// AuditEvents queries the audit log
+func (s *Service) AuditEvents(ctx context.Context, query AuditQuery) ([]AuditEvent, error) {
+	return s.audit.Query(ctx, query)
+}
+
+// reauthenticate loads the user of claims and checks their password,
+// throttled like a login
+func (s *Service) reauthenticate(ctx context.Context, claims *jwtservice.Claims, password string) (*userdomain.User, error) {
+	user, err := s.users.GetByID(ctx, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkThrottle(ctx, user.Email); err != nil {
+		return nil, err
+	}
+	if err := s.checkPassword(ctx, user, password); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// checkPassword verifies password against user and stores a fresh hash
+// when the stored one needs a rehash
+func (s *Service) checkPassword(ctx context.Context, user *userdomain.User, password string) error {
+	match, needsRehash, err := s.passwords.CheckPassword(password, user.Password)
+	if err != nil {
+		return err
+	}
+	if !match {
+		s.fail(ctx, user.ID, user.Email, "wrong password")
+		return ErrInvalidCredentials
+	}
+	// With TOTP the password is only half the login; CompleteLogin resets
+	// the failures once the second factor passes, so wrong codes add up
+	// across fresh logins
+	if s.throttle != nil && !user.TOTPEnabled {
+		s.throttle.Success(user.Email)
+	}
+	if needsRehash {
+		if hash, err := s.passwords.HashPassword(password); err == nil {
+			user.Password = hash
+			// A failed rehash is retried on the next login
+			_ = s.users.Update(ctx, user)
+		}
+	}
+	return nil
+}
+
+func (s *Service) checkThrottle(ctx context.Context, email string) error {
+	if s.throttle == nil {
+		return nil
+	}
+	if err := s.throttle.Check(email, ClientIP(ctx), s.now()); err != nil {
+		s.record(ctx, AuditEvent{Type: EventLoginThrottled, Email: email, Detail: err.Error()})
+		return err
+	}
+	return nil
+}
+
+// fail counts a failed password check and audits it
+func (s *Service) fail(ctx context.Context, userID int, email, detail string) {
+	s.record(ctx, AuditEvent{Type: EventLoginFailure, UserID: userID, Email: email, Detail: detail})
+	if s.throttle != nil && s.throttle.Failure(email, ClientIP(ctx), s.now()) {
+		s.record(ctx, AuditEvent{Type: EventLockout, UserID: userID, Email: email})
+	}
+}
+
+// record stamps and stores event. Audit failures are logged rather than
+// failing the action, so a full disk cannot lock everyone out.
+func (s *Service) record(ctx context.Context, event AuditEvent) {
+	event.Time = s.now()
+	if event.IP == "" {
+		event.IP = ClientIP(ctx)
+	}
+	if err := s.audit.Record(ctx, &event); err != nil {
+		log.Printf("auth: failed to record %s event: %v", event.Type, err)
+	}
+}
+
+type clientIPContextKey struct{}
+
+// ContextWithClientIP returns a context carrying the client IP for
+// throttling and auditing
+func ContextWithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPContextKey{}, ip)
+}
+
+// ClientIP returns the IP stored by ContextWithClientIP, or ""
+func ClientIP(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPContextKey{}).(string)
+	return ip
+}
@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"lab05/jwtservice"
+	"lab05/security"
+	"lab05/userdomain"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func newTestService(t *testing.T, opts ...Option) (*Service, *userdomain.MemoryRepository) {
+	t.Helper()
+	passwords, err := security.NewPasswordServiceWithConfig(security.HasherConfig{
+		Algorithm:  security.AlgorithmBcrypt,
+		BcryptCost: bcrypt.MinCost,
+		Argon2:     security.DefaultArgon2Params,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := jwtservice.NewJWTService("test-secret", jwtservice.WithRevocationStore(jwtservice.NewMemoryRevocationStore()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := userdomain.NewMemoryRepository()
+	opts = append([]Option{WithMailer(NewConsoleMailer(io.Discard))}, opts...)
+	service, err := NewService(users, passwords, tokens, opts...)
+	if err != nil {
+		t.Fatalf("NewService() failed: %v", err)
+	}
+	return service, users
+}
+
+func TestService_RegisterAndLogin(t *testing.T) {
+	service, users := newTestService(t)
+	ctx := context.Background()
+
+	user, err := service.Register(ctx, "Jane@Example.com", "Jane Roe", "Password123")
+	if err != nil {
+		t.Fatalf("Register() failed: %v", err)
+	}
+	stored, _ := users.GetByID(ctx, user.ID)
+	if !strings.HasPrefix(stored.Password, "$2a$") || stored.Email != "jane@example.com" {
+		t.Errorf("stored user = %+v, want a bcrypt hash and a normalised email", stored)
+	}
+
+	if _, err := service.Register(ctx, "jane@example.com", "Jane Again", "Password123"); !errors.Is(err, userdomain.ErrEmailTaken) {
+		t.Errorf("Register(duplicate) error = %v, want ErrEmailTaken", err)
+	}
+	_, err = service.Register(ctx, "john@example.com", "John Doe", "password")
+	var policyErr *security.PolicyError
+	if !errors.Is(err, ErrInvalidInput) || !errors.As(err, &policyErr) {
+		t.Errorf("Register(weak password) error = %v, want ErrInvalidInput with a PolicyError", err)
+	}
+
+	result, err := service.Login(ctx, "jane@example.com", "Password123")
+	if err != nil {
+		t.Fatalf("Login() failed: %v", err)
+	}
+	claims, err := service.Tokens().ValidateToken(result.AccessToken)
+	if err != nil || claims.UserID != user.ID || claims.Email != "jane@example.com" {
+		t.Errorf("ValidateToken(access) = %+v, %v", claims, err)
+	}
+
+	for _, tt := range []struct{ email, password string }{
+		{"jane@example.com", "Password124"},
+		{"nobody@example.com", "Password123"},
+	} {
+		if _, err := service.Login(ctx, tt.email, tt.password); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("Login(%s, %s) error = %v, want ErrInvalidCredentials", tt.email, tt.password, err)
+		}
+	}
+}
+
+func TestService_LoginRehashes(t *testing.T) {
+	service, users := newTestService(t)
+	ctx := context.Background()
+
+	user, _ := userdomain.NewUser("jane@example.com", "Jane Roe", "Password123")
+	legacy, _ := bcrypt.GenerateFromPassword([]byte("Password123"), bcrypt.MinCost+1)
+	user.Password = string(legacy)
+	users.Create(ctx, user)
+
+	if _, err := service.Login(ctx, "jane@example.com", "Password123"); err != nil {
+		t.Fatalf("Login() failed: %v", err)
+	}
+	stored, _ := users.GetByID(ctx, user.ID)
+	if cost, _ := bcrypt.Cost([]byte(stored.Password)); cost != bcrypt.MinCost {
+		t.Errorf("stored hash cost = %d, want the rehash at %d", cost, bcrypt.MinCost)
+	}
+}
+
+func TestService_AccountManagement(t *testing.T) {
+	service, _ := newTestService(t)
+	ctx := context.Background()
+	tokens := service.Tokens()
+
+	service.Register(ctx, "jane@example.com", "Jane Roe", "Password123")
+	service.Register(ctx, "john@example.com", "John Doe", "Password123")
+	result, _ := service.Login(ctx, "jane@example.com", "Password123")
+	pair := result.TokenPair
+	claims, _ := tokens.ValidateToken(pair.AccessToken)
+
+	if me, err := service.Me(ctx, claims); err != nil || me.Email != "jane@example.com" {
+		t.Errorf("Me() = %+v, %v", me, err)
+	}
+
+	if _, err := service.ChangeEmail(ctx, claims, "wrong", "jane@new.example.com"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("ChangeEmail(wrong password) error = %v", err)
+	}
+	if _, err := service.ChangeEmail(ctx, claims, "Password123", "john@example.com"); !errors.Is(err, userdomain.ErrEmailTaken) {
+		t.Errorf("ChangeEmail(taken) error = %v, want ErrEmailTaken", err)
+	}
+	if user, err := service.ChangeEmail(ctx, claims, "Password123", "Jane@New.example.com"); err != nil || user.Email != "jane@example.com" || user.PendingEmail != "jane@new.example.com" {
+		t.Errorf("ChangeEmail() = %+v, %v, want the new email pending", user, err)
+	}
+
+	if _, err := service.ChangePassword(ctx, claims, "Password123", "short"); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("ChangePassword(weak) error = %v, want ErrInvalidInput", err)
+	}
+	newPair, err := service.ChangePassword(ctx, claims, "Password123", "NewPassword456")
+	if err != nil {
+		t.Fatalf("ChangePassword() failed: %v", err)
+	}
+	if _, err := tokens.ValidateToken(pair.AccessToken); !errors.Is(err, jwtservice.ErrTokenRevoked) {
+		t.Errorf("old session after ChangePassword: %v, want ErrTokenRevoked", err)
+	}
+	if _, err := service.Login(ctx, "jane@new.example.com", "Password123"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Login(old password) error = %v", err)
+	}
+
+	newClaims, err := tokens.ValidateToken(newPair.AccessToken)
+	if err != nil {
+		t.Fatalf("ValidateToken(new pair) failed: %v", err)
+	}
+	if err := service.Logout(ctx, newClaims); err != nil {
+		t.Fatalf("Logout() failed: %v", err)
+	}
+	if _, err := service.Refresh(ctx, newPair.RefreshToken); !errors.Is(err, jwtservice.ErrTokenRevoked) {
+		t.Errorf("Refresh() after Logout error = %v, want ErrTokenRevoked", err)
+	}
+}
@@ -0,0 +1,416 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"lab05/jwtservice"
+	"lab05/userdomain"
+)
+
+// SessionTouchInterval is how often activity in a session is written to
+// the store; requests in between do not update LastSeenAt
+const SessionTouchInterval = time.Minute
+
+// maxUserAgentLength caps stored user agents, which clients choose freely
+const maxUserAgentLength = 512
+
+// ErrSessionNotFound is returned for a session that does not exist or
+// belongs to another user
+var ErrSessionNotFound = errors.New("session not found")
+
+// Session is one login: the token family of a token pair, from the login
+// that started it through every refresh
+type Session struct {
+	// ID is the jwtservice family ID of the session's tokens
+	ID         string    `json:"id"`
+	UserID     int       `json:"-"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	// ExpiresAt is when the latest refresh token of the session expires
+	ExpiresAt time.Time `json:"expires_at"`
+	// Current is set by Service.Sessions for the session of the caller
+	Current bool `json:"current"`
+}
+
+// SessionStore keeps the sessions of users
+type SessionStore interface {
+	Create(ctx context.Context, session *Session) error
+	// Get returns nil for an unknown ID
+	Get(ctx context.Context, id string) (*Session, error)
+	// Update replaces the user agent, IP, last seen and expiry of a session
+	Update(ctx context.Context, session *Session) error
+	// ListUserSessions returns a user's sessions, most recently seen first
+	ListUserSessions(ctx context.Context, userID int) ([]Session, error)
+	Delete(ctx context.Context, id string) error
+	// Purge removes sessions that expired before now
+	Purge(ctx context.Context, now time.Time) error
+}
+
+// WithSessionStore keeps sessions in store instead of memory
+func WithSessionStore(store SessionStore) Option {
+	return func(s *Service) {
+		s.sessions = store
+	}
+}
+
+// Sessions lists the unexpired sessions of the user of claims and marks
+// the one claims belong to
+func (s *Service) Sessions(ctx context.Context, claims *jwtservice.Claims) ([]Session, error) {
+	all, err := s.sessions.ListUserSessions(ctx, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+	now := s.now()
+	sessions := make([]Session, 0, len(all))
+	for _, session := range all {
+		if session.ExpiresAt.Before(now) {
+			continue
+		}
+		session.Current = session.ID == claims.FamilyID
+		sessions = append(sessions, session)
+	}
+	return sessions, nil
+}
+
+// RevokeSession ends one session of the user of claims. Its access and
+// refresh tokens stop working at once.
+func (s *Service) RevokeSession(ctx context.Context, claims *jwtservice.Claims, id string) error {
+	session, err := s.sessions.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if session == nil || session.UserID != claims.UserID {
+		return ErrSessionNotFound
+	}
+	if err := s.endSession(ctx, session.ID); err != nil {
+		return err
+	}
+	s.record(ctx, AuditEvent{Type: EventSessionRevoked, UserID: claims.UserID, Email: claims.Email, Detail: describeSession(session)})
+	return nil
+}
+
+// RevokeAllSessions ends every session of the user of claims, including
+// the caller's own
+func (s *Service) RevokeAllSessions(ctx context.Context, claims *jwtservice.Claims) error {
+	if err := s.endUserSessions(ctx, claims.UserID); err != nil {
+		return err
+	}
+	if claims.FamilyID != "" {
+		if err := s.endSession(ctx, claims.FamilyID); err != nil {
+			return err
+		}
+	}
+	s.record(ctx, AuditEvent{Type: EventSessionRevoked, UserID: claims.UserID, Email: claims.Email, Detail: "all sessions"})
+	return nil
+}
+
+// TouchSession records a request made with claims as activity in their
+// session. Failures are logged; they must not fail the request.
+func (s *Service) TouchSession(ctx context.Context, claims *jwtservice.Claims) {
+	if claims.FamilyID == "" {
+		return
+	}
+	if err := s.touchSession(ctx, claims.FamilyID, time.Time{}); err != nil {
+		log.Printf("auth: failed to update session: %v", err)
+	}
+}
+
+// startSession issues the token pair of a new login and stores its session
+func (s *Service) startSession(ctx context.Context, user *userdomain.User) (*jwtservice.TokenPair, error) {
+	pair, err := s.tokens.GenerateTokenPair(user.ID, user.Email)
+	if err != nil {
+		return nil, err
+	}
+	now := s.now()
+	err = s.sessions.Create(ctx, &Session{
+		ID:         pair.FamilyID,
+		UserID:     user.ID,
+		UserAgent:  UserAgent(ctx),
+		IP:         ClientIP(ctx),
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  pair.RefreshExpiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pair, nil
+}
+
+// touchSession moves the last seen time of a session to now, along with
+// the client of ctx, and extends it to expiresAt unless that is zero.
+// Sessions this store does not know, such as ones from before it was
+// configured, are left alone.
+func (s *Service) touchSession(ctx context.Context, id string, expiresAt time.Time) error {
+	session, err := s.sessions.Get(ctx, id)
+	if err != nil || session == nil {
+		return err
+	}
+	now := s.now()
+	if expiresAt.IsZero() && now.Sub(session.LastSeenAt) < SessionTouchInterval {
+		return nil
+	}
+	session.LastSeenAt = now
+	if ip := ClientIP(ctx); ip != "" {
+		session.IP = ip
+	}
+	if agent := UserAgent(ctx); agent != "" {
+		session.UserAgent = agent
+	}
+	if !expiresAt.IsZero() {
+		session.ExpiresAt = expiresAt
+	}
+	return s.sessions.Update(ctx, session)
+}
+
+// endSession revokes the token family of a session and forgets it
+func (s *Service) endSession(ctx context.Context, id string) error {
+	if err := s.tokens.RevokeFamilyContext(ctx, id); err != nil {
+		return err
+	}
+	return s.sessions.Delete(ctx, id)
+}
+
+// endUserSessions ends every stored session of a user
+func (s *Service) endUserSessions(ctx context.Context, userID int) error {
+	sessions, err := s.sessions.ListUserSessions(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		if err := s.endSession(ctx, session.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func describeSession(session *Session) string {
+	if session.UserAgent == "" {
+		return "session from " + session.IP
+	}
+	return fmt.Sprintf("session from %s (%s)", session.IP, session.UserAgent)
+}
+
+type userAgentContextKey struct{}
+
+// ContextWithUserAgent returns a context carrying the client's user agent
+// for the sessions it starts
+func ContextWithUserAgent(ctx context.Context, userAgent string) context.Context {
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+	return context.WithValue(ctx, userAgentContextKey{}, userAgent)
+}
+
+// UserAgent returns the user agent stored by ContextWithUserAgent, or ""
+func UserAgent(ctx context.Context) string {
+	agent, _ := ctx.Value(userAgentContextKey{}).(string)
+	return agent
+}
+
+// MemorySessionStore is a SessionStore for a single process
+type MemorySessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]Session
+}
+
+// NewMemorySessionStore creates an empty store
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{sessions: make(map[string]Session)}
+}
+
+func (s *MemorySessionStore) Create(ctx context.Context, session *Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.sessions[session.ID]; ok {
+		return fmt.Errorf("session %s already exists", session.ID)
+	}
+	s.sessions[session.ID] = *session
+	return nil
+}
+
+func (s *MemorySessionStore) Get(ctx context.Context, id string) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[id]
+	if !ok {
+		return nil, nil
+	}
+	return &session, nil
+}
+
+func (s *MemorySessionStore) Update(ctx context.Context, session *Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, ok := s.sessions[session.ID]
+	if !ok {
+		return ErrSessionNotFound
+	}
+	stored.UserAgent = session.UserAgent
+	stored.IP = session.IP
+	stored.LastSeenAt = session.LastSeenAt
+	stored.ExpiresAt = session.ExpiresAt
+	s.sessions[session.ID] = stored
+	return nil
+}
+
+func (s *MemorySessionStore) ListUserSessions(ctx context.Context, userID int) ([]Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var sessions []Session
+	for _, session := range s.sessions {
+		if session.UserID == userID {
+			sessions = append(sessions, session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt)
+	})
+	return sessions, nil
+}
+
+func (s *MemorySessionStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, id)
+	return nil
+}
+
+func (s *MemorySessionStore) Purge(ctx context.Context, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, session := range s.sessions {
+		if session.ExpiresAt.Before(now) {
+			delete(s.sessions, id)
+		}
+	}
+	return nil
+}
+
+// sessionSchema keys sessions by their token family ID; the user_id
+// index serves ListUserSessions
+const sessionSchema = `CREATE TABLE IF NOT EXISTS auth_sessions (
+	id VARCHAR(64) PRIMARY KEY,
+	user_id INTEGER NOT NULL,
+	user_agent VARCHAR(512) NOT NULL,
+	ip VARCHAR(64) NOT NULL,
+	created_at INTEGER NOT NULL,
+	last_seen_at INTEGER NOT NULL,
+	expires_at INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_auth_sessions_user ON auth_sessions(user_id)`
+
+// SQLSessionStore is a SessionStore over an auth_sessions table. Times
+// are stored as Unix nanoseconds, and Purge drops sessions whose last
+// refresh token has expired.
+type SQLSessionStore struct {
+	db *sql.DB
+}
+
+// NewSQLSessionStore creates the auth_sessions table if needed
+func NewSQLSessionStore(db *sql.DB) (*SQLSessionStore, error) {
+	if db == nil {
+		return nil, errors.New("db must not be nil")
+	}
+	if _, err := db.Exec(sessionSchema); err != nil {
+		return nil, fmt.Errorf("failed to create auth_sessions: %v", err)
+	}
+	return &SQLSessionStore{db: db}, nil
+}
+
+func (s *SQLSessionStore) Create(ctx context.Context, session *Session) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO auth_sessions (id, user_id, user_agent, ip, created_at, last_seen_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		session.ID, session.UserID, session.UserAgent, session.IP,
+		session.CreatedAt.UnixNano(), session.LastSeenAt.UnixNano(), session.ExpiresAt.UnixNano(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create session: %v", err)
+	}
+	return nil
+}
+
+func (s *SQLSessionStore) Get(ctx context.Context, id string) (*Session, error) {
+	rows, err := s.db.QueryContext(ctx, sessionSelect+` WHERE id = ?`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session: %v", err)
+	}
+	sessions, err := scanSessions(rows)
+	if err != nil || len(sessions) == 0 {
+		return nil, err
+	}
+	return &sessions[0], nil
+}
+
+func (s *SQLSessionStore) Update(ctx context.Context, session *Session) error {
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE auth_sessions SET user_agent = ?, ip = ?, last_seen_at = ?, expires_at = ? WHERE id = ?`,
+		session.UserAgent, session.IP, session.LastSeenAt.UnixNano(), session.ExpiresAt.UnixNano(), session.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update session: %v", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to update session: %v", err)
+	}
+	if n == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+func (s *SQLSessionStore) ListUserSessions(ctx context.Context, userID int) ([]Session, error) {
+	rows, err := s.db.QueryContext(ctx, sessionSelect+` WHERE user_id = ? ORDER BY last_seen_at DESC`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %v", err)
+	}
+	return scanSessions(rows)
+}
+
+func (s *SQLSessionStore) Delete(ctx context.Context, id string) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM auth_sessions WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete session: %v", err)
+	}
+	return nil
+}
+
+func (s *SQLSessionStore) Purge(ctx context.Context, now time.Time) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM auth_sessions WHERE expires_at < ?`, now.UnixNano()); err != nil {
+		return fmt.Errorf("failed to purge sessions: %v", err)
+	}
+	return nil
+}
+
+const sessionSelect = `SELECT id, user_id, user_agent, ip, created_at, last_seen_at, expires_at FROM auth_sessions`
+
+func scanSessions(rows *sql.Rows) ([]Session, error) {
+	defer rows.Close()
+	var sessions []Session
+	for rows.Next() {
+		var session Session
+		var createdAt, lastSeenAt, expiresAt int64
+		if err := rows.Scan(&session.ID, &session.UserID, &session.UserAgent, &session.IP, &createdAt, &lastSeenAt, &expiresAt); err != nil {
+			return nil, fmt.Errorf("failed to scan session: %v", err)
+		}
+		session.CreatedAt = time.Unix(0, createdAt)
+		session.LastSeenAt = time.Unix(0, lastSeenAt)
+		session.ExpiresAt = time.Unix(0, expiresAt)
+		sessions = append(sessions, session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %v", err)
+	}
+	return sessions, nil
+}
@@ -0,0 +1,231 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"lab05/internal/sqlitetest"
+	"lab05/jwtservice"
+)
+
+func newSQLSessionStore(t *testing.T) *SQLSessionStore {
+	store, err := NewSQLSessionStore(sqlitetest.Open(t))
+	if err != nil {
+		t.Fatalf("NewSQLSessionStore() failed: %v", err)
+	}
+	return store
+}
+
+func TestSessionStores(t *testing.T) {
+	stores := map[string]func(t *testing.T) SessionStore{
+		"memory": func(t *testing.T) SessionStore { return NewMemorySessionStore() },
+		"sql":    func(t *testing.T) SessionStore { return newSQLSessionStore(t) },
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+			ctx := context.Background()
+			now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+			sessions := []Session{
+				{ID: "a", UserID: 1, UserAgent: "Firefox", IP: "192.0.2.1", CreatedAt: now, LastSeenAt: now, ExpiresAt: now.Add(time.Hour)},
+				{ID: "b", UserID: 1, UserAgent: "curl", IP: "192.0.2.2", CreatedAt: now, LastSeenAt: now.Add(time.Minute), ExpiresAt: now.Add(time.Hour)},
+				{ID: "c", UserID: 2, CreatedAt: now, LastSeenAt: now, ExpiresAt: now.Add(-time.Minute)},
+			}
+			for i := range sessions {
+				if err := store.Create(ctx, &sessions[i]); err != nil {
+					t.Fatalf("Create() failed: %v", err)
+				}
+			}
+			if err := store.Create(ctx, &sessions[0]); err == nil {
+				t.Errorf("Create(duplicate ID) succeeded")
+			}
+
+			got, err := store.Get(ctx, "a")
+			if err != nil || got == nil || got.UserAgent != "Firefox" || got.UserID != 1 || !got.ExpiresAt.Equal(now.Add(time.Hour)) {
+				t.Errorf("Get(a) = %+v, %v", got, err)
+			}
+			if got, err := store.Get(ctx, "missing"); got != nil || err != nil {
+				t.Errorf("Get(missing) = %+v, %v, want nil", got, err)
+			}
+
+			got.IP = "198.51.100.1"
+			got.LastSeenAt = now.Add(2 * time.Minute)
+			if err := store.Update(ctx, got); err != nil {
+				t.Fatalf("Update() failed: %v", err)
+			}
+			if err := store.Update(ctx, &Session{ID: "missing"}); !errors.Is(err, ErrSessionNotFound) {
+				t.Errorf("Update(missing) error = %v, want ErrSessionNotFound", err)
+			}
+			list, err := store.ListUserSessions(ctx, 1)
+			if err != nil || len(list) != 2 || list[0].ID != "a" || list[0].IP != "198.51.100.1" || list[1].ID != "b" {
+				t.Errorf("ListUserSessions(1) = %+v, %v, want a then b", list, err)
+			}
+
+			store.Delete(ctx, "b")
+			if got, _ := store.Get(ctx, "b"); got != nil {
+				t.Errorf("Get(b) after Delete = %+v", got)
+			}
+			store.Purge(ctx, now)
+			if got, _ := store.Get(ctx, "c"); got != nil {
+				t.Errorf("Get(c) after Purge = %+v", got)
+			}
+		})
+	}
+}
+
+func TestService_Sessions(t *testing.T) {
+	service, clock := newMFATestService(t)
+	ctx := context.Background()
+	service.Register(ctx, "jane@example.com", "Jane Roe", "Password123")
+
+	laptop := ContextWithUserAgent(ContextWithClientIP(ctx, "192.0.2.1"), "Firefox")
+	phone := ContextWithUserAgent(ContextWithClientIP(ctx, "192.0.2.2"), "Lab App/1.0")
+	first, _ := service.Login(laptop, "jane@example.com", "Password123")
+	clock.now = clock.now.Add(time.Minute)
+	second, _ := service.Login(phone, "jane@example.com", "Password123")
+	claims, err := service.Tokens().ValidateToken(first.AccessToken)
+	if err != nil {
+		t.Fatalf("ValidateToken() failed: %v", err)
+	}
+
+	sessions, err := service.Sessions(ctx, claims)
+	if err != nil || len(sessions) != 2 {
+		t.Fatalf("Sessions() = %+v, %v, want 2", sessions, err)
+	}
+	if s := sessions[1]; s.ID != first.FamilyID || !s.Current || s.UserAgent != "Firefox" || s.IP != "192.0.2.1" {
+		t.Errorf("laptop session = %+v", s)
+	}
+	if s := sessions[0]; s.Current || s.UserAgent != "Lab App/1.0" {
+		t.Errorf("phone session = %+v", s)
+	}
+
+	// Refreshing moves the session to the new client and extends it
+	clock.now = clock.now.Add(time.Hour)
+	moved := ContextWithClientIP(ctx, "198.51.100.7")
+	refreshed, err := service.Refresh(moved, first.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh() failed: %v", err)
+	}
+	sessions, _ = service.Sessions(ctx, claims)
+	if s := sessions[0]; s.ID != first.FamilyID || s.IP != "198.51.100.7" || s.UserAgent != "Firefox" ||
+		!s.LastSeenAt.Equal(clock.now) || !s.ExpiresAt.Equal(refreshed.RefreshExpiresAt) {
+		t.Errorf("session after Refresh = %+v", s)
+	}
+
+	// Requests only count once per SessionTouchInterval
+	clock.now = clock.now.Add(SessionTouchInterval / 2)
+	service.TouchSession(ctx, claims)
+	if sessions, _ = service.Sessions(ctx, claims); sessions[0].LastSeenAt.Equal(clock.now) {
+		t.Errorf("TouchSession() within the interval updated LastSeenAt")
+	}
+	clock.now = clock.now.Add(SessionTouchInterval)
+	service.TouchSession(ctx, claims)
+	if sessions, _ = service.Sessions(ctx, claims); !sessions[0].LastSeenAt.Equal(clock.now) {
+		t.Errorf("TouchSession() after the interval left LastSeenAt at %v", sessions[0].LastSeenAt)
+	}
+
+	// Revoking a session stops its tokens at once
+	john, _ := service.Register(ctx, "john@example.com", "John Doe", "Password123")
+	johnClaims := &jwtservice.Claims{UserID: john.ID, Email: john.Email}
+	if err := service.RevokeSession(ctx, johnClaims, second.FamilyID); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("RevokeSession(another user's session) error = %v, want ErrSessionNotFound", err)
+	}
+	if err := service.RevokeSession(ctx, claims, second.FamilyID); err != nil {
+		t.Fatalf("RevokeSession() failed: %v", err)
+	}
+	if _, err := service.Tokens().ValidateToken(second.AccessToken); !errors.Is(err, jwtservice.ErrTokenRevoked) {
+		t.Errorf("ValidateToken(revoked session) error = %v, want ErrTokenRevoked", err)
+	}
+	if _, err := service.Refresh(ctx, second.RefreshToken); !errors.Is(err, jwtservice.ErrTokenRevoked) {
+		t.Errorf("Refresh(revoked session) error = %v, want ErrTokenRevoked", err)
+	}
+	if _, err := service.Tokens().ValidateToken(refreshed.AccessToken); err != nil {
+		t.Errorf("ValidateToken(other session) failed: %v", err)
+	}
+
+	// Sessions end after their refresh token expires
+	clock.now = refreshed.RefreshExpiresAt.Add(time.Second)
+	if sessions, _ := service.Sessions(ctx, claims); len(sessions) != 0 {
+		t.Errorf("Sessions() after expiry = %+v, want none", sessions)
+	}
+}
+
+func TestService_RevokeAllSessions(t *testing.T) {
+	service, _ := newTestService(t)
+	ctx := context.Background()
+	service.Register(ctx, "jane@example.com", "Jane Roe", "Password123")
+
+	var pairs []*LoginResult
+	for i := 0; i < 3; i++ {
+		result, _ := service.Login(ctx, "jane@example.com", "Password123")
+		pairs = append(pairs, result)
+	}
+	claims, _ := service.Tokens().ValidateToken(pairs[0].AccessToken)
+	if err := service.RevokeAllSessions(ctx, claims); err != nil {
+		t.Fatalf("RevokeAllSessions() failed: %v", err)
+	}
+	for i, result := range pairs {
+		if _, err := service.Tokens().ValidateToken(result.AccessToken); !errors.Is(err, jwtservice.ErrTokenRevoked) {
+			t.Errorf("ValidateToken(session %d) error = %v, want ErrTokenRevoked", i, err)
+		}
+	}
+	if sessions, _ := service.Sessions(ctx, claims); len(sessions) != 0 {
+		t.Errorf("Sessions() = %+v, want none", sessions)
+	}
+
+	events, _ := service.AuditEvents(ctx, AuditQuery{Types: []string{EventSessionRevoked}})
+	if len(events) != 1 || events[0].Detail != "all sessions" {
+		t.Errorf("session_revoked events = %+v", events)
+	}
+}
+
+func TestHandler_Sessions(t *testing.T) {
+	service, _ := newTestService(t)
+	handler := NewHandler(service)
+
+	do := func(method, path, token, userAgent, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("User-Agent", userAgent)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	do("POST", "/auth/register", "", "", `{"email":"jane@example.com","name":"Jane Roe","password":"Password123"}`)
+	login := `{"email":"jane@example.com","password":"Password123"}`
+	laptop := regexpGroup(t, `"access_token":"([^"]+)"`, do("POST", "/auth/login", "", "Firefox", login).Body.String())
+	phone := regexpGroup(t, `"access_token":"([^"]+)"`, do("POST", "/auth/login", "", "Lab App/1.0", login).Body.String())
+
+	rec := do("GET", "/auth/sessions", laptop, "Firefox", "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"user_agent":"Lab App/1.0"`) || !strings.Contains(rec.Body.String(), `"ip":"192.0.2.1"`) {
+		t.Fatalf("sessions = %d %s", rec.Code, rec.Body.String())
+	}
+	phoneClaims, _ := service.Tokens().ValidateToken(phone)
+
+	if rec := do("DELETE", "/auth/sessions/unknown", laptop, "Firefox", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("revoke(unknown) = %d, want 404", rec.Code)
+	}
+	if rec := do("DELETE", "/auth/sessions/"+phoneClaims.FamilyID, laptop, "Firefox", ""); rec.Code != http.StatusNoContent {
+		t.Errorf("revoke(phone) = %d, want 204", rec.Code)
+	}
+	if rec := do("GET", "/auth/me", phone, "Lab App/1.0", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("me(revoked session) = %d, want 401", rec.Code)
+	}
+
+	if rec := do("DELETE", "/auth/sessions", laptop, "Firefox", ""); rec.Code != http.StatusNoContent {
+		t.Errorf("revoke all = %d, want 204", rec.Code)
+	}
+	if rec := do("GET", "/auth/sessions", laptop, "Firefox", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("sessions after revoking all = %d, want 401", rec.Code)
+	}
+}
@@ -0,0 +1,253 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ThrottleConfig tunes login throttling. Failures are counted per account
+// (email) and per client IP; counters reset after FailureWindow without
+// failures.
+type ThrottleConfig struct {
+	// FreeAttempts are failures allowed before delays start
+	FreeAttempts int
+	// BaseDelay is the first delay; each further failure doubles it up
+	// to MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// MaxAccountFailures locks the account for LockoutDuration
+	MaxAccountFailures int
+	LockoutDuration    time.Duration
+	// MaxIPFailures blocks the IP for LockoutDuration, across accounts
+	MaxIPFailures int
+	FailureWindow time.Duration
+}
+
+// DefaultThrottleConfig allows 3 free attempts, then waits 1s, 2s, 4s...
+// and locks an account after 10 failures or an IP after 50, for 15 minutes
+func DefaultThrottleConfig() ThrottleConfig {
+	return ThrottleConfig{
+		FreeAttempts:       3,
+		BaseDelay:          time.Second,
+		MaxDelay:           5 * time.Minute,
+		MaxAccountFailures: 10,
+		LockoutDuration:    15 * time.Minute,
+		MaxIPFailures:      50,
+		FailureWindow:      time.Hour,
+	}
+}
+
+// ThrottledError rejects a login attempt before the password is checked
+type ThrottledError struct {
+	// Locked is true for a lockout, false for a backoff delay
+	Locked     bool
+	RetryAfter time.Duration
+}
+
+func (e *ThrottledError) Error() string {
+	if e.Locked {
+		return fmt.Sprintf("too many failed logins; locked for %s", e.RetryAfter.Round(time.Second))
+	}
+	return fmt.Sprintf("too many failed logins; retry in %s", e.RetryAfter.Round(time.Second))
+}
+
+// failureCounter tracks the failures of one account or IP
+type failureCounter struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// maxThrottleCounters is how many accounts and IPs are tracked. Past it,
+// ended counters are forgotten first, then the least recent failures.
+const maxThrottleCounters = 100000
+
+// Throttle counts login failures in memory. Restarting the process
+// forgets them, which only ever unlocks.
+type Throttle struct {
+	config      ThrottleConfig
+	maxCounters int
+	mu          sync.Mutex
+	counters    map[string]*failureCounter
+}
+
+// NewThrottle creates a throttle; zero limits disable their rule
+func NewThrottle(config ThrottleConfig) *Throttle {
+	return &Throttle{
+		config:      config,
+		maxCounters: maxThrottleCounters,
+		counters:    make(map[string]*failureCounter),
+	}
+}
+
+func accountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Check returns a *ThrottledError when email or ip may not try now
+func (t *Throttle) Check(email, ip string, now time.Time) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var worst *ThrottledError
+	for _, key := range []string{accountKey(email), ipKey(ip)} {
+		counter := t.counter(key, now, false)
+		if counter == nil {
+			continue
+		}
+		var err *ThrottledError
+		if now.Before(counter.lockedUntil) {
+			err = &ThrottledError{Locked: true, RetryAfter: counter.lockedUntil.Sub(now)}
+		} else if strings.HasPrefix(key, "account:") {
+			if next := counter.lastFailure.Add(t.delay(counter.failures)); now.Before(next) {
+				err = &ThrottledError{RetryAfter: next.Sub(now)}
+			}
+		}
+		if err != nil && (worst == nil || err.RetryAfter > worst.RetryAfter) {
+			worst = err
+		}
+	}
+	if worst == nil {
+		return nil
+	}
+	return worst
+}
+
+// Failure records a failed login and reports whether it locked the
+// account
+func (t *Throttle) Failure(email, ip string, now time.Time) (locked bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	account := t.counter(accountKey(email), now, true)
+	account.failures++
+	account.lastFailure = now
+	if t.config.MaxAccountFailures > 0 && account.failures >= t.config.MaxAccountFailures && !now.Before(account.lockedUntil) {
+		account.lockedUntil = now.Add(t.config.LockoutDuration)
+		locked = true
+	}
+
+	if ip != "" {
+		address := t.counter(ipKey(ip), now, true)
+		address.failures++
+		address.lastFailure = now
+		if t.config.MaxIPFailures > 0 && address.failures >= t.config.MaxIPFailures {
+			address.lockedUntil = now.Add(t.config.LockoutDuration)
+		}
+	}
+	return locked
+}
+
+// Success forgets the failures of the account. IP failures stay, so one
+// valid account cannot launder guesses against others.
+func (t *Throttle) Success(email string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.counters, accountKey(email))
+}
+
+// Unlock clears the failures and lockout of an account, for admins
+func (t *Throttle) Unlock(email string) {
+	t.Success(email)
+}
+
+// UnlockIP clears the failures and block of an IP, for admins
+func (t *Throttle) UnlockIP(ip string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.counters, ipKey(ip))
+}
+
+// counter returns the live counter of key. Counters end when their
+// lockout ends or their last failure leaves the window, so an unlocked
+// account starts over. With create it never returns nil.
+func (t *Throttle) counter(key string, now time.Time, create bool) *failureCounter {
+	counter, ok := t.counters[key]
+	if ok && t.ended(counter, now) {
+		delete(t.counters, key)
+		ok = false
+	}
+	if !ok && create {
+		if len(t.counters) >= t.maxCounters {
+			t.forgetEnded(now)
+		}
+		if len(t.counters) >= t.maxCounters {
+			t.forgetLeastRecent(now)
+		}
+		counter = &failureCounter{}
+		t.counters[key] = counter
+		ok = true
+	}
+	if !ok {
+		return nil
+	}
+	return counter
+}
+
+// ended reports whether counter no longer throttles anything
+func (t *Throttle) ended(counter *failureCounter, now time.Time) bool {
+	if now.Before(counter.lockedUntil) {
+		return false
+	}
+	lockExpired := !counter.lockedUntil.IsZero()
+	windowPassed := t.config.FailureWindow > 0 && now.Sub(counter.lastFailure) > t.config.FailureWindow
+	return lockExpired || windowPassed
+}
+
+// forgetEnded drops the counters that have ended. The caller holds the
+// mutex.
+func (t *Throttle) forgetEnded(now time.Time) {
+	for key, counter := range t.counters {
+		if t.ended(counter, now) {
+			delete(t.counters, key)
+		}
+	}
+}
+
+// forgetLeastRecent drops the counter whose last failure is oldest,
+// sparing lockouts while any counter is not locked, so a flood of new
+// emails or IPs can neither grow the map without bound nor cheaply lift
+// a lockout. The caller holds the mutex.
+func (t *Throttle) forgetLeastRecent(now time.Time) {
+	var oldest string
+	var oldestCounter *failureCounter
+	for key, counter := range t.counters {
+		if oldestCounter == nil {
+			oldest, oldestCounter = key, counter
+			continue
+		}
+		locked, oldestLocked := now.Before(counter.lockedUntil), now.Before(oldestCounter.lockedUntil)
+		if locked != oldestLocked {
+			if !locked {
+				oldest, oldestCounter = key, counter
+			}
+			continue
+		}
+		if counter.lastFailure.Before(oldestCounter.lastFailure) {
+			oldest, oldestCounter = key, counter
+		}
+	}
+	delete(t.counters, oldest)
+}
+
+// delay is the wait after failures failures
+func (t *Throttle) delay(failures int) time.Duration {
+	excess := failures - t.config.FreeAttempts
+	if excess <= 0 || t.config.BaseDelay <= 0 {
+		return 0
+	}
+	delay := t.config.BaseDelay
+	for i := 1; i < excess && i < 32 && (t.config.MaxDelay <= 0 || delay < t.config.MaxDelay); i++ {
+		delay *= 2
+	}
+	if t.config.MaxDelay > 0 && delay > t.config.MaxDelay {
+		delay = t.config.MaxDelay
+	}
+	return delay
+}
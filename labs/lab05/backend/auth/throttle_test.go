@@ -0,0 +1,205 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"lab05/jwtservice"
+)
+
+func TestThrottle(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	throttle := NewThrottle(ThrottleConfig{
+		FreeAttempts:       2,
+		BaseDelay:          time.Second,
+		MaxDelay:           4 * time.Second,
+		MaxAccountFailures: 6,
+		LockoutDuration:    time.Minute,
+		MaxIPFailures:      10,
+		FailureWindow:      time.Hour,
+	})
+
+	now := start
+	var delays []time.Duration
+	for i := 1; i <= 5; i++ {
+		if err := throttle.Check("Jane@example.com", "10.0.0.1", now); err != nil {
+			t.Fatalf("attempt %d throttled: %v", i, err)
+		}
+		throttle.Failure("jane@example.com", "10.0.0.1", now)
+
+		var throttled *ThrottledError
+		if err := throttle.Check("jane@example.com", "10.0.0.2", now); errors.As(err, &throttled) {
+			delays = append(delays, throttled.RetryAfter)
+			now = now.Add(throttled.RetryAfter)
+		} else {
+			delays = append(delays, 0)
+		}
+	}
+	want := []time.Duration{0, 0, time.Second, 2 * time.Second, 4 * time.Second}
+	for i := range want {
+		if delays[i] != want[i] {
+			t.Errorf("delays = %v, want %v", delays, want)
+			break
+		}
+	}
+
+	if locked := throttle.Failure("jane@example.com", "10.0.0.1", now); !locked {
+		t.Fatal("Failure() should lock the account at MaxAccountFailures")
+	}
+	var throttled *ThrottledError
+	if err := throttle.Check("jane@example.com", "10.9.9.9", now.Add(30*time.Second)); !errors.As(err, &throttled) || !throttled.Locked {
+		t.Errorf("Check() during lockout = %v, want a lock", err)
+	}
+	if err := throttle.Check("jane@example.com", "10.9.9.9", now.Add(time.Minute)); err != nil {
+		t.Errorf("Check() after lockout = %v, want nil", err)
+	}
+	if err := throttle.Check("john@example.com", "10.0.0.1", now); err != nil {
+		t.Errorf("Check() of another account from the same IP = %v, want nil below MaxIPFailures", err)
+	}
+
+	for i := 0; i < 4; i++ {
+		throttle.Failure("user"+string(rune('a'+i))+"@example.com", "10.0.0.1", now)
+	}
+	if err := throttle.Check("fresh@example.com", "10.0.0.1", now); !errors.As(err, &throttled) || !throttled.Locked {
+		t.Errorf("Check() from a blocked IP = %v, want a lock", err)
+	}
+	throttle.UnlockIP("10.0.0.1")
+	if err := throttle.Check("fresh@example.com", "10.0.0.1", now); err != nil {
+		t.Errorf("Check() after UnlockIP = %v", err)
+	}
+
+	throttle.Failure("old@example.com", "", start)
+	throttle.Failure("old@example.com", "", start)
+	throttle.Failure("old@example.com", "", start)
+	if err := throttle.Check("old@example.com", "", start.Add(2*time.Hour)); err != nil {
+		t.Errorf("Check() after FailureWindow = %v, want nil", err)
+	}
+}
+
+func TestThrottle_MaxCounters(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	throttle := NewThrottle(ThrottleConfig{
+		MaxAccountFailures: 2,
+		LockoutDuration:    time.Minute,
+		FailureWindow:      time.Hour,
+	})
+	throttle.maxCounters = 3
+
+	throttle.Failure("locked@example.com", "", now)
+	throttle.Failure("locked@example.com", "", now)
+	throttle.Failure("alice@example.com", "", now.Add(time.Second))
+	throttle.Failure("bob@example.com", "", now.Add(2*time.Second))
+
+	// The lockout is older but spared; alice's failure goes instead
+	throttle.Failure("carol@example.com", "", now.Add(3*time.Second))
+	if len(throttle.counters) != 3 {
+		t.Errorf("%d counters, want 3", len(throttle.counters))
+	}
+	if _, ok := throttle.counters[accountKey("alice@example.com")]; ok {
+		t.Error("alice's counter should have been forgotten")
+	}
+	if err := throttle.Check("locked@example.com", "", now.Add(4*time.Second)); err == nil {
+		t.Error("Check() = nil, want the lockout to survive")
+	}
+
+	// Once the window has passed, ended counters go first
+	throttle.Failure("dave@example.com", "", now.Add(2*time.Hour))
+	if len(throttle.counters) != 1 {
+		t.Errorf("%d counters after the window, want 1", len(throttle.counters))
+	}
+}
+
+func TestService_LockoutAndAudit(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	service, _ := newTestService(t,
+		WithClock(func() time.Time { return now }),
+		WithThrottle(NewThrottle(ThrottleConfig{MaxAccountFailures: 3, LockoutDuration: 10 * time.Minute, FailureWindow: time.Hour})),
+	)
+	ctx := ContextWithClientIP(context.Background(), "192.0.2.7")
+	service.Register(ctx, "jane@example.com", "Jane Roe", "Password123")
+
+	for i := 0; i < 3; i++ {
+		if _, err := service.Login(ctx, "jane@example.com", "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("Login(wrong) #%d error = %v", i+1, err)
+		}
+	}
+	var throttled *ThrottledError
+	if _, err := service.Login(ctx, "jane@example.com", "Password123"); !errors.As(err, &throttled) || !throttled.Locked {
+		t.Fatalf("Login() while locked error = %v, want a lock", err)
+	}
+
+	admin := &jwtservice.Claims{UserID: 99, Roles: []string{AdminRole}}
+	service.Unlock(ctx, admin, "jane@example.com")
+	if _, err := service.Login(ctx, "jane@example.com", "Password123"); err != nil {
+		t.Fatalf("Login() after Unlock failed: %v", err)
+	}
+
+	events, err := service.AuditEvents(ctx, AuditQuery{Email: "jane@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var types []string
+	for _, event := range events {
+		types = append(types, event.Type)
+		if event.IP != "192.0.2.7" || !event.Time.Equal(now) {
+			t.Errorf("event %+v should carry the client IP and clock time", event)
+		}
+	}
+	want := "login_success unlock login_throttled lockout login_failure login_failure login_failure registered"
+	if strings.Join(types, " ") != want {
+		t.Errorf("audit types = %v, want %s", types, want)
+	}
+
+	lockouts, _ := service.AuditEvents(ctx, AuditQuery{Types: []string{EventLockout}})
+	if len(lockouts) != 1 || lockouts[0].UserID == 0 {
+		t.Errorf("lockout events = %+v", lockouts)
+	}
+}
+
+func TestHandler_ThrottleAndAdmin(t *testing.T) {
+	service, _ := newTestService(t, WithThrottle(NewThrottle(ThrottleConfig{MaxAccountFailures: 1, LockoutDuration: time.Hour})))
+	handler := NewHandler(service)
+	service.Register(context.Background(), "jane@example.com", "Jane Roe", "Password123")
+
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.RemoteAddr = "198.51.100.4:5555"
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	do("POST", "/auth/login", "", `{"email":"jane@example.com","password":"wrong"}`)
+	rec := do("POST", "/auth/login", "", `{"email":"jane@example.com","password":"Password123"}`)
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "3600" {
+		t.Fatalf("login while locked = %d, Retry-After %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+
+	user, _ := service.Tokens().GenerateToken(7, "user@example.com")
+	admin, _ := service.Tokens().GenerateTokenFor(&jwtservice.Claims{UserID: 1, Email: "admin@example.com", Roles: []string{AdminRole}})
+	if rec := do("POST", "/auth/admin/unlock", user, `{"email":"jane@example.com"}`); rec.Code != http.StatusForbidden {
+		t.Errorf("unlock as user = %d, want 403", rec.Code)
+	}
+	if rec := do("POST", "/auth/admin/unlock", admin, `{"email":"jane@example.com"}`); rec.Code != http.StatusNoContent {
+		t.Errorf("unlock as admin = %d, want 204", rec.Code)
+	}
+	if rec := do("POST", "/auth/login", "", `{"email":"jane@example.com","password":"Password123"}`); rec.Code != http.StatusOK {
+		t.Errorf("login after unlock = %d, want 200", rec.Code)
+	}
+
+	rec = do("GET", "/auth/admin/audit?email=jane@example.com&type=lockout,unlock&limit=10", admin, "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"type":"unlock"`) || !strings.Contains(rec.Body.String(), `"ip":"198.51.100.4"`) {
+		t.Errorf("audit = %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := do("GET", "/auth/admin/audit?since=yesterday", admin, ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("audit with a bad since = %d, want 400", rec.Code)
+	}
+}
@@ -0,0 +1,185 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// One-time token purposes
+const (
+	PurposeVerifyEmail   = "verify_email"
+	PurposeResetPassword = "reset_password"
+)
+
+// OneTimeToken is the stored half of an emailed link. Only the hash of
+// the token is kept, so a leaked table cannot be turned into links.
+type OneTimeToken struct {
+	Hash    string
+	Purpose string
+	UserID  int
+	// Email is the address the link was sent to
+	Email     string
+	ExpiresAt time.Time
+}
+
+// OneTimeTokenStore keeps the tokens of emailed links until they are used
+type OneTimeTokenStore interface {
+	Save(ctx context.Context, token *OneTimeToken) error
+	// Get returns nil for an unknown hash
+	Get(ctx context.Context, hash string) (*OneTimeToken, error)
+	// Consume deletes the token with hash. It returns false when the token
+	// was already gone, atomically with the deletion.
+	Consume(ctx context.Context, hash string) (bool, error)
+	// DeleteUserTokens deletes the tokens of a user for purpose, so a new
+	// link invalidates the older ones
+	DeleteUserTokens(ctx context.Context, userID int, purpose string) error
+	// Purge removes tokens that expired before now
+	Purge(ctx context.Context, now time.Time) error
+}
+
+// MemoryTokenStore is a OneTimeTokenStore for a single process
+type MemoryTokenStore struct {
+	mu     sync.Mutex
+	tokens map[string]OneTimeToken
+}
+
+// NewMemoryTokenStore creates an empty store
+func NewMemoryTokenStore() *MemoryTokenStore {
+	return &MemoryTokenStore{tokens: make(map[string]OneTimeToken)}
+}
+
+func (s *MemoryTokenStore) Save(ctx context.Context, token *OneTimeToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[token.Hash] = *token
+	return nil
+}
+
+func (s *MemoryTokenStore) Get(ctx context.Context, hash string) (*OneTimeToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	token, ok := s.tokens[hash]
+	if !ok {
+		return nil, nil
+	}
+	return &token, nil
+}
+
+func (s *MemoryTokenStore) Consume(ctx context.Context, hash string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tokens[hash]; !ok {
+		return false, nil
+	}
+	delete(s.tokens, hash)
+	return true, nil
+}
+
+func (s *MemoryTokenStore) DeleteUserTokens(ctx context.Context, userID int, purpose string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for hash, token := range s.tokens {
+		if token.UserID == userID && token.Purpose == purpose {
+			delete(s.tokens, hash)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryTokenStore) Purge(ctx context.Context, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for hash, token := range s.tokens {
+		if token.ExpiresAt.Before(now) {
+			delete(s.tokens, hash)
+		}
+	}
+	return nil
+}
+
+// tokenSchema keys tokens by their hash; the user and purpose index
+// serves DeleteUserTokens
+const tokenSchema = `CREATE TABLE IF NOT EXISTS auth_tokens (
+	hash CHAR(64) PRIMARY KEY,
+	purpose VARCHAR(32) NOT NULL,
+	user_id INTEGER NOT NULL,
+	email VARCHAR(255) NOT NULL,
+	expires_at INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_auth_tokens_user ON auth_tokens(user_id, purpose)`
+
+// SQLTokenStore is a OneTimeTokenStore over an auth_tokens table.
+// Consume deletes the row, so only one of two concurrent uses of a token
+// succeeds. Times are stored as Unix nanoseconds.
+type SQLTokenStore struct {
+	db *sql.DB
+}
+
+// NewSQLTokenStore creates the auth_tokens table if needed
+func NewSQLTokenStore(db *sql.DB) (*SQLTokenStore, error) {
+	if db == nil {
+		return nil, errors.New("db must not be nil")
+	}
+	if _, err := db.Exec(tokenSchema); err != nil {
+		return nil, fmt.Errorf("failed to create auth_tokens: %v", err)
+	}
+	return &SQLTokenStore{db: db}, nil
+}
+
+func (s *SQLTokenStore) Save(ctx context.Context, token *OneTimeToken) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO auth_tokens (hash, purpose, user_id, email, expires_at) VALUES (?, ?, ?, ?, ?)`,
+		token.Hash, token.Purpose, token.UserID, token.Email, token.ExpiresAt.UnixNano(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save token: %v", err)
+	}
+	return nil
+}
+
+func (s *SQLTokenStore) Get(ctx context.Context, hash string) (*OneTimeToken, error) {
+	token := OneTimeToken{Hash: hash}
+	var expiresAt int64
+	err := s.db.QueryRowContext(ctx,
+		`SELECT purpose, user_id, email, expires_at FROM auth_tokens WHERE hash = ?`, hash,
+	).Scan(&token.Purpose, &token.UserID, &token.Email, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get token: %v", err)
+	}
+	token.ExpiresAt = time.Unix(0, expiresAt)
+	return &token, nil
+}
+
+func (s *SQLTokenStore) Consume(ctx context.Context, hash string) (bool, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM auth_tokens WHERE hash = ?`, hash)
+	if err != nil {
+		return false, fmt.Errorf("failed to consume token: %v", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to consume token: %v", err)
+	}
+	return n > 0, nil
+}
+
+func (s *SQLTokenStore) DeleteUserTokens(ctx context.Context, userID int, purpose string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM auth_tokens WHERE user_id = ? AND purpose = ?`, userID, purpose)
+	if err != nil {
+		return fmt.Errorf("failed to delete tokens: %v", err)
+	}
+	return nil
+}
+
+func (s *SQLTokenStore) Purge(ctx context.Context, now time.Time) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM auth_tokens WHERE expires_at < ?`, now.UnixNano()); err != nil {
+		return fmt.Errorf("failed to purge tokens: %v", err)
+	}
+	return nil
+}
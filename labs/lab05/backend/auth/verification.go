@@ -0,0 +1,286 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"lab05/jwtservice"
+	"lab05/security"
+	"lab05/userdomain"
+)
+
+// Link lifetimes
+const (
+	DefaultVerifyEmailTTL   = 24 * time.Hour
+	DefaultResetPasswordTTL = time.Hour
+)
+
+// DefaultLinkBaseURL is the frontend that opens emailed links
+const DefaultLinkBaseURL = "http://localhost:8080"
+
+// ErrInvalidLink is returned for an emailed token that is forged, used,
+// expired or replaced by a newer one
+var ErrInvalidLink = errors.New("invalid or expired link")
+
+// WithMailer sends verification and reset emails through mailer instead
+// of printing them to stdout
+func WithMailer(mailer Mailer) Option {
+	return func(s *Service) {
+		s.mailer = mailer
+	}
+}
+
+// WithTokenStore keeps the tokens of emailed links in store instead of
+// memory
+func WithTokenStore(store OneTimeTokenStore) Option {
+	return func(s *Service) {
+		s.linkTokens = store
+	}
+}
+
+// WithLinkKey sets the key that signs emailed tokens. Without it a random
+// key is used, so links stop working when the process restarts.
+func WithLinkKey(key []byte) Option {
+	return func(s *Service) {
+		s.linkKey = key
+	}
+}
+
+// WithLinkBaseURL sets the frontend URL that emailed links point to
+func WithLinkBaseURL(baseURL string) Option {
+	return func(s *Service) {
+		s.linkBaseURL = strings.TrimRight(baseURL, "/")
+	}
+}
+
+// WithLinkTTLs sets how long verification and reset links stay valid
+func WithLinkTTLs(verifyEmail, resetPassword time.Duration) Option {
+	return func(s *Service) {
+		s.verifyEmailTTL = verifyEmail
+		s.resetPasswordTTL = resetPassword
+	}
+}
+
+// ResendVerification emails a new verification link for the pending
+// email, or for the current one while it is unverified. Earlier links
+// stop working.
+func (s *Service) ResendVerification(ctx context.Context, claims *jwtservice.Claims) error {
+	user, err := s.users.GetByID(ctx, claims.UserID)
+	if err != nil {
+		return err
+	}
+	email := user.PendingEmail
+	if email == "" {
+		if user.EmailVerified {
+			return fmt.Errorf("%w: email is already verified", ErrInvalidInput)
+		}
+		email = user.Email
+	}
+	return s.sendVerification(ctx, user, email)
+}
+
+// VerifyEmail uses a link sent by Register, ChangeEmail or
+// ResendVerification. It marks the email verified, or makes a pending
+// email the user's email.
+func (s *Service) VerifyEmail(ctx context.Context, token string) (*userdomain.User, error) {
+	link, err := s.findLink(ctx, token, PurposeVerifyEmail)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.users.GetByID(ctx, link.UserID)
+	if err != nil {
+		return nil, err
+	}
+	previous := user.Email
+	switch link.Email {
+	case user.PendingEmail:
+		if err := user.ConfirmEmailChange(); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidInput, err)
+		}
+	case user.Email:
+		user.EmailVerified = true
+	default:
+		return nil, ErrInvalidLink
+	}
+	if err := s.consumeLink(ctx, link); err != nil {
+		return nil, err
+	}
+	if err := s.users.Update(ctx, user); err != nil {
+		return nil, err
+	}
+
+	if previous != user.Email {
+		s.record(ctx, AuditEvent{Type: EventEmailChanged, UserID: user.ID, Email: user.Email, Detail: "previous email " + previous})
+	} else {
+		s.record(ctx, AuditEvent{Type: EventEmailVerified, UserID: user.ID, Email: user.Email})
+	}
+	return user, nil
+}
+
+// RequestPasswordReset emails a reset link if an account has email. It
+// succeeds for unknown emails too, so callers cannot probe which accounts
+// exist.
+func (s *Service) RequestPasswordReset(ctx context.Context, email string) error {
+	user, err := s.users.GetByEmail(ctx, email)
+	if errors.Is(err, userdomain.ErrUserNotFound) {
+		s.record(ctx, AuditEvent{Type: EventPasswordResetRequested, Email: email, Detail: "unknown account"})
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	token, err := s.issueLink(ctx, user, PurposeResetPassword, user.Email, s.resetPasswordTTL)
+	if err != nil {
+		return err
+	}
+	s.record(ctx, AuditEvent{Type: EventPasswordResetRequested, UserID: user.ID, Email: user.Email})
+	s.mail(ctx, Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nOpen this link within %s to choose a new password:\n\n%s\n\n"+
+			"If you did not ask for this, ignore this email; your password stays the same.",
+			user.Name, describeTTL(s.resetPasswordTTL), s.linkURL("/reset-password", token)),
+	})
+	return nil
+}
+
+// ResetPassword sets a new password with a link from RequestPasswordReset.
+// A password the policy rejects leaves the link usable. Following the link
+// proves the user reads the email, so it also verifies the email and lifts
+// a lockout. Every session ends, in case the old password leaked.
+func (s *Service) ResetPassword(ctx context.Context, token, password string) error {
+	link, err := s.findLink(ctx, token, PurposeResetPassword)
+	if err != nil {
+		return err
+	}
+	user, err := s.users.GetByID(ctx, link.UserID)
+	if err != nil {
+		return err
+	}
+	if link.Email != user.Email {
+		return ErrInvalidLink
+	}
+	if err := userdomain.PasswordPolicy.Validate(password, user.Name, user.Email); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidInput, err)
+	}
+	if err := s.consumeLink(ctx, link); err != nil {
+		return err
+	}
+
+	if user.Password, err = s.passwords.HashPassword(password); err != nil {
+		return err
+	}
+	user.EmailVerified = true
+	user.UpdatedAt = s.now()
+	if err := s.users.Update(ctx, user); err != nil {
+		return err
+	}
+	if s.throttle != nil {
+		s.throttle.Unlock(user.Email)
+	}
+	if s.tokens.CanRevoke() {
+		if err := s.endUserSessions(ctx, user.ID); err != nil {
+			return err
+		}
+	}
+	s.record(ctx, AuditEvent{Type: EventPasswordReset, UserID: user.ID, Email: user.Email})
+	return nil
+}
+
+// sendVerification emails a verification link for email, which is either
+// the user's email or their pending one
+func (s *Service) sendVerification(ctx context.Context, user *userdomain.User, email string) error {
+	token, err := s.issueLink(ctx, user, PurposeVerifyEmail, email, s.verifyEmailTTL)
+	if err != nil {
+		return err
+	}
+	s.mail(ctx, Message{
+		To:      email,
+		Subject: "Confirm your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nOpen this link within %s to confirm %s:\n\n%s",
+			user.Name, describeTTL(s.verifyEmailTTL), email, s.linkURL("/verify-email", token)),
+	})
+	return nil
+}
+
+// issueLink stores a new token for purpose, replacing the user's earlier
+// ones, and returns it
+func (s *Service) issueLink(ctx context.Context, user *userdomain.User, purpose, email string, ttl time.Duration) (string, error) {
+	token, err := security.NewSignedToken(s.linkKey, purpose)
+	if err != nil {
+		return "", err
+	}
+	if err := s.linkTokens.DeleteUserTokens(ctx, user.ID, purpose); err != nil {
+		return "", err
+	}
+	err = s.linkTokens.Save(ctx, &OneTimeToken{
+		Hash:      security.HashToken(token),
+		Purpose:   purpose,
+		UserID:    user.ID,
+		Email:     email,
+		ExpiresAt: s.now().Add(ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// findLink checks the signature of token and returns its unexpired stored
+// half without using it up
+func (s *Service) findLink(ctx context.Context, token, purpose string) (*OneTimeToken, error) {
+	if !security.VerifySignedToken(s.linkKey, purpose, token) {
+		return nil, ErrInvalidLink
+	}
+	link, err := s.linkTokens.Get(ctx, security.HashToken(token))
+	if err != nil {
+		return nil, err
+	}
+	if link == nil || link.Purpose != purpose || !s.now().Before(link.ExpiresAt) {
+		return nil, ErrInvalidLink
+	}
+	return link, nil
+}
+
+// consumeLink uses up link, failing if a concurrent request did first
+func (s *Service) consumeLink(ctx context.Context, link *OneTimeToken) error {
+	ok, err := s.linkTokens.Consume(ctx, link.Hash)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidLink
+	}
+	return nil
+}
+
+func (s *Service) linkURL(path, token string) string {
+	return s.linkBaseURL + path + "?token=" + url.QueryEscape(token)
+}
+
+// mail sends msg. Failures are logged rather than failing the action,
+// like audit failures, and the user can ask for another email; answering
+// differently would also reveal which emails have accounts.
+func (s *Service) mail(ctx context.Context, msg Message) {
+	if err := s.mailer.Send(ctx, msg); err != nil {
+		log.Printf("auth: failed to send %q to %s: %v", msg.Subject, msg.To, err)
+	}
+}
+
+// describeTTL writes ttl the way an email would, such as "24 hours"
+func describeTTL(ttl time.Duration) string {
+	n, unit := int(ttl/time.Minute), "minute"
+	if ttl >= time.Hour && ttl%time.Hour == 0 {
+		n, unit = int(ttl/time.Hour), "hour"
+	}
+	if n == 1 {
+		return "1 " + unit
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
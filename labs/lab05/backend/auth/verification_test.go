@@ -0,0 +1,328 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"lab05/internal/sqlitetest"
+	"lab05/jwtservice"
+	"lab05/security"
+	"lab05/userdomain"
+)
+
+// recordingMailer keeps sent messages for tests
+type recordingMailer struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func (m *recordingMailer) Send(ctx context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// last returns the last message to to and its link token
+func (m *recordingMailer) last(t *testing.T, to string) (Message, string) {
+	t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := len(m.messages) - 1; i >= 0; i-- {
+		if m.messages[i].To == to {
+			token := ""
+			if strings.Contains(m.messages[i].Body, "?token=") {
+				token = regexpGroup(t, `\?token=([A-Za-z0-9_\-.]+)`, m.messages[i].Body)
+			}
+			return m.messages[i], token
+		}
+	}
+	t.Fatalf("no message to %s", to)
+	return Message{}, ""
+}
+
+func (m *recordingMailer) count() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.messages)
+}
+
+func newSQLTokenStore(t *testing.T) *SQLTokenStore {
+	store, err := NewSQLTokenStore(sqlitetest.Open(t))
+	if err != nil {
+		t.Fatalf("NewSQLTokenStore() failed: %v", err)
+	}
+	return store
+}
+
+func TestTokenStores(t *testing.T) {
+	stores := map[string]func(t *testing.T) OneTimeTokenStore{
+		"memory": func(t *testing.T) OneTimeTokenStore { return NewMemoryTokenStore() },
+		"sql":    func(t *testing.T) OneTimeTokenStore { return newSQLTokenStore(t) },
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+			ctx := context.Background()
+			now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+			tokens := []OneTimeToken{
+				{Hash: "a", Purpose: PurposeVerifyEmail, UserID: 1, Email: "jane@example.com", ExpiresAt: now.Add(time.Hour)},
+				{Hash: "b", Purpose: PurposeResetPassword, UserID: 1, Email: "jane@example.com", ExpiresAt: now.Add(time.Hour)},
+				{Hash: "c", Purpose: PurposeResetPassword, UserID: 2, Email: "john@example.com", ExpiresAt: now.Add(-time.Minute)},
+			}
+			for i := range tokens {
+				if err := store.Save(ctx, &tokens[i]); err != nil {
+					t.Fatalf("Save() failed: %v", err)
+				}
+			}
+
+			got, err := store.Get(ctx, "a")
+			if err != nil || got == nil || got.Email != "jane@example.com" || !got.ExpiresAt.Equal(now.Add(time.Hour)) {
+				t.Errorf("Get(a) = %+v, %v", got, err)
+			}
+			if got, err := store.Get(ctx, "missing"); got != nil || err != nil {
+				t.Errorf("Get(missing) = %+v, %v, want nil", got, err)
+			}
+
+			if ok, err := store.Consume(ctx, "a"); !ok || err != nil {
+				t.Errorf("Consume(a) = %v, %v", ok, err)
+			}
+			if ok, _ := store.Consume(ctx, "a"); ok {
+				t.Errorf("second Consume(a) = true")
+			}
+
+			store.DeleteUserTokens(ctx, 1, PurposeResetPassword)
+			if got, _ := store.Get(ctx, "b"); got != nil {
+				t.Errorf("Get(b) after DeleteUserTokens = %+v", got)
+			}
+			store.Purge(ctx, now)
+			if got, _ := store.Get(ctx, "c"); got != nil {
+				t.Errorf("Get(c) after Purge = %+v", got)
+			}
+		})
+	}
+}
+
+func TestService_VerifyEmail(t *testing.T) {
+	now := time.Now()
+	mailer := &recordingMailer{}
+	store := NewMemoryTokenStore()
+	service, users := newTestService(t, WithMailer(mailer), WithTokenStore(store), WithClock(func() time.Time { return now }))
+	ctx := context.Background()
+
+	user, _ := service.Register(ctx, "jane@example.com", "Jane Roe", "Password123")
+	service.Register(ctx, "john@example.com", "John Doe", "Password123")
+	msg, token := mailer.last(t, "jane@example.com")
+	if user.EmailVerified || !strings.Contains(msg.Body, "http://localhost:8080/verify-email?token=") || !strings.Contains(msg.Body, "24 hours") {
+		t.Errorf("verification mail = %+v", msg)
+	}
+	if link, _ := store.Get(ctx, token); link != nil {
+		t.Errorf("token stored in plain text")
+	}
+
+	forged, _ := security.NewSignedToken([]byte("other key"), PurposeVerifyEmail)
+	for _, bad := range []string{"", "garbage", forged, token + "x"} {
+		if _, err := service.VerifyEmail(ctx, bad); !errors.Is(err, ErrInvalidLink) {
+			t.Errorf("VerifyEmail(%q) error = %v, want ErrInvalidLink", bad, err)
+		}
+	}
+	if err := service.ResetPassword(ctx, token, "NewPassword456"); !errors.Is(err, ErrInvalidLink) {
+		t.Errorf("ResetPassword(verification token) error = %v, want ErrInvalidLink", err)
+	}
+
+	verified, err := service.VerifyEmail(ctx, token)
+	if err != nil || !verified.EmailVerified {
+		t.Fatalf("VerifyEmail() = %+v, %v", verified, err)
+	}
+	if _, err := service.VerifyEmail(ctx, token); !errors.Is(err, ErrInvalidLink) {
+		t.Errorf("VerifyEmail(used) error = %v, want ErrInvalidLink", err)
+	}
+	claims := &jwtservice.Claims{UserID: user.ID, Email: user.Email}
+	if err := service.ResendVerification(ctx, claims); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("ResendVerification(verified) error = %v, want ErrInvalidInput", err)
+	}
+
+	// A change waits for the new address; a second change replaces the link
+	if _, err := service.ChangeEmail(ctx, claims, "Password123", "john@example.com"); !errors.Is(err, userdomain.ErrEmailTaken) {
+		t.Errorf("ChangeEmail(taken) error = %v, want ErrEmailTaken", err)
+	}
+	service.ChangeEmail(ctx, claims, "Password123", "jane@first.example.com")
+	_, superseded := mailer.last(t, "jane@first.example.com")
+	if _, err := service.ChangeEmail(ctx, claims, "Password123", "jane@new.example.com"); err != nil {
+		t.Fatalf("ChangeEmail() failed: %v", err)
+	}
+	if notice, _ := mailer.last(t, "jane@example.com"); !strings.Contains(notice.Body, "jane@new.example.com") {
+		t.Errorf("notice to the current address = %+v", notice)
+	}
+	if _, err := service.VerifyEmail(ctx, superseded); !errors.Is(err, ErrInvalidLink) {
+		t.Errorf("VerifyEmail(superseded) error = %v, want ErrInvalidLink", err)
+	}
+	if _, err := service.Login(ctx, "jane@new.example.com", "Password123"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Login(pending email) error = %v", err)
+	}
+
+	_, token = mailer.last(t, "jane@new.example.com")
+	now = now.Add(DefaultVerifyEmailTTL)
+	if _, err := service.VerifyEmail(ctx, token); !errors.Is(err, ErrInvalidLink) {
+		t.Errorf("VerifyEmail(expired) error = %v, want ErrInvalidLink", err)
+	}
+	if err := service.ResendVerification(ctx, claims); err != nil {
+		t.Fatalf("ResendVerification() failed: %v", err)
+	}
+	_, token = mailer.last(t, "jane@new.example.com")
+	if changed, err := service.VerifyEmail(ctx, token); err != nil || changed.Email != "jane@new.example.com" || changed.PendingEmail != "" {
+		t.Fatalf("VerifyEmail(pending) = %+v, %v", changed, err)
+	}
+	if _, err := service.Login(ctx, "jane@new.example.com", "Password123"); err != nil {
+		t.Errorf("Login(new email) failed: %v", err)
+	}
+	stored, _ := users.GetByID(ctx, user.ID)
+	if !stored.EmailVerified {
+		t.Errorf("stored user = %+v, want the new email verified", stored)
+	}
+
+	events, _ := service.AuditEvents(ctx, AuditQuery{Types: []string{EventEmailVerified, EventEmailChangeRequested, EventEmailChanged}})
+	if len(events) != 4 || events[0].Type != EventEmailChanged || events[0].Detail != "previous email jane@example.com" {
+		t.Errorf("email audit events = %+v", events)
+	}
+}
+
+func TestService_ResetPassword(t *testing.T) {
+	mailer := &recordingMailer{}
+	service, _ := newTestService(t, WithMailer(mailer), WithLinkBaseURL("https://app.example.com/"),
+		WithThrottle(NewThrottle(ThrottleConfig{FreeAttempts: 10, MaxAccountFailures: 2, LockoutDuration: time.Hour})))
+	ctx := context.Background()
+	service.Register(ctx, "jane@example.com", "Jane Roe", "Password123")
+	before, _ := service.Login(ctx, "jane@example.com", "Password123")
+
+	sent := mailer.count()
+	if err := service.RequestPasswordReset(ctx, "nobody@example.com"); err != nil || mailer.count() != sent {
+		t.Errorf("RequestPasswordReset(unknown) = %v with %d new mails, want nil and none", err, mailer.count()-sent)
+	}
+
+	service.Login(ctx, "jane@example.com", "wrong")
+	service.Login(ctx, "jane@example.com", "wrong")
+	var throttled *ThrottledError
+	if _, err := service.Login(ctx, "jane@example.com", "Password123"); !errors.As(err, &throttled) || !throttled.Locked {
+		t.Fatalf("Login() after failures error = %v, want a lockout", err)
+	}
+
+	service.RequestPasswordReset(ctx, "Jane@Example.com")
+	_, first := mailer.last(t, "jane@example.com")
+	if err := service.RequestPasswordReset(ctx, "jane@example.com"); err != nil {
+		t.Fatalf("RequestPasswordReset() failed: %v", err)
+	}
+	msg, token := mailer.last(t, "jane@example.com")
+	if !strings.Contains(msg.Body, "https://app.example.com/reset-password?token=") || !strings.Contains(msg.Body, "1 hour") {
+		t.Errorf("reset mail = %+v", msg)
+	}
+	if err := service.ResetPassword(ctx, first, "NewPassword456"); !errors.Is(err, ErrInvalidLink) {
+		t.Errorf("ResetPassword(superseded) error = %v, want ErrInvalidLink", err)
+	}
+	if _, err := service.VerifyEmail(ctx, token); !errors.Is(err, ErrInvalidLink) {
+		t.Errorf("VerifyEmail(reset token) error = %v, want ErrInvalidLink", err)
+	}
+
+	var policyErr *security.PolicyError
+	if err := service.ResetPassword(ctx, token, "short"); !errors.Is(err, ErrInvalidInput) || !errors.As(err, &policyErr) {
+		t.Errorf("ResetPassword(weak) error = %v, want ErrInvalidInput with a PolicyError", err)
+	}
+	if err := service.ResetPassword(ctx, token, "NewPassword456"); err != nil {
+		t.Fatalf("ResetPassword() failed: %v", err)
+	}
+	if err := service.ResetPassword(ctx, token, "OtherPassword789"); !errors.Is(err, ErrInvalidLink) {
+		t.Errorf("ResetPassword(used) error = %v, want ErrInvalidLink", err)
+	}
+	if _, err := service.Refresh(ctx, before.RefreshToken); !errors.Is(err, jwtservice.ErrTokenRevoked) {
+		t.Errorf("Refresh(session from before the reset) error = %v, want ErrTokenRevoked", err)
+	}
+
+	result, err := service.Login(ctx, "jane@example.com", "NewPassword456")
+	if err != nil || !result.User.EmailVerified {
+		t.Errorf("Login(new password) = %+v, %v, want the lockout lifted and the email verified", result, err)
+	}
+	if _, err := service.Login(ctx, "jane@example.com", "Password123"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Login(old password) error = %v", err)
+	}
+}
+
+func TestHandler_EmailLinks(t *testing.T) {
+	mailer := &recordingMailer{}
+	service, _ := newTestService(t, WithMailer(mailer))
+	handler := NewHandler(service)
+
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	do("POST", "/auth/register", "", `{"email":"jane@example.com","name":"Jane Roe","password":"Password123"}`)
+	if rec := do("POST", "/auth/email/verify", "", `{"token":"nope"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("verify(bad token) = %d, want 400", rec.Code)
+	}
+	_, token := mailer.last(t, "jane@example.com")
+	if rec := do("POST", "/auth/email/verify", "", `{"token":"`+token+`"}`); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"email_verified":true`) {
+		t.Errorf("verify = %d %s", rec.Code, rec.Body.String())
+	}
+
+	for _, email := range []string{"jane@example.com", "nobody@example.com"} {
+		if rec := do("POST", "/auth/password/forgot", "", `{"email":"`+email+`"}`); rec.Code != http.StatusAccepted {
+			t.Errorf("forgot(%s) = %d, want 202", email, rec.Code)
+		}
+	}
+	_, token = mailer.last(t, "jane@example.com")
+	if rec := do("POST", "/auth/password/reset", "", `{"token":"`+token+`","password":"short"}`); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "violations") {
+		t.Errorf("reset(weak) = %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := do("POST", "/auth/password/reset", "", `{"token":"`+token+`","password":"NewPassword456"}`); rec.Code != http.StatusNoContent {
+		t.Errorf("reset = %d %s", rec.Code, rec.Body.String())
+	}
+
+	result, err := service.Login(context.Background(), "jane@example.com", "NewPassword456")
+	if err != nil {
+		t.Fatalf("Login(new password) failed: %v", err)
+	}
+	if rec := do("POST", "/auth/email/verify/resend", result.AccessToken, ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("resend(verified) = %d, want 400", rec.Code)
+	}
+}
+
+func TestMailers(t *testing.T) {
+	msg := Message{To: "jane@example.com", Subject: "Hello", Body: "Line one"}
+
+	var buf bytes.Buffer
+	if err := NewConsoleMailer(&buf).Send(context.Background(), msg); err != nil {
+		t.Fatalf("ConsoleMailer.Send() failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), "To: jane@example.com\nSubject: Hello\n\nLine one\n") {
+		t.Errorf("console output = %q", buf.String())
+	}
+
+	path := filepath.Join(t.TempDir(), "mail.txt")
+	mailer := NewFileMailer(path)
+	for i := 0; i < 2; i++ {
+		if err := mailer.Send(context.Background(), msg); err != nil {
+			t.Fatalf("FileMailer.Send() failed: %v", err)
+		}
+	}
+	data, _ := os.ReadFile(path)
+	if strings.Count(string(data), "Subject: Hello") != 2 {
+		t.Errorf("mail file = %q, want two messages", data)
+	}
+}
@@ -0,0 +1,23 @@
+// Package sqlitetest opens throwaway SQLite databases for the tests of the
+// SQL-backed stores.
+package sqlitetest
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Open opens an empty SQLite file in a temporary directory of t. The
+// database is closed, and the file removed, when t ends.
+func Open(t testing.TB) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
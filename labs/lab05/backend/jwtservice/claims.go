@@ -1,13 +1,38 @@
 package jwtservice
 
 import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
 	"github.com/golang-jwt/jwt/v4"
 )
 
+// Token types carried in the token_type claim
+const (
+	TokenTypeAccess  = "access"
+	TokenTypeRefresh = "refresh"
+	// TokenTypeMFAPending proves only the first login factor; it is
+	// exchanged for a token pair once the second factor is checked
+	TokenTypeMFAPending = "mfa_pending"
+)
+
 // Claims represents JWT token claims
 type Claims struct {
 	UserID int    `json:"user_id"`
 	Email  string `json:"email"`
+	// Roles are coarse groups such as "admin"
+	Roles []string `json:"roles,omitempty"`
+	// Scope is the space-separated list of granted scopes (RFC 8693)
+	Scope string `json:"scope,omitempty"`
+	// Extra holds application claims; use ClaimKey for typed access
+	Extra map[string]json.RawMessage `json:"ext,omitempty"`
+	// TokenType is TokenTypeAccess, TokenTypeRefresh or
+	// TokenTypeMFAPending; tokens without it are access tokens
+	TokenType string `json:"token_type,omitempty"`
+	// FamilyID links every token issued from one login, across refresh
+	// token rotations
+	FamilyID string `json:"fid,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -15,3 +40,86 @@ type Claims struct {
 func (c Claims) Valid() error {
 	return c.RegisteredClaims.Valid()
 }
+
+// IsRefresh reports whether the claims belong to a refresh token
+func (c *Claims) IsRefresh() bool {
+	return c.TokenType == TokenTypeRefresh
+}
+
+// Scopes splits Scope into its entries
+func (c *Claims) Scopes() []string {
+	return strings.Fields(c.Scope)
+}
+
+// SetScopes replaces Scope with the given entries
+func (c *Claims) SetScopes(scopes ...string) {
+	c.Scope = strings.Join(scopes, " ")
+}
+
+// HasScope reports whether scope was granted
+func (c *Claims) HasScope(scope string) bool {
+	for _, s := range c.Scopes() {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// HasRole reports whether the subject has role
+func (c *Claims) HasRole(role string) bool {
+	for _, r := range c.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// HasAnyRole reports whether the subject has at least one of roles
+func (c *Claims) HasAnyRole(roles ...string) bool {
+	for _, role := range roles {
+		if c.HasRole(role) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClaimKey names a typed application claim stored in Claims.Extra
+type ClaimKey[T any] struct {
+	Name string
+}
+
+// NewClaimKey declares an application claim, for example
+//
+//	var TenantClaim = jwtservice.NewClaimKey[string]("tenant")
+func NewClaimKey[T any](name string) ClaimKey[T] {
+	return ClaimKey[T]{Name: name}
+}
+
+// Set stores value in the claims
+func (k ClaimKey[T]) Set(c *Claims, value T) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to encode claim %q: %v", k.Name, err)
+	}
+	if c.Extra == nil {
+		c.Extra = make(map[string]json.RawMessage)
+	}
+	c.Extra[k.Name] = raw
+	return nil
+}
+
+// Get reads the claim. ok is false when it is absent; err is set when it
+// is present but does not decode as T.
+func (k ClaimKey[T]) Get(c *Claims) (value T, ok bool, err error) {
+	raw, ok := c.Extra[k.Name]
+	if !ok {
+		return value, false, nil
+	}
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return value, true, fmt.Errorf("%w: claim %q: %v", ErrInvalidClaims, k.Name, err)
+	}
+	return value, true, nil
+}
@@ -11,6 +11,13 @@ var ErrTokenExpired = fmt.Errorf("token expired")
 // ErrInvalidClaims indicates the token claims are invalid
 var ErrInvalidClaims = fmt.Errorf("invalid token claims")
 
+// ErrTokenRevoked indicates the token, or its family, has been revoked
+var ErrTokenRevoked = fmt.Errorf("token revoked")
+
+// ErrTokenReused indicates a refresh token was presented a second time;
+// its whole family is revoked in response
+var ErrTokenReused = fmt.Errorf("refresh token reused")
+
 // ErrEmptyToken indicates the token string is empty
 var ErrEmptyToken = fmt.Errorf("token string cannot be empty")
 
@@ -0,0 +1,38 @@
+// Package ginjwt adapts the jwtservice middleware to gin
+package ginjwt
+
+import (
+	"lab05/jwtservice"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ClaimsKey is the gin context key holding *jwtservice.Claims
+const ClaimsKey = "jwtservice.claims"
+
+// Middleware authenticates the bearer token of each request and applies
+// requirements. The claims are stored under ClaimsKey and in the request
+// context, so jwtservice.ClaimsFromContext works in both worlds.
+func Middleware(service *jwtservice.JWTService, requirements ...jwtservice.Requirement) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, authErr := service.Authenticate(c.Request, requirements...)
+		if authErr != nil {
+			c.Header("WWW-Authenticate", authErr.Challenge())
+			c.AbortWithStatusJSON(authErr.Status, gin.H{"error": authErr.Description})
+			return
+		}
+		c.Set(ClaimsKey, claims)
+		c.Request = c.Request.WithContext(jwtservice.ContextWithClaims(c.Request.Context(), claims))
+		c.Next()
+	}
+}
+
+// Claims returns the claims stored by Middleware
+func Claims(c *gin.Context) (*jwtservice.Claims, bool) {
+	value, ok := c.Get(ClaimsKey)
+	if !ok {
+		return nil, false
+	}
+	claims, ok := value.(*jwtservice.Claims)
+	return claims, ok
+}
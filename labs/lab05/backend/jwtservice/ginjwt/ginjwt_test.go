@@ -0,0 +1,59 @@
+package ginjwt
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"lab05/jwtservice"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	service, _ := jwtservice.NewJWTService("test-secret")
+
+	claims := &jwtservice.Claims{UserID: 4, Email: "gin@example.com"}
+	claims.SetScopes("posts:read")
+	token, _ := service.GenerateTokenFor(claims)
+
+	router := gin.New()
+	router.GET("/posts", Middleware(service, jwtservice.RequireScopes("posts:read")), func(c *gin.Context) {
+		fromGin, ok := Claims(c)
+		fromContext, _ := jwtservice.ClaimsFromContext(c.Request.Context())
+		if !ok || fromContext == nil || fromGin.UserID != fromContext.UserID {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"user_id": fromGin.UserID})
+	})
+	router.GET("/admin", Middleware(service, jwtservice.RequireRoles("admin")), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		path   string
+		token  string
+		status int
+	}{
+		{"/posts", token, http.StatusOK},
+		{"/posts", "", http.StatusUnauthorized},
+		{"/admin", token, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		if rec.Code != tt.status {
+			t.Errorf("GET %s = %d, want %d", tt.path, rec.Code, tt.status)
+		}
+		if tt.status != http.StatusOK && rec.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("GET %s should send a WWW-Authenticate challenge", tt.path)
+		}
+	}
+}
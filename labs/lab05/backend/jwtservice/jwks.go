@@ -0,0 +1,147 @@
+package jwtservice
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"time"
+)
+
+// JWK is a public key in JSON Web Key format (RFC 7517)
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use,omitempty"`
+	Algorithm string `json:"alg,omitempty"`
+	// RSA modulus and exponent
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// OKP curve and public key
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKSCacheMaxAge is how long clients may cache the JWKS response. Keep it
+// shorter than the retention of rotated keys so verifiers see a new key
+// before tokens signed with it are common.
+const JWKSCacheMaxAge = 5 * time.Minute
+
+var b64 = base64.RawURLEncoding
+
+// ToJWK converts the public half of an RS256 or EdDSA key. HMAC keys have
+// no public half and return an error.
+func (k *Key) ToJWK() (JWK, error) {
+	switch pub := k.public.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			KeyType:   "RSA",
+			KeyID:     k.ID,
+			Use:       "sig",
+			Algorithm: AlgRS256,
+			N:         b64.EncodeToString(pub.N.Bytes()),
+			E:         b64.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}, nil
+	case ed25519.PublicKey:
+		return JWK{
+			KeyType:   "OKP",
+			KeyID:     k.ID,
+			Use:       "sig",
+			Algorithm: AlgEdDSA,
+			Curve:     "Ed25519",
+			X:         b64.EncodeToString(pub),
+		}, nil
+	default:
+		return JWK{}, fmt.Errorf("key %q has no public key to publish", k.ID)
+	}
+}
+
+// Key converts a JWK into a verification-only Key
+func (j JWK) Key() (*Key, error) {
+	switch j.KeyType {
+	case "RSA":
+		n, err := b64.DecodeString(j.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA modulus of key %q: %v", j.KeyID, err)
+		}
+		e, err := b64.DecodeString(j.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA exponent of key %q: %v", j.KeyID, err)
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("invalid RSA exponent of key %q", j.KeyID)
+		}
+		return NewPublicKey(j.KeyID, &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())})
+	case "OKP":
+		if j.Curve != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q of key %q", j.Curve, j.KeyID)
+		}
+		x, err := b64.DecodeString(j.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid public key of key %q: %v", j.KeyID, err)
+		}
+		return NewPublicKey(j.KeyID, ed25519.PublicKey(x))
+	default:
+		return nil, fmt.Errorf("unsupported key type %q of key %q", j.KeyType, j.KeyID)
+	}
+}
+
+// JWKS returns the public keys that still verify at now. HMAC keys are
+// left out.
+func (ks *KeySet) JWKS(now time.Time) JWKS {
+	set := JWKS{Keys: []JWK{}}
+	for _, key := range ks.Keys(now) {
+		if jwk, err := key.ToJWK(); err == nil {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	return set
+}
+
+// KeySetFromJWKS builds a verification-only key set from a JWKS document.
+// Keys of unsupported types are skipped, as RFC 7517 asks.
+func KeySetFromJWKS(data []byte) (*KeySet, error) {
+	var set JWKS
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %v", err)
+	}
+
+	ks, _ := NewKeySet()
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.Key()
+		if err != nil {
+			continue
+		}
+		if err := ks.Add(key); err != nil {
+			return nil, err
+		}
+	}
+	return ks, nil
+}
+
+// JWKSHandler serves the public keys of the service at a
+// /.well-known/jwks.json style endpoint
+func (j *JWTService) JWKSHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(JWKSCacheMaxAge.Seconds())))
+		json.NewEncoder(w).Encode(j.keys.JWKS(j.now()))
+	})
+}
@@ -1,48 +1,334 @@
 package jwtservice
 
 import (
-	"errors"
-	_ "github.com/golang-jwt/jwt/v4"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
 )
 
+// DefaultTokenTTL is the lifetime of tokens from GenerateToken
+const DefaultTokenTTL = 24 * time.Hour
+
+// DefaultRefreshTTL is the lifetime of refresh tokens
+const DefaultRefreshTTL = 14 * 24 * time.Hour
+
+// DefaultMFATokenTTL is the lifetime of mfa_pending tokens, the time a
+// user has to enter their second factor
+const DefaultMFATokenTTL = 5 * time.Minute
+
+// DefaultKeyID is the kid of the key created by NewJWTService
+const DefaultKeyID = "default"
+
 // JWTService handles JWT token operations
 type JWTService struct {
-	secretKey string
+	keys       *KeySet
+	issuer     string
+	audience   []string
+	leeway     time.Duration
+	ttl        time.Duration
+	refreshTTL time.Duration
+	mfaTTL     time.Duration
+	store      RevocationStore
+	now        func() time.Time
 }
 
-// TODO: Implement NewJWTService function
-// NewJWTService creates a new JWT service
+// Option configures a JWTService
+type Option func(*JWTService)
+
+// WithIssuer sets the iss claim of new tokens and requires it on
+// validated ones
+func WithIssuer(issuer string) Option {
+	return func(j *JWTService) {
+		j.issuer = issuer
+	}
+}
+
+// WithAudience sets the aud claim of new tokens. Validated tokens must
+// name at least one of the audiences.
+func WithAudience(audience ...string) Option {
+	return func(j *JWTService) {
+		j.audience = audience
+	}
+}
+
+// WithLeeway tolerates clock skew between issuer and verifier when
+// checking exp, nbf and iat
+func WithLeeway(leeway time.Duration) Option {
+	return func(j *JWTService) {
+		j.leeway = leeway
+	}
+}
+
+// WithTokenTTL sets the lifetime of tokens from GenerateToken
+func WithTokenTTL(ttl time.Duration) Option {
+	return func(j *JWTService) {
+		j.ttl = ttl
+	}
+}
+
+// WithRefreshTTL sets the lifetime of refresh tokens
+func WithRefreshTTL(ttl time.Duration) Option {
+	return func(j *JWTService) {
+		j.refreshTTL = ttl
+	}
+}
+
+// WithMFATokenTTL sets the lifetime of mfa_pending tokens
+func WithMFATokenTTL(ttl time.Duration) Option {
+	return func(j *JWTService) {
+		j.mfaTTL = ttl
+	}
+}
+
+// WithRevocationStore enables revocation: ValidateToken refuses revoked
+// tokens and families, and Refresh detects reused refresh tokens
+func WithRevocationStore(store RevocationStore) Option {
+	return func(j *JWTService) {
+		j.store = store
+	}
+}
+
+// WithClock replaces time.Now, for tests
+func WithClock(now func() time.Time) Option {
+	return func(j *JWTService) {
+		j.now = now
+	}
+}
+
+// NewJWTService creates a new JWT service signing with HS256
 // Requirements:
 // - secretKey must not be empty
-func NewJWTService(secretKey string) (*JWTService, error) {
-	// TODO: Implement this function
-	// Validate secretKey and create service instance
-	return nil, errors.New("not implemented")
+func NewJWTService(secretKey string, opts ...Option) (*JWTService, error) {
+	if secretKey == "" {
+		return nil, NewValidationError("secretKey", "must not be empty")
+	}
+	key, err := NewHMACKey(DefaultKeyID, []byte(secretKey))
+	if err != nil {
+		return nil, err
+	}
+	keys, err := NewKeySet(key)
+	if err != nil {
+		return nil, err
+	}
+	return NewJWTServiceWithKeys(keys, opts...)
+}
+
+// NewJWTServiceWithKeys creates a service signing with the active key of
+// keys, which may be HS256, RS256 or EdDSA. Rotating keys through the
+// KeySet takes effect immediately.
+func NewJWTServiceWithKeys(keys *KeySet, opts ...Option) (*JWTService, error) {
+	if keys == nil {
+		return nil, NewValidationError("keys", "must not be nil")
+	}
+	j := &JWTService{keys: keys, ttl: DefaultTokenTTL, refreshTTL: DefaultRefreshTTL, mfaTTL: DefaultMFATokenTTL, now: time.Now}
+	for _, opt := range opts {
+		opt(j)
+	}
+	if j.ttl <= 0 || j.refreshTTL <= 0 || j.mfaTTL <= 0 {
+		return nil, NewValidationError("ttl", "must be positive")
+	}
+	if j.leeway < 0 {
+		return nil, NewValidationError("leeway", "must not be negative")
+	}
+	return j, nil
+}
+
+// Keys returns the key set, for rotation
+func (j *JWTService) Keys() *KeySet {
+	return j.keys
 }
 
-// TODO: Implement GenerateToken method
 // GenerateToken creates a new JWT token with user claims
 // Requirements:
 // - userID must be positive
 // - email must not be empty
-// - Token expires in 24 hours
-// - Use HS256 signing method
+// - Token expires after the configured TTL, 24 hours by default
+// - Signed with the active key of the key set
 func (j *JWTService) GenerateToken(userID int, email string) (string, error) {
-	// TODO: Implement token generation
-	// Create claims with userID, email, and expiration
-	// Sign token with secret key
-	return "", errors.New("not implemented")
+	return j.GenerateTokenFor(&Claims{UserID: userID, Email: email})
+}
+
+// GenerateTokenFor signs an access token carrying the subject, roles,
+// scope and extra claims of claims. Registered claims are always set by
+// the service.
+func (j *JWTService) GenerateTokenFor(claims *Claims) (string, error) {
+	subject, err := subjectClaims(claims)
+	if err != nil {
+		return "", err
+	}
+	subject.TokenType = TokenTypeAccess
+	return j.sign(subject, j.ttl)
+}
+
+// subjectClaims copies the application part of claims after checking it
+func subjectClaims(claims *Claims) (*Claims, error) {
+	if claims == nil {
+		return nil, NewValidationError("claims", "must not be nil")
+	}
+	if claims.UserID <= 0 {
+		return nil, NewValidationError("userID", "must be positive")
+	}
+	if strings.TrimSpace(claims.Email) == "" {
+		return nil, NewValidationError("email", "must not be empty")
+	}
+
+	subject := &Claims{
+		UserID: claims.UserID,
+		Email:  claims.Email,
+		Roles:  append([]string(nil), claims.Roles...),
+		Scope:  claims.Scope,
+	}
+	if len(claims.Extra) > 0 {
+		subject.Extra = make(map[string]json.RawMessage, len(claims.Extra))
+		for name, raw := range claims.Extra {
+			subject.Extra[name] = raw
+		}
+	}
+	return subject, nil
+}
+
+// sign fills in the registered claims and signs with the active key
+func (j *JWTService) sign(claims *Claims, ttl time.Duration) (string, error) {
+	key := j.keys.Active()
+	if key == nil || !key.CanSign() {
+		return "", fmt.Errorf("no active signing key")
+	}
+
+	now := j.now()
+	jti, err := newTokenID()
+	if err != nil {
+		return "", err
+	}
+	claims.Issuer = j.issuer
+	claims.Subject = strconv.Itoa(claims.UserID)
+	claims.Audience = jwt.ClaimStrings(j.audience)
+	claims.IssuedAt = jwt.NewNumericDate(now)
+	claims.NotBefore = jwt.NewNumericDate(now)
+	claims.ExpiresAt = jwt.NewNumericDate(now.Add(ttl))
+	claims.ID = jti
+
+	token := jwt.NewWithClaims(key.method(), claims)
+	token.Header["kid"] = key.ID
+	signed, err := token.SignedString(key.signingKey())
+	if err != nil {
+		return "", fmt.Errorf("failed to sign token: %v", err)
+	}
+	return signed, nil
 }
 
-// TODO: Implement ValidateToken method
 // ValidateToken parses and validates a JWT token
 // Requirements:
-// - Check token signature with secret key
-// - Verify token is not expired
+// - Check the signature with the key named by the kid header
+// - Reject algorithms other than the key's own
+// - Verify exp, nbf and iat with the configured leeway
+// - Verify issuer and audience when configured
+// - Reject refresh and mfa_pending tokens, and revoked tokens or families
 // - Return parsed claims on success
 func (j *JWTService) ValidateToken(tokenString string) (*Claims, error) {
-	// TODO: Implement token validation
-	// Parse token and verify signature
-	// Return claims if valid
-	return nil, errors.New("not implemented")
+	return j.ValidateTokenContext(context.Background(), tokenString)
+}
+
+// ValidateTokenContext is ValidateToken with a caller-supplied context for
+// the revocation store
+func (j *JWTService) ValidateTokenContext(ctx context.Context, tokenString string) (*Claims, error) {
+	claims, err := j.parse(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if claims.TokenType != "" && claims.TokenType != TokenTypeAccess {
+		return nil, fmt.Errorf("%w: %s token used as access token", ErrInvalidToken, claims.TokenType)
+	}
+	if err := j.checkRevoked(ctx, claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// parse verifies the signature and registered claims of any token type
+func (j *JWTService) parse(tokenString string) (*Claims, error) {
+	if tokenString == "" {
+		return nil, ErrEmptyToken
+	}
+
+	claims := &Claims{}
+	parser := jwt.NewParser(
+		jwt.WithValidMethods([]string{AlgHS256, AlgRS256, AlgEdDSA}),
+		jwt.WithoutClaimsValidation(),
+	)
+	if _, err := parser.ParseWithClaims(tokenString, claims, j.keyFunc); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	if err := j.validateClaims(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// keyFunc picks the verification key by kid and pins the algorithm to
+// that key's, so an RS256 public key can never be used as an HS256 secret
+func (j *JWTService) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, err := j.keys.Lookup(kid, j.now())
+	if err != nil {
+		return nil, err
+	}
+	if token.Method.Alg() != key.Algorithm {
+		return nil, NewInvalidSigningMethodError(token.Method.Alg())
+	}
+	return key.verificationKey(), nil
+}
+
+func (j *JWTService) validateClaims(claims *Claims) error {
+	now := j.now()
+
+	if claims.ExpiresAt == nil {
+		return fmt.Errorf("%w: missing exp", ErrInvalidClaims)
+	}
+	if now.After(claims.ExpiresAt.Add(j.leeway)) {
+		return ErrTokenExpired
+	}
+	if claims.NotBefore != nil && now.Add(j.leeway).Before(claims.NotBefore.Time) {
+		return fmt.Errorf("%w: token not valid yet", ErrInvalidClaims)
+	}
+	if claims.IssuedAt != nil && now.Add(j.leeway).Before(claims.IssuedAt.Time) {
+		return fmt.Errorf("%w: token issued in the future", ErrInvalidClaims)
+	}
+	if j.issuer != "" && claims.Issuer != j.issuer {
+		return fmt.Errorf("%w: unexpected issuer %q", ErrInvalidClaims, claims.Issuer)
+	}
+	if len(j.audience) > 0 && !hasAudience(claims.Audience, j.audience) {
+		return fmt.Errorf("%w: unexpected audience %v", ErrInvalidClaims, []string(claims.Audience))
+	}
+	if claims.UserID <= 0 {
+		return fmt.Errorf("%w: missing user_id", ErrInvalidClaims)
+	}
+	return nil
+}
+
+func hasAudience(got jwt.ClaimStrings, want []string) bool {
+	for _, g := range got {
+		for _, w := range want {
+			if g == w {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// newTokenID returns a random jti
+func newTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token id: %v", err)
+	}
+	return hex.EncodeToString(b), nil
 }
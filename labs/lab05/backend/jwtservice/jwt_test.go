@@ -1,7 +1,14 @@
 package jwtservice
 
 import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
 )
 
 func TestNewJWTService(t *testing.T) {
@@ -154,3 +161,183 @@ func TestJWTService_DifferentSecrets(t *testing.T) {
 		t.Error("Claims should not be nil for valid token")
 	}
 }
+
+func TestJWTService_AsymmetricKeys(t *testing.T) {
+	rsaKey, err := GenerateRSAKey("rsa-1", 2048)
+	if err != nil {
+		t.Fatalf("GenerateRSAKey() failed: %v", err)
+	}
+	edKey, err := GenerateEd25519Key("ed-1")
+	if err != nil {
+		t.Fatalf("GenerateEd25519Key() failed: %v", err)
+	}
+
+	for _, key := range []*Key{rsaKey, edKey} {
+		t.Run(key.Algorithm, func(t *testing.T) {
+			keys, _ := NewKeySet(key)
+			service, err := NewJWTServiceWithKeys(keys)
+			if err != nil {
+				t.Fatalf("NewJWTServiceWithKeys() failed: %v", err)
+			}
+			token, err := service.GenerateToken(7, "keys@example.com")
+			if err != nil {
+				t.Fatalf("GenerateToken() failed: %v", err)
+			}
+			claims, err := service.ValidateToken(token)
+			if err != nil || claims.UserID != 7 || claims.Subject != "7" || claims.ID == "" {
+				t.Errorf("ValidateToken() = %+v, %v", claims, err)
+			}
+		})
+	}
+
+	if _, err := NewRSAKey("weak", nil); err == nil {
+		t.Error("NewRSAKey() should reject a missing key")
+	}
+}
+
+func TestJWTService_AlgorithmPinnedToKey(t *testing.T) {
+	rsaKey, _ := GenerateRSAKey("rsa-1", 2048)
+	keys, _ := NewKeySet(rsaKey)
+	service, _ := NewJWTServiceWithKeys(keys)
+
+	// An HS256 token claiming the RSA kid must not verify, whatever secret
+	// the attacker used
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{
+		UserID:           1,
+		Email:            "mallory@example.com",
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))},
+	})
+	forged.Header["kid"] = "rsa-1"
+	token, _ := forged.SignedString([]byte("guessed"))
+
+	if _, err := service.ValidateToken(token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("ValidateToken(forged) error = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestJWTService_KeyRotation(t *testing.T) {
+	oldKey, _ := GenerateEd25519Key("2024-01")
+	keys, _ := NewKeySet(oldKey)
+	service, _ := NewJWTServiceWithKeys(keys)
+
+	oldToken, _ := service.GenerateToken(1, "rotate@example.com")
+
+	newKey, _ := GenerateEd25519Key("2024-02")
+	if err := keys.Rotate(newKey, time.Hour); err != nil {
+		t.Fatalf("Rotate() failed: %v", err)
+	}
+	newToken, _ := service.GenerateToken(1, "rotate@example.com")
+
+	parsed, _, _ := jwt.NewParser().ParseUnverified(newToken, &Claims{})
+	if parsed.Header["kid"] != "2024-02" {
+		t.Errorf("new token kid = %v, want 2024-02", parsed.Header["kid"])
+	}
+	if _, err := service.ValidateToken(oldToken); err != nil {
+		t.Errorf("token of the retired key should verify until it expires: %v", err)
+	}
+	if _, err := service.ValidateToken(newToken); err != nil {
+		t.Errorf("token of the new key should verify: %v", err)
+	}
+
+	if err := keys.Retire("2024-02", time.Time{}); err == nil {
+		t.Error("Retire() should refuse the active key")
+	}
+	if err := keys.Retire("2024-01", time.Now().Add(-time.Second)); err != nil {
+		t.Fatalf("Retire() failed: %v", err)
+	}
+	if _, err := service.ValidateToken(oldToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("token of an expired key error = %v, want ErrInvalidToken", err)
+	}
+	keys.Prune(time.Now())
+	if n := len(keys.Keys(time.Now())); n != 1 {
+		t.Errorf("Prune() left %d keys, want 1", n)
+	}
+}
+
+func TestJWTService_IssuerAudienceLeeway(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	service, _ := NewJWTService("test-secret",
+		WithIssuer("https://auth.example.com"),
+		WithAudience("blog-api"),
+		WithTokenTTL(time.Minute),
+		WithLeeway(30*time.Second),
+		WithClock(clock),
+	)
+	token, err := service.GenerateToken(5, "aud@example.com")
+	if err != nil {
+		t.Fatalf("GenerateToken() failed: %v", err)
+	}
+
+	claims, err := service.ValidateToken(token)
+	if err != nil || claims.Issuer != "https://auth.example.com" || len(claims.Audience) != 1 {
+		t.Fatalf("ValidateToken() = %+v, %v", claims, err)
+	}
+
+	now = now.Add(80 * time.Second)
+	if _, err := service.ValidateToken(token); err != nil {
+		t.Errorf("token within the leeway should be valid: %v", err)
+	}
+	now = now.Add(20 * time.Second)
+	if _, err := service.ValidateToken(token); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("token past the leeway error = %v, want ErrTokenExpired", err)
+	}
+
+	now = time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	otherAudience, _ := NewJWTService("test-secret", WithIssuer("https://auth.example.com"), WithAudience("admin-api"), WithClock(clock))
+	if _, err := otherAudience.ValidateToken(token); !errors.Is(err, ErrInvalidClaims) {
+		t.Errorf("wrong audience error = %v, want ErrInvalidClaims", err)
+	}
+	otherIssuer, _ := NewJWTService("test-secret", WithIssuer("https://evil.example.com"), WithClock(clock))
+	if _, err := otherIssuer.ValidateToken(token); !errors.Is(err, ErrInvalidClaims) {
+		t.Errorf("wrong issuer error = %v, want ErrInvalidClaims", err)
+	}
+
+	// A verifier whose clock runs behind accepts fresh tokens within the leeway
+	behind, _ := NewJWTService("test-secret", WithLeeway(30*time.Second), WithClock(func() time.Time { return now.Add(-10 * time.Second) }))
+	if _, err := behind.ValidateToken(token); err != nil {
+		t.Errorf("token from a clock 10s ahead should be valid: %v", err)
+	}
+}
+
+func TestJWTService_JWKS(t *testing.T) {
+	rsaKey, _ := GenerateRSAKey("rsa-1", 2048)
+	edKey, _ := GenerateEd25519Key("ed-1")
+	hmacKey, _ := NewHMACKey("hmac-1", []byte("secret"))
+	keys, _ := NewKeySet(edKey, rsaKey, hmacKey)
+	service, _ := NewJWTServiceWithKeys(keys)
+
+	rec := httptest.NewRecorder()
+	service.JWKSHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Cache-Control") == "" {
+		t.Fatalf("JWKS handler = %d %v", rec.Code, rec.Header())
+	}
+
+	var set JWKS
+	if err := json.Unmarshal(rec.Body.Bytes(), &set); err != nil {
+		t.Fatalf("invalid JWKS body: %v", err)
+	}
+	if len(set.Keys) != 2 {
+		t.Errorf("JWKS has %d keys, want the 2 public keys", len(set.Keys))
+	}
+	for _, jwk := range set.Keys {
+		if jwk.KeyID == "hmac-1" {
+			t.Error("JWKS must not publish HMAC secrets")
+		}
+	}
+
+	// A verifier built from the JWKS alone accepts the service's tokens
+	verifierKeys, err := KeySetFromJWKS(rec.Body.Bytes())
+	if err != nil {
+		t.Fatalf("KeySetFromJWKS() failed: %v", err)
+	}
+	verifier, _ := NewJWTServiceWithKeys(verifierKeys)
+	token, _ := service.GenerateToken(9, "jwks@example.com")
+	if claims, err := verifier.ValidateToken(token); err != nil || claims.UserID != 9 {
+		t.Errorf("verifier.ValidateToken() = %+v, %v", claims, err)
+	}
+	if _, err := verifier.GenerateToken(9, "jwks@example.com"); err == nil {
+		t.Error("a JWKS key set should not be able to sign")
+	}
+}
@@ -0,0 +1,297 @@
+package jwtservice
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Supported signing algorithms
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// minRSABits is the smallest RSA modulus accepted for signing
+const minRSABits = 2048
+
+// ErrUnknownKey indicates no usable key matches the token's kid
+var ErrUnknownKey = fmt.Errorf("unknown signing key")
+
+// Key is one signing or verification key identified by its kid
+type Key struct {
+	ID        string
+	Algorithm string
+
+	secret  []byte
+	private interface{}
+	public  interface{}
+}
+
+// NewHMACKey creates an HS256 key. The same secret signs and verifies,
+// so HMAC keys are never published in the JWKS.
+func NewHMACKey(kid string, secret []byte) (*Key, error) {
+	if kid == "" {
+		return nil, NewValidationError("kid", "must not be empty")
+	}
+	if len(secret) == 0 {
+		return nil, NewValidationError("secret", "must not be empty")
+	}
+	return &Key{ID: kid, Algorithm: AlgHS256, secret: append([]byte(nil), secret...)}, nil
+}
+
+// NewRSAKey creates an RS256 signing key
+func NewRSAKey(kid string, private *rsa.PrivateKey) (*Key, error) {
+	if kid == "" {
+		return nil, NewValidationError("kid", "must not be empty")
+	}
+	if private == nil || private.N.BitLen() < minRSABits {
+		return nil, NewValidationError("private", fmt.Sprintf("RSA key must have at least %d bits", minRSABits))
+	}
+	return &Key{ID: kid, Algorithm: AlgRS256, private: private, public: &private.PublicKey}, nil
+}
+
+// NewEd25519Key creates an EdDSA signing key
+func NewEd25519Key(kid string, private ed25519.PrivateKey) (*Key, error) {
+	if kid == "" {
+		return nil, NewValidationError("kid", "must not be empty")
+	}
+	if len(private) != ed25519.PrivateKeySize {
+		return nil, NewValidationError("private", "invalid Ed25519 private key")
+	}
+	return &Key{ID: kid, Algorithm: AlgEdDSA, private: private, public: private.Public()}, nil
+}
+
+// NewPublicKey creates a verification-only key from an *rsa.PublicKey or
+// an ed25519.PublicKey, for example one read from another issuer's JWKS
+func NewPublicKey(kid string, public interface{}) (*Key, error) {
+	if kid == "" {
+		return nil, NewValidationError("kid", "must not be empty")
+	}
+	switch pub := public.(type) {
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < minRSABits {
+			return nil, NewValidationError("public", fmt.Sprintf("RSA key must have at least %d bits", minRSABits))
+		}
+		return &Key{ID: kid, Algorithm: AlgRS256, public: pub}, nil
+	case ed25519.PublicKey:
+		if len(pub) != ed25519.PublicKeySize {
+			return nil, NewValidationError("public", "invalid Ed25519 public key")
+		}
+		return &Key{ID: kid, Algorithm: AlgEdDSA, public: pub}, nil
+	default:
+		return nil, NewValidationError("public", fmt.Sprintf("unsupported key type %T", public))
+	}
+}
+
+// GenerateRSAKey creates a new random RS256 key
+func GenerateRSAKey(kid string, bits int) (*Key, error) {
+	private, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate RSA key: %v", err)
+	}
+	return NewRSAKey(kid, private)
+}
+
+// GenerateEd25519Key creates a new random EdDSA key
+func GenerateEd25519Key(kid string) (*Key, error) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate Ed25519 key: %v", err)
+	}
+	return NewEd25519Key(kid, private)
+}
+
+// CanSign reports whether the key holds private material
+func (k *Key) CanSign() bool {
+	return k.secret != nil || k.private != nil
+}
+
+// Public returns the public key, or nil for HMAC keys
+func (k *Key) Public() interface{} {
+	return k.public
+}
+
+func (k *Key) method() jwt.SigningMethod {
+	switch k.Algorithm {
+	case AlgRS256:
+		return jwt.SigningMethodRS256
+	case AlgEdDSA:
+		return jwt.SigningMethodEdDSA
+	default:
+		return jwt.SigningMethodHS256
+	}
+}
+
+func (k *Key) signingKey() interface{} {
+	if k.secret != nil {
+		return k.secret
+	}
+	return k.private
+}
+
+func (k *Key) verificationKey() interface{} {
+	if k.secret != nil {
+		return k.secret
+	}
+	return k.public
+}
+
+// keyEntry is a key in a KeySet with the time it stops verifying
+type keyEntry struct {
+	key *Key
+	// expiresAt is zero while the key is current
+	expiresAt time.Time
+}
+
+// KeySet holds the keys of a JWTService. One key is active and signs new
+// tokens; retired keys keep verifying until their expiry so tokens issued
+// before a rotation stay valid. It is safe for concurrent use.
+type KeySet struct {
+	mu     sync.RWMutex
+	keys   map[string]*keyEntry
+	order  []string
+	active string
+}
+
+// NewKeySet creates a key set; the first key that can sign becomes active
+func NewKeySet(keys ...*Key) (*KeySet, error) {
+	ks := &KeySet{keys: make(map[string]*keyEntry)}
+	for _, key := range keys {
+		if err := ks.Add(key); err != nil {
+			return nil, err
+		}
+		if ks.active == "" && key.CanSign() {
+			ks.active = key.ID
+		}
+	}
+	return ks, nil
+}
+
+// Add inserts a key that verifies tokens but does not sign them until it
+// is activated
+func (ks *KeySet) Add(key *Key) error {
+	if key == nil {
+		return NewValidationError("key", "must not be nil")
+	}
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	if _, exists := ks.keys[key.ID]; exists {
+		return NewValidationError("kid", fmt.Sprintf("duplicate key id %q", key.ID))
+	}
+	ks.keys[key.ID] = &keyEntry{key: key}
+	ks.order = append(ks.order, key.ID)
+	return nil
+}
+
+// Rotate adds key and makes it active. The previous active key keeps
+// verifying for retain, which should be at least the token lifetime.
+func (ks *KeySet) Rotate(key *Key, retain time.Duration) error {
+	if key == nil || !key.CanSign() {
+		return NewValidationError("key", "rotation needs a signing key")
+	}
+	if err := ks.Add(key); err != nil {
+		return err
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if previous, ok := ks.keys[ks.active]; ok {
+		previous.expiresAt = time.Now().Add(retain)
+	}
+	ks.active = key.ID
+	return nil
+}
+
+// Retire stops kid from verifying after expiresAt; a zero time removes it
+// immediately. The active key cannot be retired.
+func (ks *KeySet) Retire(kid string, expiresAt time.Time) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	if kid == ks.active {
+		return NewValidationError("kid", "cannot retire the active key")
+	}
+	entry, ok := ks.keys[kid]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownKey, kid)
+	}
+	if expiresAt.IsZero() {
+		ks.remove(kid)
+		return nil
+	}
+	entry.expiresAt = expiresAt
+	return nil
+}
+
+// Prune removes retired keys that expired before now
+func (ks *KeySet) Prune(now time.Time) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	for _, kid := range append([]string(nil), ks.order...) {
+		if entry := ks.keys[kid]; !entry.expiresAt.IsZero() && now.After(entry.expiresAt) {
+			ks.remove(kid)
+		}
+	}
+}
+
+func (ks *KeySet) remove(kid string) {
+	delete(ks.keys, kid)
+	for i, id := range ks.order {
+		if id == kid {
+			ks.order = append(ks.order[:i], ks.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// Active returns the key signing new tokens, or nil when there is none
+func (ks *KeySet) Active() *Key {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	if entry, ok := ks.keys[ks.active]; ok {
+		return entry.key
+	}
+	return nil
+}
+
+// Lookup returns the key for kid if it still verifies at now. An empty
+// kid selects the active key, for tokens issued without a kid header.
+func (ks *KeySet) Lookup(kid string, now time.Time) (*Key, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	if kid == "" {
+		kid = ks.active
+	}
+	entry, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, kid)
+	}
+	if !entry.expiresAt.IsZero() && now.After(entry.expiresAt) {
+		return nil, fmt.Errorf("%w: %q has been retired", ErrUnknownKey, kid)
+	}
+	return entry.key, nil
+}
+
+// Keys returns the keys that still verify at now, in insertion order
+func (ks *KeySet) Keys(now time.Time) []*Key {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	keys := make([]*Key, 0, len(ks.order))
+	for _, kid := range ks.order {
+		entry := ks.keys[kid]
+		if entry.expiresAt.IsZero() || !now.After(entry.expiresAt) {
+			keys = append(keys, entry.key)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,39 @@
+package jwtservice
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// GenerateMFAToken issues a short-lived mfa_pending token after the
+// password of a user with a second factor was checked. ValidateToken
+// refuses it; only ValidateMFAToken accepts it.
+func (j *JWTService) GenerateMFAToken(userID int, email string) (string, time.Time, error) {
+	subject, err := subjectClaims(&Claims{UserID: userID, Email: email})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	subject.TokenType = TokenTypeMFAPending
+	token, err := j.sign(subject, j.mfaTTL)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, j.now().Add(j.mfaTTL), nil
+}
+
+// ValidateMFAToken validates an mfa_pending token. Callers revoke it with
+// RevokeToken once the second factor succeeds, so it works only once.
+func (j *JWTService) ValidateMFAToken(ctx context.Context, tokenString string) (*Claims, error) {
+	claims, err := j.parse(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if claims.TokenType != TokenTypeMFAPending {
+		return nil, fmt.Errorf("%w: not an mfa_pending token", ErrInvalidToken)
+	}
+	if err := j.checkRevoked(ctx, claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
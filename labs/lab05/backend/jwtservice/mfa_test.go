@@ -0,0 +1,55 @@
+package jwtservice
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMFAToken(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	service, _ := NewJWTService("test-secret",
+		WithClock(func() time.Time { return now }),
+		WithMFATokenTTL(2*time.Minute),
+		WithRevocationStore(NewMemoryRevocationStore()),
+	)
+	ctx := context.Background()
+
+	token, expiresAt, err := service.GenerateMFAToken(1, "mfa@example.com")
+	if err != nil {
+		t.Fatalf("GenerateMFAToken() failed: %v", err)
+	}
+	if !expiresAt.Equal(now.Add(2 * time.Minute)) {
+		t.Errorf("expiresAt = %v, want now + 2m", expiresAt)
+	}
+
+	claims, err := service.ValidateMFAToken(ctx, token)
+	if err != nil || claims.UserID != 1 || claims.TokenType != TokenTypeMFAPending {
+		t.Fatalf("ValidateMFAToken() = %+v, %v", claims, err)
+	}
+	if _, err := service.ValidateToken(token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("ValidateToken(mfa_pending) error = %v, want ErrInvalidToken", err)
+	}
+	if _, err := service.Refresh(token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Refresh(mfa_pending) error = %v, want ErrInvalidToken", err)
+	}
+
+	access, _ := service.GenerateToken(1, "mfa@example.com")
+	if _, err := service.ValidateMFAToken(ctx, access); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("ValidateMFAToken(access) error = %v, want ErrInvalidToken", err)
+	}
+
+	if err := service.RevokeToken(token); err != nil {
+		t.Fatalf("RevokeToken() failed: %v", err)
+	}
+	if _, err := service.ValidateMFAToken(ctx, token); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("ValidateMFAToken(revoked) error = %v, want ErrTokenRevoked", err)
+	}
+
+	fresh, _, _ := service.GenerateMFAToken(1, "mfa@example.com")
+	now = now.Add(3 * time.Minute)
+	if _, err := service.ValidateMFAToken(ctx, fresh); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("ValidateMFAToken(expired) error = %v, want ErrTokenExpired", err)
+	}
+}
@@ -0,0 +1,160 @@
+package jwtservice
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// AuthError is an authentication or authorization failure of a request.
+// Code and Scope follow the Bearer token error codes of RFC 6750.
+type AuthError struct {
+	Status      int
+	Code        string
+	Description string
+	// Scope lists the scopes the route requires, for insufficient_scope
+	Scope string
+	Err   error
+}
+
+func (e *AuthError) Error() string {
+	return e.Description
+}
+
+func (e *AuthError) Unwrap() error {
+	return e.Err
+}
+
+// Requirement is a per-route authorization check on validated claims
+type Requirement func(*Claims) *AuthError
+
+// RequireScopes demands every one of scopes
+func RequireScopes(scopes ...string) Requirement {
+	return func(c *Claims) *AuthError {
+		for _, scope := range scopes {
+			if !c.HasScope(scope) {
+				return &AuthError{
+					Status:      http.StatusForbidden,
+					Code:        "insufficient_scope",
+					Description: fmt.Sprintf("missing scope %q", scope),
+					Scope:       strings.Join(scopes, " "),
+				}
+			}
+		}
+		return nil
+	}
+}
+
+// RequireRoles demands at least one of roles
+func RequireRoles(roles ...string) Requirement {
+	return func(c *Claims) *AuthError {
+		if c.HasAnyRole(roles...) {
+			return nil
+		}
+		return &AuthError{
+			Status:      http.StatusForbidden,
+			Code:        "insufficient_role",
+			Description: fmt.Sprintf("requires one of roles %v", roles),
+		}
+	}
+}
+
+// BearerToken extracts the token of an "Authorization: Bearer" header
+func BearerToken(r *http.Request) (string, error) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return "", ErrEmptyToken
+	}
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+		return "", fmt.Errorf("%w: expected a Bearer authorization header", ErrInvalidToken)
+	}
+	return strings.TrimSpace(token), nil
+}
+
+// Authenticate validates the bearer token of r and applies requirements
+func (j *JWTService) Authenticate(r *http.Request, requirements ...Requirement) (*Claims, *AuthError) {
+	token, err := BearerToken(r)
+	if err != nil {
+		code := "invalid_request"
+		if errors.Is(err, ErrEmptyToken) {
+			// RFC 6750: no error code when credentials are simply missing
+			code = ""
+		}
+		return nil, &AuthError{Status: http.StatusUnauthorized, Code: code, Description: "missing or malformed bearer token", Err: err}
+	}
+
+	claims, err := j.ValidateTokenContext(r.Context(), token)
+	if err != nil {
+		description := "invalid token"
+		switch {
+		case errors.Is(err, ErrTokenExpired):
+			description = "token expired"
+		case errors.Is(err, ErrTokenRevoked):
+			description = "token revoked"
+		}
+		return nil, &AuthError{Status: http.StatusUnauthorized, Code: "invalid_token", Description: description, Err: err}
+	}
+
+	for _, requirement := range requirements {
+		if authErr := requirement(claims); authErr != nil {
+			return claims, authErr
+		}
+	}
+	return claims, nil
+}
+
+// Middleware authenticates requests and stores the claims in the request
+// context; handlers read them with ClaimsFromContext
+func (j *JWTService) Middleware(requirements ...Requirement) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, authErr := j.Authenticate(r, requirements...)
+			if authErr != nil {
+				WriteAuthError(w, authErr)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(ContextWithClaims(r.Context(), claims)))
+		})
+	}
+}
+
+// WriteAuthError writes the status, WWW-Authenticate header and a JSON
+// body for err
+func WriteAuthError(w http.ResponseWriter, err *AuthError) {
+	w.Header().Set("WWW-Authenticate", err.Challenge())
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(err.Status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Description})
+}
+
+// Challenge renders the WWW-Authenticate header value
+func (e *AuthError) Challenge() string {
+	params := []string{}
+	if e.Code != "" {
+		params = append(params, fmt.Sprintf("error=%q", e.Code), fmt.Sprintf("error_description=%q", e.Description))
+	}
+	if e.Scope != "" {
+		params = append(params, fmt.Sprintf("scope=%q", e.Scope))
+	}
+	if len(params) == 0 {
+		return "Bearer"
+	}
+	return "Bearer " + strings.Join(params, ", ")
+}
+
+type claimsContextKey struct{}
+
+// ContextWithClaims returns a context carrying claims
+func ContextWithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsContextKey{}, claims)
+}
+
+// ClaimsFromContext returns the claims stored by Middleware
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsContextKey{}).(*Claims)
+	return claims, ok
+}
@@ -0,0 +1,131 @@
+package jwtservice
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var tenantClaim = NewClaimKey[string]("tenant")
+
+type quota struct {
+	Posts int `json:"posts"`
+}
+
+var quotaClaim = NewClaimKey[quota]("quota")
+
+func TestClaims_RolesScopesAndCustomClaims(t *testing.T) {
+	service, _ := NewJWTService("test-secret", WithRevocationStore(NewMemoryRevocationStore()))
+
+	claims := &Claims{UserID: 3, Email: "editor@example.com", Roles: []string{"editor"}}
+	claims.SetScopes("posts:read", "posts:write")
+	if err := tenantClaim.Set(claims, "acme"); err != nil {
+		t.Fatalf("Set() failed: %v", err)
+	}
+	if err := quotaClaim.Set(claims, quota{Posts: 10}); err != nil {
+		t.Fatalf("Set() failed: %v", err)
+	}
+
+	pair, err := service.GenerateTokenPairFor(claims)
+	if err != nil {
+		t.Fatalf("GenerateTokenPairFor() failed: %v", err)
+	}
+	// Roles, scopes and custom claims survive a refresh
+	pair, err = service.Refresh(pair.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh() failed: %v", err)
+	}
+	got, err := service.ValidateToken(pair.AccessToken)
+	if err != nil {
+		t.Fatalf("ValidateToken() failed: %v", err)
+	}
+
+	if !got.HasRole("editor") || got.HasRole("admin") || !got.HasAnyRole("admin", "editor") {
+		t.Errorf("roles = %v", got.Roles)
+	}
+	if !got.HasScope("posts:write") || got.HasScope("posts") {
+		t.Errorf("scope = %q", got.Scope)
+	}
+	if tenant, ok, err := tenantClaim.Get(got); !ok || err != nil || tenant != "acme" {
+		t.Errorf("tenant claim = %q, %v, %v", tenant, ok, err)
+	}
+	if q, ok, err := quotaClaim.Get(got); !ok || err != nil || q.Posts != 10 {
+		t.Errorf("quota claim = %+v, %v, %v", q, ok, err)
+	}
+	if _, ok, _ := NewClaimKey[int]("missing").Get(got); ok {
+		t.Error("Get() of an absent claim should report ok=false")
+	}
+	if _, _, err := NewClaimKey[int]("tenant").Get(got); !errors.Is(err, ErrInvalidClaims) {
+		t.Errorf("Get() with the wrong type error = %v, want ErrInvalidClaims", err)
+	}
+}
+
+func TestJWTService_Middleware(t *testing.T) {
+	service, _ := NewJWTService("test-secret", WithRevocationStore(NewMemoryRevocationStore()))
+
+	reader := &Claims{UserID: 1, Email: "reader@example.com"}
+	reader.SetScopes("posts:read")
+	readerToken, _ := service.GenerateTokenFor(reader)
+
+	admin := &Claims{UserID: 2, Email: "admin@example.com", Roles: []string{"admin"}}
+	admin.SetScopes("posts:read", "posts:write")
+	adminToken, _ := service.GenerateTokenFor(admin)
+
+	revokedToken, _ := service.GenerateToken(1, "reader@example.com")
+	service.RevokeToken(revokedToken)
+
+	var seen *Claims
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = ClaimsFromContext(r.Context())
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux := http.NewServeMux()
+	mux.Handle("/posts", service.Middleware(RequireScopes("posts:read"))(ok))
+	mux.Handle("/posts/write", service.Middleware(RequireScopes("posts:read", "posts:write"))(ok))
+	mux.Handle("/admin", service.Middleware(RequireRoles("admin"))(ok))
+
+	tests := []struct {
+		name      string
+		path      string
+		header    string
+		status    int
+		challenge string
+	}{
+		{"no header", "/posts", "", http.StatusUnauthorized, "Bearer"},
+		{"wrong scheme", "/posts", "Basic abc", http.StatusUnauthorized, `error="invalid_request"`},
+		{"garbage token", "/posts", "Bearer nope", http.StatusUnauthorized, `error="invalid_token"`},
+		{"revoked token", "/posts", "Bearer " + revokedToken, http.StatusUnauthorized, `error_description="token revoked"`},
+		{"reader reads", "/posts", "Bearer " + readerToken, http.StatusNoContent, ""},
+		{"reader writes", "/posts/write", "bearer " + readerToken, http.StatusForbidden, `scope="posts:read posts:write"`},
+		{"admin writes", "/posts/write", "Bearer " + adminToken, http.StatusNoContent, ""},
+		{"reader admin", "/admin", "Bearer " + readerToken, http.StatusForbidden, `error="insufficient_role"`},
+		{"admin admin", "/admin", "Bearer " + adminToken, http.StatusNoContent, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seen = nil
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if tt.status == http.StatusNoContent {
+				if seen == nil {
+					t.Error("handler should see the claims in its context")
+				}
+				return
+			}
+			if got := rec.Header().Get("WWW-Authenticate"); !strings.Contains(got, tt.challenge) {
+				t.Errorf("WWW-Authenticate = %q, want it to contain %q", got, tt.challenge)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package jwtservice
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// TokenPair is an access token with the refresh token that renews it
+type TokenPair struct {
+	AccessToken      string    `json:"access_token"`
+	RefreshToken     string    `json:"refresh_token"`
+	TokenType        string    `json:"token_type"`
+	AccessExpiresAt  time.Time `json:"access_expires_at"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+	// FamilyID identifies the login the pair belongs to
+	FamilyID string `json:"-"`
+}
+
+// GenerateTokenPair starts a new token family for a login
+func (j *JWTService) GenerateTokenPair(userID int, email string) (*TokenPair, error) {
+	return j.GenerateTokenPairFor(&Claims{UserID: userID, Email: email})
+}
+
+// GenerateTokenPairFor starts a new token family whose tokens carry the
+// roles, scope and extra claims of claims, also after refreshes
+func (j *JWTService) GenerateTokenPairFor(claims *Claims) (*TokenPair, error) {
+	subject, err := subjectClaims(claims)
+	if err != nil {
+		return nil, err
+	}
+	familyID, err := newTokenID()
+	if err != nil {
+		return nil, err
+	}
+	return j.issuePair(subject, familyID)
+}
+
+func (j *JWTService) issuePair(subject *Claims, familyID string) (*TokenPair, error) {
+	now := j.now()
+
+	access := *subject
+	access.TokenType = TokenTypeAccess
+	access.FamilyID = familyID
+	accessToken, err := j.sign(&access, j.ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	refresh := *subject
+	refresh.TokenType = TokenTypeRefresh
+	refresh.FamilyID = familyID
+	refreshToken, err := j.sign(&refresh, j.refreshTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:      accessToken,
+		RefreshToken:     refreshToken,
+		TokenType:        "Bearer",
+		AccessExpiresAt:  now.Add(j.ttl),
+		RefreshExpiresAt: now.Add(j.refreshTTL),
+		FamilyID:         familyID,
+	}, nil
+}
+
+// Refresh exchanges a refresh token for a new pair in the same family.
+// Each refresh token works once; presenting it again means it was copied,
+// so the whole family is revoked and ErrTokenReused returned.
+func (j *JWTService) Refresh(refreshToken string) (*TokenPair, error) {
+	return j.RefreshContext(context.Background(), refreshToken)
+}
+
+// RefreshContext is Refresh with a caller-supplied context
+func (j *JWTService) RefreshContext(ctx context.Context, refreshToken string) (*TokenPair, error) {
+	if j.store == nil {
+		return nil, fmt.Errorf("refresh tokens need a revocation store")
+	}
+
+	claims, err := j.parse(refreshToken)
+	if err != nil {
+		return nil, err
+	}
+	if !claims.IsRefresh() || claims.FamilyID == "" {
+		return nil, fmt.Errorf("%w: not a refresh token", ErrInvalidToken)
+	}
+	if err := j.checkRevoked(ctx, claims); err != nil {
+		return nil, err
+	}
+
+	first, err := j.store.UseRefreshToken(ctx, claims.ID, claims.ExpiresAt.Time)
+	if err != nil {
+		return nil, err
+	}
+	if !first {
+		if err := j.store.RevokeFamily(ctx, claims.FamilyID, j.familyExpiry()); err != nil {
+			return nil, err
+		}
+		return nil, ErrTokenReused
+	}
+
+	subject, err := subjectClaims(claims)
+	if err != nil {
+		return nil, err
+	}
+	return j.issuePair(subject, claims.FamilyID)
+}
+
+// CanRevoke reports whether the service has a revocation store
+func (j *JWTService) CanRevoke() bool {
+	return j.store != nil
+}
+
+// RevokeToken revokes one access or refresh token until it expires. A
+// revoked refresh token also ends its family, which logs the session out.
+func (j *JWTService) RevokeToken(tokenString string) error {
+	return j.RevokeTokenContext(context.Background(), tokenString)
+}
+
+// RevokeTokenContext is RevokeToken with a caller-supplied context
+func (j *JWTService) RevokeTokenContext(ctx context.Context, tokenString string) error {
+	if j.store == nil {
+		return fmt.Errorf("revocation needs a revocation store")
+	}
+	claims, err := j.parse(tokenString)
+	if err != nil {
+		return err
+	}
+	if err := j.store.RevokeToken(ctx, claims.ID, claims.ExpiresAt.Time); err != nil {
+		return err
+	}
+	if claims.IsRefresh() && claims.FamilyID != "" {
+		return j.store.RevokeFamily(ctx, claims.FamilyID, j.familyExpiry())
+	}
+	return nil
+}
+
+// RevokeFamily revokes every token issued from one login
+func (j *JWTService) RevokeFamily(familyID string) error {
+	return j.RevokeFamilyContext(context.Background(), familyID)
+}
+
+// RevokeFamilyContext is RevokeFamily with a caller-supplied context
+func (j *JWTService) RevokeFamilyContext(ctx context.Context, familyID string) error {
+	if j.store == nil {
+		return fmt.Errorf("revocation needs a revocation store")
+	}
+	if familyID == "" {
+		return NewValidationError("familyID", "must not be empty")
+	}
+	return j.store.RevokeFamily(ctx, familyID, j.familyExpiry())
+}
+
+// familyExpiry outlives every token the family can still hold
+func (j *JWTService) familyExpiry() time.Time {
+	return j.now().Add(j.refreshTTL + j.leeway)
+}
+
+// checkRevoked consults the store, if any, for the token and its family
+func (j *JWTService) checkRevoked(ctx context.Context, claims *Claims) error {
+	if j.store == nil {
+		return nil
+	}
+	revoked, err := j.store.IsTokenRevoked(ctx, claims.ID)
+	if err != nil {
+		return err
+	}
+	if !revoked && claims.FamilyID != "" {
+		if revoked, err = j.store.IsFamilyRevoked(ctx, claims.FamilyID); err != nil {
+			return err
+		}
+	}
+	if revoked {
+		return ErrTokenRevoked
+	}
+	return nil
+}
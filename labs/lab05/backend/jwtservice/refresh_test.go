@@ -0,0 +1,147 @@
+package jwtservice
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"lab05/internal/sqlitetest"
+)
+
+func newSQLStore(t *testing.T) *SQLRevocationStore {
+	store, err := NewSQLRevocationStore(sqlitetest.Open(t))
+	if err != nil {
+		t.Fatalf("NewSQLRevocationStore() failed: %v", err)
+	}
+	return store
+}
+
+func TestRevocationStores(t *testing.T) {
+	stores := map[string]func(t *testing.T) RevocationStore{
+		"memory": func(t *testing.T) RevocationStore { return NewMemoryRevocationStore() },
+		"sql":    func(t *testing.T) RevocationStore { return newSQLStore(t) },
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+			ctx := context.Background()
+			now := time.Now()
+
+			if revoked, _ := store.IsTokenRevoked(ctx, "jti-1"); revoked {
+				t.Error("fresh store should not report revocations")
+			}
+			if err := store.RevokeToken(ctx, "jti-1", now.Add(time.Hour)); err != nil {
+				t.Fatalf("RevokeToken() failed: %v", err)
+			}
+			if err := store.RevokeToken(ctx, "jti-1", now.Add(time.Hour)); err != nil {
+				t.Fatalf("second RevokeToken() failed: %v", err)
+			}
+			if revoked, err := store.IsTokenRevoked(ctx, "jti-1"); err != nil || !revoked {
+				t.Errorf("IsTokenRevoked() = %v, %v, want true", revoked, err)
+			}
+
+			if err := store.RevokeFamily(ctx, "family-1", now.Add(-time.Minute)); err != nil {
+				t.Fatalf("RevokeFamily() failed: %v", err)
+			}
+			if revoked, err := store.IsFamilyRevoked(ctx, "family-1"); err != nil || !revoked {
+				t.Errorf("IsFamilyRevoked() = %v, %v, want true", revoked, err)
+			}
+
+			if first, err := store.UseRefreshToken(ctx, "refresh-1", now.Add(time.Hour)); err != nil || !first {
+				t.Errorf("first UseRefreshToken() = %v, %v, want true", first, err)
+			}
+			if first, err := store.UseRefreshToken(ctx, "refresh-1", now.Add(time.Hour)); err != nil || first {
+				t.Errorf("second UseRefreshToken() = %v, %v, want false", first, err)
+			}
+
+			if err := store.Purge(ctx, now); err != nil {
+				t.Fatalf("Purge() failed: %v", err)
+			}
+			if revoked, _ := store.IsFamilyRevoked(ctx, "family-1"); revoked {
+				t.Error("Purge() should remove expired entries")
+			}
+			if revoked, _ := store.IsTokenRevoked(ctx, "jti-1"); !revoked {
+				t.Error("Purge() should keep entries that have not expired")
+			}
+		})
+	}
+}
+
+func TestJWTService_Refresh(t *testing.T) {
+	service, _ := NewJWTService("test-secret", WithRevocationStore(NewMemoryRevocationStore()))
+
+	pair, err := service.GenerateTokenPair(1, "pair@example.com")
+	if err != nil {
+		t.Fatalf("GenerateTokenPair() failed: %v", err)
+	}
+	if _, err := service.ValidateToken(pair.AccessToken); err != nil {
+		t.Errorf("access token should be valid: %v", err)
+	}
+	if _, err := service.ValidateToken(pair.RefreshToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("refresh token as access token error = %v, want ErrInvalidToken", err)
+	}
+	if _, err := service.Refresh(pair.AccessToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Refresh(access token) error = %v, want ErrInvalidToken", err)
+	}
+
+	next, err := service.Refresh(pair.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh() failed: %v", err)
+	}
+	if next.RefreshToken == pair.RefreshToken || next.FamilyID != pair.FamilyID {
+		t.Errorf("Refresh() should rotate the refresh token within the family")
+	}
+
+	// Replaying the old refresh token revokes the family, including the
+	// tokens the legitimate client just received
+	if _, err := service.Refresh(pair.RefreshToken); !errors.Is(err, ErrTokenReused) {
+		t.Fatalf("reused refresh token error = %v, want ErrTokenReused", err)
+	}
+	if _, err := service.Refresh(next.RefreshToken); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("refresh after reuse error = %v, want ErrTokenRevoked", err)
+	}
+	if _, err := service.ValidateToken(next.AccessToken); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("access token after reuse error = %v, want ErrTokenRevoked", err)
+	}
+
+	// Other logins of the same user are unaffected
+	other, _ := service.GenerateTokenPair(1, "pair@example.com")
+	if _, err := service.Refresh(other.RefreshToken); err != nil {
+		t.Errorf("other family should still refresh: %v", err)
+	}
+}
+
+func TestJWTService_Revoke(t *testing.T) {
+	service, _ := NewJWTService("test-secret", WithRevocationStore(newSQLStore(t)))
+
+	pair, _ := service.GenerateTokenPair(2, "logout@example.com")
+	plain, _ := service.GenerateToken(2, "logout@example.com")
+
+	if err := service.RevokeToken(plain); err != nil {
+		t.Fatalf("RevokeToken() failed: %v", err)
+	}
+	if _, err := service.ValidateToken(plain); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("revoked token error = %v, want ErrTokenRevoked", err)
+	}
+	if _, err := service.ValidateToken(pair.AccessToken); err != nil {
+		t.Errorf("revoking one token should not affect others: %v", err)
+	}
+
+	// Logging out with the refresh token ends the whole login
+	if err := service.RevokeToken(pair.RefreshToken); err != nil {
+		t.Fatalf("RevokeToken(refresh) failed: %v", err)
+	}
+	if _, err := service.ValidateToken(pair.AccessToken); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("access token after logout error = %v, want ErrTokenRevoked", err)
+	}
+	if _, err := service.Refresh(pair.RefreshToken); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("refresh after logout error = %v, want ErrTokenRevoked", err)
+	}
+
+	without, _ := NewJWTService("test-secret")
+	if _, err := without.Refresh(pair.RefreshToken); err == nil {
+		t.Error("Refresh() without a store should fail")
+	}
+}
@@ -0,0 +1,95 @@
+package jwtservice
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RevocationStore records revoked tokens, revoked refresh token families
+// and refresh tokens that have already been exchanged. Entries carry an
+// expiry after which the token they describe is invalid anyway, so they
+// can be purged.
+type RevocationStore interface {
+	// RevokeToken revokes a single token by its jti
+	RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error
+	// IsTokenRevoked reports whether RevokeToken was called for jti
+	IsTokenRevoked(ctx context.Context, jti string) (bool, error)
+	// RevokeFamily revokes every token issued from one login
+	RevokeFamily(ctx context.Context, familyID string, expiresAt time.Time) error
+	// IsFamilyRevoked reports whether RevokeFamily was called for familyID
+	IsFamilyRevoked(ctx context.Context, familyID string) (bool, error)
+	// UseRefreshToken marks a refresh token as exchanged. It returns false
+	// when the token had been used before, atomically with the marking.
+	UseRefreshToken(ctx context.Context, jti string, expiresAt time.Time) (bool, error)
+	// Purge removes entries that expired before now
+	Purge(ctx context.Context, now time.Time) error
+}
+
+// MemoryRevocationStore is a RevocationStore for a single process
+type MemoryRevocationStore struct {
+	mu       sync.Mutex
+	tokens   map[string]time.Time
+	families map[string]time.Time
+	used     map[string]time.Time
+}
+
+// NewMemoryRevocationStore creates an empty in-memory store
+func NewMemoryRevocationStore() *MemoryRevocationStore {
+	return &MemoryRevocationStore{
+		tokens:   make(map[string]time.Time),
+		families: make(map[string]time.Time),
+		used:     make(map[string]time.Time),
+	}
+}
+
+func (s *MemoryRevocationStore) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[jti] = expiresAt
+	return nil
+}
+
+func (s *MemoryRevocationStore) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.tokens[jti]
+	return ok, nil
+}
+
+func (s *MemoryRevocationStore) RevokeFamily(ctx context.Context, familyID string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.families[familyID] = expiresAt
+	return nil
+}
+
+func (s *MemoryRevocationStore) IsFamilyRevoked(ctx context.Context, familyID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.families[familyID]
+	return ok, nil
+}
+
+func (s *MemoryRevocationStore) UseRefreshToken(ctx context.Context, jti string, expiresAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.used[jti]; ok {
+		return false, nil
+	}
+	s.used[jti] = expiresAt
+	return true, nil
+}
+
+func (s *MemoryRevocationStore) Purge(ctx context.Context, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, entries := range []map[string]time.Time{s.tokens, s.families, s.used} {
+		for id, expiresAt := range entries {
+			if expiresAt.Before(now) {
+				delete(entries, id)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package jwtservice
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Kinds of rows in the token_revocations table
+const (
+	revokedToken  = "token"
+	revokedFamily = "family"
+	usedRefresh   = "used"
+)
+
+// revocationSchema holds revoked tokens, revoked families and used
+// refresh tokens side by side, told apart by kind. Rows are only needed
+// until expires_at, after which the token is rejected anyway.
+const revocationSchema = `CREATE TABLE IF NOT EXISTS token_revocations (
+	kind VARCHAR(10) NOT NULL,
+	id VARCHAR(64) NOT NULL,
+	expires_at INTEGER NOT NULL,
+	PRIMARY KEY (kind, id)
+)`
+
+// SQLRevocationStore is a RevocationStore shared by every process using
+// the same database. Queries use ? placeholders and ON CONFLICT, which
+// SQLite supports.
+type SQLRevocationStore struct {
+	db *sql.DB
+}
+
+// NewSQLRevocationStore creates the token_revocations table if needed
+func NewSQLRevocationStore(db *sql.DB) (*SQLRevocationStore, error) {
+	if db == nil {
+		return nil, NewValidationError("db", "must not be nil")
+	}
+	if _, err := db.Exec(revocationSchema); err != nil {
+		return nil, fmt.Errorf("failed to create token_revocations: %v", err)
+	}
+	return &SQLRevocationStore{db: db}, nil
+}
+
+func (s *SQLRevocationStore) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	return s.revoke(ctx, revokedToken, jti, expiresAt)
+}
+
+func (s *SQLRevocationStore) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	return s.exists(ctx, revokedToken, jti)
+}
+
+func (s *SQLRevocationStore) RevokeFamily(ctx context.Context, familyID string, expiresAt time.Time) error {
+	return s.revoke(ctx, revokedFamily, familyID, expiresAt)
+}
+
+func (s *SQLRevocationStore) IsFamilyRevoked(ctx context.Context, familyID string) (bool, error) {
+	return s.exists(ctx, revokedFamily, familyID)
+}
+
+func (s *SQLRevocationStore) UseRefreshToken(ctx context.Context, jti string, expiresAt time.Time) (bool, error) {
+	result, err := s.db.ExecContext(ctx,
+		`INSERT INTO token_revocations (kind, id, expires_at) VALUES (?, ?, ?)
+		 ON CONFLICT (kind, id) DO NOTHING`,
+		usedRefresh, jti, expiresAt.Unix(),
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to mark refresh token used: %v", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to mark refresh token used: %v", err)
+	}
+	return n == 1, nil
+}
+
+func (s *SQLRevocationStore) Purge(ctx context.Context, now time.Time) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM token_revocations WHERE expires_at < ?`, now.Unix()); err != nil {
+		return fmt.Errorf("failed to purge token revocations: %v", err)
+	}
+	return nil
+}
+
+// revoke keeps the later expiry when an entry is revoked twice
+func (s *SQLRevocationStore) revoke(ctx context.Context, kind, id string, expiresAt time.Time) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO token_revocations (kind, id, expires_at) VALUES (?, ?, ?)
+		 ON CONFLICT (kind, id) DO UPDATE SET expires_at = MAX(expires_at, excluded.expires_at)`,
+		kind, id, expiresAt.Unix(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to revoke %s: %v", kind, err)
+	}
+	return nil
+}
+
+func (s *SQLRevocationStore) exists(ctx context.Context, kind, id string) (bool, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM token_revocations WHERE kind = ? AND id = ?`, kind, id,
+	).Scan(&n)
+	if err != nil {
+		return false, fmt.Errorf("failed to look up %s revocation: %v", kind, err)
+	}
+	return n > 0, nil
+}
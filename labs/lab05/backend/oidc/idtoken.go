@@ -0,0 +1,124 @@
+package oidc
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"lab05/jwtservice"
+)
+
+// ErrInvalidIDToken is returned for ID tokens that fail verification; the
+// wrapped message says which check failed
+var ErrInvalidIDToken = errors.New("invalid ID token")
+
+// IDToken holds the verified claims of an ID token
+type IDToken struct {
+	Issuer        string `json:"iss"`
+	Subject       string `json:"sub"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified bool   `json:"email_verified,omitempty"`
+	Name          string `json:"name,omitempty"`
+	Nonce         string `json:"nonce,omitempty"`
+	// AuthorizedParty is the client the token was issued to when it has
+	// several audiences
+	AuthorizedParty string `json:"azp,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Valid is left to VerifyIDToken, which knows the clock and leeway
+func (t IDToken) Valid() error {
+	return nil
+}
+
+// VerifyIDToken checks an ID token as OIDC Core section 3.1.3.7 asks: the
+// signature against the provider's JWKS with an asymmetric algorithm, the
+// issuer, our client ID in the audience, the expiry and issue time, and
+// that nonce matches the one of the AuthRequest.
+func (p *Provider) VerifyIDToken(ctx context.Context, raw, nonce string) (*IDToken, error) {
+	token := &IDToken{}
+	parser := jwt.NewParser(
+		jwt.WithValidMethods([]string{jwtservice.AlgRS256, jwtservice.AlgEdDSA}),
+		jwt.WithoutClaimsValidation(),
+	)
+	if _, err := parser.ParseWithClaims(raw, token, func(t *jwt.Token) (interface{}, error) {
+		return p.verificationKey(ctx, t)
+	}); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	now := p.now()
+	switch {
+	case token.Issuer != p.metadata.Issuer:
+		return nil, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidIDToken, token.Issuer)
+	case !containsString(token.Audience, p.config.ClientID):
+		return nil, fmt.Errorf("%w: not issued to this client", ErrInvalidIDToken)
+	case len(token.Audience) > 1 && token.AuthorizedParty != p.config.ClientID,
+		token.AuthorizedParty != "" && token.AuthorizedParty != p.config.ClientID:
+		return nil, fmt.Errorf("%w: authorized party %q is not this client", ErrInvalidIDToken, token.AuthorizedParty)
+	case token.Subject == "":
+		return nil, fmt.Errorf("%w: missing sub", ErrInvalidIDToken)
+	case token.ExpiresAt == nil || now.After(token.ExpiresAt.Add(p.leeway)):
+		return nil, fmt.Errorf("%w: expired", ErrInvalidIDToken)
+	case token.IssuedAt == nil || now.Add(p.leeway).Before(token.IssuedAt.Time):
+		return nil, fmt.Errorf("%w: missing or future iat", ErrInvalidIDToken)
+	case subtle.ConstantTimeCompare([]byte(token.Nonce), []byte(nonce)) != 1:
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+	return token, nil
+}
+
+// verificationKey finds the key for the token's kid, refetching the JWKS
+// once when the provider may have rotated keys
+func (p *Provider) verificationKey(ctx context.Context, token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, err := p.lookupKey(kid)
+	if errors.Is(err, jwtservice.ErrUnknownKey) && p.canRefreshKeys() {
+		if err := p.refreshKeys(ctx); err != nil {
+			return nil, err
+		}
+		key, err = p.lookupKey(kid)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if token.Method.Alg() != key.Algorithm {
+		return nil, jwtservice.NewInvalidSigningMethodError(token.Method.Alg())
+	}
+	return key.Public(), nil
+}
+
+// lookupKey returns the key for kid. Tokens without a kid are accepted
+// only while the provider publishes a single key.
+func (p *Provider) lookupKey(kid string) (*jwtservice.Key, error) {
+	p.mu.Lock()
+	keys := p.keys
+	p.mu.Unlock()
+
+	now := p.now()
+	if kid == "" {
+		if all := keys.Keys(now); len(all) == 1 {
+			return all[0], nil
+		}
+		return nil, fmt.Errorf("%w: token has no kid", jwtservice.ErrUnknownKey)
+	}
+	return keys.Lookup(kid, now)
+}
+
+func (p *Provider) canRefreshKeys() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.now().Sub(p.keysFetched) >= minJWKSRefresh
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,349 @@
+// Package oidc is an OpenID Connect relying party: it sends users to an
+// identity provider with the authorization code flow and PKCE, exchanges
+// the returned code and verifies the ID token against the provider's JWKS
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"lab05/jwtservice"
+)
+
+// DefaultScopes ask for the claims used to link and create accounts
+var DefaultScopes = []string{"openid", "email", "profile"}
+
+// DefaultLeeway tolerates clock skew between us and the provider
+const DefaultLeeway = time.Minute
+
+// minJWKSRefresh limits how often an unknown kid refetches the JWKS, so
+// forged tokens cannot make us hammer the provider
+const minJWKSRefresh = time.Minute
+
+// maxResponseSize caps provider responses
+const maxResponseSize = 1 << 20
+
+// Config identifies our client at one provider
+type Config struct {
+	// Issuer is the provider's issuer URL, e.g. https://accounts.google.com
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is our callback, registered at the provider
+	RedirectURL string
+	// Scopes default to DefaultScopes; "openid" is always sent
+	Scopes []string
+}
+
+// Metadata is the part of the provider's discovery document we use
+type Metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint,omitempty"`
+}
+
+// Provider talks to one identity provider. It is safe for concurrent use.
+type Provider struct {
+	config   Config
+	metadata Metadata
+	client   *http.Client
+	now      func() time.Time
+	leeway   time.Duration
+
+	mu          sync.Mutex
+	keys        *jwtservice.KeySet
+	keysFetched time.Time
+}
+
+// Option configures a Provider
+type Option func(*Provider)
+
+// WithHTTPClient replaces http.DefaultClient for provider requests
+func WithHTTPClient(client *http.Client) Option {
+	return func(p *Provider) {
+		p.client = client
+	}
+}
+
+// WithClock replaces time.Now for ID token checks
+func WithClock(now func() time.Time) Option {
+	return func(p *Provider) {
+		p.now = now
+	}
+}
+
+// WithLeeway sets the clock skew tolerated in ID token times
+func WithLeeway(leeway time.Duration) Option {
+	return func(p *Provider) {
+		p.leeway = leeway
+	}
+}
+
+// Discover reads the provider's /.well-known/openid-configuration and
+// JWKS. The document must name config.Issuer as its issuer.
+func Discover(ctx context.Context, config Config, opts ...Option) (*Provider, error) {
+	p := newProvider(config, Metadata{}, opts)
+	discoveryURL := strings.TrimRight(config.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := p.getJSON(ctx, discoveryURL, &p.metadata); err != nil {
+		return nil, fmt.Errorf("failed to discover %s: %w", config.Issuer, err)
+	}
+	if p.metadata.Issuer != config.Issuer {
+		return nil, fmt.Errorf("discovery document of %s names issuer %q", config.Issuer, p.metadata.Issuer)
+	}
+	if err := p.init(ctx); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// NewProvider creates a provider from known metadata, for providers
+// without discovery
+func NewProvider(ctx context.Context, config Config, metadata Metadata, opts ...Option) (*Provider, error) {
+	p := newProvider(config, metadata, opts)
+	if err := p.init(ctx); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func newProvider(config Config, metadata Metadata, opts []Option) *Provider {
+	p := &Provider{
+		config:   config,
+		metadata: metadata,
+		client:   http.DefaultClient,
+		now:      time.Now,
+		leeway:   DefaultLeeway,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// init checks the configuration and fetches the JWKS
+func (p *Provider) init(ctx context.Context) error {
+	switch {
+	case p.config.Issuer == "" || p.config.ClientID == "" || p.config.RedirectURL == "":
+		return errors.New("oidc provider needs an issuer, client ID and redirect URL")
+	case p.metadata.AuthorizationEndpoint == "" || p.metadata.TokenEndpoint == "" || p.metadata.JWKSURI == "":
+		return fmt.Errorf("metadata of %s lacks an authorization, token or JWKS endpoint", p.config.Issuer)
+	}
+	if p.metadata.Issuer == "" {
+		p.metadata.Issuer = p.config.Issuer
+	}
+	return p.refreshKeys(ctx)
+}
+
+// Issuer returns the provider's issuer URL
+func (p *Provider) Issuer() string {
+	return p.metadata.Issuer
+}
+
+// Metadata returns the endpoints in use
+func (p *Provider) Metadata() Metadata {
+	return p.metadata
+}
+
+// AuthRequest is one redirect to the provider. Keep State, Nonce and
+// CodeVerifier until the callback; only URL is shown to the browser.
+type AuthRequest struct {
+	URL          string
+	State        string
+	Nonce        string
+	CodeVerifier string
+}
+
+// AuthCodeURL starts the authorization code flow with a fresh state,
+// nonce and S256 PKCE verifier
+func (p *Provider) AuthCodeURL() (*AuthRequest, error) {
+	state, err := randomString(24)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := randomString(24)
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := randomString(32)
+	if err != nil {
+		return nil, err
+	}
+
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", p.config.ClientID)
+	params.Set("redirect_uri", p.config.RedirectURL)
+	params.Set("scope", strings.Join(p.scopes(), " "))
+	params.Set("state", state)
+	params.Set("nonce", nonce)
+	params.Set("code_challenge", CodeChallenge(verifier))
+	params.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(p.metadata.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return &AuthRequest{
+		URL:          p.metadata.AuthorizationEndpoint + separator + params.Encode(),
+		State:        state,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+	}, nil
+}
+
+func (p *Provider) scopes() []string {
+	scopes := p.config.Scopes
+	if len(scopes) == 0 {
+		scopes = DefaultScopes
+	}
+	for _, scope := range scopes {
+		if scope == "openid" {
+			return scopes
+		}
+	}
+	return append([]string{"openid"}, scopes...)
+}
+
+// CodeChallenge is the RFC 7636 S256 challenge of verifier
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// Token is the provider's token response
+type Token struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresIn    int    `json:"expires_in,omitempty"`
+	IDToken      string `json:"id_token"`
+}
+
+// Error is an OAuth 2.0 error response (RFC 6749 section 5.2)
+type Error struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e *Error) Error() string {
+	if e.Description == "" {
+		return "oidc: " + e.Code
+	}
+	return "oidc: " + e.Code + ": " + e.Description
+}
+
+// Exchange trades an authorization code and its PKCE verifier for tokens.
+// The ID token is not verified yet; pass it to VerifyIDToken.
+func (p *Provider) Exchange(ctx context.Context, code, verifier string) (*Token, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.config.RedirectURL)
+	form.Set("code_verifier", verifier)
+	form.Set("client_id", p.config.ClientID)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var oauthErr Error
+		if json.Unmarshal(body, &oauthErr) == nil && oauthErr.Code != "" {
+			return nil, &oauthErr
+		}
+		return nil, fmt.Errorf("token endpoint answered %s", resp.Status)
+	}
+
+	var token Token
+	if err := json.Unmarshal(body, &token); err != nil {
+		return nil, fmt.Errorf("invalid token response: %v", err)
+	}
+	if token.IDToken == "" {
+		return nil, fmt.Errorf("%w: token response has no id_token", ErrInvalidIDToken)
+	}
+	return &token, nil
+}
+
+// refreshKeys fetches the JWKS
+func (p *Provider) refreshKeys(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.metadata.JWKSURI, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create JWKS request: %v", err)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("JWKS request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("JWKS endpoint answered %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return fmt.Errorf("failed to read JWKS: %v", err)
+	}
+	keys, err := jwtservice.KeySetFromJWKS(data)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keys = keys
+	p.keysFetched = p.now()
+	return nil
+}
+
+func (p *Provider) getJSON(ctx context.Context, target string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s answered %s", target, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(v)
+}
+
+// randomString returns n random bytes, base64url encoded
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate random value: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,176 @@
+package oidc_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"lab05/oidc"
+	"lab05/oidc/oidctest"
+)
+
+const redirectURL = "http://localhost:8080/auth/oidc/mock/callback"
+
+// noRedirects lets tests read the Location of the provider's redirect
+var noRedirects = &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+	return http.ErrUseLastResponse
+}}
+
+// authorize follows an AuthRequest to the provider and returns the query
+// of the redirect back to us
+func authorize(t *testing.T, request *oidc.AuthRequest) url.Values {
+	t.Helper()
+	resp, err := noRedirects.Get(request.URL)
+	if err != nil {
+		t.Fatalf("GET authorize failed: %v", err)
+	}
+	resp.Body.Close()
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || !strings.HasPrefix(location.String(), redirectURL) {
+		t.Fatalf("authorize redirected to %q", resp.Header.Get("Location"))
+	}
+	return location.Query()
+}
+
+func TestProvider_CodeFlow(t *testing.T) {
+	idp := oidctest.NewProvider("lab05", "secret")
+	defer idp.Close()
+	ctx := context.Background()
+
+	config := idp.Config(redirectURL)
+	config.Issuer += "/"
+	if _, err := oidc.Discover(ctx, config); err == nil {
+		t.Errorf("Discover() accepted a discovery document for another issuer")
+	}
+	provider, err := oidc.Discover(ctx, idp.Config(redirectURL))
+	if err != nil {
+		t.Fatalf("Discover() failed: %v", err)
+	}
+
+	request, err := provider.AuthCodeURL()
+	if err != nil {
+		t.Fatalf("AuthCodeURL() failed: %v", err)
+	}
+	params, _ := url.Parse(request.URL)
+	for name, want := range map[string]string{
+		"response_type":         "code",
+		"client_id":             "lab05",
+		"redirect_uri":          redirectURL,
+		"scope":                 "openid email profile",
+		"state":                 request.State,
+		"nonce":                 request.Nonce,
+		"code_challenge":        oidc.CodeChallenge(request.CodeVerifier),
+		"code_challenge_method": "S256",
+	} {
+		if got := params.Query().Get(name); got != want {
+			t.Errorf("auth URL %s = %q, want %q", name, got, want)
+		}
+	}
+	if len(request.CodeVerifier) < 43 {
+		t.Errorf("code verifier %q is shorter than RFC 7636 allows", request.CodeVerifier)
+	}
+
+	callback := authorize(t, request)
+	if callback.Get("state") != request.State {
+		t.Fatalf("callback state = %q, want %q", callback.Get("state"), request.State)
+	}
+
+	var oauthErr *oidc.Error
+	if _, err := provider.Exchange(ctx, callback.Get("code"), "wrong-verifier"); !errors.As(err, &oauthErr) || oauthErr.Code != "invalid_grant" {
+		t.Errorf("Exchange(wrong verifier) error = %v, want invalid_grant", err)
+	}
+
+	callback = authorize(t, request)
+	token, err := provider.Exchange(ctx, callback.Get("code"), request.CodeVerifier)
+	if err != nil {
+		t.Fatalf("Exchange() failed: %v", err)
+	}
+	if _, err := provider.Exchange(ctx, callback.Get("code"), request.CodeVerifier); !errors.As(err, &oauthErr) {
+		t.Errorf("Exchange(used code) error = %v, want an OAuth error", err)
+	}
+
+	if _, err := provider.VerifyIDToken(ctx, token.IDToken, "other nonce"); !errors.Is(err, oidc.ErrInvalidIDToken) {
+		t.Errorf("VerifyIDToken(wrong nonce) error = %v", err)
+	}
+	claims, err := provider.VerifyIDToken(ctx, token.IDToken, request.Nonce)
+	if err != nil {
+		t.Fatalf("VerifyIDToken() failed: %v", err)
+	}
+	if claims.Subject != "user-1" || claims.Email != "jane@example.com" || !claims.EmailVerified || claims.Name != "Jane Roe" {
+		t.Errorf("ID token claims = %+v", claims)
+	}
+}
+
+func TestProvider_VerifyIDToken(t *testing.T) {
+	idp := oidctest.NewProvider("lab05", "secret")
+	defer idp.Close()
+	ctx := context.Background()
+	now := time.Now()
+	provider, err := oidc.Discover(ctx, idp.Config(redirectURL), oidc.WithClock(func() time.Time { return now }))
+	if err != nil {
+		t.Fatalf("Discover() failed: %v", err)
+	}
+	user := oidctest.User{Subject: "user-1", Email: "jane@example.com"}
+
+	hmacToken := jwt.NewWithClaims(jwt.SigningMethodHS256, idp.IDTokenClaims(user, "n"))
+	hmacSigned, _ := hmacToken.SignedString([]byte("secret"))
+	otherIdP := oidctest.NewProvider("lab05", "secret")
+	defer otherIdP.Close()
+	otherClaims := idp.IDTokenClaims(user, "n")
+
+	tests := []struct {
+		name   string
+		token  string
+		modify func(jwt.MapClaims)
+	}{
+		{name: "other issuer", modify: func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }},
+		{name: "other audience", modify: func(c jwt.MapClaims) { c["aud"] = "other-client" }},
+		{name: "several audiences without azp", modify: func(c jwt.MapClaims) { c["aud"] = []string{"lab05", "other-client"} }},
+		{name: "other azp", modify: func(c jwt.MapClaims) { c["azp"] = "other-client" }},
+		{name: "expired", modify: func(c jwt.MapClaims) { c["exp"] = now.Add(-2 * time.Minute).Unix() }},
+		{name: "issued in the future", modify: func(c jwt.MapClaims) { c["iat"] = now.Add(time.Hour).Unix() }},
+		{name: "no iat", modify: func(c jwt.MapClaims) { delete(c, "iat") }},
+		{name: "no sub", modify: func(c jwt.MapClaims) { delete(c, "sub") }},
+		{name: "no nonce", modify: func(c jwt.MapClaims) { delete(c, "nonce") }},
+		{name: "HS256 with the client secret", token: hmacSigned},
+		{name: "signed by another provider's key", token: otherIdP.SignIDToken(otherClaims)},
+		{name: "garbage", token: "not.a.token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := tt.token
+			if token == "" {
+				claims := idp.IDTokenClaims(user, "n")
+				tt.modify(claims)
+				token = idp.SignIDToken(claims)
+			}
+			if _, err := provider.VerifyIDToken(ctx, token, "n"); !errors.Is(err, oidc.ErrInvalidIDToken) {
+				t.Errorf("VerifyIDToken() error = %v, want ErrInvalidIDToken", err)
+			}
+		})
+	}
+
+	claims := idp.IDTokenClaims(user, "n")
+	claims["aud"] = []string{"lab05", "other-client"}
+	claims["azp"] = "lab05"
+	if _, err := provider.VerifyIDToken(ctx, idp.SignIDToken(claims), "n"); err != nil {
+		t.Errorf("VerifyIDToken(several audiences with azp) failed: %v", err)
+	}
+
+	// A rotated key is fetched, but at most once a minute
+	idp.RotateKey()
+	rotated := idp.SignIDToken(idp.IDTokenClaims(user, "n"))
+	if _, err := provider.VerifyIDToken(ctx, rotated, "n"); !errors.Is(err, oidc.ErrInvalidIDToken) {
+		t.Errorf("VerifyIDToken(new key right after a fetch) error = %v", err)
+	}
+	now = now.Add(2 * time.Minute)
+	if _, err := provider.VerifyIDToken(ctx, rotated, "n"); err != nil {
+		t.Errorf("VerifyIDToken(new key) failed: %v", err)
+	}
+}
@@ -0,0 +1,264 @@
+// Package oidctest runs a local OpenID Connect provider for tests. It
+// implements discovery, the authorization code flow with PKCE, the token
+// endpoint and a JWKS, and signs ID tokens with an RSA key it can rotate.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"lab05/jwtservice"
+	"lab05/oidc"
+)
+
+// User is an account at the provider. The authorize endpoint never shows
+// a login page; it signs in the user of SetUser straight away.
+type User struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// Provider is a mock identity provider on an httptest.Server
+type Provider struct {
+	Server       *httptest.Server
+	ClientID     string
+	ClientSecret string
+
+	mu    sync.Mutex
+	user  User
+	keys  []*rsa.PrivateKey
+	kids  []string
+	codes map[string]grant
+	// modify, when set, edits the claims of issued ID tokens
+	modify func(claims jwt.MapClaims)
+}
+
+// grant is an issued authorization code
+type grant struct {
+	user          User
+	redirectURI   string
+	nonce         string
+	codeChallenge string
+}
+
+// NewProvider starts a provider that accepts one client
+func NewProvider(clientID, clientSecret string) *Provider {
+	p := &Provider{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		codes:        make(map[string]grant),
+		user:         User{Subject: "user-1", Email: "jane@example.com", EmailVerified: true, Name: "Jane Roe"},
+	}
+	p.RotateKey()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("GET /authorize", p.authorize)
+	mux.HandleFunc("POST /token", p.token)
+	mux.HandleFunc("GET /jwks", p.jwks)
+	p.Server = httptest.NewServer(mux)
+	return p
+}
+
+// Close shuts the server down
+func (p *Provider) Close() {
+	p.Server.Close()
+}
+
+// Issuer is the provider's issuer URL
+func (p *Provider) Issuer() string {
+	return p.Server.URL
+}
+
+// Config returns a client configuration for redirectURL
+func (p *Provider) Config(redirectURL string) oidc.Config {
+	return oidc.Config{
+		Issuer:       p.Issuer(),
+		ClientID:     p.ClientID,
+		ClientSecret: p.ClientSecret,
+		RedirectURL:  redirectURL,
+	}
+}
+
+// SetUser changes the account signed in by the next authorizations
+func (p *Provider) SetUser(user User) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.user = user
+}
+
+// Modify passes the claims of ID tokens issued from now on through modify
+// before signing, to test how clients handle bad tokens; nil restores
+// normal tokens
+func (p *Provider) Modify(modify func(claims jwt.MapClaims)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.modify = modify
+}
+
+// RotateKey signs new ID tokens with a new key. The JWKS keeps publishing
+// the earlier keys.
+func (p *Provider) RotateKey() {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(fmt.Sprintf("oidctest: failed to generate key: %v", err))
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keys = append(p.keys, key)
+	p.kids = append(p.kids, fmt.Sprintf("key-%d", len(p.kids)+1))
+}
+
+// SignIDToken signs claims with the current key
+func (p *Provider) SignIDToken(claims jwt.MapClaims) string {
+	p.mu.Lock()
+	key, kid := p.keys[len(p.keys)-1], p.kids[len(p.kids)-1]
+	p.mu.Unlock()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		panic(fmt.Sprintf("oidctest: failed to sign ID token: %v", err))
+	}
+	return signed
+}
+
+// IDTokenClaims are the claims the provider issues for user
+func (p *Provider) IDTokenClaims(user User, nonce string) jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":            p.Issuer(),
+		"sub":            user.Subject,
+		"aud":            p.ClientID,
+		"exp":            now.Add(time.Hour).Unix(),
+		"iat":            now.Unix(),
+		"nonce":          nonce,
+		"email":          user.Email,
+		"email_verified": user.EmailVerified,
+		"name":           user.Name,
+	}
+}
+
+func (p *Provider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, oidc.Metadata{
+		Issuer:                p.Issuer(),
+		AuthorizationEndpoint: p.Issuer() + "/authorize",
+		TokenEndpoint:         p.Issuer() + "/token",
+		JWKSURI:               p.Issuer() + "/jwks",
+	})
+}
+
+func (p *Provider) authorize(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	redirectURI := params.Get("redirect_uri")
+	if params.Get("client_id") != p.ClientID || redirectURI == "" {
+		http.Error(w, "unknown client or redirect_uri", http.StatusBadRequest)
+		return
+	}
+	redirect, err := url.Parse(redirectURI)
+	if err != nil {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	query := redirect.Query()
+	query.Set("state", params.Get("state"))
+	switch {
+	case params.Get("response_type") != "code":
+		query.Set("error", "unsupported_response_type")
+	case params.Get("code_challenge_method") != "S256" || params.Get("code_challenge") == "":
+		query.Set("error", "invalid_request")
+		query.Set("error_description", "PKCE with S256 is required")
+	default:
+		code := randomCode()
+		p.mu.Lock()
+		p.codes[code] = grant{
+			user:          p.user,
+			redirectURI:   redirectURI,
+			nonce:         params.Get("nonce"),
+			codeChallenge: params.Get("code_challenge"),
+		}
+		p.mu.Unlock()
+		query.Set("code", code)
+	}
+	redirect.RawQuery = query.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (p *Provider) token(w http.ResponseWriter, r *http.Request) {
+	clientID, secret, ok := r.BasicAuth()
+	if ok {
+		clientID, _ = url.QueryUnescape(clientID)
+		secret, _ = url.QueryUnescape(secret)
+	}
+	if !ok || clientID != p.ClientID || secret != p.ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, oidc.Error{Code: "invalid_client"})
+		return
+	}
+	if r.PostFormValue("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, oidc.Error{Code: "unsupported_grant_type"})
+		return
+	}
+
+	p.mu.Lock()
+	code := r.PostFormValue("code")
+	g, found := p.codes[code]
+	delete(p.codes, code)
+	modify := p.modify
+	p.mu.Unlock()
+
+	switch {
+	case !found || g.redirectURI != r.PostFormValue("redirect_uri"):
+		writeJSON(w, http.StatusBadRequest, oidc.Error{Code: "invalid_grant"})
+		return
+	case oidc.CodeChallenge(r.PostFormValue("code_verifier")) != g.codeChallenge:
+		writeJSON(w, http.StatusBadRequest, oidc.Error{Code: "invalid_grant", Description: "PKCE verification failed"})
+		return
+	}
+
+	claims := p.IDTokenClaims(g.user, g.nonce)
+	if modify != nil {
+		modify(claims)
+	}
+	writeJSON(w, http.StatusOK, oidc.Token{
+		AccessToken: randomCode(),
+		TokenType:   "Bearer",
+		ExpiresIn:   3600,
+		IDToken:     p.SignIDToken(claims),
+	})
+}
+
+func (p *Provider) jwks(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	set := jwtservice.JWKS{}
+	for i, key := range p.keys {
+		k, _ := jwtservice.NewRSAKey(p.kids[i], key)
+		jwk, _ := k.ToJWK()
+		set.Keys = append(set.Keys, jwk)
+	}
+	writeJSON(w, http.StatusOK, set)
+}
+
+func randomCode() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return fmt.Sprintf("%x", b)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,164 @@
+package security
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+// BreachedList reports whether a password appeared in a known breach
+type BreachedList interface {
+	Contains(password string) bool
+}
+
+// BloomFilter is a compact BreachedList. Contains has no false negatives
+// and a false-positive rate chosen at construction, so a multi-gigabyte
+// breach corpus fits in a few megabytes on disk.
+type BloomFilter struct {
+	bits   []uint64
+	m      uint64
+	hashes uint32
+}
+
+// bloomMagic starts every filter file; the version is its last byte
+var bloomMagic = [6]byte{'P', 'W', 'B', 'L', 'M', 1}
+
+// ErrInvalidBloomFilter indicates a corrupt or foreign filter file
+var ErrInvalidBloomFilter = errors.New("invalid bloom filter file")
+
+// maxBloomFilterBits bounds the filter size a file may declare, 1 GiB of
+// bits, far more than any breach corpus needs at a sane error rate
+const maxBloomFilterBits = 1 << 33
+
+// bloomReadChunk is how many words ReadBloomFilter allocates ahead of the
+// data it has read, so a truncated file cannot force a huge allocation
+const bloomReadChunk = 1 << 16
+
+// NewBloomFilter sizes a filter for n passwords at false-positive rate p
+func NewBloomFilter(n int, p float64) *BloomFilter {
+	if n < 1 {
+		n = 1
+	}
+	if p <= 0 || p >= 1 {
+		p = 0.001
+	}
+	m := uint64(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	k := uint32(math.Max(1, math.Round(float64(m)/float64(n)*math.Ln2)))
+	return newBloomFilter(m, k)
+}
+
+func newBloomFilter(m uint64, k uint32) *BloomFilter {
+	words := (m + 63) / 64
+	return &BloomFilter{bits: make([]uint64, words), m: words * 64, hashes: k}
+}
+
+// locations derives the k bit positions by double hashing SHA-256
+func (f *BloomFilter) locations(password string, visit func(bit uint64) bool) bool {
+	sum := sha256.Sum256([]byte(password))
+	h1 := binary.BigEndian.Uint64(sum[0:8])
+	h2 := binary.BigEndian.Uint64(sum[8:16]) | 1
+	for i := uint64(0); i < uint64(f.hashes); i++ {
+		if !visit((h1 + i*h2) % f.m) {
+			return false
+		}
+	}
+	return true
+}
+
+// Add records password
+func (f *BloomFilter) Add(password string) {
+	f.locations(password, func(bit uint64) bool {
+		f.bits[bit/64] |= 1 << (bit % 64)
+		return true
+	})
+}
+
+// Contains reports whether password was probably added
+func (f *BloomFilter) Contains(password string) bool {
+	return f.locations(password, func(bit uint64) bool {
+		return f.bits[bit/64]&(1<<(bit%64)) != 0
+	})
+}
+
+// WriteTo stores the filter as magic, bit count, hash count and bits,
+// all big-endian
+func (f *BloomFilter) WriteTo(w io.Writer) (int64, error) {
+	bw := bufio.NewWriter(w)
+	header := make([]byte, 0, len(bloomMagic)+12)
+	header = append(header, bloomMagic[:]...)
+	header = binary.BigEndian.AppendUint64(header, f.m)
+	header = binary.BigEndian.AppendUint32(header, f.hashes)
+	if _, err := bw.Write(header); err != nil {
+		return 0, err
+	}
+	word := make([]byte, 8)
+	for _, bits := range f.bits {
+		binary.BigEndian.PutUint64(word, bits)
+		if _, err := bw.Write(word); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(header) + 8*len(f.bits)), bw.Flush()
+}
+
+// ReadBloomFilter reads a filter written by WriteTo
+func ReadBloomFilter(r io.Reader) (*BloomFilter, error) {
+	br := bufio.NewReader(r)
+	header := make([]byte, len(bloomMagic)+12)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBloomFilter, err)
+	}
+	if [6]byte(header[:6]) != bloomMagic {
+		return nil, fmt.Errorf("%w: bad magic", ErrInvalidBloomFilter)
+	}
+	m := binary.BigEndian.Uint64(header[6:14])
+	k := binary.BigEndian.Uint32(header[14:18])
+	if m == 0 || m%64 != 0 || m > maxBloomFilterBits || k == 0 || k > 64 {
+		return nil, fmt.Errorf("%w: bad parameters m=%d k=%d", ErrInvalidBloomFilter, m, k)
+	}
+
+	// The bits grow with the input rather than with the header's claim
+	words := m / 64
+	bits := make([]uint64, 0, min(words, bloomReadChunk))
+	word := make([]byte, 8)
+	for uint64(len(bits)) < words {
+		if _, err := io.ReadFull(br, word); err != nil {
+			return nil, fmt.Errorf("%w: truncated: %v", ErrInvalidBloomFilter, err)
+		}
+		bits = append(bits, binary.BigEndian.Uint64(word))
+	}
+	return &BloomFilter{bits: bits, m: m, hashes: k}, nil
+}
+
+// LoadBloomFilterFile reads a filter file, typically built once from a
+// breach corpus with BuildBloomFilter
+func LoadBloomFilterFile(path string) (*BloomFilter, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open breached-password filter: %v", err)
+	}
+	defer file.Close()
+	return ReadBloomFilter(file)
+}
+
+// BuildBloomFilter builds a filter for n passwords at false-positive rate
+// p from a newline-separated list. Blank lines are skipped.
+func BuildBloomFilter(r io.Reader, n int, p float64) (*BloomFilter, error) {
+	f := NewBloomFilter(n, p)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if password := strings.TrimRight(scanner.Text(), "\r"); password != "" {
+			f.Add(password)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read password list: %v", err)
+	}
+	return f, nil
+}
@@ -0,0 +1,74 @@
+package security
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrUnknownHashFormat indicates a hash no configured hasher recognises
+var ErrUnknownHashFormat = errors.New("unknown password hash format")
+
+// PasswordHasher hashes passwords with one algorithm. Hashes are
+// self-describing strings in PHC format ($id$params$salt$hash); bcrypt
+// keeps its $2a$cost$ modular crypt form, which PHC extends.
+type PasswordHasher interface {
+	// Hash returns the encoded hash of password
+	Hash(password string) (string, error)
+	// Verify compares password with encoded in constant time. needsRehash
+	// is true when encoded was made with parameters other than the
+	// hasher's current ones.
+	Verify(password, encoded string) (match bool, needsRehash bool, err error)
+	// Recognizes reports whether encoded was produced by this algorithm
+	Recognizes(encoded string) bool
+}
+
+// BcryptHasher hashes with bcrypt
+type BcryptHasher struct {
+	Cost int
+}
+
+// DefaultBcryptCost is the bcrypt cost of NewPasswordService
+const DefaultBcryptCost = 10
+
+// NewBcryptHasher checks cost against bcrypt's limits
+func NewBcryptHasher(cost int) (*BcryptHasher, error) {
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return nil, fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	return &BcryptHasher{Cost: cost}, nil
+}
+
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %v", err)
+	}
+	return string(hash), nil
+}
+
+func (h *BcryptHasher) Verify(password, encoded string) (bool, bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	switch {
+	case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
+		return false, false, nil
+	case err != nil:
+		return false, false, fmt.Errorf("invalid bcrypt hash: %v", err)
+	}
+	cost, err := bcrypt.Cost([]byte(encoded))
+	if err != nil {
+		return true, true, nil
+	}
+	return true, cost != h.Cost, nil
+}
+
+func (h *BcryptHasher) Recognizes(encoded string) bool {
+	for _, prefix := range []string{"$2a$", "$2b$", "$2y$"} {
+		if strings.HasPrefix(encoded, prefix) {
+			return true
+		}
+	}
+	return false
+}
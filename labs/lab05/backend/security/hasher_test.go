@@ -0,0 +1,132 @@
+package security
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testArgon2Params keep tests fast; never use them in production
+var testArgon2Params = Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func TestArgon2idHasher(t *testing.T) {
+	hasher, err := NewArgon2idHasher(testArgon2Params)
+	if err != nil {
+		t.Fatalf("NewArgon2idHasher() failed: %v", err)
+	}
+
+	hash, err := hasher.Hash("correct horse")
+	if err != nil {
+		t.Fatalf("Hash() failed: %v", err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$") || strings.Count(hash, "$") != 5 {
+		t.Errorf("Hash() = %q, want a PHC argon2id string", hash)
+	}
+	if other, _ := hasher.Hash("correct horse"); other == hash {
+		t.Error("Hash() should use a random salt")
+	}
+
+	if match, rehash, err := hasher.Verify("correct horse", hash); !match || rehash || err != nil {
+		t.Errorf("Verify(correct) = %v, %v, %v", match, rehash, err)
+	}
+	if match, _, err := hasher.Verify("wrong horse", hash); match || err != nil {
+		t.Errorf("Verify(wrong) = %v, %v", match, err)
+	}
+
+	stronger, _ := NewArgon2idHasher(Argon2Params{Memory: 128, Iterations: 2, Parallelism: 1, SaltLength: 16, KeyLength: 32})
+	if match, rehash, _ := stronger.Verify("correct horse", hash); !match || !rehash {
+		t.Errorf("Verify() with new parameters = %v, %v, want a match that needs rehash", match, rehash)
+	}
+
+	for _, bad := range []string{
+		"$argon2id$v=19$m=64,t=1,p=1$c2FsdA",
+		"$argon2id$v=16$m=64,t=1,p=1$c2FsdHNhbHQ$aGFzaA",
+		"$argon2id$v=19$m=64,t=0,p=1$c2FsdHNhbHQ$aGFzaA",
+		"$argon2id$v=19$m=64,t=1,p=1$!!$aGFzaA",
+	} {
+		if _, _, err := hasher.Verify("x", bad); err == nil {
+			t.Errorf("Verify(%q) should fail", bad)
+		}
+	}
+
+	if _, err := NewArgon2idHasher(Argon2Params{Memory: 64, Iterations: 0, Parallelism: 1, SaltLength: 16, KeyLength: 32}); err == nil {
+		t.Error("NewArgon2idHasher() should reject zero iterations")
+	}
+}
+
+func TestPasswordService_CheckPassword(t *testing.T) {
+	bcryptService, _ := NewPasswordServiceWithConfig(HasherConfig{Algorithm: AlgorithmBcrypt, BcryptCost: bcrypt.MinCost, Argon2: testArgon2Params})
+	argonService, _ := NewPasswordServiceWithConfig(HasherConfig{Algorithm: AlgorithmArgon2id, BcryptCost: bcrypt.MinCost, Argon2: testArgon2Params})
+	costlier, _ := NewPasswordServiceWithConfig(HasherConfig{Algorithm: AlgorithmBcrypt, BcryptCost: bcrypt.MinCost + 1, Argon2: testArgon2Params})
+
+	bcryptHash, _ := bcryptService.HashPassword("secret123")
+	argonHash, _ := argonService.HashPassword("secret123")
+
+	tests := []struct {
+		name        string
+		service     *PasswordService
+		hash        string
+		password    string
+		match       bool
+		needsRehash bool
+	}{
+		{"bcrypt current", bcryptService, bcryptHash, "secret123", true, false},
+		{"bcrypt wrong password", bcryptService, bcryptHash, "secret124", false, false},
+		{"bcrypt cost raised", costlier, bcryptHash, "secret123", true, true},
+		{"argon2id current", argonService, argonHash, "secret123", true, false},
+		{"bcrypt hash on argon2id service", argonService, bcryptHash, "secret123", true, true},
+		{"argon2id hash on bcrypt service", bcryptService, argonHash, "secret123", true, true},
+		{"wrong password never needs rehash", argonService, bcryptHash, "nope", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, needsRehash, err := tt.service.CheckPassword(tt.password, tt.hash)
+			if err != nil {
+				t.Fatalf("CheckPassword() failed: %v", err)
+			}
+			if match != tt.match || needsRehash != tt.needsRehash {
+				t.Errorf("CheckPassword() = %v, %v, want %v, %v", match, needsRehash, tt.match, tt.needsRehash)
+			}
+		})
+	}
+
+	if _, _, err := bcryptService.CheckPassword("secret123", "plaintext"); !errors.Is(err, ErrUnknownHashFormat) {
+		t.Errorf("CheckPassword(unknown format) error = %v, want ErrUnknownHashFormat", err)
+	}
+	if bcryptService.VerifyPassword("secret123", "plaintext") {
+		t.Error("VerifyPassword() must not accept an unknown format")
+	}
+}
+
+func TestHasherConfigFromEnv(t *testing.T) {
+	t.Setenv("PASSWORD_HASH_ALGORITHM", AlgorithmArgon2id)
+	t.Setenv("PASSWORD_ARGON2_MEMORY_KIB", "64")
+	t.Setenv("PASSWORD_ARGON2_ITERATIONS", "1")
+	t.Setenv("PASSWORD_BCRYPT_COST", "12")
+
+	cfg, err := HasherConfigFromEnv()
+	if err != nil {
+		t.Fatalf("HasherConfigFromEnv() failed: %v", err)
+	}
+	if cfg.Algorithm != AlgorithmArgon2id || cfg.Argon2.Memory != 64 || cfg.Argon2.Iterations != 1 || cfg.BcryptCost != 12 {
+		t.Errorf("HasherConfigFromEnv() = %+v", cfg)
+	}
+	service, err := NewPasswordServiceWithConfig(cfg)
+	if err != nil {
+		t.Fatalf("NewPasswordServiceWithConfig() failed: %v", err)
+	}
+	if hash, _ := service.HashPassword("secret123"); !strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,") {
+		t.Errorf("HashPassword() = %q, want an argon2id hash with the configured cost", hash)
+	}
+
+	t.Setenv("PASSWORD_BCRYPT_COST", "lots")
+	if _, err := HasherConfigFromEnv(); err == nil {
+		t.Error("HasherConfigFromEnv() should reject a non-numeric cost")
+	}
+	if _, err := NewPasswordServiceWithConfig(HasherConfig{Algorithm: "md5", BcryptCost: 10, Argon2: testArgon2Params}); err == nil {
+		t.Error("NewPasswordServiceWithConfig() should reject unknown algorithms")
+	}
+}
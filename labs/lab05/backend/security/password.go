@@ -2,54 +2,159 @@ package security
 
 import (
 	"errors"
-	_ "regexp"
+	"fmt"
+	"os"
+	"strconv"
+)
 
-	_ "golang.org/x/crypto/bcrypt"
+// Hash algorithms selectable in HasherConfig
+const (
+	AlgorithmBcrypt   = "bcrypt"
+	AlgorithmArgon2id = "argon2id"
 )
 
+// HasherConfig selects the algorithm and cost of new hashes, so that
+// development can hash cheaply and production expensively
+type HasherConfig struct {
+	Algorithm  string
+	BcryptCost int
+	Argon2     Argon2Params
+}
+
+// DefaultHasherConfig hashes with bcrypt cost 10
+func DefaultHasherConfig() HasherConfig {
+	return HasherConfig{
+		Algorithm:  AlgorithmBcrypt,
+		BcryptCost: DefaultBcryptCost,
+		Argon2:     DefaultArgon2Params,
+	}
+}
+
+// HasherConfigFromEnv starts from DefaultHasherConfig and applies
+// PASSWORD_HASH_ALGORITHM, PASSWORD_BCRYPT_COST, PASSWORD_ARGON2_MEMORY_KIB,
+// PASSWORD_ARGON2_ITERATIONS and PASSWORD_ARGON2_PARALLELISM when set
+func HasherConfigFromEnv() (HasherConfig, error) {
+	cfg := DefaultHasherConfig()
+	if algorithm := os.Getenv("PASSWORD_HASH_ALGORITHM"); algorithm != "" {
+		cfg.Algorithm = algorithm
+	}
+
+	for _, setting := range []struct {
+		name string
+		set  func(n uint64)
+		bits int
+	}{
+		{"PASSWORD_BCRYPT_COST", func(n uint64) { cfg.BcryptCost = int(n) }, 8},
+		{"PASSWORD_ARGON2_MEMORY_KIB", func(n uint64) { cfg.Argon2.Memory = uint32(n) }, 32},
+		{"PASSWORD_ARGON2_ITERATIONS", func(n uint64) { cfg.Argon2.Iterations = uint32(n) }, 32},
+		{"PASSWORD_ARGON2_PARALLELISM", func(n uint64) { cfg.Argon2.Parallelism = uint8(n) }, 8},
+	} {
+		value := os.Getenv(setting.name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.ParseUint(value, 10, setting.bits)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s: %v", setting.name, err)
+		}
+		setting.set(n)
+	}
+	return cfg, nil
+}
+
 // PasswordService handles password operations
-type PasswordService struct{}
+type PasswordService struct {
+	// preferred hashes new passwords; hashers verifies existing ones
+	preferred PasswordHasher
+	hashers   []PasswordHasher
+}
 
-// TODO: Implement NewPasswordService function
-// NewPasswordService creates a new password service
+// NewPasswordService creates a new password service hashing with bcrypt
+// cost 10 and verifying both bcrypt and Argon2id hashes
 func NewPasswordService() *PasswordService {
-	// TODO: Implement this function
-	// Return a new PasswordService instance
-	return nil
+	service, _ := NewPasswordServiceWithConfig(DefaultHasherConfig())
+	return service
+}
+
+// NewPasswordServiceWithConfig creates a service hashing new passwords as
+// cfg says. Hashes of the other algorithm still verify and are reported
+// as needing a rehash.
+func NewPasswordServiceWithConfig(cfg HasherConfig) (*PasswordService, error) {
+	bcryptHasher, err := NewBcryptHasher(cfg.BcryptCost)
+	if err != nil {
+		return nil, err
+	}
+	argon2Hasher, err := NewArgon2idHasher(cfg.Argon2)
+	if err != nil {
+		return nil, err
+	}
+
+	switch cfg.Algorithm {
+	case AlgorithmBcrypt:
+		return NewPasswordServiceWithHashers(bcryptHasher, argon2Hasher), nil
+	case AlgorithmArgon2id:
+		return NewPasswordServiceWithHashers(argon2Hasher, bcryptHasher), nil
+	default:
+		return nil, fmt.Errorf("unknown password hash algorithm %q", cfg.Algorithm)
+	}
 }
 
-// TODO: Implement HashPassword method
-// HashPassword hashes a password using bcrypt
+// NewPasswordServiceWithHashers hashes with preferred and verifies hashes
+// of preferred and legacy
+func NewPasswordServiceWithHashers(preferred PasswordHasher, legacy ...PasswordHasher) *PasswordService {
+	return &PasswordService{
+		preferred: preferred,
+		hashers:   append([]PasswordHasher{preferred}, legacy...),
+	}
+}
+
+// HashPassword hashes a password with the preferred hasher
 // Requirements:
 // - password must not be empty
-// - use bcrypt with cost 10
-// - return the hashed password as string
+// - return the encoded hash as string
 func (p *PasswordService) HashPassword(password string) (string, error) {
-	// TODO: Implement password hashing
-	// Use golang.org/x/crypto/bcrypt.GenerateFromPassword
-	return "", errors.New("not implemented")
+	if password == "" {
+		return "", errors.New("password cannot be empty")
+	}
+	return p.preferred.Hash(password)
 }
 
-// TODO: Implement VerifyPassword method
 // VerifyPassword checks if password matches hash
 // Requirements:
 // - password and hash must not be empty
 // - return true if password matches hash
 // - return false if password doesn't match
 func (p *PasswordService) VerifyPassword(password, hash string) bool {
-	// TODO: Implement password verification
-	// Use bcrypt.CompareHashAndPassword
-	// Return true only if passwords match exactly
-	return false
+	match, _, err := p.CheckPassword(password, hash)
+	return err == nil && match
+}
+
+// CheckPassword verifies password like VerifyPassword and also reports
+// whether hash should be replaced by HashPassword(password) because it
+// was made with another algorithm or cost. Callers rehash after a
+// successful login.
+func (p *PasswordService) CheckPassword(password, hash string) (match bool, needsRehash bool, err error) {
+	if password == "" || hash == "" {
+		return false, false, nil
+	}
+	for _, hasher := range p.hashers {
+		if !hasher.Recognizes(hash) {
+			continue
+		}
+		match, needsRehash, err = hasher.Verify(password, hash)
+		if err != nil || !match {
+			return false, false, err
+		}
+		return true, needsRehash || hasher != p.preferred, nil
+	}
+	return false, false, ErrUnknownHashFormat
 }
 
-// TODO: Implement ValidatePassword function
 // ValidatePassword checks if password meets basic requirements
 // Requirements:
 // - At least 6 characters
 // - Contains at least one letter and one number
+// The returned error is a *PolicyError; see PasswordPolicy for stricter rules.
 func ValidatePassword(password string) error {
-	// TODO: Implement password validation
-	// Check length and basic complexity requirements
-	return errors.New("not implemented")
+	return BasicPolicy().Validate(password)
 }
@@ -0,0 +1,216 @@
+package security
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Violation codes are stable so clients can localise messages
+const (
+	ViolationTooShort      = "too_short"
+	ViolationTooLong       = "too_long"
+	ViolationMissingLower  = "missing_lowercase"
+	ViolationMissingUpper  = "missing_uppercase"
+	ViolationMissingLetter = "missing_letter"
+	ViolationMissingDigit  = "missing_digit"
+	ViolationMissingSymbol = "missing_symbol"
+	ViolationRepeated      = "too_many_repeats"
+	ViolationTooWeak       = "too_weak"
+	ViolationPersonalInfo  = "contains_personal_info"
+	ViolationBreached      = "breached"
+)
+
+// Violation is one rule a password broke
+type Violation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// PolicyError lists every rule a password broke, with the strength
+// estimate when the policy computed one
+type PolicyError struct {
+	Violations []Violation `json:"violations"`
+	Strength   *Strength   `json:"strength,omitempty"`
+}
+
+func (e *PolicyError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Has reports whether the password broke the rule with code
+func (e *PolicyError) Has(code string) bool {
+	for _, v := range e.Violations {
+		if v.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// PasswordPolicy is a configurable set of password rules. Zero fields
+// disable their rule. MinLength counts characters; MaxLength counts bytes
+// because hashers limit their input in bytes.
+type PasswordPolicy struct {
+	MinLength     int
+	MaxLength     int
+	RequireLower  bool
+	RequireUpper  bool
+	RequireLetter bool
+	RequireDigit  bool
+	RequireSymbol bool
+	// MaxRepeat limits runs of one character, e.g. 3 rejects "aaaa"
+	MaxRepeat int
+	// MinStrength is the lowest acceptable EstimateStrength score, 1-4
+	MinStrength int
+	// RejectPersonalInfo rejects passwords containing the user's name,
+	// email or email local part
+	RejectPersonalInfo bool
+	// Breached rejects passwords found in a breach corpus
+	Breached BreachedList
+}
+
+// BasicPolicy is the policy of ValidatePassword: 6+ characters with a
+// letter and a digit
+func BasicPolicy() *PasswordPolicy {
+	return &PasswordPolicy{MinLength: 6, RequireLetter: true, RequireDigit: true}
+}
+
+// AccountPolicy is the policy of user accounts: 8 to 72 characters with
+// upper and lower case letters and a digit. 72 bytes is bcrypt's limit.
+func AccountPolicy() *PasswordPolicy {
+	return &PasswordPolicy{MinLength: 8, MaxLength: 72, RequireLower: true, RequireUpper: true, RequireDigit: true}
+}
+
+// RecommendedPolicy follows NIST SP 800-63B: length, strength and breach
+// checks instead of composition rules. breached may be nil.
+func RecommendedPolicy(breached BreachedList) *PasswordPolicy {
+	return &PasswordPolicy{
+		MinLength:          10,
+		MaxLength:          72,
+		MaxRepeat:          3,
+		MinStrength:        3,
+		RejectPersonalInfo: true,
+		Breached:           breached,
+	}
+}
+
+// Check returns every rule password breaks, or nil. userInputs are the
+// user's name, email and similar values that must not appear in it.
+func (p *PasswordPolicy) Check(password string, userInputs ...string) []Violation {
+	violations, _ := p.check(password, userInputs)
+	return violations
+}
+
+// Validate returns a *PolicyError when password breaks any rule
+func (p *PasswordPolicy) Validate(password string, userInputs ...string) error {
+	violations, strength := p.check(password, userInputs)
+	if len(violations) == 0 {
+		return nil
+	}
+	return &PolicyError{Violations: violations, Strength: strength}
+}
+
+func (p *PasswordPolicy) check(password string, userInputs []string) ([]Violation, *Strength) {
+	var violations []Violation
+	add := func(code, format string, args ...any) {
+		violations = append(violations, Violation{Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if len([]rune(password)) < p.MinLength {
+		add(ViolationTooShort, "password must be at least %d characters", p.MinLength)
+	}
+	if p.MaxLength > 0 && len(password) > p.MaxLength {
+		add(ViolationTooLong, "password must be at most %d bytes", p.MaxLength)
+	}
+
+	var hasLower, hasUpper, hasLetter, hasDigit, hasSymbol bool
+	longestRun, run := 0, 0
+	var previous rune
+	for i, r := range []rune(password) {
+		switch {
+		case unicode.IsLower(r):
+			hasLower, hasLetter = true, true
+		case unicode.IsUpper(r):
+			hasUpper, hasLetter = true, true
+		case unicode.IsLetter(r):
+			hasLetter = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case !unicode.IsSpace(r):
+			hasSymbol = true
+		}
+		if i > 0 && r == previous {
+			run++
+		} else {
+			run = 1
+		}
+		longestRun = max(longestRun, run)
+		previous = r
+	}
+	if p.RequireLower && !hasLower {
+		add(ViolationMissingLower, "password must contain a lowercase letter")
+	}
+	if p.RequireUpper && !hasUpper {
+		add(ViolationMissingUpper, "password must contain an uppercase letter")
+	}
+	if p.RequireLetter && !hasLetter {
+		add(ViolationMissingLetter, "password must contain a letter")
+	}
+	if p.RequireDigit && !hasDigit {
+		add(ViolationMissingDigit, "password must contain a number")
+	}
+	if p.RequireSymbol && !hasSymbol {
+		add(ViolationMissingSymbol, "password must contain a symbol")
+	}
+	if p.MaxRepeat > 0 && longestRun > p.MaxRepeat {
+		add(ViolationRepeated, "password must not repeat a character more than %d times in a row", p.MaxRepeat)
+	}
+
+	if p.RejectPersonalInfo && containsPersonalInfo(password, userInputs) {
+		add(ViolationPersonalInfo, "password must not contain your name or email")
+	}
+	if p.Breached != nil && password != "" && p.Breached.Contains(password) {
+		add(ViolationBreached, "password has appeared in a data breach; choose another")
+	}
+	var strength *Strength
+	// A password over MaxLength is rejected anyway; skipping the estimate
+	// keeps a huge one from costing much CPU
+	if p.MinStrength > 0 && (p.MaxLength <= 0 || len(password) <= p.MaxLength) {
+		estimate := EstimateStrength(password, userInputs...)
+		strength = &estimate
+		if estimate.Score < p.MinStrength {
+			add(ViolationTooWeak, "password is too easy to guess")
+		}
+	}
+	return violations, strength
+}
+
+// containsPersonalInfo matches whole inputs and their words of 3+
+// characters case-insensitively. Only the local part of an email is
+// split into words, so "example" in "jane@example.com" stays allowed.
+func containsPersonalInfo(password string, userInputs []string) bool {
+	lower := strings.ToLower(password)
+	for _, input := range userInputs {
+		input = strings.ToLower(strings.TrimSpace(input))
+		if input == "" {
+			continue
+		}
+		if strings.Contains(lower, input) {
+			return true
+		}
+		if at := strings.LastIndex(input, "@"); at >= 0 {
+			input = input[:at]
+		}
+		for _, token := range personalTokens(input) {
+			if strings.Contains(lower, token) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,181 @@
+package security
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func violationCodes(violations []Violation) []string {
+	codes := make([]string, len(violations))
+	for i, v := range violations {
+		codes[i] = v.Code
+	}
+	return codes
+}
+
+func TestPasswordPolicy_Check(t *testing.T) {
+	breached, err := BuildBloomFilter(strings.NewReader("Summer2024!\nhunter2\n"), 2, 0.001)
+	if err != nil {
+		t.Fatalf("BuildBloomFilter() failed: %v", err)
+	}
+	recommended := RecommendedPolicy(breached)
+
+	tests := []struct {
+		name     string
+		policy   *PasswordPolicy
+		password string
+		inputs   []string
+		want     []string
+	}{
+		{"account ok", AccountPolicy(), "Password123", nil, nil},
+		{"account short and lower only", AccountPolicy(), "abc", nil, []string{ViolationTooShort, ViolationMissingUpper, ViolationMissingDigit}},
+		{"account too long", AccountPolicy(), "Aa1" + strings.Repeat("x", 70), nil, []string{ViolationTooLong}},
+		{"symbol required", &PasswordPolicy{RequireSymbol: true}, "Password123", nil, []string{ViolationMissingSymbol}},
+		{"repeats", &PasswordPolicy{MaxRepeat: 2}, "abccc1", nil, []string{ViolationRepeated}},
+		{"recommended ok", recommended, "violet-anchor-drift-42", []string{"Jane Roe", "jane@example.com"}, nil},
+		{"recommended weak", recommended, "qwertyuiop", nil, []string{ViolationTooWeak}},
+		{"recommended breached", recommended, "Summer2024!", nil, []string{ViolationBreached, ViolationTooWeak}},
+		{"name in password", recommended, "roe-violet-anchor-42", []string{"Jane Roe", "jane@example.com"}, []string{ViolationPersonalInfo}},
+		{"email local part in password", recommended, "violet-anchor-jane-42", []string{"", "jane@example.com"}, []string{ViolationPersonalInfo}},
+		{"email domain is allowed", recommended, "violet-anchor-example-42", []string{"", "jane@example.com"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := violationCodes(tt.policy.Check(tt.password, tt.inputs...))
+			if len(got) == 0 && len(tt.want) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Check(%q) = %v, want %v", tt.password, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPasswordPolicy_Validate(t *testing.T) {
+	err := RecommendedPolicy(nil).Validate("password", "Jane Roe")
+	var policyErr *PolicyError
+	if !errors.As(err, &policyErr) {
+		t.Fatalf("Validate() error = %v, want *PolicyError", err)
+	}
+	if !policyErr.Has(ViolationTooShort) || !policyErr.Has(ViolationTooWeak) || policyErr.Has(ViolationBreached) {
+		t.Errorf("Validate() violations = %v", violationCodes(policyErr.Violations))
+	}
+	if policyErr.Strength == nil || policyErr.Strength.Score != 0 || len(policyErr.Strength.Feedback) == 0 {
+		t.Errorf("Validate() strength = %+v, want score 0 with feedback", policyErr.Strength)
+	}
+	if !strings.Contains(err.Error(), "at least 10 characters") {
+		t.Errorf("Error() = %q, want the violation messages", err.Error())
+	}
+
+	if err := AccountPolicy().Validate("Password123"); err != nil {
+		t.Errorf("Validate() = %v, want nil", err)
+	}
+}
+
+func TestPasswordPolicy_ValidateLongPassword(t *testing.T) {
+	// Rejected for its length without estimating its strength
+	long := strings.Repeat("Tr0ub4dor&3qwerty", 60000)
+	err := RecommendedPolicy(nil).Validate(long)
+	var policyErr *PolicyError
+	if !errors.As(err, &policyErr) || !policyErr.Has(ViolationTooLong) || policyErr.Strength != nil {
+		t.Fatalf("Validate(long) error = %v, want too_long without a strength estimate", err)
+	}
+
+	// The estimate itself grows linearly, so this finishes quickly
+	if got := EstimateStrength(long[:20000]); got.Score != 4 {
+		t.Errorf("EstimateStrength(20000 characters).Score = %d, want 4", got.Score)
+	}
+}
+
+func TestEstimateStrength(t *testing.T) {
+	tests := []struct {
+		password string
+		maxScore int
+		minScore int
+	}{
+		{"", 0, 0},
+		{"password", 0, 0},
+		{"P@ssw0rd", 0, 0},
+		{"qwertyuiop", 0, 0},
+		{"aaaaaaaaaa", 0, 0},
+		{"abcdef123", 0, 0},
+		{"1990jane", 0, 0},
+		{"xK9#mQ2vL7pW", 4, 4},
+		{"correct horse battery staple", 4, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.password, func(t *testing.T) {
+			got := EstimateStrength(tt.password, "Jane Roe")
+			if got.Score < tt.minScore || got.Score > tt.maxScore {
+				t.Errorf("EstimateStrength(%q).Score = %d (%.0f guesses), want %d-%d", tt.password, got.Score, got.Guesses, tt.minScore, tt.maxScore)
+			}
+		})
+	}
+
+	if EstimateStrength("rosebud-alpine").Guesses <= EstimateStrength("roe-alpine", "Jane Roe").Guesses {
+		t.Error("user inputs should make a password easier to guess")
+	}
+}
+
+func TestBloomFilter(t *testing.T) {
+	filter := NewBloomFilter(1000, 0.01)
+	for i := 0; i < 1000; i++ {
+		filter.Add(fmt.Sprintf("breached-%d", i))
+	}
+	for i := 0; i < 1000; i++ {
+		if !filter.Contains(fmt.Sprintf("breached-%d", i)) {
+			t.Fatalf("Contains(breached-%d) = false, bloom filters have no false negatives", i)
+		}
+	}
+	falsePositives := 0
+	for i := 0; i < 10000; i++ {
+		if filter.Contains(fmt.Sprintf("fresh-%d", i)) {
+			falsePositives++
+		}
+	}
+	if falsePositives > 300 {
+		t.Errorf("%d false positives in 10000, want about 1%%", falsePositives)
+	}
+
+	path := filepath.Join(t.TempDir(), "breached.bloom")
+	var buf bytes.Buffer
+	if _, err := filter.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo() failed: %v", err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadBloomFilterFile(path)
+	if err != nil {
+		t.Fatalf("LoadBloomFilterFile() failed: %v", err)
+	}
+	if !loaded.Contains("breached-42") || !reflect.DeepEqual(loaded.bits, filter.bits) {
+		t.Error("loaded filter differs from the written one")
+	}
+
+	if _, err := ReadBloomFilter(bytes.NewReader(buf.Bytes()[:len(buf.Bytes())-1])); !errors.Is(err, ErrInvalidBloomFilter) {
+		t.Errorf("ReadBloomFilter(truncated) error = %v, want ErrInvalidBloomFilter", err)
+	}
+	if _, err := ReadBloomFilter(strings.NewReader("not a bloom filter file")); !errors.Is(err, ErrInvalidBloomFilter) {
+		t.Errorf("ReadBloomFilter(garbage) error = %v, want ErrInvalidBloomFilter", err)
+	}
+
+	// A corrupt header must not allocate what it claims
+	huge := append(bloomMagic[:], 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xc0, 0, 0, 0, 7)
+	if _, err := ReadBloomFilter(bytes.NewReader(huge)); !errors.Is(err, ErrInvalidBloomFilter) {
+		t.Errorf("ReadBloomFilter(huge m) error = %v, want ErrInvalidBloomFilter", err)
+	}
+	large := append(bloomMagic[:], 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 7)
+	if _, err := ReadBloomFilter(bytes.NewReader(large)); !errors.Is(err, ErrInvalidBloomFilter) {
+		t.Errorf("ReadBloomFilter(truncated large filter) error = %v, want ErrInvalidBloomFilter", err)
+	}
+}
@@ -0,0 +1,298 @@
+package security
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// Strength is a zxcvbn-style estimate of how hard a password is to guess
+type Strength struct {
+	// Score is 0 (too guessable) to 4 (very unguessable)
+	Score int `json:"score"`
+	// Guesses is the estimated number of guesses of an informed attacker
+	Guesses float64 `json:"guesses"`
+	// Feedback suggests how to improve a weak password
+	Feedback []string `json:"feedback,omitempty"`
+}
+
+// Score thresholds on guesses, as in zxcvbn
+var strengthThresholds = []float64{1e3, 1e6, 1e8, 1e10}
+
+// commonPasswords are ranked by popularity; a match costs its rank in
+// guesses. The list is short on purpose: the breached-password filter
+// covers the long tail.
+var commonPasswords = []string{
+	"password", "123456", "qwerty", "letmein", "welcome", "admin", "login", "dragon",
+	"monkey", "football", "baseball", "master", "shadow", "sunshine", "princess", "iloveyou",
+	"trustno1", "superman", "batman", "starwars", "whatever", "freedom", "secret", "hello",
+	"charlie", "michael", "jordan", "jennifer", "hunter", "ranger", "buster", "thomas",
+	"tigger", "robert", "soccer", "hockey", "killer", "george", "summer", "winter",
+	"spring", "autumn", "flower", "cookie", "pepper", "ginger", "orange", "banana",
+	"computer", "internet", "google", "samsung", "pokemon", "mustang", "access", "matrix",
+	"love", "god", "money", "test", "pass", "user", "guest", "root",
+}
+
+// keyboardRows are scanned for runs of adjacent keys
+var keyboardRows = []string{"`1234567890-=", "qwertyuiop[]", "asdfghjkl;'", "zxcvbnm,./", "1qaz2wsx3edc4rfv5tgb6yhn7ujm8ik9ol0p"}
+
+// keyboardPatterns are keyboardRows typed forwards and backwards
+var keyboardPatterns = func() []string {
+	patterns := make([]string, 0, 2*len(keyboardRows))
+	for _, row := range keyboardRows {
+		patterns = append(patterns, row, reverse(row))
+	}
+	return patterns
+}()
+
+// longestKeyboardRow bounds the runs keyboardMatches looks for
+var longestKeyboardRow = func() int {
+	longest := 0
+	for _, row := range keyboardRows {
+		longest = max(longest, len(row))
+	}
+	return longest
+}()
+
+var leetSubstitutions = strings.NewReplacer("@", "a", "4", "a", "3", "e", "1", "i", "!", "i", "0", "o", "$", "s", "5", "s", "7", "t", "+", "t")
+
+// match is a guessable substring password[start:end]
+type match struct {
+	start, end int
+	guesses    float64
+	feedback   string
+}
+
+// EstimateStrength scores password. userInputs such as the user's name
+// and email are treated as the most likely dictionary words.
+func EstimateStrength(password string, userInputs ...string) Strength {
+	runes := []rune(password)
+	if len(runes) == 0 {
+		return Strength{Score: 0, Guesses: 1, Feedback: []string{"Choose a password"}}
+	}
+
+	dictionary := make(map[string]float64, len(commonPasswords)+len(userInputs))
+	for rank, word := range commonPasswords {
+		dictionary[word] = float64(rank + 1)
+	}
+	for _, input := range userInputs {
+		for _, word := range personalTokens(input) {
+			dictionary[word] = 1
+		}
+	}
+
+	var matches []match
+	matches = append(matches, dictionaryMatches(runes, dictionary)...)
+	matches = append(matches, sequenceMatches(runes)...)
+	matches = append(matches, repeatMatches(runes)...)
+	matches = append(matches, keyboardMatches(runes)...)
+	matches = append(matches, yearMatches(runes)...)
+
+	endingAt := make([][]int, len(runes)+1)
+	for m := range matches {
+		endingAt[matches[m].end] = append(endingAt[matches[m].end], m)
+	}
+
+	// best[i] is the cheapest guess count for runes[:i]; each character
+	// not covered by a match costs a brute-force factor of 10
+	best := make([]float64, len(runes)+1)
+	via := make([]*match, len(runes)+1)
+	best[0] = 1
+	for i := 1; i <= len(runes); i++ {
+		best[i] = best[i-1] * 10
+		via[i] = nil
+		for _, m := range endingAt[i] {
+			if g := best[matches[m].start] * matches[m].guesses; g < best[i] {
+				best[i] = g
+				via[i] = &matches[m]
+			}
+		}
+	}
+
+	guesses := best[len(runes)]
+	score := len(strengthThresholds)
+	for i, threshold := range strengthThresholds {
+		if guesses < threshold {
+			score = i
+			break
+		}
+	}
+
+	strength := Strength{Score: score, Guesses: guesses}
+	if score < 3 {
+		seen := map[string]bool{}
+		for i := len(runes); i > 0; {
+			if m := via[i]; m != nil {
+				if !seen[m.feedback] {
+					seen[m.feedback] = true
+					strength.Feedback = append(strength.Feedback, m.feedback)
+				}
+				i = m.start
+			} else {
+				i--
+			}
+		}
+		strength.Feedback = append(strength.Feedback, "Add another word or two; uncommon words are better")
+	}
+	return strength
+}
+
+// personalTokens splits a name or email into lowercase words of 3+ runes
+func personalTokens(input string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(input), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	tokens := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if len([]rune(field)) >= 3 {
+			tokens = append(tokens, field)
+		}
+	}
+	return tokens
+}
+
+// dictionaryMatches only tries substrings up to the longest word, so the
+// work grows linearly with the password
+func dictionaryMatches(runes []rune, dictionary map[string]float64) []match {
+	longest := 0
+	for word := range dictionary {
+		longest = max(longest, len([]rune(word)))
+	}
+
+	var matches []match
+	lower := []rune(strings.ToLower(string(runes)))
+	for i := 0; i < len(runes); i++ {
+		for j := i + 3; j <= min(len(runes), i+longest); j++ {
+			word := string(lower[i:j])
+			unleeted := leetSubstitutions.Replace(word)
+			rank, ok := dictionary[word]
+			leet := false
+			if !ok {
+				if rank, ok = dictionary[unleeted]; !ok {
+					continue
+				}
+				leet = true
+			}
+			guesses := rank * uppercaseVariations(runes[i:j])
+			if leet {
+				guesses *= 2
+			}
+			matches = append(matches, match{i, j, math.Max(guesses, 1), "Avoid common words, names and passwords"})
+		}
+	}
+	return matches
+}
+
+// uppercaseVariations is the extra work of guessing where capitals are
+func uppercaseVariations(word []rune) float64 {
+	upper := 0
+	for _, r := range word {
+		if unicode.IsUpper(r) {
+			upper++
+		}
+	}
+	switch {
+	case upper == 0:
+		return 1
+	case upper == len(word), upper == 1 && unicode.IsUpper(word[0]):
+		// All caps and a capitalised first letter are tried first
+		return 2
+	default:
+		return float64(len(word) * upper)
+	}
+}
+
+func sequenceMatches(runes []rune) []match {
+	var matches []match
+	for i := 0; i+2 < len(runes); {
+		delta := runes[i+1] - runes[i]
+		if (delta != 1 && delta != -1) || !sameClass(runes[i], runes[i+1]) {
+			i++
+			continue
+		}
+		j := i + 1
+		for j+1 < len(runes) && runes[j+1]-runes[j] == delta && sameClass(runes[j], runes[j+1]) {
+			j++
+		}
+		if length := j - i + 1; length >= 3 {
+			base := 26.0
+			if unicode.IsDigit(runes[i]) {
+				base = 10
+			}
+			if strings.ContainsRune("aAzZ019", runes[i]) {
+				base = 4
+			}
+			matches = append(matches, match{i, j + 1, base * float64(length), "Avoid sequences like abc or 6543"})
+		}
+		i = j
+	}
+	return matches
+}
+
+func sameClass(a, b rune) bool {
+	return (unicode.IsDigit(a) && unicode.IsDigit(b)) ||
+		(unicode.IsLower(a) && unicode.IsLower(b)) ||
+		(unicode.IsUpper(a) && unicode.IsUpper(b))
+}
+
+func repeatMatches(runes []rune) []match {
+	var matches []match
+	for i := 0; i < len(runes); {
+		j := i
+		for j+1 < len(runes) && runes[j+1] == runes[i] {
+			j++
+		}
+		if length := j - i + 1; length >= 3 {
+			matches = append(matches, match{i, j + 1, 12 * float64(length), `Avoid repeats like "aaa"`})
+		}
+		i = j + 1
+	}
+	return matches
+}
+
+// keyboardMatches only tries runs as long as a keyboard row, so the work
+// grows linearly with the password
+func keyboardMatches(runes []rune) []match {
+	var matches []match
+	lower := []rune(strings.ToLower(string(runes)))
+	for i := 0; i < len(lower); i++ {
+		for j := min(len(lower), i+longestKeyboardRow); j >= i+4; j-- {
+			run := string(lower[i:j])
+			for _, row := range keyboardPatterns {
+				if strings.Contains(row, run) {
+					matches = append(matches, match{i, j, 40 * float64(len(run)), "Avoid keyboard patterns like qwerty"})
+					break
+				}
+			}
+		}
+	}
+	return matches
+}
+
+func yearMatches(runes []rune) []match {
+	var matches []match
+	for i := 0; i+4 <= len(runes); i++ {
+		s := string(runes[i : i+4])
+		if (strings.HasPrefix(s, "19") || strings.HasPrefix(s, "20")) && isDigits(s) {
+			matches = append(matches, match{i, i + 4, 120, "Avoid years and dates that are associated with you"})
+		}
+	}
+	return matches
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func reverse(s string) string {
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
@@ -0,0 +1,43 @@
+package security
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSignedToken(t *testing.T) {
+	key := []byte("token-key")
+	token, err := NewSignedToken(key, "reset_password")
+	if err != nil {
+		t.Fatalf("NewSignedToken() failed: %v", err)
+	}
+	if strings.ContainsAny(token, "+/=") {
+		t.Errorf("token %q is not URL-safe", token)
+	}
+	if !VerifySignedToken(key, "reset_password", token) {
+		t.Errorf("VerifySignedToken() rejected its own token")
+	}
+
+	payload, signature, _ := strings.Cut(token, ".")
+	other, _ := NewSignedToken(key, "reset_password")
+	otherPayload, _, _ := strings.Cut(other, ".")
+	for _, tt := range []struct {
+		name, key, purpose, token string
+	}{
+		{"other purpose", "token-key", "verify_email", token},
+		{"other key", "other-key", "reset_password", token},
+		{"swapped payload", "token-key", "reset_password", otherPayload + "." + signature},
+		{"no signature", "token-key", "reset_password", payload},
+		{"bad encoding", "token-key", "reset_password", payload + ".!!"},
+		{"truncated", "token-key", "reset_password", token[:len(token)-2]},
+		{"empty", "token-key", "reset_password", ""},
+	} {
+		if VerifySignedToken([]byte(tt.key), tt.purpose, tt.token) {
+			t.Errorf("VerifySignedToken(%s) = true", tt.name)
+		}
+	}
+
+	if token == other || HashToken(token) == HashToken(other) || len(HashToken(token)) != 64 {
+		t.Errorf("tokens or hashes collide: %s %s", HashToken(token), HashToken(other))
+	}
+}
@@ -0,0 +1,177 @@
+package security
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTP defaults match what authenticator apps assume when the
+// provisioning URI omits them
+const (
+	DefaultTOTPDigits = 6
+	DefaultTOTPPeriod = 30 * time.Second
+	// DefaultTOTPSkew accepts codes one step before or after now
+	DefaultTOTPSkew = 1
+	// totpSecretSize is the RFC 4226 recommended 160 bits
+	totpSecretSize = 20
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// TOTP generates and checks RFC 6238 time-based one-time passwords with
+// HMAC-SHA1, the algorithm every authenticator app supports
+type TOTP struct {
+	Secret []byte
+	Digits int
+	Period time.Duration
+}
+
+// NewTOTP creates a TOTP with a random secret and default parameters
+func NewTOTP() (*TOTP, error) {
+	secret := make([]byte, totpSecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate TOTP secret: %v", err)
+	}
+	return &TOTP{Secret: secret, Digits: DefaultTOTPDigits, Period: DefaultTOTPPeriod}, nil
+}
+
+// ParseTOTP restores a TOTP from the base32 secret of EncodedSecret
+func ParseTOTP(encoded string) (*TOTP, error) {
+	secret, err := totpEncoding.DecodeString(strings.ToUpper(strings.TrimRight(encoded, "=")))
+	if err != nil || len(secret) == 0 {
+		return nil, fmt.Errorf("invalid TOTP secret")
+	}
+	return &TOTP{Secret: secret, Digits: DefaultTOTPDigits, Period: DefaultTOTPPeriod}, nil
+}
+
+// EncodedSecret is the unpadded base32 secret users type into apps
+func (t *TOTP) EncodedSecret() string {
+	return totpEncoding.EncodeToString(t.Secret)
+}
+
+// ProvisioningURI is the otpauth:// URI shown as a QR code at enrolment
+func (t *TOTP) ProvisioningURI(issuer, account string) string {
+	params := url.Values{}
+	params.Set("secret", t.EncodedSecret())
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(t.Digits))
+	params.Set("period", fmt.Sprint(int(t.Period/time.Second)))
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(account)
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+// Step is the RFC 6238 time step counter at at
+func (t *TOTP) Step(at time.Time) int64 {
+	return at.Unix() / int64(t.Period/time.Second)
+}
+
+// Code returns the code for at
+func (t *TOTP) Code(at time.Time) string {
+	return t.codeAt(t.Step(at))
+}
+
+// codeAt is the RFC 4226 HOTP value of counter
+func (t *TOTP) codeAt(counter int64) string {
+	message := make([]byte, 8)
+	binary.BigEndian.PutUint64(message, uint64(counter))
+	mac := hmac.New(sha1.New, t.Secret)
+	mac.Write(message)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	modulus := uint32(1)
+	for i := 0; i < t.Digits; i++ {
+		modulus *= 10
+	}
+	return fmt.Sprintf("%0*d", t.Digits, value%modulus)
+}
+
+// Verify checks code against the steps within skew of at and returns the
+// matching step. Callers store it and pass it as after next time, so each
+// code works once.
+func (t *TOTP) Verify(code string, at time.Time, skew int, after int64) (step int64, ok bool) {
+	code = strings.ReplaceAll(code, " ", "")
+	if len(code) != t.Digits {
+		return 0, false
+	}
+	now := t.Step(at)
+	for delta := -int64(skew); delta <= int64(skew); delta++ {
+		candidate := now + delta
+		if candidate <= after {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(t.codeAt(candidate)), []byte(code)) == 1 {
+			return candidate, true
+		}
+	}
+	return 0, false
+}
+
+// recoveryAlphabet avoids characters that are easily confused
+const recoveryAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+// GenerateRecoveryCodes returns n one-time codes such as "k7mq-2xbd-9tpe".
+// Store them hashed, e.g. with PasswordService.HashPassword.
+func GenerateRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, n)
+	for i := range codes {
+		var code strings.Builder
+		for j := 0; j < 12; j++ {
+			if j > 0 && j%4 == 0 {
+				code.WriteByte('-')
+			}
+			c, err := randomRecoveryChar()
+			if err != nil {
+				return nil, err
+			}
+			code.WriteByte(c)
+		}
+		codes[i] = code.String()
+	}
+	return codes, nil
+}
+
+// randomRecoveryChar draws uniformly from recoveryAlphabet, rejecting
+// bytes that would bias the modulo
+func randomRecoveryChar() (byte, error) {
+	limit := 256 - 256%len(recoveryAlphabet)
+	b := make([]byte, 1)
+	for {
+		if _, err := rand.Read(b); err != nil {
+			return 0, fmt.Errorf("failed to generate recovery code: %v", err)
+		}
+		if int(b[0]) < limit {
+			return recoveryAlphabet[int(b[0])%len(recoveryAlphabet)], nil
+		}
+	}
+}
+
+// NormalizeRecoveryCode lowercases code and restores its dashes, so
+// users may type it in any case and with or without dashes
+func NormalizeRecoveryCode(code string) string {
+	var compact strings.Builder
+	for _, r := range strings.ToLower(code) {
+		if r != '-' && r != ' ' {
+			compact.WriteRune(r)
+		}
+	}
+	plain := compact.String()
+	var normalized strings.Builder
+	for i, r := range plain {
+		if i > 0 && i%4 == 0 {
+			normalized.WriteByte('-')
+		}
+		normalized.WriteRune(r)
+	}
+	return normalized.String()
+}
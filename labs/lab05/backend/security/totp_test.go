@@ -0,0 +1,90 @@
+package security
+
+import (
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestTOTP_RFC6238Vectors(t *testing.T) {
+	totp := &TOTP{Secret: []byte("12345678901234567890"), Digits: 8, Period: 30 * time.Second}
+	vectors := map[int64]string{
+		59:          "94287082",
+		1111111109:  "07081804",
+		1111111111:  "14050471",
+		1234567890:  "89005924",
+		2000000000:  "69279037",
+		20000000000: "65353130",
+	}
+	for unix, want := range vectors {
+		if got := totp.Code(time.Unix(unix, 0)); got != want {
+			t.Errorf("Code(%d) = %s, want %s", unix, got, want)
+		}
+	}
+}
+
+func TestTOTP_Verify(t *testing.T) {
+	totp, err := NewTOTP()
+	if err != nil {
+		t.Fatalf("NewTOTP() failed: %v", err)
+	}
+	now := time.Date(2024, 1, 1, 12, 0, 10, 0, time.UTC)
+	code := totp.Code(now)
+
+	step, ok := totp.Verify(code, now, DefaultTOTPSkew, 0)
+	if !ok || step != totp.Step(now) {
+		t.Fatalf("Verify(current) = %d, %v", step, ok)
+	}
+	if _, ok := totp.Verify(code, now, DefaultTOTPSkew, step); ok {
+		t.Error("Verify() must not accept a code twice")
+	}
+	if _, ok := totp.Verify(code, now.Add(30*time.Second), DefaultTOTPSkew, 0); !ok {
+		t.Error("Verify() should accept the previous step within the skew")
+	}
+	if _, ok := totp.Verify(code, now.Add(90*time.Second), DefaultTOTPSkew, 0); ok {
+		t.Error("Verify() should reject codes outside the skew")
+	}
+	if _, ok := totp.Verify("12345", now, DefaultTOTPSkew, 0); ok {
+		t.Error("Verify() should reject codes of the wrong length")
+	}
+
+	parsed, err := ParseTOTP(totp.EncodedSecret())
+	if err != nil || parsed.Code(now) != code {
+		t.Errorf("ParseTOTP(EncodedSecret()) = %v, code mismatch", err)
+	}
+	if _, err := ParseTOTP("not base32!"); err == nil {
+		t.Error("ParseTOTP() should reject invalid secrets")
+	}
+
+	uri, err := url.Parse(totp.ProvisioningURI("Lab 05", "jane@example.com"))
+	if err != nil {
+		t.Fatalf("ProvisioningURI() is not a URL: %v", err)
+	}
+	query := uri.Query()
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/Lab 05:jane@example.com" ||
+		query.Get("secret") != totp.EncodedSecret() || query.Get("issuer") != "Lab 05" || query.Get("digits") != "6" {
+		t.Errorf("ProvisioningURI() = %s", uri)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatalf("GenerateRecoveryCodes() failed: %v", err)
+	}
+	format := regexp.MustCompile(`^[a-z2-9]{4}-[a-z2-9]{4}-[a-z2-9]{4}$`)
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if !format.MatchString(code) || seen[code] {
+			t.Errorf("recovery code %q is malformed or repeated", code)
+		}
+		seen[code] = true
+	}
+
+	for _, typed := range []string{"K7MQ-2XBD-9TPE", "k7mq2xbd9tpe", "k7mq 2xbd 9tpe"} {
+		if got := NormalizeRecoveryCode(typed); got != "k7mq-2xbd-9tpe" {
+			t.Errorf("NormalizeRecoveryCode(%q) = %q", typed, got)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package userdomain
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrIdentityNotFound indicates no user is linked to the external identity
+var ErrIdentityNotFound = errors.New("identity not found")
+
+// ErrIdentityLinked indicates the external identity already belongs to a
+// user, or the user already has an identity at that provider
+var ErrIdentityLinked = errors.New("identity already linked")
+
+// Identity links an account at an external identity provider, such as an
+// OpenID Connect provider, to a user
+type Identity struct {
+	Provider string `json:"provider"`
+	// Subject is the provider's stable ID of the account
+	Subject string `json:"subject"`
+	UserID  int    `json:"-"`
+	// Email is the provider's email for the account when it was linked
+	Email     string    `json:"email,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// IdentityRepository persists identities. A user has at most one identity
+// per provider.
+type IdentityRepository interface {
+	Link(ctx context.Context, identity *Identity) error
+	GetIdentity(ctx context.Context, provider, subject string) (*Identity, error)
+	// ListIdentities returns the identities of a user sorted by provider
+	ListIdentities(ctx context.Context, userID int) ([]Identity, error)
+	Unlink(ctx context.Context, userID int, provider string) error
+}
+
+// MemoryIdentityRepository is an IdentityRepository for tests and
+// single-process demos
+type MemoryIdentityRepository struct {
+	mu         sync.RWMutex
+	identities []Identity
+}
+
+// NewMemoryIdentityRepository creates an empty repository
+func NewMemoryIdentityRepository() *MemoryIdentityRepository {
+	return &MemoryIdentityRepository{}
+}
+
+func (r *MemoryIdentityRepository) Link(ctx context.Context, identity *Identity) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.identities {
+		if existing.Provider == identity.Provider &&
+			(existing.Subject == identity.Subject || existing.UserID == identity.UserID) {
+			return ErrIdentityLinked
+		}
+	}
+	r.identities = append(r.identities, *identity)
+	return nil
+}
+
+func (r *MemoryIdentityRepository) GetIdentity(ctx context.Context, provider, subject string) (*Identity, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, identity := range r.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			return &identity, nil
+		}
+	}
+	return nil, ErrIdentityNotFound
+}
+
+func (r *MemoryIdentityRepository) ListIdentities(ctx context.Context, userID int) ([]Identity, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var identities []Identity
+	for _, identity := range r.identities {
+		if identity.UserID == userID {
+			identities = append(identities, identity)
+		}
+	}
+	sort.Slice(identities, func(i, j int) bool { return identities[i].Provider < identities[j].Provider })
+	return identities, nil
+}
+
+func (r *MemoryIdentityRepository) Unlink(ctx context.Context, userID int, provider string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, identity := range r.identities {
+		if identity.UserID == userID && identity.Provider == provider {
+			r.identities = append(r.identities[:i], r.identities[i+1:]...)
+			return nil
+		}
+	}
+	return ErrIdentityNotFound
+}
@@ -0,0 +1,107 @@
+package userdomain
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// identitySchema lets a provider subject link to one user, and a user
+// link one subject per provider
+const identitySchema = `CREATE TABLE IF NOT EXISTS user_identities (
+	provider VARCHAR(64) NOT NULL,
+	subject VARCHAR(255) NOT NULL,
+	user_id INTEGER NOT NULL,
+	email VARCHAR(255) NOT NULL DEFAULT '',
+	created_at INTEGER NOT NULL,
+	PRIMARY KEY (provider, subject),
+	UNIQUE (user_id, provider)
+)`
+
+// SQLIdentityRepository is an IdentityRepository over a user_identities
+// table next to the users table of SQLRepository. Deleting a user does
+// not delete their identities; unlink them first.
+type SQLIdentityRepository struct {
+	db *sql.DB
+}
+
+// NewSQLIdentityRepository creates the user_identities table if needed
+func NewSQLIdentityRepository(db *sql.DB) (*SQLIdentityRepository, error) {
+	if db == nil {
+		return nil, errors.New("db must not be nil")
+	}
+	if _, err := db.Exec(identitySchema); err != nil {
+		return nil, fmt.Errorf("failed to create user_identities: %v", err)
+	}
+	return &SQLIdentityRepository{db: db}, nil
+}
+
+func (r *SQLIdentityRepository) Link(ctx context.Context, identity *Identity) error {
+	result, err := r.db.ExecContext(ctx,
+		`INSERT INTO user_identities (provider, subject, user_id, email, created_at) VALUES (?, ?, ?, ?, ?)
+		 ON CONFLICT DO NOTHING`,
+		identity.Provider, identity.Subject, identity.UserID, identity.Email, identity.CreatedAt.UnixNano(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to link identity: %v", err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to link identity: %v", err)
+	} else if n == 0 {
+		return ErrIdentityLinked
+	}
+	return nil
+}
+
+func (r *SQLIdentityRepository) GetIdentity(ctx context.Context, provider, subject string) (*Identity, error) {
+	identity := Identity{Provider: provider, Subject: subject}
+	var createdAt int64
+	err := r.db.QueryRowContext(ctx,
+		`SELECT user_id, email, created_at FROM user_identities WHERE provider = ? AND subject = ?`, provider, subject,
+	).Scan(&identity.UserID, &identity.Email, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrIdentityNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get identity: %v", err)
+	}
+	identity.CreatedAt = time.Unix(0, createdAt)
+	return &identity, nil
+}
+
+func (r *SQLIdentityRepository) ListIdentities(ctx context.Context, userID int) ([]Identity, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT provider, subject, email, created_at FROM user_identities WHERE user_id = ? ORDER BY provider`, userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list identities: %v", err)
+	}
+	defer rows.Close()
+
+	var identities []Identity
+	for rows.Next() {
+		identity := Identity{UserID: userID}
+		var createdAt int64
+		if err := rows.Scan(&identity.Provider, &identity.Subject, &identity.Email, &createdAt); err != nil {
+			return nil, fmt.Errorf("failed to scan identity: %v", err)
+		}
+		identity.CreatedAt = time.Unix(0, createdAt)
+		identities = append(identities, identity)
+	}
+	return identities, rows.Err()
+}
+
+func (r *SQLIdentityRepository) Unlink(ctx context.Context, userID int, provider string) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM user_identities WHERE user_id = ? AND provider = ?`, userID, provider)
+	if err != nil {
+		return fmt.Errorf("failed to unlink identity: %v", err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to unlink identity: %v", err)
+	} else if n == 0 {
+		return ErrIdentityNotFound
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package userdomain
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+)
+
+// ErrUserNotFound indicates no user has the requested ID or email
+var ErrUserNotFound = errors.New("user not found")
+
+// ErrEmailTaken indicates another user already has the email
+var ErrEmailTaken = errors.New("email already registered")
+
+// Repository persists users. It stores Password as given, so callers
+// hash it first; emails are unique and compared case-insensitively.
+type Repository interface {
+	// Create stores user and assigns its ID
+	Create(ctx context.Context, user *User) error
+	GetByID(ctx context.Context, id int) (*User, error)
+	GetByEmail(ctx context.Context, email string) (*User, error)
+	// Update stores every field of an existing user
+	Update(ctx context.Context, user *User) error
+	Delete(ctx context.Context, id int) error
+}
+
+// MemoryRepository is a Repository for tests and single-process demos
+type MemoryRepository struct {
+	mu     sync.RWMutex
+	users  map[int]User
+	nextID int
+}
+
+// NewMemoryRepository creates an empty repository
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{users: make(map[int]User), nextID: 1}
+}
+
+func (r *MemoryRepository) Create(ctx context.Context, user *User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.emailTaken(user.Email, 0) {
+		return ErrEmailTaken
+	}
+	user.ID = r.nextID
+	r.nextID++
+	r.users[user.ID] = clone(user)
+	return nil
+}
+
+func (r *MemoryRepository) GetByID(ctx context.Context, id int) (*User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	user, ok := r.users[id]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	user = clone(&user)
+	return &user, nil
+}
+
+func (r *MemoryRepository) GetByEmail(ctx context.Context, email string) (*User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, user := range r.users {
+		if strings.EqualFold(user.Email, strings.TrimSpace(email)) {
+			user = clone(&user)
+			return &user, nil
+		}
+	}
+	return nil, ErrUserNotFound
+}
+
+func (r *MemoryRepository) Update(ctx context.Context, user *User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.users[user.ID]; !ok {
+		return ErrUserNotFound
+	}
+	if r.emailTaken(user.Email, user.ID) {
+		return ErrEmailTaken
+	}
+	r.users[user.ID] = clone(user)
+	return nil
+}
+
+func (r *MemoryRepository) Delete(ctx context.Context, id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.users[id]; !ok {
+		return ErrUserNotFound
+	}
+	delete(r.users, id)
+	return nil
+}
+
+// emailTaken reports whether a user other than exceptID has email
+func (r *MemoryRepository) emailTaken(email string, exceptID int) bool {
+	for id, user := range r.users {
+		if id != exceptID && strings.EqualFold(user.Email, email) {
+			return true
+		}
+	}
+	return false
+}
+
+// clone copies user so that callers cannot modify stored slices
+func clone(user *User) User {
+	copied := *user
+	copied.RecoveryCodes = append([]string(nil), user.RecoveryCodes...)
+	return copied
+}
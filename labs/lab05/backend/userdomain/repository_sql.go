@@ -0,0 +1,176 @@
+package userdomain
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// userSchema is the current users table; userMigrations bring older
+// ones up to it. Emails are stored lowercased, which keeps the UNIQUE
+// constraint case-insensitive.
+const userSchema = `CREATE TABLE IF NOT EXISTS users (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	email VARCHAR(255) NOT NULL UNIQUE,
+	name VARCHAR(50) NOT NULL,
+	password_hash VARCHAR(255) NOT NULL,
+	created_at INTEGER NOT NULL,
+	updated_at INTEGER NOT NULL,
+	totp_secret VARCHAR(64) NOT NULL DEFAULT '',
+	totp_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+	totp_last_step INTEGER NOT NULL DEFAULT 0,
+	recovery_codes TEXT NOT NULL DEFAULT '',
+	email_verified BOOLEAN NOT NULL DEFAULT FALSE,
+	pending_email VARCHAR(255) NOT NULL DEFAULT ''
+)`
+
+// userMigrations add columns that tables created by earlier versions lack
+var userMigrations = []struct{ column, definition string }{
+	{"totp_secret", "VARCHAR(64) NOT NULL DEFAULT ''"},
+	{"totp_enabled", "BOOLEAN NOT NULL DEFAULT FALSE"},
+	{"totp_last_step", "INTEGER NOT NULL DEFAULT 0"},
+	{"recovery_codes", "TEXT NOT NULL DEFAULT ''"},
+	{"email_verified", "BOOLEAN NOT NULL DEFAULT FALSE"},
+	{"pending_email", "VARCHAR(255) NOT NULL DEFAULT ''"},
+}
+
+// userColumns are selected in this order by get
+const userColumns = `id, email, name, password_hash, created_at, updated_at,
+	totp_secret, totp_enabled, totp_last_step, recovery_codes, email_verified, pending_email`
+
+// SQLRepository is a Repository over a users table. Queries use ?
+// placeholders and ON CONFLICT, which SQLite supports; timestamps are
+// stored as Unix nanoseconds and recovery code hashes one per line.
+type SQLRepository struct {
+	db *sql.DB
+}
+
+// NewSQLRepository creates the users table if needed
+func NewSQLRepository(db *sql.DB) (*SQLRepository, error) {
+	if db == nil {
+		return nil, errors.New("db must not be nil")
+	}
+	if _, err := db.Exec(userSchema); err != nil {
+		return nil, fmt.Errorf("failed to create users: %v", err)
+	}
+	for _, migration := range userMigrations {
+		if _, err := db.Exec(`SELECT ` + migration.column + ` FROM users LIMIT 0`); err == nil {
+			continue
+		}
+		if _, err := db.Exec(`ALTER TABLE users ADD COLUMN ` + migration.column + ` ` + migration.definition); err != nil {
+			return nil, fmt.Errorf("failed to add users.%s: %v", migration.column, err)
+		}
+	}
+	return &SQLRepository{db: db}, nil
+}
+
+func (r *SQLRepository) Create(ctx context.Context, user *User) error {
+	result, err := r.db.ExecContext(ctx,
+		`INSERT INTO users (email, name, password_hash, created_at, updated_at,
+			totp_secret, totp_enabled, totp_last_step, recovery_codes, email_verified, pending_email)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		 ON CONFLICT (email) DO NOTHING`,
+		normalizeEmail(user.Email), user.Name, user.Password, user.CreatedAt.UnixNano(), user.UpdatedAt.UnixNano(),
+		user.TOTPSecret, user.TOTPEnabled, user.TOTPLastStep, strings.Join(user.RecoveryCodes, "\n"),
+		user.EmailVerified, normalizeEmail(user.PendingEmail),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create user: %v", err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to create user: %v", err)
+	} else if n == 0 {
+		return ErrEmailTaken
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to read user ID: %v", err)
+	}
+	user.ID = int(id)
+	return nil
+}
+
+func (r *SQLRepository) GetByID(ctx context.Context, id int) (*User, error) {
+	return r.get(ctx, `WHERE id = ?`, id)
+}
+
+func (r *SQLRepository) GetByEmail(ctx context.Context, email string) (*User, error) {
+	return r.get(ctx, `WHERE email = ?`, normalizeEmail(email))
+}
+
+func (r *SQLRepository) Update(ctx context.Context, user *User) error {
+	var taken int
+	err := r.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM users WHERE email = ? AND id <> ?`, normalizeEmail(user.Email), user.ID,
+	).Scan(&taken)
+	if err != nil {
+		return fmt.Errorf("failed to update user: %v", err)
+	}
+	if taken > 0 {
+		return ErrEmailTaken
+	}
+
+	result, err := r.db.ExecContext(ctx,
+		`UPDATE users SET email = ?, name = ?, password_hash = ?, updated_at = ?,
+			totp_secret = ?, totp_enabled = ?, totp_last_step = ?, recovery_codes = ?,
+			email_verified = ?, pending_email = ?
+		 WHERE id = ?`,
+		normalizeEmail(user.Email), user.Name, user.Password, user.UpdatedAt.UnixNano(),
+		user.TOTPSecret, user.TOTPEnabled, user.TOTPLastStep, strings.Join(user.RecoveryCodes, "\n"),
+		user.EmailVerified, normalizeEmail(user.PendingEmail), user.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update user: %v", err)
+	}
+	return requireRow(result)
+}
+
+func (r *SQLRepository) Delete(ctx context.Context, id int) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM users WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete user: %v", err)
+	}
+	return requireRow(result)
+}
+
+func (r *SQLRepository) get(ctx context.Context, where string, arg interface{}) (*User, error) {
+	var user User
+	var createdAt, updatedAt int64
+	var recoveryCodes string
+	err := r.db.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users `+where, arg).Scan(
+		&user.ID, &user.Email, &user.Name, &user.Password, &createdAt, &updatedAt,
+		&user.TOTPSecret, &user.TOTPEnabled, &user.TOTPLastStep, &recoveryCodes,
+		&user.EmailVerified, &user.PendingEmail,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %v", err)
+	}
+	user.CreatedAt = time.Unix(0, createdAt)
+	user.UpdatedAt = time.Unix(0, updatedAt)
+	if recoveryCodes != "" {
+		user.RecoveryCodes = strings.Split(recoveryCodes, "\n")
+	}
+	return &user, nil
+}
+
+// requireRow maps an update of no rows to ErrUserNotFound
+func requireRow(result sql.Result) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to read affected rows: %v", err)
+	}
+	if n == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,116 @@
+package userdomain
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"lab05/internal/sqlitetest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newSQLRepository(t *testing.T) *SQLRepository {
+	repo, err := NewSQLRepository(sqlitetest.Open(t))
+	require.NoError(t, err)
+	return repo
+}
+
+func TestRepositories(t *testing.T) {
+	repos := map[string]func(t *testing.T) Repository{
+		"memory": func(t *testing.T) Repository { return NewMemoryRepository() },
+		"sql":    func(t *testing.T) Repository { return newSQLRepository(t) },
+	}
+
+	for name, newRepo := range repos {
+		t.Run(name, func(t *testing.T) {
+			repo := newRepo(t)
+			ctx := context.Background()
+
+			user, err := NewUser("jane@example.com", "Jane Roe", "Password123")
+			require.NoError(t, err)
+			user.Password = "$2a$10$hash"
+			require.NoError(t, repo.Create(ctx, user))
+			assert.NotZero(t, user.ID)
+
+			other, _ := NewUser("JANE@example.com", "Jane Two", "Password123")
+			assert.ErrorIs(t, repo.Create(ctx, other), ErrEmailTaken)
+
+			got, err := repo.GetByEmail(ctx, " Jane@Example.com ")
+			require.NoError(t, err)
+			assert.Equal(t, user.ID, got.ID)
+			assert.Equal(t, "$2a$10$hash", got.Password)
+			assert.True(t, user.CreatedAt.Equal(got.CreatedAt))
+
+			second, _ := NewUser("john@example.com", "John Doe", "Password123")
+			require.NoError(t, repo.Create(ctx, second))
+			second.Email = "jane@example.com"
+			assert.ErrorIs(t, repo.Update(ctx, second), ErrEmailTaken)
+
+			require.NoError(t, got.UpdateName("Jane Q. Roe"))
+			require.NoError(t, repo.Update(ctx, got))
+			got, err = repo.GetByID(ctx, user.ID)
+			require.NoError(t, err)
+			assert.Equal(t, "Jane Q. Roe", got.Name)
+
+			require.NoError(t, got.RequestEmailChange("Jane@New.example.com"))
+			require.NoError(t, repo.Update(ctx, got))
+			got, err = repo.GetByID(ctx, user.ID)
+			require.NoError(t, err)
+			assert.Equal(t, "jane@new.example.com", got.PendingEmail)
+			assert.False(t, got.EmailVerified)
+
+			require.NoError(t, repo.Delete(ctx, user.ID))
+			_, err = repo.GetByID(ctx, user.ID)
+			assert.ErrorIs(t, err, ErrUserNotFound)
+			assert.ErrorIs(t, repo.Delete(ctx, user.ID), ErrUserNotFound)
+			assert.ErrorIs(t, repo.Update(ctx, user), ErrUserNotFound)
+		})
+	}
+}
+
+func newSQLIdentityRepository(t *testing.T) *SQLIdentityRepository {
+	repo, err := NewSQLIdentityRepository(sqlitetest.Open(t))
+	require.NoError(t, err)
+	return repo
+}
+
+func TestIdentityRepositories(t *testing.T) {
+	repos := map[string]func(t *testing.T) IdentityRepository{
+		"memory": func(t *testing.T) IdentityRepository { return NewMemoryIdentityRepository() },
+		"sql":    func(t *testing.T) IdentityRepository { return newSQLIdentityRepository(t) },
+	}
+
+	for name, newRepo := range repos {
+		t.Run(name, func(t *testing.T) {
+			repo := newRepo(t)
+			ctx := context.Background()
+			now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+			require.NoError(t, repo.Link(ctx, &Identity{Provider: "google", Subject: "g-1", UserID: 1, Email: "jane@example.com", CreatedAt: now}))
+			require.NoError(t, repo.Link(ctx, &Identity{Provider: "github", Subject: "h-1", UserID: 1, CreatedAt: now}))
+			require.NoError(t, repo.Link(ctx, &Identity{Provider: "google", Subject: "g-2", UserID: 2, CreatedAt: now}))
+			assert.ErrorIs(t, repo.Link(ctx, &Identity{Provider: "google", Subject: "g-1", UserID: 3}), ErrIdentityLinked)
+			assert.ErrorIs(t, repo.Link(ctx, &Identity{Provider: "google", Subject: "g-3", UserID: 1}), ErrIdentityLinked)
+
+			got, err := repo.GetIdentity(ctx, "google", "g-1")
+			require.NoError(t, err)
+			assert.Equal(t, 1, got.UserID)
+			assert.Equal(t, "jane@example.com", got.Email)
+			assert.True(t, now.Equal(got.CreatedAt))
+			_, err = repo.GetIdentity(ctx, "github", "g-1")
+			assert.ErrorIs(t, err, ErrIdentityNotFound)
+
+			identities, err := repo.ListIdentities(ctx, 1)
+			require.NoError(t, err)
+			require.Len(t, identities, 2)
+			assert.Equal(t, "github", identities[0].Provider)
+
+			require.NoError(t, repo.Unlink(ctx, 1, "google"))
+			assert.ErrorIs(t, repo.Unlink(ctx, 1, "google"), ErrIdentityNotFound)
+			_, err = repo.GetIdentity(ctx, "google", "g-1")
+			assert.ErrorIs(t, err, ErrIdentityNotFound)
+		})
+	}
+}
@@ -2,9 +2,11 @@ package userdomain
 
 import (
 	"errors"
-	_ "regexp"
+	"regexp"
 	"strings"
 	"time"
+
+	"lab05/security"
 )
 
 // User represents a user entity in the domain
@@ -15,54 +17,92 @@ type User struct {
 	Password  string    `json:"-"` // Never serialize password
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+
+	// EmailVerified is set once the user follows a link sent to Email
+	EmailVerified bool `json:"email_verified"`
+	// PendingEmail replaces Email once the user follows a link sent to it
+	PendingEmail string `json:"pending_email,omitempty"`
+
+	// TOTPSecret is the base32 TOTP secret. It is set without TOTPEnabled
+	// while enrolment awaits its first code.
+	TOTPSecret  string `json:"-"`
+	TOTPEnabled bool   `json:"totp_enabled"`
+	// TOTPLastStep is the time step of the last accepted code, so that no
+	// code works twice
+	TOTPLastStep int64 `json:"-"`
+	// RecoveryCodes are the hashes of unused recovery codes
+	RecoveryCodes []string `json:"-"`
 }
 
-// TODO: Implement NewUser function
+// PasswordPolicy decides which passwords users may choose. Applications
+// may replace it, for example with security.RecommendedPolicy and a
+// breached-password filter, before creating users.
+var PasswordPolicy = security.AccountPolicy()
+
+var emailPattern = regexp.MustCompile(`^[a-zA-Z0-9._%+\-]+@[a-zA-Z0-9.\-]+\.[a-zA-Z]{2,}$`)
+
 // NewUser creates a new user with validation
 // Requirements:
 // - Email must be valid format
-// - Name must be 2-51 characters
-// - Password must be at least 8 characters
+// - Name must be 2-50 characters
+// - Password must satisfy PasswordPolicy and not contain the name or email
 // - CreatedAt and UpdatedAt should be set to current time
 func NewUser(email, name, password string) (*User, error) {
-	// TODO: Implement this function
-	// Hint: Use ValidateEmail, ValidateName, ValidatePassword helper functions
-	return nil, errors.New("not implemented")
+	now := time.Now()
+	user := &User{
+		Email:     normalizeEmail(email),
+		Name:      strings.TrimSpace(name),
+		Password:  password,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := user.Validate(); err != nil {
+		return nil, err
+	}
+	return user, nil
 }
 
-// TODO: Implement Validate method
-// Validate checks if the user data is valid
+// Validate checks if the user data is valid. Password must still be the
+// plain password, so validate before hashing it.
 func (u *User) Validate() error {
-	// TODO: Implement validation logic
-	// Check email, name, and password validity
-	return errors.New("not implemented")
+	if err := ValidateEmail(u.Email); err != nil {
+		return err
+	}
+	if err := ValidateName(u.Name); err != nil {
+		return err
+	}
+	return PasswordPolicy.Validate(u.Password, u.Name, u.Email)
 }
 
-// TODO: Implement ValidateEmail function
 // ValidateEmail checks if email format is valid
 func ValidateEmail(email string) error {
-	// TODO: Implement email validation
-	// Use regex pattern to validate email format
-	// Email should not be empty and should match standard email pattern
-	return errors.New("not implemented")
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return errors.New("email cannot be empty")
+	}
+	if !emailPattern.MatchString(email) {
+		return errors.New("invalid email format")
+	}
+	return nil
 }
 
-// TODO: Implement ValidateName function
 // ValidateName checks if name is valid
+// Name should be 2-50 characters after trimming whitespace
 func ValidateName(name string) error {
-	// TODO: Implement name validation
-	// Name should be 2-50 characters, trimmed of whitespace
-	// Should not be empty after trimming
-	return errors.New("not implemented")
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return errors.New("name cannot be empty")
+	}
+	if len(name) < 2 || len(name) > 50 {
+		return errors.New("name must be between 2 and 50 characters")
+	}
+	return nil
 }
 
-// TODO: Implement ValidatePassword function
-// ValidatePassword checks if password meets security requirements
+// ValidatePassword checks password against PasswordPolicy. The error is a
+// *security.PolicyError listing every broken rule.
 func ValidatePassword(password string) error {
-	// TODO: Implement password validation
-	// Password should be at least 8 characters
-	// Should contain at least one uppercase, lowercase, and number
-	return errors.New("not implemented")
+	return PasswordPolicy.Validate(password)
 }
 
 // UpdateName updates the user's name with validation
@@ -75,12 +115,39 @@ func (u *User) UpdateName(name string) error {
 	return nil
 }
 
-// UpdateEmail updates the user's email with validation
+// UpdateEmail updates the user's email with validation. The new email is
+// unverified; use RequestEmailChange to keep the old one until the user
+// proves they own the new one.
 func (u *User) UpdateEmail(email string) error {
 	if err := ValidateEmail(email); err != nil {
 		return err
 	}
 	u.Email = strings.ToLower(strings.TrimSpace(email))
+	u.EmailVerified = false
 	u.UpdatedAt = time.Now()
 	return nil
 }
+
+// RequestEmailChange validates email and stores it in PendingEmail,
+// replacing an earlier pending one
+func (u *User) RequestEmailChange(email string) error {
+	if err := ValidateEmail(email); err != nil {
+		return err
+	}
+	u.PendingEmail = normalizeEmail(email)
+	u.UpdatedAt = time.Now()
+	return nil
+}
+
+// ConfirmEmailChange makes PendingEmail the verified email
+func (u *User) ConfirmEmailChange() error {
+	if u.PendingEmail == "" {
+		return errors.New("no email change is pending")
+	}
+	if err := u.UpdateEmail(u.PendingEmail); err != nil {
+		return err
+	}
+	u.EmailVerified = true
+	u.PendingEmail = ""
+	return nil
+}
@@ -6,6 +6,8 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"lab05/security"
 )
 
 func TestNewUser(t *testing.T) {
@@ -283,3 +285,38 @@ func TestUser_UpdateEmail(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, "test@example.com", user.Email)
 }
+
+func TestUser_EmailChange(t *testing.T) {
+	user := &User{Email: "test@example.com", Name: "John Doe", EmailVerified: true}
+
+	assert.Error(t, user.ConfirmEmailChange())
+	assert.Error(t, user.RequestEmailChange("invalid-email"))
+	assert.Empty(t, user.PendingEmail)
+
+	require.NoError(t, user.RequestEmailChange("  New@Example.com "))
+	assert.Equal(t, "test@example.com", user.Email)
+	assert.Equal(t, "new@example.com", user.PendingEmail)
+	assert.True(t, user.EmailVerified)
+
+	require.NoError(t, user.ConfirmEmailChange())
+	assert.Equal(t, "new@example.com", user.Email)
+	assert.Empty(t, user.PendingEmail)
+	assert.True(t, user.EmailVerified)
+
+	require.NoError(t, user.UpdateEmail("other@example.com"))
+	assert.False(t, user.EmailVerified)
+}
+
+func TestNewUser_PasswordPolicy(t *testing.T) {
+	defer func(policy *security.PasswordPolicy) { PasswordPolicy = policy }(PasswordPolicy)
+	PasswordPolicy = security.RecommendedPolicy(nil)
+
+	_, err := NewUser("jane@example.com", "Jane Roe", "roe-violet-anchor-42")
+	var policyErr *security.PolicyError
+	require.ErrorAs(t, err, &policyErr)
+	assert.True(t, policyErr.Has(security.ViolationPersonalInfo))
+
+	user, err := NewUser("jane@example.com", "Jane Roe", "violet-anchor-drift-42")
+	require.NoError(t, err)
+	assert.Equal(t, "Jane Roe", user.Name)
+}
@@ -0,0 +1,330 @@
+package calculator
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"unicode/utf8"
+)
+
+// maxExpressionLength and maxExpressionDepth bound the work of one
+// expression and the recursion of the parser
+const (
+	maxExpressionLength = 1000
+	maxExpressionDepth  = 100
+)
+
+// ExpressionError reports where an expression is invalid. Position is the
+// 1-based position of the offending character; Token is empty when the
+// expression ended too early.
+type ExpressionError struct {
+	Message  string
+	Position int
+	Token    string
+}
+
+func (e *ExpressionError) Error() string {
+	if e.Token == "" {
+		return fmt.Sprintf("%s at position %d", e.Message, e.Position)
+	}
+	return fmt.Sprintf("%s at position %d: %q", e.Message, e.Position, e.Token)
+}
+
+// token is a lexeme of an expression. pos is the 0-based byte offset.
+type token struct {
+	kind  tokenKind
+	text  string
+	pos   int
+	value float64
+}
+
+type tokenKind int
+
+const (
+	tokenEnd tokenKind = iota
+	tokenNumber
+	tokenIdent
+	tokenOperator
+	tokenLeftParen
+	tokenRightParen
+)
+
+// node is a parsed expression
+type node interface {
+	eval(variables map[string]float64) (float64, error)
+}
+
+type numberNode struct {
+	value float64
+}
+
+type variableNode struct {
+	name string
+	pos  int
+}
+
+type unaryNode struct {
+	operand node
+}
+
+type binaryNode struct {
+	op          byte
+	pos         int
+	left, right node
+}
+
+func (n numberNode) eval(map[string]float64) (float64, error) {
+	return n.value, nil
+}
+
+func (n variableNode) eval(variables map[string]float64) (float64, error) {
+	value, ok := variables[n.name]
+	if !ok {
+		return 0, &ExpressionError{Message: "unknown variable", Position: n.pos + 1, Token: n.name}
+	}
+	return value, nil
+}
+
+func (n unaryNode) eval(variables map[string]float64) (float64, error) {
+	value, err := n.operand.eval(variables)
+	return -value, err
+}
+
+func (n binaryNode) eval(variables map[string]float64) (float64, error) {
+	left, err := n.left.eval(variables)
+	if err != nil {
+		return 0, err
+	}
+	right, err := n.right.eval(variables)
+	if err != nil {
+		return 0, err
+	}
+	switch n.op {
+	case '+':
+		return left + right, nil
+	case '-':
+		return left - right, nil
+	case '*':
+		return left * right, nil
+	case '/':
+		if right == 0 {
+			return 0, &ExpressionError{Message: "division by zero", Position: n.pos + 1, Token: "/"}
+		}
+		return left / right, nil
+	default:
+		return math.Pow(left, right), nil
+	}
+}
+
+// Evaluate parses expression and computes it with variables. Supported are
+// numbers, variable names, parentheses, unary minus and the operators
+// + - * / and ^ (right-associative, binding tighter than unary minus).
+func Evaluate(expression string, variables map[string]float64) (float64, error) {
+	if len(expression) > maxExpressionLength {
+		return 0, &ExpressionError{Message: fmt.Sprintf("expression longer than %d characters", maxExpressionLength), Position: maxExpressionLength + 1}
+	}
+	tokens, err := tokenize(expression)
+	if err != nil {
+		return 0, err
+	}
+	p := &expressionParser{tokens: tokens}
+	tree, err := p.parseSum(0)
+	if err != nil {
+		return 0, err
+	}
+	if next := p.peek(); next.kind != tokenEnd {
+		return 0, p.unexpected(next)
+	}
+
+	result, err := tree.eval(variables)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(result) || math.IsInf(result, 0) {
+		return 0, &ExpressionError{Message: "result is not a finite number", Position: 1}
+	}
+	return result, nil
+}
+
+func tokenize(expression string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(expression); {
+		c := expression[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case isDigit(c) || c == '.':
+			start := i
+			for i < len(expression) && (isDigit(expression[i]) || expression[i] == '.') {
+				i++
+			}
+			// An exponent such as 1e-3
+			if i < len(expression) && (expression[i] == 'e' || expression[i] == 'E') {
+				j := i + 1
+				if j < len(expression) && (expression[j] == '+' || expression[j] == '-') {
+					j++
+				}
+				if j < len(expression) && isDigit(expression[j]) {
+					for i = j; i < len(expression) && isDigit(expression[i]); i++ {
+					}
+				}
+			}
+			value, err := strconv.ParseFloat(expression[start:i], 64)
+			if err != nil {
+				return nil, &ExpressionError{Message: "invalid number", Position: start + 1, Token: expression[start:i]}
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: expression[start:i], pos: start, value: value})
+		case isLetter(c):
+			start := i
+			for i < len(expression) && (isLetter(expression[i]) || isDigit(expression[i])) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: expression[start:i], pos: start})
+		case c == '+' || c == '-' || c == '*' || c == '/' || c == '^':
+			tokens = append(tokens, token{kind: tokenOperator, text: string(c), pos: i})
+			i++
+		case c == '(':
+			tokens = append(tokens, token{kind: tokenLeftParen, text: "(", pos: i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokenRightParen, text: ")", pos: i})
+			i++
+		default:
+			// Everything before i is ASCII, so i is also the character count
+			r, _ := utf8.DecodeRuneInString(expression[i:])
+			return nil, &ExpressionError{Message: "unexpected character", Position: i + 1, Token: string(r)}
+		}
+	}
+	return append(tokens, token{kind: tokenEnd, pos: len(expression)}), nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// isLetter accepts the ASCII letters and _ of variable names
+func isLetter(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// expressionParser is a recursive descent parser over the tokens of one
+// expression
+type expressionParser struct {
+	tokens []token
+	next   int
+}
+
+func (p *expressionParser) peek() token {
+	return p.tokens[p.next]
+}
+
+func (p *expressionParser) advance() token {
+	t := p.tokens[p.next]
+	if t.kind != tokenEnd {
+		p.next++
+	}
+	return t
+}
+
+func (p *expressionParser) unexpected(t token) error {
+	if t.kind == tokenEnd {
+		return &ExpressionError{Message: "unexpected end of expression", Position: t.pos + 1}
+	}
+	return &ExpressionError{Message: "unexpected token", Position: t.pos + 1, Token: t.text}
+}
+
+// parseSum parses terms joined by + and -
+func (p *expressionParser) parseSum(depth int) (node, error) {
+	left, err := p.parseProduct(depth)
+	if err != nil {
+		return nil, err
+	}
+	for t := p.peek(); t.kind == tokenOperator && (t.text == "+" || t.text == "-"); t = p.peek() {
+		p.advance()
+		right, err := p.parseProduct(depth)
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode{op: t.text[0], pos: t.pos, left: left, right: right}
+	}
+	return left, nil
+}
+
+// parseProduct parses factors joined by * and /
+func (p *expressionParser) parseProduct(depth int) (node, error) {
+	left, err := p.parseUnary(depth)
+	if err != nil {
+		return nil, err
+	}
+	for t := p.peek(); t.kind == tokenOperator && (t.text == "*" || t.text == "/"); t = p.peek() {
+		p.advance()
+		right, err := p.parseUnary(depth)
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode{op: t.text[0], pos: t.pos, left: left, right: right}
+	}
+	return left, nil
+}
+
+// parseUnary parses a signed power, so -2^2 is -(2^2)
+func (p *expressionParser) parseUnary(depth int) (node, error) {
+	if depth > maxExpressionDepth {
+		t := p.peek()
+		return nil, &ExpressionError{Message: "expression nested too deeply", Position: t.pos + 1, Token: t.text}
+	}
+	t := p.peek()
+	if t.kind == tokenOperator && (t.text == "-" || t.text == "+") {
+		p.advance()
+		operand, err := p.parseUnary(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if t.text == "+" {
+			return operand, nil
+		}
+		return unaryNode{operand: operand}, nil
+	}
+	return p.parsePower(depth)
+}
+
+// parsePower parses a primary raised to a right-associative exponent
+func (p *expressionParser) parsePower(depth int) (node, error) {
+	base, err := p.parsePrimary(depth)
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind == tokenOperator && t.text == "^" {
+		p.advance()
+		exponent, err := p.parseUnary(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return binaryNode{op: '^', pos: t.pos, left: base, right: exponent}, nil
+	}
+	return base, nil
+}
+
+func (p *expressionParser) parsePrimary(depth int) (node, error) {
+	t := p.advance()
+	switch t.kind {
+	case tokenNumber:
+		return numberNode{value: t.value}, nil
+	case tokenIdent:
+		return variableNode{name: t.text, pos: t.pos}, nil
+	case tokenLeftParen:
+		inner, err := p.parseSum(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.advance(); closing.kind != tokenRightParen {
+			if closing.kind == tokenEnd {
+				return nil, &ExpressionError{Message: "missing closing parenthesis", Position: closing.pos + 1}
+			}
+			return nil, p.unexpected(closing)
+		}
+		return inner, nil
+	default:
+		return nil, p.unexpected(t)
+	}
+}
@@ -0,0 +1,76 @@
+package calculator
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestEvaluate(t *testing.T) {
+	variables := map[string]float64{"x": 3, "rate_2": 0.5}
+
+	tests := []struct {
+		expression string
+		want       float64
+	}{
+		{"1 + 2 * 3", 7},
+		{"(1 + 2) * 3", 9},
+		{"10 - 4 - 3", 3},
+		{"2 ^ 3 ^ 2", 512},
+		{"-2 ^ 2", -4},
+		{"(-2) ^ 2", 4},
+		{"--x", 3},
+		{"+x * rate_2", 1.5},
+		{"1.5e2 / .5", 300},
+		{"2 * x ^ -1", 2.0 / 3},
+	}
+
+	for _, tt := range tests {
+		got, err := Evaluate(tt.expression, variables)
+		if err != nil {
+			t.Errorf("Evaluate(%q) failed: %v", tt.expression, err)
+			continue
+		}
+		if math.Abs(got-tt.want) > 1e-12 {
+			t.Errorf("Evaluate(%q): expected %v, got %v", tt.expression, tt.want, got)
+		}
+	}
+}
+
+func TestEvaluate_Errors(t *testing.T) {
+	tests := []struct {
+		expression string
+		message    string
+		position   int
+		token      string
+	}{
+		{"1 + ", "unexpected end of expression", 5, ""},
+		{"1 + * 2", "unexpected token", 5, "*"},
+		{"(1 + 2", "missing closing parenthesis", 7, ""},
+		{"1 + 2)", "unexpected token", 6, ")"},
+		{"2 $ 3", "unexpected character", 3, "$"},
+		{"1 + é", "unexpected character", 5, "é"},
+		{"1..2", "invalid number", 1, "1..2"},
+		{"y * 2", "unknown variable", 1, "y"},
+		{"1 / (x - x)", "division by zero", 3, "/"},
+		{"10 ^ 400", "result is not a finite number", 1, ""},
+		{strings.Repeat("(", 200) + "1" + strings.Repeat(")", 200), "expression nested too deeply", 102, "("},
+	}
+
+	for _, tt := range tests {
+		_, err := Evaluate(tt.expression, map[string]float64{"x": 1})
+		var exprErr *ExpressionError
+		if !errors.As(err, &exprErr) {
+			t.Errorf("Evaluate(%q): expected an ExpressionError, got %v", tt.expression, err)
+			continue
+		}
+		if exprErr.Message != tt.message || exprErr.Position != tt.position || exprErr.Token != tt.token {
+			t.Errorf("Evaluate(%q): expected %q at %d (%q), got %+v", tt.expression, tt.message, tt.position, tt.token, exprErr)
+		}
+	}
+
+	if _, err := Evaluate(strings.Repeat("1+", maxExpressionLength), nil); err == nil {
+		t.Error("Expected an error for an overlong expression")
+	}
+}
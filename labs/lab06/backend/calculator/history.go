@@ -0,0 +1,343 @@
+package calculator
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	pb "lab06-backend/proto"
+)
+
+// CallerFunc returns the authenticated caller of a call, whose history the
+// call reads and writes. Calls without one share an anonymous history.
+type CallerFunc func(ctx context.Context) (caller string, ok bool)
+
+// maxCallerLength bounds the caller names kept with every entry
+const maxCallerLength = 128
+
+// maxHistoryCallers is how many callers a RingHistoryStore keeps. Past it,
+// callers whose entries have all expired are forgotten, or else the least
+// recently used one.
+const maxHistoryCallers = 10000
+
+// maxHistoryPage is the largest and the default GetHistory page
+const maxHistoryPage = 100
+
+// DefaultHistoryRetention keeps the last 100 entries of each caller
+var DefaultHistoryRetention = HistoryRetention{MaxEntries: 100}
+
+// HistoryRetention bounds what a HistoryStore keeps
+type HistoryRetention struct {
+	// MaxEntries is kept per caller; 0 uses DefaultHistoryRetention's
+	MaxEntries int
+	// MaxAge drops older entries; 0 keeps them until MaxEntries is reached
+	MaxAge time.Duration
+}
+
+func (r HistoryRetention) maxEntries() int {
+	if r.MaxEntries <= 0 {
+		return DefaultHistoryRetention.MaxEntries
+	}
+	return r.MaxEntries
+}
+
+// cutoff is the Unix time of the oldest entry to keep, or 0 for no limit
+func (r HistoryRetention) cutoff(now time.Time) int64 {
+	if r.MaxAge <= 0 {
+		return 0
+	}
+	return now.Add(-r.MaxAge).Unix()
+}
+
+// HistoryQuery selects history entries of one caller. Since and Until are
+// inclusive Unix seconds and BeforeID continues after a previous page;
+// zero values do not filter.
+type HistoryQuery struct {
+	Caller    string
+	Operation string
+	Since     int64
+	Until     int64
+	BeforeID  int64
+	Limit     int
+}
+
+func (q HistoryQuery) matches(entry *pb.HistoryEntry) bool {
+	return (q.Operation == "" || entry.Operation == q.Operation) &&
+		(q.Since == 0 || entry.Timestamp >= q.Since) &&
+		(q.Until == 0 || entry.Timestamp <= q.Until) &&
+		(q.BeforeID == 0 || entry.Id < q.BeforeID)
+}
+
+// HistoryStore keeps the calculator history of each caller
+type HistoryStore interface {
+	// Append assigns entry the next ID and stores it for caller
+	Append(ctx context.Context, caller string, entry *pb.HistoryEntry) error
+	// Query returns up to q.Limit matching entries, newest first
+	Query(ctx context.Context, q HistoryQuery) ([]*pb.HistoryEntry, error)
+}
+
+// callerOf returns the caller of a call, or "" when it is anonymous
+func (s *Service) callerOf(ctx context.Context) string {
+	if s.caller == nil {
+		return ""
+	}
+	caller, ok := s.caller(ctx)
+	if !ok {
+		return ""
+	}
+	caller = strings.TrimSpace(caller)
+	if len(caller) > maxCallerLength {
+		caller = caller[:maxCallerLength]
+	}
+	return caller
+}
+
+// pageToken continues a history query after the entry with id
+func pageToken(id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(id, 10)))
+}
+
+func parsePageToken(token string) (int64, error) {
+	if token == "" {
+		return 0, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, err
+	}
+	id, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, errors.New("invalid page token")
+	}
+	return id, nil
+}
+
+// RingHistoryStore keeps the last entries of each caller in memory
+type RingHistoryStore struct {
+	mu         sync.Mutex
+	retention  HistoryRetention
+	maxCallers int
+	rings      map[string]*historyRing
+	lastID     int64
+	// uses counts Appends and Queries to order rings by last use
+	uses int64
+}
+
+// historyRing is a fixed-size buffer that overwrites its oldest entry
+type historyRing struct {
+	entries []*pb.HistoryEntry
+	next    int
+	lastUse int64
+}
+
+// NewRingHistoryStore creates an empty store
+func NewRingHistoryStore(retention HistoryRetention) *RingHistoryStore {
+	return &RingHistoryStore{
+		retention:  retention,
+		maxCallers: maxHistoryCallers,
+		rings:      make(map[string]*historyRing),
+	}
+}
+
+func (s *RingHistoryStore) Append(ctx context.Context, caller string, entry *pb.HistoryEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastID++
+	entry.Id = s.lastID
+
+	ring, ok := s.rings[caller]
+	if !ok {
+		if len(s.rings) >= s.maxCallers {
+			s.forgetExpired()
+		}
+		if len(s.rings) >= s.maxCallers {
+			s.forgetLeastRecent()
+		}
+		ring = &historyRing{}
+		s.rings[caller] = ring
+	}
+	s.uses++
+	ring.lastUse = s.uses
+	if len(ring.entries) < s.retention.maxEntries() {
+		ring.entries = append(ring.entries, copyEntry(entry))
+		return nil
+	}
+	ring.entries[ring.next] = copyEntry(entry)
+	ring.next = (ring.next + 1) % len(ring.entries)
+	return nil
+}
+
+func (s *RingHistoryStore) Query(ctx context.Context, q HistoryQuery) ([]*pb.HistoryEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ring, ok := s.rings[q.Caller]
+	if !ok {
+		return nil, nil
+	}
+	s.uses++
+	ring.lastUse = s.uses
+
+	cutoff := s.retention.cutoff(time.Now())
+	var entries []*pb.HistoryEntry
+	for i := 1; i <= len(ring.entries) && (q.Limit <= 0 || len(entries) < q.Limit); i++ {
+		entry := ring.entries[(ring.next-i+len(ring.entries))%len(ring.entries)]
+		if entry.Timestamp >= cutoff && q.matches(entry) {
+			entries = append(entries, copyEntry(entry))
+		}
+	}
+	return entries, nil
+}
+
+// newest returns the last entry appended to the ring
+func (r *historyRing) newest() *pb.HistoryEntry {
+	return r.entries[(r.next-1+len(r.entries))%len(r.entries)]
+}
+
+// forgetExpired drops the rings whose entries are all past MaxAge. The
+// caller holds the mutex.
+func (s *RingHistoryStore) forgetExpired() {
+	cutoff := s.retention.cutoff(time.Now())
+	if cutoff == 0 {
+		return
+	}
+	for caller, ring := range s.rings {
+		if ring.newest().Timestamp < cutoff {
+			delete(s.rings, caller)
+		}
+	}
+}
+
+// forgetLeastRecent drops the ring used longest ago, so a flood of new
+// callers cannot grow the store without bound. The caller holds the mutex.
+func (s *RingHistoryStore) forgetLeastRecent() {
+	var oldest string
+	var oldestRing *historyRing
+	for caller, ring := range s.rings {
+		if oldestRing == nil || ring.lastUse < oldestRing.lastUse {
+			oldest, oldestRing = caller, ring
+		}
+	}
+	delete(s.rings, oldest)
+}
+
+// historySchema indexes entries by caller and ID, the order Query pages
+// through them in
+const historySchema = `CREATE TABLE IF NOT EXISTS calculator_history (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	caller VARCHAR(128) NOT NULL,
+	operation VARCHAR(16) NOT NULL,
+	a REAL NOT NULL,
+	b REAL NOT NULL,
+	result REAL NOT NULL,
+	timestamp INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_calculator_history_caller ON calculator_history(caller, id)`
+
+// SQLHistoryStore is a HistoryStore over a calculator_history table.
+// Append prunes the caller's entries past the retention as it goes.
+// Timestamps are Unix seconds.
+type SQLHistoryStore struct {
+	db        *sql.DB
+	retention HistoryRetention
+}
+
+// NewSQLHistoryStore creates the calculator_history table if needed
+func NewSQLHistoryStore(db *sql.DB, retention HistoryRetention) (*SQLHistoryStore, error) {
+	if db == nil {
+		return nil, errors.New("db must not be nil")
+	}
+	if _, err := db.Exec(historySchema); err != nil {
+		return nil, fmt.Errorf("failed to create calculator_history: %v", err)
+	}
+	return &SQLHistoryStore{db: db, retention: retention}, nil
+}
+
+// Append stores entry and drops the entries of caller that fall outside
+// the retention
+func (s *SQLHistoryStore) Append(ctx context.Context, caller string, entry *pb.HistoryEntry) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to append history: %v", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx,
+		`INSERT INTO calculator_history (caller, operation, a, b, result, timestamp) VALUES (?, ?, ?, ?, ?, ?)`,
+		caller, entry.Operation, entry.A, entry.B, entry.Result, entry.Timestamp,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to append history: %v", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to append history: %v", err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`DELETE FROM calculator_history WHERE caller = ? AND (timestamp < ? OR id <= (
+			SELECT id FROM calculator_history WHERE caller = ? ORDER BY id DESC LIMIT 1 OFFSET ?))`,
+		caller, s.retention.cutoff(time.Now()), caller, s.retention.maxEntries(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to apply history retention: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to append history: %v", err)
+	}
+	entry.Id = id
+	return nil
+}
+
+func (s *SQLHistoryStore) Query(ctx context.Context, q HistoryQuery) ([]*pb.HistoryEntry, error) {
+	query := `SELECT id, operation, a, b, result, timestamp FROM calculator_history WHERE caller = ?`
+	args := []any{q.Caller}
+	if cutoff := s.retention.cutoff(time.Now()); cutoff != 0 {
+		query += ` AND timestamp >= ?`
+		args = append(args, cutoff)
+	}
+	if q.Operation != "" {
+		query += ` AND operation = ?`
+		args = append(args, q.Operation)
+	}
+	if q.Since != 0 {
+		query += ` AND timestamp >= ?`
+		args = append(args, q.Since)
+	}
+	if q.Until != 0 {
+		query += ` AND timestamp <= ?`
+		args = append(args, q.Until)
+	}
+	if q.BeforeID != 0 {
+		query += ` AND id < ?`
+		args = append(args, q.BeforeID)
+	}
+	query += ` ORDER BY id DESC`
+	if q.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, q.Limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query history: %v", err)
+	}
+	defer rows.Close()
+	var entries []*pb.HistoryEntry
+	for rows.Next() {
+		entry := &pb.HistoryEntry{}
+		if err := rows.Scan(&entry.Id, &entry.Operation, &entry.A, &entry.B, &entry.Result, &entry.Timestamp); err != nil {
+			return nil, fmt.Errorf("failed to scan history: %v", err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query history: %v", err)
+	}
+	return entries, nil
+}
@@ -0,0 +1,124 @@
+package calculator
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+	"time"
+
+	pb "lab06-backend/proto"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func newSQLHistoryStore(t *testing.T, retention HistoryRetention) *SQLHistoryStore {
+	testDB := "./test_history.db"
+	os.Remove(testDB)
+
+	db, err := sql.Open("sqlite3", testDB)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		os.Remove(testDB)
+	})
+
+	store, err := NewSQLHistoryStore(db, retention)
+	if err != nil {
+		t.Fatalf("NewSQLHistoryStore failed: %v", err)
+	}
+	return store
+}
+
+func TestHistoryStores(t *testing.T) {
+	stores := map[string]func(t *testing.T, retention HistoryRetention) HistoryStore{
+		"ring": func(t *testing.T, retention HistoryRetention) HistoryStore { return NewRingHistoryStore(retention) },
+		"sql":  func(t *testing.T, retention HistoryRetention) HistoryStore { return newSQLHistoryStore(t, retention) },
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t, HistoryRetention{MaxEntries: 4, MaxAge: time.Hour})
+			ctx := context.Background()
+			now := time.Now().Unix()
+
+			// Six entries for alice, of which only the last four are kept
+			for i, op := range []string{"add", "subtract", "add", "multiply", "add", "divide"} {
+				entry := &pb.HistoryEntry{Operation: op, A: float64(i), B: 1, Result: float64(i + 1), Timestamp: now - int64(6-i)*60}
+				if err := store.Append(ctx, "alice", entry); err != nil {
+					t.Fatalf("Append failed: %v", err)
+				}
+				if entry.Id == 0 {
+					t.Fatal("Expected Append to assign an ID")
+				}
+			}
+			// bob's first entry is beyond MaxAge
+			store.Append(ctx, "bob", &pb.HistoryEntry{Operation: "add", Timestamp: now - 2*3600})
+			store.Append(ctx, "bob", &pb.HistoryEntry{Operation: "add", Timestamp: now})
+
+			entries, err := store.Query(ctx, HistoryQuery{Caller: "alice"})
+			if err != nil {
+				t.Fatalf("Query failed: %v", err)
+			}
+			if len(entries) != 4 || entries[0].Operation != "divide" || entries[3].Operation != "add" || entries[3].A != 2 {
+				t.Fatalf("Expected divide, add, multiply, add, got %v", entries)
+			}
+			if entries[0].Id <= entries[1].Id {
+				t.Errorf("Expected newest first, got IDs %d and %d", entries[0].Id, entries[1].Id)
+			}
+
+			entries, _ = store.Query(ctx, HistoryQuery{Caller: "alice", Operation: "add"})
+			if len(entries) != 2 || entries[0].A != 4 || entries[1].A != 2 {
+				t.Errorf("Expected the adds of 4 and 2, got %v", entries)
+			}
+			entries, _ = store.Query(ctx, HistoryQuery{Caller: "alice", Since: now - 180, Until: now - 120})
+			if len(entries) != 2 || entries[0].A != 4 || entries[1].A != 3 {
+				t.Errorf("Expected the entries of 4 and 3, got %v", entries)
+			}
+
+			first, _ := store.Query(ctx, HistoryQuery{Caller: "alice", Limit: 3})
+			rest, _ := store.Query(ctx, HistoryQuery{Caller: "alice", BeforeID: first[2].Id})
+			if len(first) != 3 || len(rest) != 1 || rest[0].A != 2 {
+				t.Errorf("Expected pages of 3 and 1, got %v and %v", first, rest)
+			}
+
+			entries, _ = store.Query(ctx, HistoryQuery{Caller: "bob"})
+			if len(entries) != 1 || entries[0].Timestamp != now {
+				t.Errorf("Expected bob to see only his recent entry, got %v", entries)
+			}
+			if entries, _ := store.Query(ctx, HistoryQuery{Caller: "carol"}); len(entries) != 0 {
+				t.Errorf("Expected no entries for an unknown caller, got %v", entries)
+			}
+		})
+	}
+}
+
+func TestRingHistoryStore_MaxCallers(t *testing.T) {
+	store := NewRingHistoryStore(HistoryRetention{MaxEntries: 5, MaxAge: time.Hour})
+	store.maxCallers = 2
+	ctx := context.Background()
+	now := time.Now().Unix()
+
+	// carol's only entry has expired, so she goes first
+	store.Append(ctx, "carol", &pb.HistoryEntry{Operation: "add", Timestamp: now - 7200})
+	store.Append(ctx, "alice", &pb.HistoryEntry{Operation: "add", Timestamp: now})
+	store.Append(ctx, "bob", &pb.HistoryEntry{Operation: "add", Timestamp: now})
+	if _, ok := store.rings["carol"]; ok || len(store.rings) != 2 {
+		t.Errorf("Expected the expired caller to be forgotten, got %d callers", len(store.rings))
+	}
+
+	// Reading alice's history makes bob the least recently used
+	store.Query(ctx, HistoryQuery{Caller: "alice"})
+	store.Append(ctx, "dave", &pb.HistoryEntry{Operation: "add", Timestamp: now})
+	if len(store.rings) != 2 {
+		t.Errorf("Expected 2 callers, got %d", len(store.rings))
+	}
+	if entries, _ := store.Query(ctx, HistoryQuery{Caller: "bob"}); len(entries) != 0 {
+		t.Errorf("Expected bob to be forgotten, got %v", entries)
+	}
+	if entries, _ := store.Query(ctx, HistoryQuery{Caller: "alice"}); len(entries) != 1 {
+		t.Errorf("Expected alice to be kept, got %v", entries)
+	}
+}
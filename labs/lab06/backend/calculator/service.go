@@ -2,136 +2,352 @@ package calculator
 
 import (
 	"context"
+	"errors"
+	"io"
+	"log"
+	"slices"
 	"sync"
 	"time"
 
 	pb "lab06-backend/proto"
 
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
+// watchBuffer is how many entries a slow watcher may fall behind before
+// it is dropped
+const watchBuffer = 64
+
+// maxBatchSize limits the operations of one Batch call
+const maxBatchSize = 1000
+
+// operationNames are the names used in responses and history
+var operationNames = map[pb.Operation]string{
+	pb.Operation_OPERATION_ADD:      "add",
+	pb.Operation_OPERATION_SUBTRACT: "subtract",
+	pb.Operation_OPERATION_MULTIPLY: "multiply",
+	pb.Operation_OPERATION_DIVIDE:   "divide",
+}
+
 // Service implements the Calculator gRPC service
 type Service struct {
 	pb.UnimplementedCalculatorServer
-	history []pb.HistoryEntry
-	mutex   sync.RWMutex
+	history HistoryStore
+	caller  CallerFunc
+	// watchers maps each WatchHistory stream to its caller
+	watchers map[chan *pb.HistoryEntry]string
+	mutex    sync.RWMutex
+}
+
+// Option configures a Service
+type Option func(*Service)
+
+// WithHistoryStore keeps the history in store. The default is a
+// RingHistoryStore with DefaultHistoryRetention.
+func WithHistoryStore(store HistoryStore) Option {
+	return func(s *Service) {
+		s.history = store
+	}
+}
+
+// WithCaller identifies the caller of each call, such as the one
+// authenticated by interceptor.Auth. Without it every call shares one
+// anonymous history; clients can never name the caller themselves.
+func WithCaller(caller CallerFunc) Option {
+	return func(s *Service) {
+		s.caller = caller
+	}
 }
 
 // NewService creates a new calculator service
-func NewService() *Service {
-	return &Service{
-		history: make([]pb.HistoryEntry, 0),
+func NewService(opts ...Option) *Service {
+	s := &Service{
+		history:  NewRingHistoryStore(DefaultHistoryRetention),
+		watchers: make(map[chan *pb.HistoryEntry]string),
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 // Add performs addition operation
 func (s *Service) Add(ctx context.Context, req *pb.OperationRequest) (*pb.OperationResponse, error) {
-	result := req.A + req.B
-
-	s.addToHistory("add", req.A, req.B, result)
-
-	return &pb.OperationResponse{
-		Result:    result,
-		Operation: "add",
-		Success:   true,
-	}, nil
+	return s.apply(ctx, pb.Operation_OPERATION_ADD, req.A, req.B), nil
 }
 
 // Subtract performs subtraction operation
 func (s *Service) Subtract(ctx context.Context, req *pb.OperationRequest) (*pb.OperationResponse, error) {
-	result := req.A - req.B
-
-	s.addToHistory("subtract", req.A, req.B, result)
-
-	return &pb.OperationResponse{
-		Result:    result,
-		Operation: "subtract",
-		Success:   true,
-	}, nil
+	return s.apply(ctx, pb.Operation_OPERATION_SUBTRACT, req.A, req.B), nil
 }
 
 // Multiply performs multiplication operation
 func (s *Service) Multiply(ctx context.Context, req *pb.OperationRequest) (*pb.OperationResponse, error) {
-	result := req.A * req.B
-
-	s.addToHistory("multiply", req.A, req.B, result)
-
-	return &pb.OperationResponse{
-		Result:    result,
-		Operation: "multiply",
-		Success:   true,
-	}, nil
+	return s.apply(ctx, pb.Operation_OPERATION_MULTIPLY, req.A, req.B), nil
 }
 
 // Divide performs division operation with zero check
 func (s *Service) Divide(ctx context.Context, req *pb.OperationRequest) (*pb.OperationResponse, error) {
-	if req.B == 0 {
-		return &pb.OperationResponse{
-			Result:    0,
-			Operation: "divide",
-			Success:   false,
-			Error:     "division by zero",
-		}, status.Errorf(codes.InvalidArgument, "cannot divide by zero")
+	resp := s.apply(ctx, pb.Operation_OPERATION_DIVIDE, req.A, req.B)
+	if !resp.Success {
+		return resp, status.Errorf(codes.InvalidArgument, "cannot divide by zero")
 	}
+	return resp, nil
+}
 
-	result := req.A / req.B
+// GetHistory returns a page of the caller's history, oldest first, with a
+// token for the older entries if there are any
+func (s *Service) GetHistory(ctx context.Context, req *pb.HistoryRequest) (*pb.HistoryResponse, error) {
+	limit := int(req.Limit)
+	if limit <= 0 || limit > maxHistoryPage {
+		limit = maxHistoryPage
+	}
+	beforeID, err := parsePageToken(req.PageToken)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid page token")
+	}
+	if req.Since != 0 && req.Until != 0 && req.Since > req.Until {
+		return nil, status.Error(codes.InvalidArgument, "since must not be after until")
+	}
 
-	s.addToHistory("divide", req.A, req.B, result)
+	// One more entry than the page tells whether there is a next page
+	entries, err := s.history.Query(ctx, HistoryQuery{
+		Caller:    s.callerOf(ctx),
+		Operation: req.Operation,
+		Since:     req.Since,
+		Until:     req.Until,
+		BeforeID:  beforeID,
+		Limit:     limit + 1,
+	})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to read history: %v", err)
+	}
 
-	return &pb.OperationResponse{
-		Result:    result,
-		Operation: "divide",
-		Success:   true,
-	}, nil
+	resp := &pb.HistoryResponse{}
+	if len(entries) > limit {
+		entries = entries[:limit]
+		resp.NextPageToken = pageToken(entries[limit-1].Id)
+	}
+	slices.Reverse(entries)
+	resp.Entries = entries
+	return resp, nil
 }
 
-// GetHistory returns operation history
-func (s *Service) GetHistory(ctx context.Context, req *pb.HistoryRequest) (*pb.HistoryResponse, error) {
-	s.mutex.RLock()
-	defer s.mutex.RUnlock()
+// Batch runs the operations of the request in order. Failed operations,
+// such as a division by zero, are reported in their result and do not
+// fail the call.
+func (s *Service) Batch(ctx context.Context, req *pb.BatchRequest) (*pb.BatchResponse, error) {
+	if len(req.Operations) > maxBatchSize {
+		return nil, status.Errorf(codes.InvalidArgument, "a batch may hold at most %d operations", maxBatchSize)
+	}
 
-	limit := int(req.Limit)
-	if limit <= 0 || limit > len(s.history) {
-		limit = len(s.history)
+	resp := &pb.BatchResponse{Results: make([]*pb.OperationResponse, 0, len(req.Operations))}
+	for _, op := range req.Operations {
+		if err := ctx.Err(); err != nil {
+			return nil, status.FromContextError(err).Err()
+		}
+		result := s.apply(ctx, op.Operation, op.A, op.B)
+		resp.Results = append(resp.Results, result)
+		if !result.Success {
+			resp.Failed++
+			if req.StopOnError {
+				break
+			}
+		}
 	}
+	return resp, nil
+}
+
+// Evaluate computes an expression with the variables of the request. An
+// invalid expression fails with InvalidArgument and an ExpressionError
+// detail that locates the problem. Evaluations are not recorded in the
+// history.
+func (s *Service) Evaluate(ctx context.Context, req *pb.ExpressionRequest) (*pb.ExpressionResponse, error) {
+	result, err := Evaluate(req.Expression, req.Variables)
+	var exprErr *ExpressionError
+	if errors.As(err, &exprErr) {
+		st, detailErr := status.New(codes.InvalidArgument, exprErr.Error()).WithDetails(&pb.ExpressionError{
+			Message:  exprErr.Message,
+			Position: int32(exprErr.Position),
+			Token:    exprErr.Token,
+		})
+		if detailErr != nil {
+			return nil, status.Error(codes.InvalidArgument, exprErr.Error())
+		}
+		return nil, st.Err()
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &pb.ExpressionResponse{Result: result, Expression: req.Expression}, nil
+}
+
+// WatchHistory sends up to req.Replay past entries of the caller, then
+// every new one until the client goes away. A client that cannot keep up
+// is dropped with ResourceExhausted rather than slowing down the
+// calculator.
+func (s *Service) WatchHistory(req *pb.WatchHistoryRequest, stream grpc.ServerStreamingServer[pb.HistoryEntry]) error {
+	caller := s.callerOf(stream.Context())
+	entries := make(chan *pb.HistoryEntry, watchBuffer)
+
+	// Register and replay under one lock so no entry is missed or repeated
+	s.mutex.Lock()
+	var replay []*pb.HistoryEntry
+	if req.Replay > 0 {
+		var err error
+		replay, err = s.history.Query(stream.Context(), HistoryQuery{Caller: caller, Limit: int(req.Replay)})
+		if err != nil {
+			s.mutex.Unlock()
+			return status.Errorf(codes.Internal, "failed to read history: %v", err)
+		}
+		slices.Reverse(replay)
+	}
+	s.watchers[entries] = caller
+	s.mutex.Unlock()
+	defer s.removeWatcher(entries)
+
+	for _, entry := range replay {
+		if err := stream.Send(entry); err != nil {
+			return err
+		}
+	}
+	for {
+		select {
+		case <-stream.Context().Done():
+			return status.FromContextError(stream.Context().Err()).Err()
+		case entry, ok := <-entries:
+			if !ok {
+				return status.Error(codes.ResourceExhausted, "history watcher fell behind")
+			}
+			if err := stream.Send(entry); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Session applies each step to a running total that starts at 0 and
+// answers with the new total. A failed step leaves the total unchanged.
+func (s *Service) Session(stream grpc.BidiStreamingServer[pb.SessionRequest, pb.SessionResponse]) error {
+	var total float64
+	var steps int64
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
 
-	// Get the last 'limit' entries
-	startIndex := len(s.history) - limit
-	entries := make([]*pb.HistoryEntry, limit)
+		resp := &pb.SessionResponse{Operand: req.Operand}
+		if req.SetTotal {
+			total = req.Operand
+			steps++
+			resp.Operation = "set"
+			resp.Success = true
+		} else {
+			result := s.apply(stream.Context(), req.Operation, total, req.Operand)
+			resp.Operation = result.Operation
+			resp.Success = result.Success
+			resp.Error = result.Error
+			if result.Success {
+				total = result.Result
+				steps++
+			}
+		}
+		resp.Total = total
+		resp.Steps = steps
+		if err := stream.Send(resp); err != nil {
+			return err
+		}
+	}
+}
+
+// apply performs one operation and records it in the caller's history
+// when it succeeds
+func (s *Service) apply(ctx context.Context, op pb.Operation, a, b float64) *pb.OperationResponse {
+	name, ok := operationNames[op]
+	if !ok {
+		return &pb.OperationResponse{Operation: op.String(), Error: "unknown operation"}
+	}
 
-	for i, entry := range s.history[startIndex:] {
-		entries[i] = &pb.HistoryEntry{
-			Operation: entry.Operation,
-			A:         entry.A,
-			B:         entry.B,
-			Result:    entry.Result,
-			Timestamp: entry.Timestamp,
+	var result float64
+	switch op {
+	case pb.Operation_OPERATION_ADD:
+		result = a + b
+	case pb.Operation_OPERATION_SUBTRACT:
+		result = a - b
+	case pb.Operation_OPERATION_MULTIPLY:
+		result = a * b
+	case pb.Operation_OPERATION_DIVIDE:
+		if b == 0 {
+			return &pb.OperationResponse{Operation: name, Error: "division by zero"}
 		}
+		result = a / b
 	}
 
-	return &pb.HistoryResponse{
-		Entries: entries,
-	}, nil
+	s.addToHistory(ctx, name, a, b, result)
+
+	return &pb.OperationResponse{
+		Result:    result,
+		Operation: name,
+		Success:   true,
+	}
 }
 
-// addToHistory adds an operation to the history
-func (s *Service) addToHistory(operation string, a, b, result float64) {
+// addToHistory adds an operation to the caller's history and passes it
+// to the caller's watchers. The result is not held back when the store
+// fails.
+func (s *Service) addToHistory(ctx context.Context, operation string, a, b, result float64) {
+	caller := s.callerOf(ctx)
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	entry := pb.HistoryEntry{
+	entry := &pb.HistoryEntry{
 		Operation: operation,
 		A:         a,
 		B:         b,
 		Result:    result,
 		Timestamp: time.Now().Unix(),
 	}
+	if err := s.history.Append(ctx, caller, entry); err != nil {
+		log.Printf("Failed to record %s in history: %v", operation, err)
+		return
+	}
+
+	for watcher, watching := range s.watchers {
+		if watching != caller {
+			continue
+		}
+		select {
+		case watcher <- copyEntry(entry):
+		default:
+			delete(s.watchers, watcher)
+			close(watcher)
+		}
+	}
+}
 
-	s.history = append(s.history, entry)
+func (s *Service) removeWatcher(watcher chan *pb.HistoryEntry) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.watchers[watcher]; ok {
+		delete(s.watchers, watcher)
+		close(watcher)
+	}
+}
 
-	// Keep only last 100 entries
-	if len(s.history) > 100 {
-		s.history = s.history[1:]
+func copyEntry(entry *pb.HistoryEntry) *pb.HistoryEntry {
+	return &pb.HistoryEntry{
+		Operation: entry.Operation,
+		A:         entry.A,
+		B:         entry.B,
+		Result:    entry.Result,
+		Timestamp: entry.Timestamp,
+		Id:        entry.Id,
 	}
 }
@@ -2,9 +2,19 @@ package calculator
 
 import (
 	"context"
+	"io"
+	"net"
 	"testing"
+	"time"
 
 	pb "lab06-backend/proto"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
 )
 
 func TestService_Add(t *testing.T) {
@@ -164,3 +174,297 @@ func TestService_GetHistoryWithLimit(t *testing.T) {
 		t.Errorf("Expected 3 history entries, got %d", len(resp.Entries))
 	}
 }
+
+func TestService_GetHistoryPages(t *testing.T) {
+	service := NewService()
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		service.Add(ctx, &pb.OperationRequest{A: float64(i), B: 1.0})
+		service.Multiply(ctx, &pb.OperationRequest{A: float64(i), B: 2.0})
+	}
+
+	// Pages go back in time, each oldest first
+	resp, err := service.GetHistory(ctx, &pb.HistoryRequest{Limit: 2, Operation: "add"})
+	if err != nil {
+		t.Fatalf("GetHistory failed: %v", err)
+	}
+	if len(resp.Entries) != 2 || resp.Entries[0].A != 3 || resp.Entries[1].A != 4 || resp.NextPageToken == "" {
+		t.Fatalf("Expected adds of 3 and 4 with a next page, got %v", resp)
+	}
+
+	var seen int
+	for token := resp.NextPageToken; token != ""; token = resp.NextPageToken {
+		resp, err = service.GetHistory(ctx, &pb.HistoryRequest{Limit: 2, Operation: "add", PageToken: token})
+		if err != nil {
+			t.Fatalf("GetHistory failed: %v", err)
+		}
+		for _, entry := range resp.Entries {
+			if entry.Operation != "add" {
+				t.Errorf("Expected only adds, got '%s'", entry.Operation)
+			}
+		}
+		seen += len(resp.Entries)
+	}
+	if seen != 3 {
+		t.Errorf("Expected 3 more adds on later pages, got %d", seen)
+	}
+
+	resp, _ = service.GetHistory(ctx, &pb.HistoryRequest{Until: time.Now().Add(-time.Hour).Unix()})
+	if len(resp.Entries) != 0 {
+		t.Errorf("Expected no entries older than an hour, got %d", len(resp.Entries))
+	}
+	if _, err := service.GetHistory(ctx, &pb.HistoryRequest{PageToken: "not a token"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument for a bad page token, got %v", err)
+	}
+}
+
+// testCaller stands in for an authenticated caller, named by metadata
+func testCaller(ctx context.Context) (string, bool) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get("test-caller"); len(values) > 0 {
+		return values[0], true
+	}
+	return "", false
+}
+
+func TestService_HistoryPerCaller(t *testing.T) {
+	service := NewService(WithCaller(testCaller))
+	client := startTestServer(t, service)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	alice := metadata.AppendToOutgoingContext(ctx, "test-caller", "alice")
+	bob := metadata.AppendToOutgoingContext(ctx, "test-caller", "bob")
+
+	stream, err := client.WatchHistory(bob, &pb.WatchHistoryRequest{})
+	if err != nil {
+		t.Fatalf("WatchHistory failed: %v", err)
+	}
+	for {
+		service.mutex.RLock()
+		watching := len(service.watchers)
+		service.mutex.RUnlock()
+		if watching == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	client.Add(alice, &pb.OperationRequest{A: 1, B: 2})
+	client.Add(bob, &pb.OperationRequest{A: 10, B: 20})
+	client.Add(ctx, &pb.OperationRequest{A: 100, B: 200})
+
+	// bob's watcher skips alice's entry
+	entry, err := stream.Recv()
+	if err != nil || entry.Result != 30 {
+		t.Errorf("Expected bob's entry with result 30, got %v, %v", entry, err)
+	}
+
+	for caller, want := range map[context.Context]float64{alice: 3, bob: 30, ctx: 300} {
+		resp, err := client.GetHistory(caller, &pb.HistoryRequest{})
+		if err != nil {
+			t.Fatalf("GetHistory failed: %v", err)
+		}
+		if len(resp.Entries) != 1 || resp.Entries[0].Result != want {
+			t.Errorf("Expected only the entry with result %v, got %v", want, resp.Entries)
+		}
+	}
+}
+
+// startTestServer serves service over an in-memory connection and returns
+// a client for it
+func startTestServer(t *testing.T, service *Service) pb.CalculatorClient {
+	t.Helper()
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	pb.RegisterCalculatorServer(server, service)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("Failed to dial test server: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewCalculatorClient(conn)
+}
+
+func TestService_Batch(t *testing.T) {
+	service := NewService()
+
+	req := &pb.BatchRequest{Operations: []*pb.BatchOperation{
+		{Operation: pb.Operation_OPERATION_ADD, A: 1, B: 2},
+		{Operation: pb.Operation_OPERATION_DIVIDE, A: 1, B: 0},
+		{Operation: pb.Operation_OPERATION_UNSPECIFIED, A: 1, B: 1},
+		{Operation: pb.Operation_OPERATION_MULTIPLY, A: 3, B: 4},
+	}}
+	resp, err := service.Batch(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Batch failed: %v", err)
+	}
+
+	if len(resp.Results) != 4 || resp.Failed != 2 {
+		t.Fatalf("Expected 4 results with 2 failures, got %d with %d", len(resp.Results), resp.Failed)
+	}
+	if resp.Results[0].Result != 3 || resp.Results[3].Result != 12 {
+		t.Errorf("Expected results 3 and 12, got %f and %f", resp.Results[0].Result, resp.Results[3].Result)
+	}
+	if resp.Results[1].Error != "division by zero" || resp.Results[2].Error != "unknown operation" {
+		t.Errorf("Unexpected errors %q and %q", resp.Results[1].Error, resp.Results[2].Error)
+	}
+
+	history, _ := service.GetHistory(context.Background(), &pb.HistoryRequest{})
+	if len(history.Entries) != 2 {
+		t.Errorf("Expected 2 history entries for the successful operations, got %d", len(history.Entries))
+	}
+
+	req.StopOnError = true
+	resp, _ = service.Batch(context.Background(), req)
+	if len(resp.Results) != 2 || resp.Failed != 1 {
+		t.Errorf("Expected batch to stop after the first failure, got %d results", len(resp.Results))
+	}
+
+	req.Operations = make([]*pb.BatchOperation, maxBatchSize+1)
+	if _, err := service.Batch(context.Background(), req); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument for an oversized batch, got %v", err)
+	}
+}
+
+func TestService_WatchHistory(t *testing.T) {
+	service := NewService()
+	client := startTestServer(t, service)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	service.Add(ctx, &pb.OperationRequest{A: 1, B: 1})
+	service.Add(ctx, &pb.OperationRequest{A: 2, B: 2})
+
+	stream, err := client.WatchHistory(ctx, &pb.WatchHistoryRequest{Replay: 1})
+	if err != nil {
+		t.Fatalf("WatchHistory failed: %v", err)
+	}
+	entry, err := stream.Recv()
+	if err != nil || entry.Result != 4 {
+		t.Fatalf("Expected replayed entry with result 4, got %v, %v", entry, err)
+	}
+
+	// Wait until the watcher is registered before adding more
+	for {
+		service.mutex.RLock()
+		watching := len(service.watchers)
+		service.mutex.RUnlock()
+		if watching == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	service.Multiply(ctx, &pb.OperationRequest{A: 3, B: 5})
+	entry, err = stream.Recv()
+	if err != nil || entry.Operation != "multiply" || entry.Result != 15 {
+		t.Errorf("Expected new multiply entry with result 15, got %v, %v", entry, err)
+	}
+}
+
+func TestService_WatchHistorySlowWatcher(t *testing.T) {
+	service := NewService()
+	watcher := make(chan *pb.HistoryEntry, watchBuffer)
+	service.watchers[watcher] = ""
+
+	for i := 0; i <= watchBuffer; i++ {
+		service.Add(context.Background(), &pb.OperationRequest{A: float64(i), B: 1})
+	}
+
+	if len(service.watchers) != 0 {
+		t.Error("Expected the full watcher to be dropped")
+	}
+	// Draining ends only if the watcher was closed
+	for range watcher {
+	}
+}
+
+func TestService_Session(t *testing.T) {
+	service := NewService()
+	client := startTestServer(t, service)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.Session(ctx)
+	if err != nil {
+		t.Fatalf("Session failed: %v", err)
+	}
+
+	steps := []struct {
+		req     *pb.SessionRequest
+		total   float64
+		success bool
+	}{
+		{&pb.SessionRequest{Operation: pb.Operation_OPERATION_ADD, Operand: 5}, 5, true},
+		{&pb.SessionRequest{Operation: pb.Operation_OPERATION_MULTIPLY, Operand: 3}, 15, true},
+		{&pb.SessionRequest{Operation: pb.Operation_OPERATION_DIVIDE, Operand: 0}, 15, false},
+		{&pb.SessionRequest{SetTotal: true, Operand: 100}, 100, true},
+		{&pb.SessionRequest{Operation: pb.Operation_OPERATION_SUBTRACT, Operand: 1}, 99, true},
+	}
+	for i, step := range steps {
+		if err := stream.Send(step.req); err != nil {
+			t.Fatalf("Send failed: %v", err)
+		}
+		resp, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("Recv failed: %v", err)
+		}
+		if resp.Total != step.total || resp.Success != step.success {
+			t.Errorf("Step %d: expected total %f and success %v, got %f and %v", i, step.total, step.success, resp.Total, resp.Success)
+		}
+	}
+
+	stream.CloseSend()
+	if _, err := stream.Recv(); err != io.EOF {
+		t.Errorf("Expected io.EOF after closing the session, got %v", err)
+	}
+
+	history, _ := service.GetHistory(ctx, &pb.HistoryRequest{})
+	if len(history.Entries) != 3 || history.Entries[1].A != 5 || history.Entries[1].Result != 15 {
+		t.Errorf("Expected 3 history entries with running totals, got %v", history.Entries)
+	}
+}
+
+func TestService_Evaluate(t *testing.T) {
+	client := startTestServer(t, NewService())
+	ctx := context.Background()
+
+	resp, err := client.Evaluate(ctx, &pb.ExpressionRequest{
+		Expression: "price * (1 + rate)",
+		Variables:  map[string]float64{"price": 200, "rate": 0.25},
+	})
+	if err != nil {
+		t.Fatalf("Evaluate failed: %v", err)
+	}
+	if resp.Result != 250 || resp.Expression != "price * (1 + rate)" {
+		t.Errorf("Expected 250, got %v for '%s'", resp.Result, resp.Expression)
+	}
+
+	_, err = client.Evaluate(ctx, &pb.ExpressionRequest{Expression: "2 * (3 + y)"})
+	st := status.Convert(err)
+	if st.Code() != codes.InvalidArgument {
+		t.Fatalf("Expected InvalidArgument, got %v", err)
+	}
+	details := st.Details()
+	if len(details) != 1 {
+		t.Fatalf("Expected 1 detail, got %v", details)
+	}
+	detail, ok := details[0].(*pb.ExpressionError)
+	if !ok || detail.Message != "unknown variable" || detail.Position != 10 || detail.Token != "y" {
+		t.Errorf("Expected unknown variable 'y' at position 10, got %v", details[0])
+	}
+
+	// Evaluations are not part of the operation history
+	history, _ := client.GetHistory(ctx, &pb.HistoryRequest{})
+	if len(history.Entries) != 0 {
+		t.Errorf("Expected empty history, got %d entries", len(history.Entries))
+	}
+}
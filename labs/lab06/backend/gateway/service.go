@@ -9,7 +9,10 @@ import (
 
 	"github.com/gorilla/mux"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 
 	pb "lab06-backend/proto"
 )
@@ -36,7 +39,8 @@ type OperationResponse struct {
 
 // HistoryResponse represents HTTP history response
 type HistoryResponse struct {
-	Entries []HistoryEntry `json:"entries"`
+	Entries       []HistoryEntry `json:"entries"`
+	NextPageToken string         `json:"next_page_token,omitempty"`
 }
 
 // HistoryEntry represents a single history entry
@@ -46,6 +50,27 @@ type HistoryEntry struct {
 	B         float64 `json:"b"`
 	Result    float64 `json:"result"`
 	Timestamp int64   `json:"timestamp"`
+	ID        int64   `json:"id"`
+}
+
+// EvaluateRequest represents an HTTP expression request
+type EvaluateRequest struct {
+	Expression string             `json:"expression"`
+	Variables  map[string]float64 `json:"variables,omitempty"`
+}
+
+// EvaluateResponse represents an HTTP expression result
+type EvaluateResponse struct {
+	Result     float64 `json:"result"`
+	Expression string  `json:"expression"`
+}
+
+// EvaluateError represents an invalid expression. Position is 1-based and
+// 0 when the calculator did not locate the problem.
+type EvaluateError struct {
+	Error    string `json:"error"`
+	Position int32  `json:"position,omitempty"`
+	Token    string `json:"token,omitempty"`
 }
 
 // NewService creates a new gateway service
@@ -93,14 +118,20 @@ func (s *Service) setupRoutes() {
 	api.HandleFunc("/calculate/{operation}", s.handleOptions).Methods("OPTIONS")
 	api.HandleFunc("/history", s.handleOptions).Methods("OPTIONS")
 	api.HandleFunc("/health", s.handleOptions).Methods("OPTIONS")
+	api.HandleFunc("/evaluate", s.handleOptions).Methods("OPTIONS")
 
 	// Regular API routes
 	api.HandleFunc("/calculate/add", s.handleAdd).Methods("POST")
 	api.HandleFunc("/calculate/subtract", s.handleSubtract).Methods("POST")
 	api.HandleFunc("/calculate/multiply", s.handleMultiply).Methods("POST")
 	api.HandleFunc("/calculate/divide", s.handleDivide).Methods("POST")
+	api.HandleFunc("/evaluate", s.handleEvaluate).Methods("POST")
 	api.HandleFunc("/history", s.handleHistory).Methods("GET")
 	api.HandleFunc("/health", s.handleHealth).Methods("GET")
+
+	// Unversioned alias of the evaluate route
+	s.router.HandleFunc("/api/evaluate", s.handleOptions).Methods("OPTIONS")
+	s.router.HandleFunc("/api/evaluate", s.handleEvaluate).Methods("POST")
 }
 
 // GetRouter returns the HTTP router
@@ -116,12 +147,12 @@ func (s *Service) handleAdd(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := callContext(r)
 	defer cancel()
 
 	resp, err := s.calculatorClient.Add(ctx, &pb.OperationRequest{A: req.A, B: req.B})
 	if err != nil {
-		http.Error(w, "Calculator service error", http.StatusInternalServerError)
+		writeCallError(w, err)
 		return
 	}
 
@@ -136,12 +167,12 @@ func (s *Service) handleSubtract(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := callContext(r)
 	defer cancel()
 
 	resp, err := s.calculatorClient.Subtract(ctx, &pb.OperationRequest{A: req.A, B: req.B})
 	if err != nil {
-		http.Error(w, "Calculator service error", http.StatusInternalServerError)
+		writeCallError(w, err)
 		return
 	}
 
@@ -156,12 +187,12 @@ func (s *Service) handleMultiply(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := callContext(r)
 	defer cancel()
 
 	resp, err := s.calculatorClient.Multiply(ctx, &pb.OperationRequest{A: req.A, B: req.B})
 	if err != nil {
-		http.Error(w, "Calculator service error", http.StatusInternalServerError)
+		writeCallError(w, err)
 		return
 	}
 
@@ -176,11 +207,16 @@ func (s *Service) handleDivide(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := callContext(r)
 	defer cancel()
 
 	resp, err := s.calculatorClient.Divide(ctx, &pb.OperationRequest{A: req.A, B: req.B})
 
+	if err != nil && status.Code(err) != codes.InvalidArgument {
+		writeCallError(w, err)
+		return
+	}
+
 	// Handle division by zero gracefully
 	if err != nil {
 		errorResp := &OperationResponse{
@@ -198,9 +234,55 @@ func (s *Service) handleDivide(w http.ResponseWriter, r *http.Request) {
 	s.writeResponse(w, resp)
 }
 
-// handleHistory handles history requests
+// handleEvaluate handles expression requests
+func (s *Service) handleEvaluate(w http.ResponseWriter, r *http.Request) {
+	var req EvaluateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := callContext(r)
+	defer cancel()
+
+	resp, err := s.calculatorClient.Evaluate(ctx, &pb.ExpressionRequest{
+		Expression: req.Expression,
+		Variables:  req.Variables,
+	})
+	if err != nil {
+		st := status.Convert(err)
+		if st.Code() != codes.InvalidArgument {
+			writeCallError(w, err)
+			return
+		}
+
+		// Pass on where the expression went wrong
+		errorResp := &EvaluateError{Error: st.Message()}
+		for _, detail := range st.Details() {
+			if exprErr, ok := detail.(*pb.ExpressionError); ok {
+				errorResp.Error = exprErr.Message
+				errorResp.Position = exprErr.Position
+				errorResp.Token = exprErr.Token
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(errorResp)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&EvaluateResponse{
+		Result:     resp.Result,
+		Expression: resp.Expression,
+	})
+}
+
+// handleHistory handles history requests. The operation, since, until and
+// page_token query parameters are passed on to the calculator.
 func (s *Service) handleHistory(w http.ResponseWriter, r *http.Request) {
-	limitStr := r.URL.Query().Get("limit")
+	query := r.URL.Query()
+	limitStr := query.Get("limit")
 	limit := int32(10) // default limit
 
 	if limitStr != "" {
@@ -209,12 +291,32 @@ func (s *Service) handleHistory(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	req := &pb.HistoryRequest{
+		Limit:     limit,
+		Operation: query.Get("operation"),
+		PageToken: query.Get("page_token"),
+	}
+	for name, bound := range map[string]*int64{"since": &req.Since, "until": &req.Until} {
+		if value := query.Get(name); value != "" {
+			parsed, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				http.Error(w, "Invalid "+name+" timestamp", http.StatusBadRequest)
+				return
+			}
+			*bound = parsed
+		}
+	}
+
+	ctx, cancel := callContext(r)
 	defer cancel()
 
-	resp, err := s.calculatorClient.GetHistory(ctx, &pb.HistoryRequest{Limit: limit})
+	resp, err := s.calculatorClient.GetHistory(ctx, req)
+	if status.Code(err) == codes.InvalidArgument {
+		http.Error(w, status.Convert(err).Message(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
-		http.Error(w, "Calculator service error", http.StatusInternalServerError)
+		writeCallError(w, err)
 		return
 	}
 
@@ -227,10 +329,11 @@ func (s *Service) handleHistory(w http.ResponseWriter, r *http.Request) {
 			B:         entry.B,
 			Result:    entry.Result,
 			Timestamp: entry.Timestamp,
+			ID:        entry.Id,
 		}
 	}
 
-	historyResp := &HistoryResponse{Entries: entries}
+	historyResp := &HistoryResponse{Entries: entries, NextPageToken: resp.NextPageToken}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(historyResp)
@@ -254,6 +357,30 @@ func (s *Service) handleOptions(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+// callContext bounds a calculator call and passes on the credentials of
+// r. The calculator learns the caller from them; a caller named by the
+// client itself is never trusted.
+func callContext(r *http.Request) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	if authorization := r.Header.Get("Authorization"); authorization != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", authorization)
+	}
+	return ctx, cancel
+}
+
+// writeCallError reports a failed calculator call. Rejections by the
+// calculator's auth and rate limiting keep their meaning for the client.
+func writeCallError(w http.ResponseWriter, err error) {
+	switch status.Code(err) {
+	case codes.Unauthenticated:
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	case codes.ResourceExhausted:
+		http.Error(w, "Too many requests", http.StatusTooManyRequests)
+	default:
+		http.Error(w, "Calculator service error", http.StatusInternalServerError)
+	}
+}
+
 // writeResponse writes a gRPC response as HTTP JSON
 func (s *Service) writeResponse(w http.ResponseWriter, resp *pb.OperationResponse) {
 	httpResp := &OperationResponse{
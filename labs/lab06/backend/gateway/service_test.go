@@ -13,6 +13,7 @@ import (
 	"github.com/gorilla/mux"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 )
 
@@ -23,13 +24,29 @@ type MockCalculatorClient struct {
 	multiplyResponse *pb.OperationResponse
 	divideResponse   *pb.OperationResponse
 	historyResponse  *pb.HistoryResponse
+	evaluateError    error
+	addError         error
 	shouldError      bool
+
+	// lastHistoryRequest and lastCaller record the last GetHistory call;
+	// lastCaller is any x-caller-id metadata sent along
+	lastHistoryRequest *pb.HistoryRequest
+	lastCaller         string
+	// lastAuthorization records the credentials of the last Add call
+	lastAuthorization string
 }
 
 func (m *MockCalculatorClient) Add(ctx context.Context, req *pb.OperationRequest, opts ...grpc.CallOption) (*pb.OperationResponse, error) {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	if values := md.Get("authorization"); len(values) > 0 {
+		m.lastAuthorization = values[0]
+	}
 	if m.shouldError {
 		return nil, status.Error(codes.Internal, "mock error")
 	}
+	if m.addError != nil {
+		return nil, m.addError
+	}
 	if m.addResponse != nil {
 		return m.addResponse, nil
 	}
@@ -86,6 +103,11 @@ func (m *MockCalculatorClient) Divide(ctx context.Context, req *pb.OperationRequ
 }
 
 func (m *MockCalculatorClient) GetHistory(ctx context.Context, req *pb.HistoryRequest, opts ...grpc.CallOption) (*pb.HistoryResponse, error) {
+	m.lastHistoryRequest = req
+	md, _ := metadata.FromOutgoingContext(ctx)
+	if callers := md.Get("x-caller-id"); len(callers) > 0 {
+		m.lastCaller = callers[0]
+	}
 	if m.shouldError {
 		return nil, status.Error(codes.Internal, "mock error")
 	}
@@ -99,6 +121,31 @@ func (m *MockCalculatorClient) GetHistory(ctx context.Context, req *pb.HistoryRe
 	}, nil
 }
 
+func (m *MockCalculatorClient) Batch(ctx context.Context, req *pb.BatchRequest, opts ...grpc.CallOption) (*pb.BatchResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "not used by the gateway")
+}
+
+func (m *MockCalculatorClient) WatchHistory(ctx context.Context, req *pb.WatchHistoryRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[pb.HistoryEntry], error) {
+	return nil, status.Error(codes.Unimplemented, "not used by the gateway")
+}
+
+func (m *MockCalculatorClient) Session(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[pb.SessionRequest, pb.SessionResponse], error) {
+	return nil, status.Error(codes.Unimplemented, "not used by the gateway")
+}
+
+func (m *MockCalculatorClient) Evaluate(ctx context.Context, req *pb.ExpressionRequest, opts ...grpc.CallOption) (*pb.ExpressionResponse, error) {
+	if m.shouldError {
+		return nil, status.Error(codes.Internal, "mock error")
+	}
+	if m.evaluateError != nil {
+		return nil, m.evaluateError
+	}
+	return &pb.ExpressionResponse{
+		Result:     req.Variables["x"] * 2,
+		Expression: req.Expression,
+	}, nil
+}
+
 func createTestService() *Service {
 	s := &Service{
 		calculatorClient: &MockCalculatorClient{},
@@ -229,6 +276,72 @@ func TestService_HandleHistory(t *testing.T) {
 	}
 }
 
+func TestService_HandleHistoryFilters(t *testing.T) {
+	client := &MockCalculatorClient{historyResponse: &pb.HistoryResponse{NextPageToken: "next"}}
+	service := createTestService()
+	service.calculatorClient = client
+
+	req := httptest.NewRequest("GET", "/api/v1/history?limit=5&operation=add&since=100&until=200&page_token=abc", nil)
+	req.Header.Set("X-Caller-ID", "alice")
+	rr := httptest.NewRecorder()
+
+	service.GetRouter().ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", rr.Code)
+	}
+
+	got := client.lastHistoryRequest
+	if got.Limit != 5 || got.Operation != "add" || got.Since != 100 || got.Until != 200 || got.PageToken != "abc" {
+		t.Errorf("Expected the query to be passed on, got %v", got)
+	}
+	if client.lastCaller != "" {
+		t.Errorf("Expected a client-named caller not to be passed on, got '%s'", client.lastCaller)
+	}
+
+	var resp HistoryResponse
+	json.NewDecoder(rr.Body).Decode(&resp)
+	if resp.NextPageToken != "next" {
+		t.Errorf("Expected next page token 'next', got '%s'", resp.NextPageToken)
+	}
+
+	req = httptest.NewRequest("GET", "/api/v1/history?since=yesterday", nil)
+	rr = httptest.NewRecorder()
+	service.GetRouter().ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid timestamp, got %d", rr.Code)
+	}
+}
+
+func TestService_CalculatorRejections(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+	}{
+		{status.Error(codes.Unauthenticated, "missing bearer token"), http.StatusUnauthorized},
+		{status.Error(codes.ResourceExhausted, "rate limit exceeded"), http.StatusTooManyRequests},
+		{status.Error(codes.Unavailable, "connection refused"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		client := &MockCalculatorClient{addError: tt.err}
+		service := createTestService()
+		service.calculatorClient = client
+
+		req := httptest.NewRequest("POST", "/api/v1/calculate/add", bytes.NewBuffer([]byte(`{"a":1,"b":2}`)))
+		req.Header.Set("Authorization", "Bearer secret")
+		rr := httptest.NewRecorder()
+		service.GetRouter().ServeHTTP(rr, req)
+
+		if rr.Code != tt.status {
+			t.Errorf("Expected status %d for %v, got %d", tt.status, status.Code(tt.err), rr.Code)
+		}
+		if client.lastAuthorization != "Bearer secret" {
+			t.Errorf("Expected the Authorization header to be passed on, got '%s'", client.lastAuthorization)
+		}
+	}
+}
+
 func TestService_HandleHealth(t *testing.T) {
 	service := createTestService()
 
@@ -266,3 +379,93 @@ func TestService_InvalidRequestBody(t *testing.T) {
 		t.Errorf("Expected status 400, got %d", rr.Code)
 	}
 }
+
+func TestService_HandleEvaluate(t *testing.T) {
+	service := createTestService()
+
+	jsonBody := []byte(`{"expression":"x * 2","variables":{"x":21}}`)
+	req := httptest.NewRequest("POST", "/api/v1/evaluate", bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+
+	rr := httptest.NewRecorder()
+	service.GetRouter().ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", rr.Code)
+	}
+
+	var resp EvaluateResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if resp.Result != 42 || resp.Expression != "x * 2" {
+		t.Errorf("Expected 42 for 'x * 2', got %v for '%s'", resp.Result, resp.Expression)
+	}
+}
+
+func TestService_HandleEvaluateUnversionedPath(t *testing.T) {
+	service := createTestService()
+
+	req := httptest.NewRequest("POST", "/api/evaluate", bytes.NewBuffer([]byte(`{"expression":"1 + 2"}`)))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	service.GetRouter().ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", rr.Code)
+	}
+
+	var resp EvaluateResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.Expression != "1 + 2" {
+		t.Errorf("Expected expression '1 + 2', got '%s'", resp.Expression)
+	}
+
+	req = httptest.NewRequest("OPTIONS", "/api/evaluate", nil)
+	rr = httptest.NewRecorder()
+	service.GetRouter().ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected status 200 for OPTIONS, got %d", rr.Code)
+	}
+}
+
+func TestService_HandleEvaluateInvalidExpression(t *testing.T) {
+	st, _ := status.New(codes.InvalidArgument, `unexpected token at position 5: ")"`).WithDetails(&pb.ExpressionError{
+		Message:  "unexpected token",
+		Position: 5,
+		Token:    ")",
+	})
+	service := createTestService()
+	service.calculatorClient = &MockCalculatorClient{evaluateError: st.Err()}
+
+	req := httptest.NewRequest("POST", "/api/v1/evaluate", bytes.NewBuffer([]byte(`{"expression":"1 + )"}`)))
+	req.Header.Set("Content-Type", "application/json")
+
+	rr := httptest.NewRecorder()
+	service.GetRouter().ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", rr.Code)
+	}
+
+	var resp EvaluateError
+	json.NewDecoder(rr.Body).Decode(&resp)
+
+	if resp.Error != "unexpected token" || resp.Position != 5 || resp.Token != ")" {
+		t.Errorf("Expected unexpected token ')' at position 5, got %+v", resp)
+	}
+
+	// Other failures of the calculator are not the client's fault
+	service.calculatorClient = &MockCalculatorClient{shouldError: true}
+	req = httptest.NewRequest("POST", "/api/v1/evaluate", bytes.NewBuffer([]byte(`{"expression":"1"}`)))
+	rr = httptest.NewRecorder()
+	service.GetRouter().ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status 500, got %d", rr.Code)
+	}
+}
@@ -10,6 +10,7 @@ toolchain go1.23.1
 require (
 	github.com/gorilla/mux v1.8.1
 	github.com/gorilla/websocket v1.5.3
+	github.com/mattn/go-sqlite3 v1.14.22
 	google.golang.org/grpc v1.73.0
 	google.golang.org/protobuf v1.36.6
 )
@@ -0,0 +1,92 @@
+package interceptor
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestAuth(t *testing.T) {
+	auth := NewAuth(AuthConfig{
+		Validate: func(ctx context.Context, token string) (string, error) {
+			switch token {
+			case "valid":
+				return "alice", nil
+			case "broken":
+				return "", errors.New("token service down")
+			}
+			return "", ErrInvalidToken
+		},
+		Public:         []string{"/test/Public"},
+		CallerMetadata: "x-caller-id",
+	})
+
+	var seen context.Context
+	handler := func(ctx context.Context, req any) (any, error) {
+		seen = ctx
+		return "ok", nil
+	}
+	call := func(method string, md metadata.MD) error {
+		seen = nil
+		ctx := metadata.NewIncomingContext(context.Background(), md)
+		_, err := auth.Unary()(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+		return err
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		md     metadata.MD
+		code   codes.Code
+	}{
+		{"no token", "/test/Private", metadata.MD{}, codes.Unauthenticated},
+		{"not bearer", "/test/Private", metadata.Pairs("authorization", "Basic valid"), codes.Unauthenticated},
+		{"invalid token", "/test/Private", metadata.Pairs("authorization", "Bearer guess"), codes.Unauthenticated},
+		{"validator failure", "/test/Private", metadata.Pairs("authorization", "Bearer broken"), codes.Unavailable},
+		{"public method", "/test/Public", metadata.MD{}, codes.OK},
+		{"invalid token on public method", "/test/Public", metadata.Pairs("authorization", "Bearer guess"), codes.Unauthenticated},
+	}
+	for _, tt := range tests {
+		if err := call(tt.method, tt.md); status.Code(err) != tt.code {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.code, err)
+		}
+	}
+
+	if err := call("/test/Private", metadata.Pairs("authorization", "Bearer valid", "x-caller-id", "mallory")); err != nil {
+		t.Fatalf("Expected a valid token to pass, got %v", err)
+	}
+	if caller, ok := CallerFromContext(seen); !ok || caller != "alice" {
+		t.Errorf("Expected caller 'alice', got '%s'", caller)
+	}
+	md, _ := metadata.FromIncomingContext(seen)
+	if got := md.Get("x-caller-id"); len(got) != 1 || got[0] != "alice" {
+		t.Errorf("Expected caller metadata to be replaced by 'alice', got %v", got)
+	}
+
+	if err := call("/test/Public", metadata.Pairs("x-caller-id", "alice")); err != nil {
+		t.Fatalf("Expected an anonymous public call to pass, got %v", err)
+	}
+	if _, ok := CallerFromContext(seen); ok {
+		t.Error("Expected no caller on an anonymous call")
+	}
+	md, _ = metadata.FromIncomingContext(seen)
+	if got := md.Get("x-caller-id"); len(got) != 0 {
+		t.Errorf("Expected claimed caller metadata to be removed, got %v", got)
+	}
+}
+
+func TestStaticTokens(t *testing.T) {
+	validate := StaticTokens(map[string]string{"s3cret": "alice"})
+
+	if caller, err := validate(context.Background(), "s3cret"); err != nil || caller != "alice" {
+		t.Errorf("Expected 'alice', got '%s', %v", caller, err)
+	}
+	if _, err := validate(context.Background(), "s3cre"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected ErrInvalidToken, got %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+// Package interceptor provides gRPC server middleware for the calculator:
+// bearer-token auth, request logging, metrics, panic recovery and rate
+// limiting.
+package interceptor
+
+import (
+	"context"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+)
+
+// Interceptor is a server middleware for unary calls and streams
+type Interceptor interface {
+	Unary() grpc.UnaryServerInterceptor
+	Stream() grpc.StreamServerInterceptor
+}
+
+// ServerOptions chains interceptors so the first one runs outermost
+func ServerOptions(interceptors ...Interceptor) []grpc.ServerOption {
+	unary := make([]grpc.UnaryServerInterceptor, len(interceptors))
+	stream := make([]grpc.StreamServerInterceptor, len(interceptors))
+	for i, interceptor := range interceptors {
+		unary[i] = interceptor.Unary()
+		stream[i] = interceptor.Stream()
+	}
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(unary...),
+		grpc.ChainStreamInterceptor(stream...),
+	}
+}
+
+// contextStream is a stream whose context carries values added by an
+// interceptor
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
+
+func withContext(stream grpc.ServerStream, ctx context.Context) grpc.ServerStream {
+	return &contextStream{ServerStream: stream, ctx: ctx}
+}
+
+// clientKey identifies the client of a call: the authenticated caller if
+// there is one, otherwise the peer's IP address. The gateway does not
+// forward its HTTP clients' addresses, since any gRPC client could claim
+// one, so only bearer tokens tell its callers apart.
+func clientKey(ctx context.Context) string {
+	if caller, ok := CallerFromContext(ctx); ok {
+		return "caller:" + caller
+	}
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return "unknown"
+	}
+	addr := p.Addr.String()
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return "ip:" + host
+	}
+	return "ip:" + addr
+}
@@ -0,0 +1,130 @@
+package interceptor
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"lab06-backend/calculator"
+	pb "lab06-backend/proto"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// startTestServer serves a calculator behind interceptors over an
+// in-memory connection and returns a client for it
+func startTestServer(t *testing.T, interceptors ...Interceptor) pb.CalculatorClient {
+	t.Helper()
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(ServerOptions(interceptors...)...)
+	pb.RegisterCalculatorServer(server, calculator.NewService(calculator.WithCaller(CallerFromContext)))
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("Failed to dial test server: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewCalculatorClient(conn)
+}
+
+func TestServerOptions(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&logs, nil))
+	metrics := NewMetrics()
+	client := startTestServer(t,
+		NewLogging(logger),
+		metrics,
+		NewRecovery(logger),
+		NewAuth(AuthConfig{
+			Validate: StaticTokens(map[string]string{"alice-token": "alice", "bob-token": "bob"}),
+			Public:   []string{"/calculator.Calculator/GetHistory"},
+		}),
+		NewRateLimit(100, 100),
+	)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := client.Add(ctx, &pb.OperationRequest{A: 1, B: 2}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Expected Unauthenticated without a token, got %v", err)
+	}
+
+	// bob cannot read alice's history by claiming to be her, and neither
+	// can an anonymous call of a public method
+	alice := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer alice-token")
+	bob := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer bob-token", "x-caller-id", "alice")
+	anonymous := metadata.AppendToOutgoingContext(ctx, "x-caller-id", "alice")
+	var header metadata.MD
+	if _, err := client.Add(alice, &pb.OperationRequest{A: 1, B: 2}, grpc.Header(&header)); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if len(header.Get(RequestIDMetadataKey)) != 1 {
+		t.Errorf("Expected a request ID header, got %v", header)
+	}
+	history, err := client.GetHistory(bob, &pb.HistoryRequest{})
+	if err != nil {
+		t.Fatalf("GetHistory failed: %v", err)
+	}
+	if len(history.Entries) != 0 {
+		t.Errorf("Expected bob to see no entries, got %v", history.Entries)
+	}
+	history, err = client.GetHistory(anonymous, &pb.HistoryRequest{})
+	if err != nil {
+		t.Fatalf("GetHistory failed: %v", err)
+	}
+	if len(history.Entries) != 0 {
+		t.Errorf("Expected an anonymous call to see no entries, got %v", history.Entries)
+	}
+	history, err = client.GetHistory(alice, &pb.HistoryRequest{})
+	if err != nil || len(history.Entries) != 1 {
+		t.Errorf("Expected alice to see her entry, got %v, %v", history, err)
+	}
+
+	// Streams pass through the chain as well
+	stream, err := client.Session(alice)
+	if err != nil {
+		t.Fatalf("Session failed: %v", err)
+	}
+	stream.Send(&pb.SessionRequest{Operation: pb.Operation_OPERATION_ADD, Operand: 5})
+	stream.CloseSend()
+	if resp, err := stream.Recv(); err != nil || resp.Total != 5 {
+		t.Errorf("Expected total 5, got %v, %v", resp, err)
+	}
+	for {
+		if _, err := stream.Recv(); err != nil {
+			break
+		}
+	}
+
+	// The stream is recorded after the client has seen its end
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if _, ok := metrics.Snapshot()["/calculator.Calculator/Session"]; ok {
+			break
+		}
+	}
+	snapshot := metrics.Snapshot()
+	if add := snapshot["/calculator.Calculator/Add"]; add.Calls != 2 || add.Errors != 1 || add.Codes["Unauthenticated"] != 1 {
+		t.Errorf("Expected 2 Add calls with 1 Unauthenticated, got %+v", add)
+	}
+	if session := snapshot["/calculator.Calculator/Session"]; session.Calls != 1 || session.Errors != 0 {
+		t.Errorf("Expected 1 successful Session, got %+v", session)
+	}
+	if !strings.Contains(logs.String(), `"caller":"alice"`) || !strings.Contains(logs.String(), `"code":"Unauthenticated"`) {
+		t.Errorf("Expected log records with the caller and failed auth, got %s", logs.String())
+	}
+}
@@ -0,0 +1,112 @@
+package interceptor
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// RequestIDMetadataKey carries the request ID in both directions. A
+// client may pick its own; otherwise one is generated.
+const RequestIDMetadataKey = "x-request-id"
+
+// maxRequestIDLength bounds client-chosen request IDs
+const maxRequestIDLength = 64
+
+type requestIDKey struct{}
+
+// loggedCall collects what inner interceptors learn about a call, such as
+// the caller found by Auth, for the record written afterwards
+type loggedCall struct {
+	caller string
+}
+
+type loggedCallKey struct{}
+
+// Logging writes one structured record per call or stream with its
+// method, request ID, caller, status code and duration
+type Logging struct {
+	logger *slog.Logger
+}
+
+// NewLogging creates a Logging interceptor writing to logger
+func NewLogging(logger *slog.Logger) *Logging {
+	return &Logging{logger: logger}
+}
+
+// RequestIDFromContext returns the request ID assigned by Logging
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+func (l *Logging) Unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, id := withRequestID(ctx)
+		grpc.SetHeader(ctx, metadata.Pairs(RequestIDMetadataKey, id))
+		call := &loggedCall{}
+		ctx = context.WithValue(ctx, loggedCallKey{}, call)
+
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		l.log(ctx, call, info.FullMethod, "unary", start, err)
+		return resp, err
+	}
+}
+
+func (l *Logging) Stream() grpc.StreamServerInterceptor {
+	return func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, id := withRequestID(stream.Context())
+		stream.SetHeader(metadata.Pairs(RequestIDMetadataKey, id))
+		call := &loggedCall{}
+		ctx = context.WithValue(ctx, loggedCallKey{}, call)
+
+		start := time.Now()
+		err := handler(srv, withContext(stream, ctx))
+		l.log(ctx, call, info.FullMethod, "stream", start, err)
+		return err
+	}
+}
+
+func (l *Logging) log(ctx context.Context, call *loggedCall, method, kind string, start time.Time, err error) {
+	code := status.Code(err)
+	level := slog.LevelInfo
+	if err != nil {
+		level = slog.LevelWarn
+	}
+	attrs := []slog.Attr{
+		slog.String("method", method),
+		slog.String("kind", kind),
+		slog.String("request_id", RequestIDFromContext(ctx)),
+		slog.String("code", code.String()),
+		slog.Duration("duration", time.Since(start)),
+	}
+	if call.caller != "" {
+		attrs = append(attrs, slog.String("caller", call.caller))
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", status.Convert(err).Message()))
+	}
+	l.logger.LogAttrs(ctx, level, "grpc request", attrs...)
+}
+
+// withRequestID keeps the client's request ID or generates one
+func withRequestID(ctx context.Context) (context.Context, string) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	var id string
+	if values := md.Get(RequestIDMetadataKey); len(values) > 0 && len(values[0]) <= maxRequestIDLength {
+		id = values[0]
+	}
+	if id == "" {
+		b := make([]byte, 8)
+		rand.Read(b)
+		id = hex.EncodeToString(b)
+	}
+	return context.WithValue(ctx, requestIDKey{}, id), id
+}
@@ -0,0 +1,55 @@
+package interceptor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestLogging(t *testing.T) {
+	var logs bytes.Buffer
+	logging := NewLogging(slog.New(slog.NewJSONHandler(&logs, nil)))
+
+	var requestID string
+	handler := func(ctx context.Context, req any) (any, error) {
+		requestID = RequestIDFromContext(ctx)
+		return nil, status.Error(codes.InvalidArgument, "bad input")
+	}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(RequestIDMetadataKey, "req-42"))
+	logging.Unary()(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/test/Method"}, handler)
+
+	if requestID != "req-42" {
+		t.Errorf("Expected the client's request ID 'req-42', got '%s'", requestID)
+	}
+	var record map[string]any
+	if err := json.Unmarshal(logs.Bytes(), &record); err != nil {
+		t.Fatalf("Expected one JSON record, got %s", logs.String())
+	}
+	want := map[string]any{
+		"level":      "WARN",
+		"method":     "/test/Method",
+		"request_id": "req-42",
+		"code":       "InvalidArgument",
+		"error":      "bad input",
+	}
+	for key, value := range want {
+		if record[key] != value {
+			t.Errorf("Expected %s %v, got %v", key, value, record[key])
+		}
+	}
+
+	// Without one, each call gets a new ID
+	logging.Unary()(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/test/Method"}, handler)
+	first := requestID
+	logging.Unary()(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/test/Method"}, handler)
+	if len(first) != 16 || first == requestID {
+		t.Errorf("Expected distinct generated request IDs, got '%s' and '%s'", first, requestID)
+	}
+}
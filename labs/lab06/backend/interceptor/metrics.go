@@ -0,0 +1,93 @@
+package interceptor
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// MethodStats are the counters of one method. Latencies of streams cover
+// the whole stream.
+type MethodStats struct {
+	Calls        int64            `json:"calls"`
+	Errors       int64            `json:"errors"`
+	Codes        map[string]int64 `json:"codes"`
+	TotalLatency time.Duration    `json:"total_latency_ns"`
+	MaxLatency   time.Duration    `json:"max_latency_ns"`
+}
+
+// Metrics counts calls, errors by status code and latency per method. It
+// serves a JSON snapshot over HTTP.
+type Metrics struct {
+	mu      sync.Mutex
+	methods map[string]*MethodStats
+}
+
+// NewMetrics creates empty Metrics
+func NewMetrics() *Metrics {
+	return &Metrics{methods: make(map[string]*MethodStats)}
+}
+
+// Snapshot copies the current counters by full method name
+func (m *Metrics) Snapshot() map[string]MethodStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	snapshot := make(map[string]MethodStats, len(m.methods))
+	for method, stats := range m.methods {
+		copied := *stats
+		copied.Codes = make(map[string]int64, len(stats.Codes))
+		for code, n := range stats.Codes {
+			copied.Codes[code] = n
+		}
+		snapshot[method] = copied
+	}
+	return snapshot
+}
+
+// ServeHTTP writes the Snapshot as JSON
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(m.Snapshot())
+}
+
+func (m *Metrics) Unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		m.record(info.FullMethod, time.Since(start), err)
+		return resp, err
+	}
+}
+
+func (m *Metrics) Stream() grpc.StreamServerInterceptor {
+	return func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, stream)
+		m.record(info.FullMethod, time.Since(start), err)
+		return err
+	}
+}
+
+func (m *Metrics) record(method string, latency time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stats, ok := m.methods[method]
+	if !ok {
+		stats = &MethodStats{Codes: make(map[string]int64)}
+		m.methods[method] = stats
+	}
+	stats.Calls++
+	if err != nil {
+		stats.Errors++
+	}
+	stats.Codes[status.Code(err).String()]++
+	stats.TotalLatency += latency
+	if latency > stats.MaxLatency {
+		stats.MaxLatency = latency
+	}
+}
@@ -0,0 +1,44 @@
+package interceptor
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestMetrics(t *testing.T) {
+	metrics := NewMetrics()
+	info := &grpc.UnaryServerInfo{FullMethod: "/test/Method"}
+
+	metrics.Unary()(context.Background(), nil, info, func(ctx context.Context, req any) (any, error) {
+		time.Sleep(2 * time.Millisecond)
+		return "ok", nil
+	})
+	metrics.Unary()(context.Background(), nil, info, func(ctx context.Context, req any) (any, error) {
+		return nil, status.Error(codes.NotFound, "missing")
+	})
+
+	stats := metrics.Snapshot()["/test/Method"]
+	if stats.Calls != 2 || stats.Errors != 1 || stats.Codes["OK"] != 1 || stats.Codes["NotFound"] != 1 {
+		t.Errorf("Expected 2 calls with one NotFound, got %+v", stats)
+	}
+	if stats.MaxLatency < 2*time.Millisecond || stats.TotalLatency < stats.MaxLatency {
+		t.Errorf("Expected latencies of at least 2ms, got %+v", stats)
+	}
+
+	rr := httptest.NewRecorder()
+	metrics.ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	var served map[string]MethodStats
+	if err := json.NewDecoder(rr.Body).Decode(&served); err != nil {
+		t.Fatalf("Failed to decode metrics: %v", err)
+	}
+	if served["/test/Method"].Calls != 2 {
+		t.Errorf("Expected 2 calls served, got %+v", served)
+	}
+}
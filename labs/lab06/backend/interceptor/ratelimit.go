@@ -0,0 +1,113 @@
+package interceptor
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxRateLimitClients is how many clients are tracked. Past it, idle
+// clients are forgotten, or else the least recently seen one.
+const maxRateLimitClients = 10000
+
+// RateLimit allows each client rate calls per second with bursts of up to
+// burst calls, and fails the rest with ResourceExhausted. Clients are the
+// callers authenticated by Auth, or else peer IP addresses. Anonymous calls
+// relayed by the HTTP gateway all come from the gateway's address, so they
+// share one client. A stream counts as one call when it opens.
+type RateLimit struct {
+	rate       float64
+	burst      float64
+	now        func() time.Time
+	maxClients int
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimit creates a RateLimit interceptor
+func NewRateLimit(rate float64, burst int) *RateLimit {
+	return &RateLimit{
+		rate:       rate,
+		burst:      float64(burst),
+		now:        time.Now,
+		maxClients: maxRateLimitClients,
+		buckets:    make(map[string]*tokenBucket),
+	}
+}
+
+// Allow takes a token of client if there is one
+func (l *RateLimit) Allow(client string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+
+	bucket, ok := l.buckets[client]
+	if !ok {
+		if len(l.buckets) >= l.maxClients {
+			l.forgetIdle(now)
+		}
+		if len(l.buckets) >= l.maxClients {
+			l.forgetLeastRecent()
+		}
+		bucket = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[client] = bucket
+	}
+	bucket.tokens = min(l.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate)
+	bucket.last = now
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
+
+// forgetIdle drops the buckets that have refilled, which behave like new
+// ones. The caller holds the mutex.
+func (l *RateLimit) forgetIdle(now time.Time) {
+	for client, bucket := range l.buckets {
+		if bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, client)
+		}
+	}
+}
+
+// forgetLeastRecent drops the bucket used longest ago, so a flood of new
+// clients cannot grow the map without bound. The caller holds the mutex.
+func (l *RateLimit) forgetLeastRecent() {
+	var oldest string
+	var oldestBucket *tokenBucket
+	for client, bucket := range l.buckets {
+		if oldestBucket == nil || bucket.last.Before(oldestBucket.last) {
+			oldest, oldestBucket = client, bucket
+		}
+	}
+	delete(l.buckets, oldest)
+}
+
+func (l *RateLimit) Unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if !l.Allow(clientKey(ctx)) {
+			return nil, status.Error(codes.ResourceExhausted, "rate limit exceeded")
+		}
+		return handler(ctx, req)
+	}
+}
+
+func (l *RateLimit) Stream() grpc.StreamServerInterceptor {
+	return func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !l.Allow(clientKey(stream.Context())) {
+			return status.Error(codes.ResourceExhausted, "rate limit exceeded")
+		}
+		return handler(srv, stream)
+	}
+}
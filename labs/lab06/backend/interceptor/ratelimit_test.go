@@ -0,0 +1,81 @@
+package interceptor
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func TestRateLimit_Allow(t *testing.T) {
+	limit := NewRateLimit(2, 3)
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	limit.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if !limit.Allow("alice") {
+			t.Fatalf("Expected call %d of the burst to be allowed", i+1)
+		}
+	}
+	if limit.Allow("alice") {
+		t.Error("Expected the call after the burst to be limited")
+	}
+	if !limit.Allow("bob") {
+		t.Error("Expected another client to have its own limit")
+	}
+
+	// Two calls per second refill one token in half a second
+	now = now.Add(500 * time.Millisecond)
+	if !limit.Allow("alice") || limit.Allow("alice") {
+		t.Error("Expected exactly one call after half a second")
+	}
+}
+
+func TestRateLimit_MaxClients(t *testing.T) {
+	limit := NewRateLimit(1, 1)
+	limit.maxClients = 2
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	limit.now = func() time.Time { return now }
+
+	// Every client spends its token, so none is idle
+	for _, client := range []string{"alice", "bob", "carol"} {
+		if !limit.Allow(client) {
+			t.Fatalf("Expected the first call of %s to be allowed", client)
+		}
+		now = now.Add(10 * time.Millisecond)
+	}
+
+	if len(limit.buckets) != 2 {
+		t.Errorf("Expected 2 tracked clients, got %d", len(limit.buckets))
+	}
+	if _, ok := limit.buckets["alice"]; ok {
+		t.Error("Expected the least recently seen client to be forgotten")
+	}
+	if limit.Allow("carol") {
+		t.Error("Expected the tracked client to stay limited")
+	}
+}
+
+func TestRateLimit_Unary(t *testing.T) {
+	limit := NewRateLimit(1, 1)
+	handler := func(ctx context.Context, req any) (any, error) { return "ok", nil }
+	info := &grpc.UnaryServerInfo{FullMethod: "/test/Method"}
+	from := func(ip string) context.Context {
+		return peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(ip), Port: 40000}})
+	}
+
+	if _, err := limit.Unary()(from("192.0.2.1"), nil, info, handler); err != nil {
+		t.Fatalf("Expected the first call to pass, got %v", err)
+	}
+	if _, err := limit.Unary()(from("192.0.2.1"), nil, info, handler); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Expected ResourceExhausted, got %v", err)
+	}
+	if _, err := limit.Unary()(from("192.0.2.2"), nil, info, handler); err != nil {
+		t.Errorf("Expected another address to pass, got %v", err)
+	}
+}
@@ -0,0 +1,51 @@
+package interceptor
+
+import (
+	"context"
+	"log/slog"
+	"runtime/debug"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Recovery turns a panic in a handler into an Internal error, so one bad
+// call does not take down the server. The panic and its stack are logged,
+// not sent to the client.
+type Recovery struct {
+	logger *slog.Logger
+}
+
+// NewRecovery creates a Recovery interceptor logging to logger
+func NewRecovery(logger *slog.Logger) *Recovery {
+	return &Recovery{logger: logger}
+}
+
+func (r *Recovery) Unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+		defer r.recover(ctx, info.FullMethod, &err)
+		return handler(ctx, req)
+	}
+}
+
+func (r *Recovery) Stream() grpc.StreamServerInterceptor {
+	return func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer r.recover(stream.Context(), info.FullMethod, &err)
+		return handler(srv, stream)
+	}
+}
+
+func (r *Recovery) recover(ctx context.Context, method string, err *error) {
+	p := recover()
+	if p == nil {
+		return
+	}
+	r.logger.ErrorContext(ctx, "grpc handler panicked",
+		slog.String("method", method),
+		slog.String("request_id", RequestIDFromContext(ctx)),
+		slog.Any("panic", p),
+		slog.String("stack", string(debug.Stack())),
+	)
+	*err = status.Error(codes.Internal, "internal error")
+}
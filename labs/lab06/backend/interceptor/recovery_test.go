@@ -0,0 +1,37 @@
+package interceptor
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRecovery(t *testing.T) {
+	var logs bytes.Buffer
+	recovery := NewRecovery(slog.New(slog.NewJSONHandler(&logs, nil)))
+
+	_, err := recovery.Unary()(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/test/Unary"},
+		func(ctx context.Context, req any) (any, error) {
+			panic("boom")
+		})
+	if status.Code(err) != codes.Internal || strings.Contains(err.Error(), "boom") {
+		t.Errorf("Expected an Internal error without the panic value, got %v", err)
+	}
+	if !strings.Contains(logs.String(), `"panic":"boom"`) || !strings.Contains(logs.String(), `"method":"/test/Unary"`) {
+		t.Errorf("Expected the panic to be logged, got %s", logs.String())
+	}
+
+	err = recovery.Stream()(nil, &contextStream{ctx: context.Background()}, &grpc.StreamServerInfo{FullMethod: "/test/Stream"},
+		func(srv any, stream grpc.ServerStream) error {
+			panic("stream boom")
+		})
+	if status.Code(err) != codes.Internal {
+		t.Errorf("Expected Internal for a panicking stream, got %v", err)
+	}
+}
@@ -1,34 +1,44 @@
 package main
 
 import (
+	"database/sql"
+	"fmt"
 	"log"
+	"log/slog"
 	"net"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
+	_ "github.com/mattn/go-sqlite3"
 	"google.golang.org/grpc"
 
 	"lab06-backend/calculator"
 	"lab06-backend/gateway"
+	"lab06-backend/interceptor"
 	pb "lab06-backend/proto"
 	wsService "lab06-backend/websocket"
 )
 
 func main() {
 	var wg sync.WaitGroup
+	metrics := interceptor.NewMetrics()
 
 	// Start gRPC Calculator Service
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		startCalculatorService()
+		startCalculatorService(metrics)
 	}()
 
 	// Start Gateway HTTP Service
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		startGatewayService()
+		startGatewayService(metrics)
 	}()
 
 	// Start WebSocket Service
@@ -47,14 +57,29 @@ func main() {
 }
 
 // startCalculatorService starts the gRPC calculator service
-func startCalculatorService() {
+func startCalculatorService(metrics *interceptor.Metrics) {
 	lis, err := net.Listen("tcp", ":50051")
 	if err != nil {
 		log.Fatalf("Failed to listen on :50051: %v", err)
 	}
 
-	server := grpc.NewServer()
-	calculatorService := calculator.NewService()
+	history, err := historyStoreFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to set up calculator history: %v", err)
+	}
+
+	interceptors, err := calculatorInterceptors(metrics)
+	if err != nil {
+		log.Fatalf("Failed to set up calculator interceptors: %v", err)
+	}
+
+	server := grpc.NewServer(interceptor.ServerOptions(interceptors...)...)
+	// Histories are kept per caller authenticated by interceptor.Auth; with
+	// auth off every call shares the anonymous history
+	calculatorService := calculator.NewService(
+		calculator.WithHistoryStore(history),
+		calculator.WithCaller(interceptor.CallerFromContext),
+	)
 
 	pb.RegisterCalculatorServer(server, calculatorService)
 
@@ -64,12 +89,97 @@ func startCalculatorService() {
 	}
 }
 
-// startGatewayService starts the HTTP gateway service
-func startGatewayService() {
+// calculatorInterceptors chains, outermost first, request logging (off
+// with CALCULATOR_LOG_REQUESTS=false), metrics, panic recovery, bearer-token
+// auth and per-client rate limiting. Auth is on when CALCULATOR_AUTH_TOKENS
+// lists token:caller pairs separated by commas; rate limiting is on when
+// CALCULATOR_RATE_LIMIT sets the calls per second, with bursts of
+// CALCULATOR_RATE_BURST.
+func calculatorInterceptors(metrics *interceptor.Metrics) ([]interceptor.Interceptor, error) {
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, nil))
+	var interceptors []interceptor.Interceptor
+
+	if os.Getenv("CALCULATOR_LOG_REQUESTS") != "false" {
+		interceptors = append(interceptors, interceptor.NewLogging(logger))
+	}
+	interceptors = append(interceptors, metrics, interceptor.NewRecovery(logger))
+
+	if value := os.Getenv("CALCULATOR_AUTH_TOKENS"); value != "" {
+		tokens := make(map[string]string)
+		for _, pair := range strings.Split(value, ",") {
+			token, caller, ok := strings.Cut(strings.TrimSpace(pair), ":")
+			if !ok || token == "" || caller == "" {
+				return nil, fmt.Errorf("CALCULATOR_AUTH_TOKENS must hold token:caller pairs, got %q", pair)
+			}
+			tokens[token] = caller
+		}
+		interceptors = append(interceptors, interceptor.NewAuth(interceptor.AuthConfig{
+			Validate: interceptor.StaticTokens(tokens),
+		}))
+		log.Printf("Calculator requires bearer tokens for %d callers", len(tokens))
+	}
+
+	if value := os.Getenv("CALCULATOR_RATE_LIMIT"); value != "" {
+		rate, err := strconv.ParseFloat(value, 64)
+		if err != nil || rate <= 0 {
+			return nil, fmt.Errorf("CALCULATOR_RATE_LIMIT must be a positive number, got %q", value)
+		}
+		burst := max(1, int(rate))
+		if value := os.Getenv("CALCULATOR_RATE_BURST"); value != "" {
+			burst, err = strconv.Atoi(value)
+			if err != nil || burst <= 0 {
+				return nil, fmt.Errorf("CALCULATOR_RATE_BURST must be a positive number, got %q", value)
+			}
+		}
+		interceptors = append(interceptors, interceptor.NewRateLimit(rate, burst))
+		if os.Getenv("CALCULATOR_AUTH_TOKENS") == "" {
+			log.Println("Warning: without CALCULATOR_AUTH_TOKENS, all calls through the gateway share one rate limit")
+		}
+	}
+	return interceptors, nil
+}
+
+// historyStoreFromEnv keeps the calculator history in the SQLite file
+// named by CALCULATOR_HISTORY_DB, or in memory when it is unset.
+// CALCULATOR_HISTORY_MAX_ENTRIES (per caller) and CALCULATOR_HISTORY_MAX_AGE
+// (such as 720h) set the retention.
+func historyStoreFromEnv() (calculator.HistoryStore, error) {
+	retention := calculator.DefaultHistoryRetention
+	if value := os.Getenv("CALCULATOR_HISTORY_MAX_ENTRIES"); value != "" {
+		maxEntries, err := strconv.Atoi(value)
+		if err != nil || maxEntries <= 0 {
+			return nil, fmt.Errorf("CALCULATOR_HISTORY_MAX_ENTRIES must be a positive number, got %q", value)
+		}
+		retention.MaxEntries = maxEntries
+	}
+	if value := os.Getenv("CALCULATOR_HISTORY_MAX_AGE"); value != "" {
+		maxAge, err := time.ParseDuration(value)
+		if err != nil || maxAge <= 0 {
+			return nil, fmt.Errorf("CALCULATOR_HISTORY_MAX_AGE must be a positive duration, got %q", value)
+		}
+		retention.MaxAge = maxAge
+	}
+
+	path := os.Getenv("CALCULATOR_HISTORY_DB")
+	if path == "" {
+		return calculator.NewRingHistoryStore(retention), nil
+	}
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Calculator history is kept in %s", path)
+	return calculator.NewSQLHistoryStore(db, retention)
+}
+
+// startGatewayService starts the HTTP gateway service, which also serves
+// the calculator metrics at /metrics
+func startGatewayService(metrics *interceptor.Metrics) {
 	gatewayService, err := gateway.NewService("localhost:50051")
 	if err != nil {
 		log.Fatalf("Failed to create gateway service: %v", err)
 	}
+	gatewayService.GetRouter().Handle("/metrics", metrics).Methods("GET")
 
 	server := &http.Server{
 		Addr:    ":8080",
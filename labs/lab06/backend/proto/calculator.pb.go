@@ -21,6 +21,62 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
+// Operation selects the arithmetic of batch and session steps
+type Operation int32
+
+const (
+	Operation_OPERATION_UNSPECIFIED Operation = 0
+	Operation_OPERATION_ADD         Operation = 1
+	Operation_OPERATION_SUBTRACT    Operation = 2
+	Operation_OPERATION_MULTIPLY    Operation = 3
+	Operation_OPERATION_DIVIDE      Operation = 4
+)
+
+// Enum value maps for Operation.
+var (
+	Operation_name = map[int32]string{
+		0: "OPERATION_UNSPECIFIED",
+		1: "OPERATION_ADD",
+		2: "OPERATION_SUBTRACT",
+		3: "OPERATION_MULTIPLY",
+		4: "OPERATION_DIVIDE",
+	}
+	Operation_value = map[string]int32{
+		"OPERATION_UNSPECIFIED": 0,
+		"OPERATION_ADD":         1,
+		"OPERATION_SUBTRACT":    2,
+		"OPERATION_MULTIPLY":    3,
+		"OPERATION_DIVIDE":      4,
+	}
+)
+
+func (x Operation) Enum() *Operation {
+	p := new(Operation)
+	*p = x
+	return p
+}
+
+func (x Operation) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Operation) Descriptor() protoreflect.EnumDescriptor {
+	return file_proto_calculator_proto_enumTypes[0].Descriptor()
+}
+
+func (Operation) Type() protoreflect.EnumType {
+	return &file_proto_calculator_proto_enumTypes[0]
+}
+
+func (x Operation) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Operation.Descriptor instead.
+func (Operation) EnumDescriptor() ([]byte, []int) {
+	return file_proto_calculator_proto_rawDescGZIP(), []int{0}
+}
+
 // Request message for basic operations
 type OperationRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
@@ -143,10 +199,18 @@ func (x *OperationResponse) GetError() string {
 	return ""
 }
 
-// Request for operation history
+// Request for operation history. A page holds the newest matching entries
+// older than page_token, oldest first.
 type HistoryRequest struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Limit         int32                  `protobuf:"varint,1,opt,name=limit,proto3" json:"limit,omitempty"`
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Limit int32                  `protobuf:"varint,1,opt,name=limit,proto3" json:"limit,omitempty"`
+	// Only entries of this operation, such as "add"; empty for all
+	Operation string `protobuf:"bytes,2,opt,name=operation,proto3" json:"operation,omitempty"`
+	// Unix seconds bounding the entry timestamps, inclusive; 0 for unbounded
+	Since int64 `protobuf:"varint,3,opt,name=since,proto3" json:"since,omitempty"`
+	Until int64 `protobuf:"varint,4,opt,name=until,proto3" json:"until,omitempty"`
+	// next_page_token of the previous page; empty for the newest entries
+	PageToken     string `protobuf:"bytes,5,opt,name=page_token,json=pageToken,proto3" json:"page_token,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -188,10 +252,40 @@ func (x *HistoryRequest) GetLimit() int32 {
 	return 0
 }
 
+func (x *HistoryRequest) GetOperation() string {
+	if x != nil {
+		return x.Operation
+	}
+	return ""
+}
+
+func (x *HistoryRequest) GetSince() int64 {
+	if x != nil {
+		return x.Since
+	}
+	return 0
+}
+
+func (x *HistoryRequest) GetUntil() int64 {
+	if x != nil {
+		return x.Until
+	}
+	return 0
+}
+
+func (x *HistoryRequest) GetPageToken() string {
+	if x != nil {
+		return x.PageToken
+	}
+	return ""
+}
+
 // Response with operation history
 type HistoryResponse struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Entries       []*HistoryEntry        `protobuf:"bytes,1,rep,name=entries,proto3" json:"entries,omitempty"`
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Entries []*HistoryEntry        `protobuf:"bytes,1,rep,name=entries,proto3" json:"entries,omitempty"`
+	// Empty on the last page
+	NextPageToken string `protobuf:"bytes,2,opt,name=next_page_token,json=nextPageToken,proto3" json:"next_page_token,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -233,14 +327,23 @@ func (x *HistoryResponse) GetEntries() []*HistoryEntry {
 	return nil
 }
 
+func (x *HistoryResponse) GetNextPageToken() string {
+	if x != nil {
+		return x.NextPageToken
+	}
+	return ""
+}
+
 // Individual history entry
 type HistoryEntry struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Operation     string                 `protobuf:"bytes,1,opt,name=operation,proto3" json:"operation,omitempty"`
-	A             float64                `protobuf:"fixed64,2,opt,name=a,proto3" json:"a,omitempty"`
-	B             float64                `protobuf:"fixed64,3,opt,name=b,proto3" json:"b,omitempty"`
-	Result        float64                `protobuf:"fixed64,4,opt,name=result,proto3" json:"result,omitempty"`
-	Timestamp     int64                  `protobuf:"varint,5,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	Operation string                 `protobuf:"bytes,1,opt,name=operation,proto3" json:"operation,omitempty"`
+	A         float64                `protobuf:"fixed64,2,opt,name=a,proto3" json:"a,omitempty"`
+	B         float64                `protobuf:"fixed64,3,opt,name=b,proto3" json:"b,omitempty"`
+	Result    float64                `protobuf:"fixed64,4,opt,name=result,proto3" json:"result,omitempty"`
+	Timestamp int64                  `protobuf:"varint,5,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	// Increases with every entry of the store
+	Id            int64 `protobuf:"varint,6,opt,name=id,proto3" json:"id,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -310,6 +413,546 @@ func (x *HistoryEntry) GetTimestamp() int64 {
 	return 0
 }
 
+func (x *HistoryEntry) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+// One operation of a batch
+type BatchOperation struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Operation     Operation              `protobuf:"varint,1,opt,name=operation,proto3,enum=calculator.Operation" json:"operation,omitempty"`
+	A             float64                `protobuf:"fixed64,2,opt,name=a,proto3" json:"a,omitempty"`
+	B             float64                `protobuf:"fixed64,3,opt,name=b,proto3" json:"b,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchOperation) Reset() {
+	*x = BatchOperation{}
+	mi := &file_proto_calculator_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchOperation) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchOperation) ProtoMessage() {}
+
+func (x *BatchOperation) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_calculator_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchOperation.ProtoReflect.Descriptor instead.
+func (*BatchOperation) Descriptor() ([]byte, []int) {
+	return file_proto_calculator_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *BatchOperation) GetOperation() Operation {
+	if x != nil {
+		return x.Operation
+	}
+	return Operation_OPERATION_UNSPECIFIED
+}
+
+func (x *BatchOperation) GetA() float64 {
+	if x != nil {
+		return x.A
+	}
+	return 0
+}
+
+func (x *BatchOperation) GetB() float64 {
+	if x != nil {
+		return x.B
+	}
+	return 0
+}
+
+// Request for a batch of operations
+type BatchRequest struct {
+	state      protoimpl.MessageState `protogen:"open.v1"`
+	Operations []*BatchOperation      `protobuf:"bytes,1,rep,name=operations,proto3" json:"operations,omitempty"`
+	// Skip the remaining operations after the first failure
+	StopOnError   bool `protobuf:"varint,2,opt,name=stop_on_error,json=stopOnError,proto3" json:"stop_on_error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchRequest) Reset() {
+	*x = BatchRequest{}
+	mi := &file_proto_calculator_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchRequest) ProtoMessage() {}
+
+func (x *BatchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_calculator_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchRequest.ProtoReflect.Descriptor instead.
+func (*BatchRequest) Descriptor() ([]byte, []int) {
+	return file_proto_calculator_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *BatchRequest) GetOperations() []*BatchOperation {
+	if x != nil {
+		return x.Operations
+	}
+	return nil
+}
+
+func (x *BatchRequest) GetStopOnError() bool {
+	if x != nil {
+		return x.StopOnError
+	}
+	return false
+}
+
+// Results of a batch, in request order
+type BatchResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Results       []*OperationResponse   `protobuf:"bytes,1,rep,name=results,proto3" json:"results,omitempty"`
+	Failed        int32                  `protobuf:"varint,2,opt,name=failed,proto3" json:"failed,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchResponse) Reset() {
+	*x = BatchResponse{}
+	mi := &file_proto_calculator_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchResponse) ProtoMessage() {}
+
+func (x *BatchResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_calculator_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchResponse.ProtoReflect.Descriptor instead.
+func (*BatchResponse) Descriptor() ([]byte, []int) {
+	return file_proto_calculator_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *BatchResponse) GetResults() []*OperationResponse {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
+func (x *BatchResponse) GetFailed() int32 {
+	if x != nil {
+		return x.Failed
+	}
+	return 0
+}
+
+// Request to watch the history
+type WatchHistoryRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Number of past entries to send before new ones
+	Replay        int32 `protobuf:"varint,1,opt,name=replay,proto3" json:"replay,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchHistoryRequest) Reset() {
+	*x = WatchHistoryRequest{}
+	mi := &file_proto_calculator_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchHistoryRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchHistoryRequest) ProtoMessage() {}
+
+func (x *WatchHistoryRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_calculator_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchHistoryRequest.ProtoReflect.Descriptor instead.
+func (*WatchHistoryRequest) Descriptor() ([]byte, []int) {
+	return file_proto_calculator_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *WatchHistoryRequest) GetReplay() int32 {
+	if x != nil {
+		return x.Replay
+	}
+	return 0
+}
+
+// One step of a session
+type SessionRequest struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	Operation Operation              `protobuf:"varint,1,opt,name=operation,proto3,enum=calculator.Operation" json:"operation,omitempty"`
+	Operand   float64                `protobuf:"fixed64,2,opt,name=operand,proto3" json:"operand,omitempty"`
+	// Set the total to operand instead of applying operation
+	SetTotal      bool `protobuf:"varint,3,opt,name=set_total,json=setTotal,proto3" json:"set_total,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SessionRequest) Reset() {
+	*x = SessionRequest{}
+	mi := &file_proto_calculator_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SessionRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SessionRequest) ProtoMessage() {}
+
+func (x *SessionRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_calculator_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SessionRequest.ProtoReflect.Descriptor instead.
+func (*SessionRequest) Descriptor() ([]byte, []int) {
+	return file_proto_calculator_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *SessionRequest) GetOperation() Operation {
+	if x != nil {
+		return x.Operation
+	}
+	return Operation_OPERATION_UNSPECIFIED
+}
+
+func (x *SessionRequest) GetOperand() float64 {
+	if x != nil {
+		return x.Operand
+	}
+	return 0
+}
+
+func (x *SessionRequest) GetSetTotal() bool {
+	if x != nil {
+		return x.SetTotal
+	}
+	return false
+}
+
+// Running total after a session step
+type SessionResponse struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	Total     float64                `protobuf:"fixed64,1,opt,name=total,proto3" json:"total,omitempty"`
+	Operation string                 `protobuf:"bytes,2,opt,name=operation,proto3" json:"operation,omitempty"`
+	Operand   float64                `protobuf:"fixed64,3,opt,name=operand,proto3" json:"operand,omitempty"`
+	Success   bool                   `protobuf:"varint,4,opt,name=success,proto3" json:"success,omitempty"`
+	Error     string                 `protobuf:"bytes,5,opt,name=error,proto3" json:"error,omitempty"`
+	// Number of steps applied so far
+	Steps         int64 `protobuf:"varint,6,opt,name=steps,proto3" json:"steps,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SessionResponse) Reset() {
+	*x = SessionResponse{}
+	mi := &file_proto_calculator_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SessionResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SessionResponse) ProtoMessage() {}
+
+func (x *SessionResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_calculator_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SessionResponse.ProtoReflect.Descriptor instead.
+func (*SessionResponse) Descriptor() ([]byte, []int) {
+	return file_proto_calculator_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *SessionResponse) GetTotal() float64 {
+	if x != nil {
+		return x.Total
+	}
+	return 0
+}
+
+func (x *SessionResponse) GetOperation() string {
+	if x != nil {
+		return x.Operation
+	}
+	return ""
+}
+
+func (x *SessionResponse) GetOperand() float64 {
+	if x != nil {
+		return x.Operand
+	}
+	return 0
+}
+
+func (x *SessionResponse) GetSuccess() bool {
+	if x != nil {
+		return x.Success
+	}
+	return false
+}
+
+func (x *SessionResponse) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *SessionResponse) GetSteps() int64 {
+	if x != nil {
+		return x.Steps
+	}
+	return 0
+}
+
+// Request to evaluate an expression
+type ExpressionRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Numbers, variables, parentheses and the operators + - * / ^
+	Expression string `protobuf:"bytes,1,opt,name=expression,proto3" json:"expression,omitempty"`
+	// Values of the variables used in expression
+	Variables     map[string]float64 `protobuf:"bytes,2,rep,name=variables,proto3" json:"variables,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"fixed64,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExpressionRequest) Reset() {
+	*x = ExpressionRequest{}
+	mi := &file_proto_calculator_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExpressionRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExpressionRequest) ProtoMessage() {}
+
+func (x *ExpressionRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_calculator_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExpressionRequest.ProtoReflect.Descriptor instead.
+func (*ExpressionRequest) Descriptor() ([]byte, []int) {
+	return file_proto_calculator_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *ExpressionRequest) GetExpression() string {
+	if x != nil {
+		return x.Expression
+	}
+	return ""
+}
+
+func (x *ExpressionRequest) GetVariables() map[string]float64 {
+	if x != nil {
+		return x.Variables
+	}
+	return nil
+}
+
+// Result of an expression
+type ExpressionResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Result        float64                `protobuf:"fixed64,1,opt,name=result,proto3" json:"result,omitempty"`
+	Expression    string                 `protobuf:"bytes,2,opt,name=expression,proto3" json:"expression,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExpressionResponse) Reset() {
+	*x = ExpressionResponse{}
+	mi := &file_proto_calculator_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExpressionResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExpressionResponse) ProtoMessage() {}
+
+func (x *ExpressionResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_calculator_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExpressionResponse.ProtoReflect.Descriptor instead.
+func (*ExpressionResponse) Descriptor() ([]byte, []int) {
+	return file_proto_calculator_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *ExpressionResponse) GetResult() float64 {
+	if x != nil {
+		return x.Result
+	}
+	return 0
+}
+
+func (x *ExpressionResponse) GetExpression() string {
+	if x != nil {
+		return x.Expression
+	}
+	return ""
+}
+
+// ExpressionError is attached to the status of a failed Evaluate call
+type ExpressionError struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Message string                 `protobuf:"bytes,1,opt,name=message,proto3" json:"message,omitempty"`
+	// 1-based position of the offending character in the expression
+	Position int32 `protobuf:"varint,2,opt,name=position,proto3" json:"position,omitempty"`
+	// The offending token, empty at the end of the expression
+	Token         string `protobuf:"bytes,3,opt,name=token,proto3" json:"token,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExpressionError) Reset() {
+	*x = ExpressionError{}
+	mi := &file_proto_calculator_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExpressionError) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExpressionError) ProtoMessage() {}
+
+func (x *ExpressionError) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_calculator_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExpressionError.ProtoReflect.Descriptor instead.
+func (*ExpressionError) Descriptor() ([]byte, []int) {
+	return file_proto_calculator_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *ExpressionError) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *ExpressionError) GetPosition() int32 {
+	if x != nil {
+		return x.Position
+	}
+	return 0
+}
+
+func (x *ExpressionError) GetToken() string {
+	if x != nil {
+		return x.Token
+	}
+	return ""
+}
+
 var File_proto_calculator_proto protoreflect.FileDescriptor
 
 const file_proto_calculator_proto_rawDesc = "" +
@@ -323,17 +966,72 @@ const file_proto_calculator_proto_rawDesc = "" +
 	"\x06result\x18\x01 \x01(\x01R\x06result\x12\x1c\n" +
 	"\toperation\x18\x02 \x01(\tR\toperation\x12\x18\n" +
 	"\asuccess\x18\x03 \x01(\bR\asuccess\x12\x14\n" +
-	"\x05error\x18\x04 \x01(\tR\x05error\"&\n" +
+	"\x05error\x18\x04 \x01(\tR\x05error\"\x8f\x01\n" +
 	"\x0eHistoryRequest\x12\x14\n" +
-	"\x05limit\x18\x01 \x01(\x05R\x05limit\"E\n" +
+	"\x05limit\x18\x01 \x01(\x05R\x05limit\x12\x1c\n" +
+	"\toperation\x18\x02 \x01(\tR\toperation\x12\x14\n" +
+	"\x05since\x18\x03 \x01(\x03R\x05since\x12\x14\n" +
+	"\x05until\x18\x04 \x01(\x03R\x05until\x12\x1d\n" +
+	"\n" +
+	"page_token\x18\x05 \x01(\tR\tpageToken\"m\n" +
 	"\x0fHistoryResponse\x122\n" +
-	"\aentries\x18\x01 \x03(\v2\x18.calculator.HistoryEntryR\aentries\"~\n" +
+	"\aentries\x18\x01 \x03(\v2\x18.calculator.HistoryEntryR\aentries\x12&\n" +
+	"\x0fnext_page_token\x18\x02 \x01(\tR\rnextPageToken\"\x8e\x01\n" +
 	"\fHistoryEntry\x12\x1c\n" +
 	"\toperation\x18\x01 \x01(\tR\toperation\x12\f\n" +
 	"\x01a\x18\x02 \x01(\x01R\x01a\x12\f\n" +
 	"\x01b\x18\x03 \x01(\x01R\x01b\x12\x16\n" +
 	"\x06result\x18\x04 \x01(\x01R\x06result\x12\x1c\n" +
-	"\ttimestamp\x18\x05 \x01(\x03R\ttimestamp2\xf0\x02\n" +
+	"\ttimestamp\x18\x05 \x01(\x03R\ttimestamp\x12\x0e\n" +
+	"\x02id\x18\x06 \x01(\x03R\x02id\"a\n" +
+	"\x0eBatchOperation\x123\n" +
+	"\toperation\x18\x01 \x01(\x0e2\x15.calculator.OperationR\toperation\x12\f\n" +
+	"\x01a\x18\x02 \x01(\x01R\x01a\x12\f\n" +
+	"\x01b\x18\x03 \x01(\x01R\x01b\"n\n" +
+	"\fBatchRequest\x12:\n" +
+	"\n" +
+	"operations\x18\x01 \x03(\v2\x1a.calculator.BatchOperationR\n" +
+	"operations\x12\"\n" +
+	"\rstop_on_error\x18\x02 \x01(\bR\vstopOnError\"`\n" +
+	"\rBatchResponse\x127\n" +
+	"\aresults\x18\x01 \x03(\v2\x1d.calculator.OperationResponseR\aresults\x12\x16\n" +
+	"\x06failed\x18\x02 \x01(\x05R\x06failed\"-\n" +
+	"\x13WatchHistoryRequest\x12\x16\n" +
+	"\x06replay\x18\x01 \x01(\x05R\x06replay\"|\n" +
+	"\x0eSessionRequest\x123\n" +
+	"\toperation\x18\x01 \x01(\x0e2\x15.calculator.OperationR\toperation\x12\x18\n" +
+	"\aoperand\x18\x02 \x01(\x01R\aoperand\x12\x1b\n" +
+	"\tset_total\x18\x03 \x01(\bR\bsetTotal\"\xa5\x01\n" +
+	"\x0fSessionResponse\x12\x14\n" +
+	"\x05total\x18\x01 \x01(\x01R\x05total\x12\x1c\n" +
+	"\toperation\x18\x02 \x01(\tR\toperation\x12\x18\n" +
+	"\aoperand\x18\x03 \x01(\x01R\aoperand\x12\x18\n" +
+	"\asuccess\x18\x04 \x01(\bR\asuccess\x12\x14\n" +
+	"\x05error\x18\x05 \x01(\tR\x05error\x12\x14\n" +
+	"\x05steps\x18\x06 \x01(\x03R\x05steps\"\xbd\x01\n" +
+	"\x11ExpressionRequest\x12\x1e\n" +
+	"\n" +
+	"expression\x18\x01 \x01(\tR\n" +
+	"expression\x12J\n" +
+	"\tvariables\x18\x02 \x03(\v2,.calculator.ExpressionRequest.VariablesEntryR\tvariables\x1a<\n" +
+	"\x0eVariablesEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x01R\x05value:\x028\x01\"L\n" +
+	"\x12ExpressionResponse\x12\x16\n" +
+	"\x06result\x18\x01 \x01(\x01R\x06result\x12\x1e\n" +
+	"\n" +
+	"expression\x18\x02 \x01(\tR\n" +
+	"expression\"]\n" +
+	"\x0fExpressionError\x12\x18\n" +
+	"\amessage\x18\x01 \x01(\tR\amessage\x12\x1a\n" +
+	"\bposition\x18\x02 \x01(\x05R\bposition\x12\x14\n" +
+	"\x05token\x18\x03 \x01(\tR\x05token*\x7f\n" +
+	"\tOperation\x12\x19\n" +
+	"\x15OPERATION_UNSPECIFIED\x10\x00\x12\x11\n" +
+	"\rOPERATION_ADD\x10\x01\x12\x16\n" +
+	"\x12OPERATION_SUBTRACT\x10\x02\x12\x16\n" +
+	"\x12OPERATION_MULTIPLY\x10\x03\x12\x14\n" +
+	"\x10OPERATION_DIVIDE\x10\x042\x8e\x05\n" +
 	"\n" +
 	"Calculator\x12B\n" +
 	"\x03Add\x12\x1c.calculator.OperationRequest\x1a\x1d.calculator.OperationResponse\x12G\n" +
@@ -341,7 +1039,11 @@ const file_proto_calculator_proto_rawDesc = "" +
 	"\bMultiply\x12\x1c.calculator.OperationRequest\x1a\x1d.calculator.OperationResponse\x12E\n" +
 	"\x06Divide\x12\x1c.calculator.OperationRequest\x1a\x1d.calculator.OperationResponse\x12E\n" +
 	"\n" +
-	"GetHistory\x12\x1a.calculator.HistoryRequest\x1a\x1b.calculator.HistoryResponseB\tZ\a./protob\x06proto3"
+	"GetHistory\x12\x1a.calculator.HistoryRequest\x1a\x1b.calculator.HistoryResponse\x12<\n" +
+	"\x05Batch\x12\x18.calculator.BatchRequest\x1a\x19.calculator.BatchResponse\x12K\n" +
+	"\fWatchHistory\x12\x1f.calculator.WatchHistoryRequest\x1a\x18.calculator.HistoryEntry0\x01\x12F\n" +
+	"\aSession\x12\x1a.calculator.SessionRequest\x1a\x1b.calculator.SessionResponse(\x010\x01\x12I\n" +
+	"\bEvaluate\x12\x1d.calculator.ExpressionRequest\x1a\x1e.calculator.ExpressionResponseB\tZ\a./protob\x06proto3"
 
 var (
 	file_proto_calculator_proto_rawDescOnce sync.Once
@@ -355,31 +1057,56 @@ func file_proto_calculator_proto_rawDescGZIP() []byte {
 	return file_proto_calculator_proto_rawDescData
 }
 
-var file_proto_calculator_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
+var file_proto_calculator_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_proto_calculator_proto_msgTypes = make([]protoimpl.MessageInfo, 15)
 var file_proto_calculator_proto_goTypes = []any{
-	(*OperationRequest)(nil),  // 0: calculator.OperationRequest
-	(*OperationResponse)(nil), // 1: calculator.OperationResponse
-	(*HistoryRequest)(nil),    // 2: calculator.HistoryRequest
-	(*HistoryResponse)(nil),   // 3: calculator.HistoryResponse
-	(*HistoryEntry)(nil),      // 4: calculator.HistoryEntry
+	(Operation)(0),              // 0: calculator.Operation
+	(*OperationRequest)(nil),    // 1: calculator.OperationRequest
+	(*OperationResponse)(nil),   // 2: calculator.OperationResponse
+	(*HistoryRequest)(nil),      // 3: calculator.HistoryRequest
+	(*HistoryResponse)(nil),     // 4: calculator.HistoryResponse
+	(*HistoryEntry)(nil),        // 5: calculator.HistoryEntry
+	(*BatchOperation)(nil),      // 6: calculator.BatchOperation
+	(*BatchRequest)(nil),        // 7: calculator.BatchRequest
+	(*BatchResponse)(nil),       // 8: calculator.BatchResponse
+	(*WatchHistoryRequest)(nil), // 9: calculator.WatchHistoryRequest
+	(*SessionRequest)(nil),      // 10: calculator.SessionRequest
+	(*SessionResponse)(nil),     // 11: calculator.SessionResponse
+	(*ExpressionRequest)(nil),   // 12: calculator.ExpressionRequest
+	(*ExpressionResponse)(nil),  // 13: calculator.ExpressionResponse
+	(*ExpressionError)(nil),     // 14: calculator.ExpressionError
+	nil,                         // 15: calculator.ExpressionRequest.VariablesEntry
 }
 var file_proto_calculator_proto_depIdxs = []int32{
-	4, // 0: calculator.HistoryResponse.entries:type_name -> calculator.HistoryEntry
-	0, // 1: calculator.Calculator.Add:input_type -> calculator.OperationRequest
-	0, // 2: calculator.Calculator.Subtract:input_type -> calculator.OperationRequest
-	0, // 3: calculator.Calculator.Multiply:input_type -> calculator.OperationRequest
-	0, // 4: calculator.Calculator.Divide:input_type -> calculator.OperationRequest
-	2, // 5: calculator.Calculator.GetHistory:input_type -> calculator.HistoryRequest
-	1, // 6: calculator.Calculator.Add:output_type -> calculator.OperationResponse
-	1, // 7: calculator.Calculator.Subtract:output_type -> calculator.OperationResponse
-	1, // 8: calculator.Calculator.Multiply:output_type -> calculator.OperationResponse
-	1, // 9: calculator.Calculator.Divide:output_type -> calculator.OperationResponse
-	3, // 10: calculator.Calculator.GetHistory:output_type -> calculator.HistoryResponse
-	6, // [6:11] is the sub-list for method output_type
-	1, // [1:6] is the sub-list for method input_type
-	1, // [1:1] is the sub-list for extension type_name
-	1, // [1:1] is the sub-list for extension extendee
-	0, // [0:1] is the sub-list for field type_name
+	5,  // 0: calculator.HistoryResponse.entries:type_name -> calculator.HistoryEntry
+	0,  // 1: calculator.BatchOperation.operation:type_name -> calculator.Operation
+	6,  // 2: calculator.BatchRequest.operations:type_name -> calculator.BatchOperation
+	2,  // 3: calculator.BatchResponse.results:type_name -> calculator.OperationResponse
+	0,  // 4: calculator.SessionRequest.operation:type_name -> calculator.Operation
+	15, // 5: calculator.ExpressionRequest.variables:type_name -> calculator.ExpressionRequest.VariablesEntry
+	1,  // 6: calculator.Calculator.Add:input_type -> calculator.OperationRequest
+	1,  // 7: calculator.Calculator.Subtract:input_type -> calculator.OperationRequest
+	1,  // 8: calculator.Calculator.Multiply:input_type -> calculator.OperationRequest
+	1,  // 9: calculator.Calculator.Divide:input_type -> calculator.OperationRequest
+	3,  // 10: calculator.Calculator.GetHistory:input_type -> calculator.HistoryRequest
+	7,  // 11: calculator.Calculator.Batch:input_type -> calculator.BatchRequest
+	9,  // 12: calculator.Calculator.WatchHistory:input_type -> calculator.WatchHistoryRequest
+	10, // 13: calculator.Calculator.Session:input_type -> calculator.SessionRequest
+	12, // 14: calculator.Calculator.Evaluate:input_type -> calculator.ExpressionRequest
+	2,  // 15: calculator.Calculator.Add:output_type -> calculator.OperationResponse
+	2,  // 16: calculator.Calculator.Subtract:output_type -> calculator.OperationResponse
+	2,  // 17: calculator.Calculator.Multiply:output_type -> calculator.OperationResponse
+	2,  // 18: calculator.Calculator.Divide:output_type -> calculator.OperationResponse
+	4,  // 19: calculator.Calculator.GetHistory:output_type -> calculator.HistoryResponse
+	8,  // 20: calculator.Calculator.Batch:output_type -> calculator.BatchResponse
+	5,  // 21: calculator.Calculator.WatchHistory:output_type -> calculator.HistoryEntry
+	11, // 22: calculator.Calculator.Session:output_type -> calculator.SessionResponse
+	13, // 23: calculator.Calculator.Evaluate:output_type -> calculator.ExpressionResponse
+	15, // [15:24] is the sub-list for method output_type
+	6,  // [6:15] is the sub-list for method input_type
+	6,  // [6:6] is the sub-list for extension type_name
+	6,  // [6:6] is the sub-list for extension extendee
+	0,  // [0:6] is the sub-list for field type_name
 }
 
 func init() { file_proto_calculator_proto_init() }
@@ -392,13 +1119,14 @@ func file_proto_calculator_proto_init() {
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_calculator_proto_rawDesc), len(file_proto_calculator_proto_rawDesc)),
-			NumEnums:      0,
-			NumMessages:   5,
+			NumEnums:      1,
+			NumMessages:   15,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
 		GoTypes:           file_proto_calculator_proto_goTypes,
 		DependencyIndexes: file_proto_calculator_proto_depIdxs,
+		EnumInfos:         file_proto_calculator_proto_enumTypes,
 		MessageInfos:      file_proto_calculator_proto_msgTypes,
 	}.Build()
 	File_proto_calculator_proto = out.File
@@ -19,11 +19,15 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	Calculator_Add_FullMethodName        = "/calculator.Calculator/Add"
-	Calculator_Subtract_FullMethodName   = "/calculator.Calculator/Subtract"
-	Calculator_Multiply_FullMethodName   = "/calculator.Calculator/Multiply"
-	Calculator_Divide_FullMethodName     = "/calculator.Calculator/Divide"
-	Calculator_GetHistory_FullMethodName = "/calculator.Calculator/GetHistory"
+	Calculator_Add_FullMethodName          = "/calculator.Calculator/Add"
+	Calculator_Subtract_FullMethodName     = "/calculator.Calculator/Subtract"
+	Calculator_Multiply_FullMethodName     = "/calculator.Calculator/Multiply"
+	Calculator_Divide_FullMethodName       = "/calculator.Calculator/Divide"
+	Calculator_GetHistory_FullMethodName   = "/calculator.Calculator/GetHistory"
+	Calculator_Batch_FullMethodName        = "/calculator.Calculator/Batch"
+	Calculator_WatchHistory_FullMethodName = "/calculator.Calculator/WatchHistory"
+	Calculator_Session_FullMethodName      = "/calculator.Calculator/Session"
+	Calculator_Evaluate_FullMethodName     = "/calculator.Calculator/Evaluate"
 )
 
 // CalculatorClient is the client API for Calculator service.
@@ -36,7 +40,17 @@ type CalculatorClient interface {
 	Subtract(ctx context.Context, in *OperationRequest, opts ...grpc.CallOption) (*OperationResponse, error)
 	Multiply(ctx context.Context, in *OperationRequest, opts ...grpc.CallOption) (*OperationResponse, error)
 	Divide(ctx context.Context, in *OperationRequest, opts ...grpc.CallOption) (*OperationResponse, error)
+	// GetHistory pages through the history of the authenticated caller
 	GetHistory(ctx context.Context, in *HistoryRequest, opts ...grpc.CallOption) (*HistoryResponse, error)
+	// Batch runs many operations in one call
+	Batch(ctx context.Context, in *BatchRequest, opts ...grpc.CallOption) (*BatchResponse, error)
+	// WatchHistory streams history entries as operations complete
+	WatchHistory(ctx context.Context, in *WatchHistoryRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[HistoryEntry], error)
+	// Session keeps a running total over a stream of operations
+	Session(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[SessionRequest, SessionResponse], error)
+	// Evaluate computes an expression such as "2 * (x + 1)". Invalid
+	// expressions fail with INVALID_ARGUMENT and an ExpressionError detail.
+	Evaluate(ctx context.Context, in *ExpressionRequest, opts ...grpc.CallOption) (*ExpressionResponse, error)
 }
 
 type calculatorClient struct {
@@ -97,6 +111,58 @@ func (c *calculatorClient) GetHistory(ctx context.Context, in *HistoryRequest, o
 	return out, nil
 }
 
+func (c *calculatorClient) Batch(ctx context.Context, in *BatchRequest, opts ...grpc.CallOption) (*BatchResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(BatchResponse)
+	err := c.cc.Invoke(ctx, Calculator_Batch_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *calculatorClient) WatchHistory(ctx context.Context, in *WatchHistoryRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[HistoryEntry], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Calculator_ServiceDesc.Streams[0], Calculator_WatchHistory_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchHistoryRequest, HistoryEntry]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Calculator_WatchHistoryClient = grpc.ServerStreamingClient[HistoryEntry]
+
+func (c *calculatorClient) Session(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[SessionRequest, SessionResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Calculator_ServiceDesc.Streams[1], Calculator_Session_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[SessionRequest, SessionResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Calculator_SessionClient = grpc.BidiStreamingClient[SessionRequest, SessionResponse]
+
+func (c *calculatorClient) Evaluate(ctx context.Context, in *ExpressionRequest, opts ...grpc.CallOption) (*ExpressionResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ExpressionResponse)
+	err := c.cc.Invoke(ctx, Calculator_Evaluate_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // CalculatorServer is the server API for Calculator service.
 // All implementations must embed UnimplementedCalculatorServer
 // for forward compatibility.
@@ -107,7 +173,17 @@ type CalculatorServer interface {
 	Subtract(context.Context, *OperationRequest) (*OperationResponse, error)
 	Multiply(context.Context, *OperationRequest) (*OperationResponse, error)
 	Divide(context.Context, *OperationRequest) (*OperationResponse, error)
+	// GetHistory pages through the history of the authenticated caller
 	GetHistory(context.Context, *HistoryRequest) (*HistoryResponse, error)
+	// Batch runs many operations in one call
+	Batch(context.Context, *BatchRequest) (*BatchResponse, error)
+	// WatchHistory streams history entries as operations complete
+	WatchHistory(*WatchHistoryRequest, grpc.ServerStreamingServer[HistoryEntry]) error
+	// Session keeps a running total over a stream of operations
+	Session(grpc.BidiStreamingServer[SessionRequest, SessionResponse]) error
+	// Evaluate computes an expression such as "2 * (x + 1)". Invalid
+	// expressions fail with INVALID_ARGUMENT and an ExpressionError detail.
+	Evaluate(context.Context, *ExpressionRequest) (*ExpressionResponse, error)
 	mustEmbedUnimplementedCalculatorServer()
 }
 
@@ -133,6 +209,18 @@ func (UnimplementedCalculatorServer) Divide(context.Context, *OperationRequest)
 func (UnimplementedCalculatorServer) GetHistory(context.Context, *HistoryRequest) (*HistoryResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetHistory not implemented")
 }
+func (UnimplementedCalculatorServer) Batch(context.Context, *BatchRequest) (*BatchResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Batch not implemented")
+}
+func (UnimplementedCalculatorServer) WatchHistory(*WatchHistoryRequest, grpc.ServerStreamingServer[HistoryEntry]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchHistory not implemented")
+}
+func (UnimplementedCalculatorServer) Session(grpc.BidiStreamingServer[SessionRequest, SessionResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method Session not implemented")
+}
+func (UnimplementedCalculatorServer) Evaluate(context.Context, *ExpressionRequest) (*ExpressionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Evaluate not implemented")
+}
 func (UnimplementedCalculatorServer) mustEmbedUnimplementedCalculatorServer() {}
 func (UnimplementedCalculatorServer) testEmbeddedByValue()                    {}
 
@@ -244,6 +332,60 @@ func _Calculator_GetHistory_Handler(srv interface{}, ctx context.Context, dec fu
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Calculator_Batch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CalculatorServer).Batch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Calculator_Batch_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CalculatorServer).Batch(ctx, req.(*BatchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Calculator_WatchHistory_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchHistoryRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CalculatorServer).WatchHistory(m, &grpc.GenericServerStream[WatchHistoryRequest, HistoryEntry]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Calculator_WatchHistoryServer = grpc.ServerStreamingServer[HistoryEntry]
+
+func _Calculator_Session_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(CalculatorServer).Session(&grpc.GenericServerStream[SessionRequest, SessionResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Calculator_SessionServer = grpc.BidiStreamingServer[SessionRequest, SessionResponse]
+
+func _Calculator_Evaluate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ExpressionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CalculatorServer).Evaluate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Calculator_Evaluate_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CalculatorServer).Evaluate(ctx, req.(*ExpressionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Calculator_ServiceDesc is the grpc.ServiceDesc for Calculator service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -271,7 +413,27 @@ var Calculator_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "GetHistory",
 			Handler:    _Calculator_GetHistory_Handler,
 		},
+		{
+			MethodName: "Batch",
+			Handler:    _Calculator_Batch_Handler,
+		},
+		{
+			MethodName: "Evaluate",
+			Handler:    _Calculator_Evaluate_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchHistory",
+			Handler:       _Calculator_WatchHistory_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Session",
+			Handler:       _Calculator_Session_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/calculator.proto",
 }